@@ -0,0 +1,157 @@
+package qbs
+
+import (
+	"strings"
+)
+
+// ArchiveTableSuffix is appended to the table name of a model to name the archive table Archive moves its rows to.
+var ArchiveTableSuffix = "_archive"
+
+// archiveModel returns the model of the archive table of the struct, which has the columns of the table
+// without its indexes and foreign keys, so the rows referenced by archived rows can be archived or deleted later.
+func archiveModel(structPtr interface{}, naming NamingConvention) *model {
+	model := structPtrToNamedModel(structPtr, false, nil, naming)
+	model.table += ArchiveTableSuffix
+	model.indexes = nil
+	model.refs = nil
+	return model
+}
+
+// CreateArchiveTableIfNotExists creates the archive table of the struct, named by the ArchiveTableSuffix,
+// and adds the new columns of the struct to it like CreateTableIfNotExists, so it is kept in step with the table.
+func (mg *Migration) CreateArchiveTableIfNotExists(structPtr interface{}) error {
+	return mg.createTableIfNotExists(archiveModel(structPtr, mg.naming()))
+}
+
+// archiveBatchSize is the number of primary keys in the statements of Archive.
+const archiveBatchSize = 1000
+
+// Archive moves the rows of the table of the struct matching the condition to its archive table created by
+// CreateArchiveTableIfNotExists, the rows are copied by INSERT ... SELECT and deleted in a single transaction.
+// The primary keys of the matching rows are read first and both statements work on them, so a matching row
+// committed meanwhile is left for the next Archive instead of being deleted without being copied.
+// The moved rows are removed from the cache of Cacheable models. It returns the number of rows moved.
+func (q *Qbs) Archive(structPtr interface{}, condition *Condition) (affected int64, err error) {
+	if condition == nil {
+		panic("Can not archive without condition")
+	}
+	q.route(structPtr)
+	model := structPtrToNamedModel(structPtr, false, nil, q.naming())
+	if len(model.pks) == 0 {
+		panic("no primary key field")
+	}
+	archive := archiveModel(structPtr, q.naming())
+	where, args := condition.Merge()
+	table := q.Dialect.quote(model.table)
+	var pks [][]interface{}
+	err = q.Transaction(func(tx *Qbs) (err error) {
+		pks, err = tx.archivedPks(model, where, args)
+		if err != nil {
+			return err
+		}
+		for start := 0; start < len(pks); start += archiveBatchSize {
+			end := start + archiveBatchSize
+			if end > len(pks) {
+				end = len(pks)
+			}
+			in, inArgs := pksCondition(q.Dialect, model, pks[start:end]).Merge()
+			var before []map[string]interface{}
+			if tx.Auditor != nil {
+				if before, err = tx.QueryMapSlice("SELECT * FROM "+table+" WHERE "+in, inArgs...); err != nil {
+					return err
+				}
+			}
+			if _, err = tx.Exec(insertSelectSql(q.Dialect, archive, table, in), inArgs...); err != nil {
+				return err
+			}
+			result, err := tx.Exec("DELETE FROM "+table+" WHERE "+in, inArgs...)
+			if err != nil {
+				return err
+			}
+			deleted, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			affected += deleted
+			if tx.Auditor != nil {
+				if err = tx.audit(model, AuditDelete, before, nil); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	q.invalidateCachedPks(structPtr, model, pks)
+	invalidateQueries(model.table)
+	invalidateQueries(archive.table)
+	if err == nil && q.shadow != nil {
+		q.shadow.mirror(structPtr, nil, new(criteria), affected, func(shadow *Qbs, structPtr interface{}) (int64, error) {
+			return shadow.Archive(structPtr, condition)
+		})
+	}
+	return affected, err
+}
+
+// archivedPks returns the primary key values of the rows of the model matching the where clause.
+func (q *Qbs) archivedPks(model *model, where string, args []interface{}) ([][]interface{}, error) {
+	columns := make([]string, len(model.pks))
+	for i, pk := range model.pks {
+		columns[i] = q.Dialect.quote(pk.name)
+	}
+	rows, err := q.Query("SELECT "+strings.Join(columns, ", ")+" FROM "+q.Dialect.quote(model.table)+" WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pks [][]interface{}
+	for rows.Next() {
+		pk := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range pk {
+			dest[i] = &pk[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, v := range pk {
+			if b, ok := v.([]byte); ok {
+				pk[i] = string(b)
+			}
+		}
+		pks = append(pks, pk)
+	}
+	return pks, rows.Err()
+}
+
+// pksCondition matches the rows of the primary key values.
+func pksCondition(d Dialect, model *model, pks [][]interface{}) *Condition {
+	if len(model.pks) == 1 {
+		values := make([]interface{}, len(pks))
+		for i, pk := range pks {
+			values[i] = pk[0]
+		}
+		return NewInCondition(d.quote(model.pks[0].name), values)
+	}
+	var ors []string
+	var args []interface{}
+	for _, pk := range pks {
+		ands := make([]string, len(model.pks))
+		for i, field := range model.pks {
+			ands[i] = d.quote(field.name) + " = ?"
+		}
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+		args = append(args, pk...)
+	}
+	return NewCondition(strings.Join(ors, " OR "), args...)
+}
+
+// insertSelectSql copies the columns of the model from the rows of the quoted table matching the where clause
+// into the table of the model.
+func insertSelectSql(d Dialect, to *model, from, where string) string {
+	columns := make([]string, len(to.fields))
+	for i, f := range to.fields {
+		columns[i] = d.quote(f.name)
+	}
+	list := strings.Join(columns, ", ")
+	return "INSERT INTO " + d.quote(to.table) + " (" + list + ") SELECT " + list + " FROM " + from + " WHERE " + where
+}
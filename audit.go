@@ -0,0 +1,172 @@
+package qbs
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// The operations passed to Auditor.Audit.
+const (
+	AuditInsert = "insert"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// Auditor receives the changes of every Save, Update, Delete, Restore, BulkInsert, BulkUpdate, Archive and
+// ApplyRetention of a Qbs, set it to Qbs.Auditor. The statements run by Exec are not audited.
+// It is called in the transaction of the write, which is begun for the write if none is, so the audit trail
+// is committed or rolled back with the change, and an error returned rolls the change back.
+// The pk is the primary key value of the row, or the slice of the values of a composite key.
+// Before is the row read before an update or delete, nil for an insert. After holds the columns written by Save
+// and BulkInsert, the row before with the written columns for the other updates, nil for a delete.
+// Audit is called for every row a write changes, the rows moved by Archive and ApplyRetention are deleted.
+type Auditor interface {
+	Audit(tx *Qbs, table, operation string, pk interface{}, before, after map[string]interface{}) error
+}
+
+// auditedRows reads the rows of the condition of the criteria before they are changed.
+func (q *Qbs) auditedRows(model *model) ([]map[string]interface{}, error) {
+	conditionSql, args := q.criteria.condition.Merge()
+	return q.QueryMapSlice("SELECT * FROM "+q.Dialect.quote(model.table)+" WHERE "+conditionSql, args...)
+}
+
+// auditedValues returns the columns of the model written by Save, with the primary key and timestamps of the struct.
+func auditedValues(model *model, structValue reflect.Value) map[string]interface{} {
+	values := make(map[string]interface{}, len(model.fields))
+	for _, field := range model.fields {
+		values[field.name] = field.value
+	}
+	for _, pk := range model.pks {
+		values[pk.name] = structValue.FieldByName(pk.camelName).Interface()
+	}
+	return values
+}
+
+func auditedPk(model *model, row map[string]interface{}) interface{} {
+	if model.pk != nil {
+		return row[model.pk.name]
+	}
+	pk := make([]interface{}, len(model.pks))
+	for i, field := range model.pks {
+		pk[i] = row[field.name]
+	}
+	return pk
+}
+
+// writtenValues returns the columns of the model written by an update.
+func writtenValues(model *model) map[string]interface{} {
+	columns, values := model.columnsAndValues(true)
+	written := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		written[column] = values[i]
+	}
+	return written
+}
+
+// audit passes the change of the rows to the Auditor, after is the row written by Save or BulkInsert,
+// nil for the rows deleted.
+func (q *Qbs) audit(model *model, operation string, before []map[string]interface{}, after map[string]interface{}) error {
+	if after != nil {
+		var row map[string]interface{}
+		if len(before) > 0 {
+			row = before[0]
+		}
+		return q.auditRows(model, operation, []map[string]interface{}{row}, []map[string]interface{}{after})
+	}
+	return q.auditRows(model, operation, before, make([]map[string]interface{}, len(before)))
+}
+
+// auditUpdated passes the update of the rows read before it to the Auditor,
+// the row after is the row before with the written columns.
+func (q *Qbs) auditUpdated(model *model, before []map[string]interface{}, written map[string]interface{}) error {
+	after := make([]map[string]interface{}, len(before))
+	for i, row := range before {
+		after[i] = make(map[string]interface{}, len(row))
+		for column, value := range row {
+			after[i][column] = value
+		}
+		for column, value := range written {
+			after[i][column] = value
+		}
+	}
+	return q.auditRows(model, AuditUpdate, before, after)
+}
+
+// auditRows passes the changes of the rows to the Auditor, the row before and after a change have the same index.
+// The Auditor is unset while it runs, so it can write the audit trail with the Qbs without auditing it,
+// and the criteria and Result of the write are kept.
+func (q *Qbs) auditRows(model *model, operation string, before, after []map[string]interface{}) error {
+	auditor, result := q.Auditor, q.lastResult
+	q.Auditor = nil
+	defer func() {
+		q.Auditor, q.lastResult = auditor, result
+	}()
+	for i, row := range before {
+		changed, pkRow := after[i], after[i]
+		if pkRow == nil {
+			pkRow = row
+		}
+		err := q.callHook(func(tx *Qbs) error {
+			return auditor.Audit(tx, model.table, operation, auditedPk(model, pkRow), row, changed)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AuditLogTable is the table AuditLog writes the audit trail to.
+var AuditLogTable = "qbs_audit_log"
+
+// AuditEntry is a row of the AuditLogTable, Before and After are the rows of the change as JSON objects.
+type AuditEntry struct {
+	Id           int64
+	AuditedTable string `qbs:"size:255"`
+	Operation    string `qbs:"size:16"`
+	Pk           string `qbs:"size:255"`
+	Before       string
+	After        string
+	Created      time.Time `qbs:"created"`
+}
+
+func (*AuditEntry) TableName() string {
+	return AuditLogTable
+}
+
+func (*AuditEntry) Indexes(indexes *Indexes) {
+	indexes.Add("audited_table", "pk")
+}
+
+// AuditLog is an Auditor saving an AuditEntry for every change, the table is created by
+// Migration.CreateAuditLogTableIfNotExists.
+type AuditLog struct{}
+
+func (AuditLog) Audit(tx *Qbs, table, operation string, pk interface{}, before, after map[string]interface{}) error {
+	entry := &AuditEntry{AuditedTable: table, Operation: operation, Pk: fmt.Sprint(pk)}
+	var err error
+	if entry.Before, err = auditJson(before); err != nil {
+		return err
+	}
+	if entry.After, err = auditJson(after); err != nil {
+		return err
+	}
+	_, err = tx.Save(entry)
+	return err
+}
+
+// auditJson returns the JSON object of the row, empty if it is nil.
+func auditJson(row map[string]interface{}) (string, error) {
+	if row == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(row)
+	return string(b), err
+}
+
+// CreateAuditLogTableIfNotExists creates the AuditLogTable written by AuditLog.
+func (mg *Migration) CreateAuditLogTableIfNotExists() error {
+	return mg.CreateTableIfNotExists(new(AuditEntry))
+}
@@ -1,10 +1,10 @@
 package qbs
 
 import (
-	"bytes"
 	"database/sql"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"time"
 )
@@ -17,14 +17,20 @@ func (d base) substituteMarkers(query string) string {
 	return query
 }
 
+// quoteLiteral quotes a string literal for statements that do not accept parameters.
+func quoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
 func (d base) quote(s string) string {
 	segs := strings.Split(s, ".")
-	buf := new(bytes.Buffer)
+	buf := getBuffer()
+	defer putBuffer(buf)
 	buf.WriteByte('`')
-	buf.WriteString(segs[0])
+	buf.WriteString(strings.Replace(segs[0], "`", "``", -1))
 	for i := 1; i < len(segs); i++ {
 		buf.WriteString("`.`")
-		buf.WriteString(segs[i])
+		buf.WriteString(strings.Replace(segs[i], "`", "``", -1))
 	}
 	buf.WriteByte('`')
 	return buf.String()
@@ -47,6 +53,8 @@ func (d base) setPtrValue(driverValue, fieldValue reflect.Value) {
 		v.Elem().SetFloat(driverValue.Interface().(float64))
 	case reflect.Bool:
 		v.Elem().SetBool(driverValue.Interface().(bool))
+	case reflect.Struct:
+		v.Elem().Set(driverValue.Elem()) //a *time.Time.
 	}
 }
 func (d base) setModelValue(driverValue, fieldValue reflect.Value) error {
@@ -88,11 +96,20 @@ func (d base) setModelValue(driverValue, fieldValue reflect.Value) error {
 }
 
 func (d base) querySql(criteria *criteria) (string, []interface{}) {
-	query := new(bytes.Buffer)
+	query := getBuffer()
+	defer putBuffer(query)
 	args := make([]interface{}, 0, 20)
 	table := d.dialect.quote(criteria.model.table)
 	columns := []string{}
 	tables := []string{table}
+	condition := criteria.condition
+	if criteria.samplePercent > 0 {
+		if sample := d.dialect.tableSampleSql(criteria.samplePercent); sample != "" {
+			tables[0] += " " + sample
+		} else {
+			condition = NewCondition(d.dialect.randomSql()+" < ?", criteria.samplePercent/100).AndCondition(condition)
+		}
+	}
 	hasJoin := len(criteria.model.refs) > 0
 	for _, v := range criteria.model.fields {
 		colName := d.dialect.quote(v.name)
@@ -102,7 +119,7 @@ func (d base) querySql(criteria *criteria) (string, []interface{}) {
 		columns = append(columns, colName)
 	}
 	for k, v := range criteria.model.refs {
-		tableAlias := StructNameToTableName(k)
+		tableAlias := unqualified(criteria.model.naming.TableName(k))
 		quotedTableAlias := d.dialect.quote(tableAlias)
 		quotedParentTable := d.dialect.quote(v.model.table)
 		leftKey := table + "." + d.dialect.quote(v.refKey)
@@ -119,12 +136,22 @@ func (d base) querySql(criteria *criteria) (string, []interface{}) {
 	query.WriteString(" FROM ")
 	query.WriteString(strings.Join(tables, " "))
 
-	if criteria.condition != nil {
-		cexpr, cargs := criteria.condition.Merge()
+	if condition != nil {
+		cexpr, cargs := condition.Merge()
 		query.WriteString(" WHERE ")
 		query.WriteString(cexpr)
 		args = append(args, cargs...)
 	}
+	if len(criteria.groupBys) > 0 {
+		query.WriteString(" GROUP BY ")
+		query.WriteString(strings.Join(criteria.groupBys, ", "))
+		if criteria.having != nil {
+			hexpr, hargs := criteria.having.Merge()
+			query.WriteString(" HAVING ")
+			query.WriteString(hexpr)
+			args = append(args, hargs...)
+		}
+	}
 	orderByLen := len(criteria.orderBys)
 	if orderByLen > 0 {
 		query.WriteString(" ORDER BY ")
@@ -150,6 +177,75 @@ func (d base) querySql(criteria *criteria) (string, []interface{}) {
 	return d.dialect.substituteMarkers(query.String()), args
 }
 
+// topNOrders returns the unquoted order by columns of the criteria, the primary key columns are appended
+// as the tie breakers, rows are ordered by primary key descending by default.
+// It panics if there is neither an order nor a primary key to rank the rows by.
+func topNOrders(criteria *criteria) []order {
+	orders := make([]order, 0, len(criteria.orderBys)+len(criteria.model.pks))
+	ordered := make(map[string]bool)
+	for _, o := range criteria.orderBys {
+		column := unquotePath(o.path)
+		orders = append(orders, order{column, o.desc})
+		ordered[column] = true
+	}
+	byDefault := len(orders) == 0
+	for _, pk := range criteria.model.pks {
+		if !ordered[pk.name] {
+			orders = append(orders, order{pk.name, byDefault})
+		}
+	}
+	if len(orders) == 0 {
+		panic("FindAllTopN requires OrderBy or a primary key to rank the rows of " + criteria.model.table)
+	}
+	return orders
+}
+
+// topNSql selects the first n rows of every group with a correlated subquery counting the rows
+// of the same group ordered before the current row.
+func (d base) topNSql(criteria *criteria, groupColumn string, n int) (string, []interface{}) {
+	model := criteria.model
+	table := d.dialect.quote(model.table)
+	alias := d.dialect.quote("qbs_top")
+	group := d.dialect.quote(groupColumn)
+	columns := make([]string, 0, len(model.fields))
+	for _, f := range model.fields {
+		columns = append(columns, table+"."+d.dialect.quote(f.name))
+	}
+	orders := topNOrders(criteria)
+	before := make([]string, 0, len(orders))
+	orderBys := []string{table + "." + group}
+	for i, o := range orders {
+		ands := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			c := d.dialect.quote(orders[j].path)
+			ands = append(ands, alias+"."+c+" = "+table+"."+c)
+		}
+		c := d.dialect.quote(o.path)
+		op, desc := " < ", ""
+		if o.desc {
+			op, desc = " > ", " DESC"
+		}
+		ands = append(ands, alias+"."+c+op+table+"."+c)
+		before = append(before, "("+strings.Join(ands, " AND ")+")")
+		orderBys = append(orderBys, table+"."+c+desc)
+	}
+	sub := fmt.Sprintf("SELECT COUNT(*) FROM %v AS %v WHERE %v.%v = %v.%v AND (%v)",
+		table, alias, alias, group, table, group, strings.Join(before, " OR "))
+	var args []interface{}
+	where := ""
+	if criteria.condition != nil {
+		cexpr, cargs := criteria.condition.Merge()
+		where = "(" + cexpr + ") AND "
+		sub += " AND (" + cexpr + ")"
+		args = append(args, cargs...)
+		args = append(args, cargs...)
+	}
+	args = append(args, n)
+	query := fmt.Sprintf("SELECT %v FROM %v WHERE %v(%v) < ? ORDER BY %v",
+		strings.Join(columns, ", "), table, where, sub, strings.Join(orderBys, ", "))
+	return d.dialect.substituteMarkers(query), args
+}
+
 func (d base) insert(q *Qbs) (int64, error) {
 	sql, args := d.dialect.insertSql(q.criteria)
 	result, err := q.Exec(sql, args...)
@@ -180,6 +276,61 @@ func (d base) insertSql(criteria *criteria) (string, []interface{}) {
 	return sql, values
 }
 
+// bulkInsert returns ids counting from the last insert id, which is the id of the first row on mysql.
+func (d base) bulkInsert(q *Qbs, models []*model) ([]int64, error) {
+	sql, args := d.dialect.bulkInsertSql(models)
+	result, err := q.Exec(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	first, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(models))
+	for i := range ids {
+		ids[i] = first + int64(i)
+	}
+	return ids, nil
+}
+
+func (d base) bulkInsertSql(models []*model) (string, []interface{}) {
+	columns, _ := models[0].columnsAndValues(false)
+	quotedColumns := make([]string, 0, len(columns))
+	markers := make([]string, 0, len(columns))
+	for _, c := range columns {
+		quotedColumns = append(quotedColumns, d.dialect.quote(c))
+		markers = append(markers, "?")
+	}
+	rowMarkers := "(" + strings.Join(markers, ", ") + ")"
+	rows := make([]string, 0, len(models))
+	args := make([]interface{}, 0, len(models)*len(columns))
+	for _, m := range models {
+		_, values := m.columnsAndValues(false)
+		rows = append(rows, rowMarkers)
+		args = append(args, values...)
+	}
+	sql := fmt.Sprintf(
+		"INSERT INTO %v (%v) VALUES %v",
+		d.dialect.quote(models[0].table),
+		strings.Join(quotedColumns, ", "),
+		strings.Join(rows, ", "),
+	)
+	return sql, args
+}
+
+// maxBulkInsertRows keeps the bind parameters of a statement under 65535.
+func (d base) maxBulkInsertRows(columns int) int {
+	if columns == 0 {
+		return 1
+	}
+	rows := 65535 / columns
+	if rows > 1000 {
+		rows = 1000
+	}
+	return rows
+}
+
 func (d base) update(q *Qbs) (int64, error) {
 	sql, args := d.dialect.updateSql(q.criteria)
 	result, err := q.Exec(sql, args...)
@@ -227,17 +378,26 @@ func (d base) createTableSql(model *model, ifNotExists bool) string {
 	if ifNotExists {
 		a = append(a, "IF NOT EXISTS ")
 	}
-	a = append(a, d.dialect.quote(model.table), " ( ")
+	a = append(a, d.dialect.quote(model.table), " ( ", d.dialect.tableDefinitionsSql(model), " )")
+	return strings.Join(a, "")
+}
+
+func (d base) tableDefinitionsSql(model *model) string {
+	var a []string
 	for i, field := range model.fields {
 		b := []string{
 			d.dialect.quote(field.name),
 		}
-		if field.pk {
+		if field.pk && model.pk != nil && field.customColType() != "" {
+			b = append(b, d.dialect.sqlType(*field)+" PRIMARY KEY")
+		} else if field.pk && model.pk != nil && field.uuid {
+			b = append(b, d.dialect.uuidType()+" PRIMARY KEY")
+		} else if field.pk && model.pk != nil {
 			_, ok := field.value.(string)
 			b = append(b, d.dialect.primaryKeySql(ok, field.size))
 		} else {
 			b = append(b, d.dialect.sqlType(*field))
-			if field.notnull {
+			if field.notnull || field.pk {
 				b = append(b, "NOT NULL")
 			}
 			if x := field.dfault; x != "" {
@@ -249,13 +409,19 @@ func (d base) createTableSql(model *model, ifNotExists bool) string {
 			a = append(a, ", ")
 		}
 	}
+	if len(model.pks) > 1 {
+		pks := make([]string, len(model.pks))
+		for i, pk := range model.pks {
+			pks[i] = d.dialect.quote(pk.name)
+		}
+		a = append(a, ", PRIMARY KEY (", strings.Join(pks, ", "), ")")
+	}
 	for _, v := range model.refs {
 		if v.foreignKey {
 			a = append(a, ", FOREIGN KEY (", d.dialect.quote(v.refKey), ") REFERENCES ")
-			a = append(a, d.dialect.quote(v.model.table), " (", d.dialect.quote(v.model.pk.name), ") ON DELETE CASCADE")
+			a = append(a, d.dialect.quote(v.model.table), " (", d.dialect.quote(v.model.pk.name), ")", v.actionsSql())
 		}
 	}
-	a = append(a, " )")
 	return strings.Join(a, "")
 }
 
@@ -274,6 +440,61 @@ func (d base) addColumnSql(table string, column modelField) string {
 	)
 }
 
+func (d base) dropColumnSql(table, column string) string {
+	return fmt.Sprintf("ALTER TABLE %v DROP COLUMN %v", d.dialect.quote(table), d.dialect.quote(column))
+}
+
+func (d base) renameColumnSql(table, oldName string, column modelField) string {
+	return fmt.Sprintf(
+		"ALTER TABLE %v RENAME COLUMN %v TO %v",
+		d.dialect.quote(table),
+		d.dialect.quote(oldName),
+		d.dialect.quote(column.name),
+	)
+}
+
+func (d base) setNotNullSql(table string, column modelField) []string {
+	dfault := ""
+	if column.dfault != "" {
+		dfault = " DEFAULT " + column.dfault
+	}
+	return []string{fmt.Sprintf(
+		"ALTER TABLE %v MODIFY COLUMN %v %v%v NOT NULL",
+		d.dialect.quote(table),
+		d.dialect.quote(column.name),
+		d.dialect.sqlType(column),
+		dfault,
+	)}
+}
+
+func (d base) resizeColumnSql(table string, column modelField) []string {
+	sql := fmt.Sprintf(
+		"ALTER TABLE %v MODIFY COLUMN %v %v",
+		d.dialect.quote(table),
+		d.dialect.quote(column.name),
+		d.dialect.sqlType(column),
+	)
+	if column.notnull {
+		sql += " NOT NULL"
+	}
+	if column.dfault != "" {
+		sql += " DEFAULT " + column.dfault
+	}
+	return []string{sql}
+}
+
+func (d base) alterColumnTypeSql(table string, column modelField) []string {
+	return d.dialect.resizeColumnSql(table, column)
+}
+
+func (d base) columnType(mg *Migration, table, column string) string {
+	return ""
+}
+
+func (d base) charLengthSql(column string) string {
+	return "CHAR_LENGTH(" + column + ")"
+}
+
 func (d base) createIndexSql(name, table string, unique bool, columns ...string) string {
 	a := []string{"CREATE"}
 	if unique {
@@ -281,7 +502,11 @@ func (d base) createIndexSql(name, table string, unique bool, columns ...string)
 	}
 	quotedColumns := make([]string, 0, len(columns))
 	for _, c := range columns {
-		quotedColumns = append(quotedColumns, d.dialect.quote(c))
+		if strings.HasPrefix(c, "(") { //an expression
+			quotedColumns = append(quotedColumns, c)
+		} else {
+			quotedColumns = append(quotedColumns, d.dialect.quote(c))
+		}
 	}
 	a = append(a, fmt.Sprintf(
 		"INDEX %v ON %v (%v)",
@@ -292,12 +517,39 @@ func (d base) createIndexSql(name, table string, unique bool, columns ...string)
 	return strings.Join(a, " ")
 }
 
+func (d base) addForeignKeySql(table, name string, ref *reference) string {
+	return fmt.Sprintf("ALTER TABLE %v ADD CONSTRAINT %v FOREIGN KEY (%v) REFERENCES %v (%v)%v",
+		d.dialect.quote(table), d.dialect.quote(name), d.dialect.quote(ref.refKey),
+		d.dialect.quote(ref.model.table), d.dialect.quote(ref.model.pk.name), ref.actionsSql())
+}
+
+func (d base) dropForeignKeySql(table, name string) string {
+	return "ALTER TABLE " + d.dialect.quote(table) + " DROP CONSTRAINT " + d.dialect.quote(name)
+}
+
+// dropIndexSql qualifies the index with the schema of the table, the index is in the schema of its table.
+func (d base) dropIndexSql(table, name string) string {
+	return "DROP INDEX " + d.dialect.quote(qualifiedIndex(table, name))
+}
+
+func (d base) renameIndexSql(table, oldName, newName string) string {
+	return "ALTER INDEX " + d.dialect.quote(qualifiedIndex(table, oldName)) + " RENAME TO " + d.dialect.quote(newName)
+}
+
+func (d base) supportsPartialIndex() bool {
+	return true
+}
+
 func (d base) columnsInTable(mg *Migration, table interface{}) map[string]bool {
-	tn := tableName(table)
+	tn := namedTableName(table, mg.naming())
 	columns := make(map[string]bool)
+	schema, tn := splitSchema(tn)
+	if schema == "" {
+		schema = mg.dbName
+	}
 	query := "SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?"
 	query = mg.dialect.substituteMarkers(query)
-	rows, err := mg.db.Query(query, mg.dbName, tn)
+	rows, err := mg.db.Query(query, schema, tn)
 	defer rows.Close()
 	if err != nil {
 		panic(err)
@@ -315,3 +567,78 @@ func (d base) columnsInTable(mg *Migration, table interface{}) map[string]bool {
 func (d base) catchMigrationError(err error) bool {
 	return false
 }
+
+func (d base) supportsRowValues() bool {
+	return true
+}
+
+func (d base) lockSql() (string, string) {
+	return "", ""
+}
+
+func (d base) returningSql(model *model) string {
+	return ""
+}
+
+func (d base) tempTableSql(model *model) (string, string) {
+	table := d.dialect.quote(model.table)
+	return "CREATE TEMPORARY TABLE " + table + " ( " + d.dialect.tableDefinitionsSql(model) + " )", "DROP TABLE " + table
+}
+
+func (d base) uuidType() string {
+	return "char(36)"
+}
+
+func (d base) snapshotIsolation() sql.IsolationLevel {
+	return sql.LevelRepeatableRead
+}
+
+func (d base) savepointSql(name string) (string, string, string) {
+	name = d.dialect.quote(name)
+	return "SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name, "RELEASE SAVEPOINT " + name
+}
+
+func (d base) inspectSqls() (string, string, string, string) {
+	return "", "", "", ""
+}
+
+func (d base) scheduleEventSql(name string, every time.Duration, statement string) (string, []interface{}) {
+	return "", nil
+}
+
+func (d base) unscheduleEventSql(name string) (string, []interface{}) {
+	return "", nil
+}
+
+func (d base) attachDatabaseSqls(name string, opts AttachOptions) []string {
+	return nil
+}
+
+func (d base) detachDatabaseSqls(name string) []string {
+	return nil
+}
+
+func (d base) createSchemaSql(schema string) string {
+	return ""
+}
+
+func (d base) explainSql(query string) string {
+	return "EXPLAIN " + query
+}
+
+func (d base) planStep(row map[string]string) PlanStep {
+	values := make([]string, 0, len(row))
+	for _, value := range row {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return PlanStep{Detail: strings.Join(values, " ")}
+}
+
+func (d base) randomSql() string {
+	return "RANDOM()"
+}
+
+func (d base) tableSampleSql(percent float64) string {
+	return ""
+}
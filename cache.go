@@ -0,0 +1,269 @@
+package qbs
+
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores the rows of Cacheable models found by Find, set it by SetCache, and the query results of
+// SetQueryCache. The values are struct pointers, pointers to slices of them and the int64 generations of tables,
+// owned by the cache, implementations backed by memcached or redis have to copy them.
+type Cache interface {
+	Get(key string) (structPtr interface{}, ok bool)
+	Set(key string, structPtr interface{}, ttl time.Duration)
+	Delete(key string)
+}
+
+// CacheOptions tells how the rows of a Cacheable model are cached.
+type CacheOptions struct {
+	TTL  time.Duration // How long a cached row lives, it bounds the staleness of rows changed without invalidation.
+	Keys []string      // The columns identifying a row, the primary key columns if empty.
+}
+
+// Cacheable is implemented by models whose rows are cached.
+// Find consults the cache when the struct has all the key values set and no condition is given,
+// Save, Update, Delete, Restore and BulkUpdate of a struct with the key values set invalidate its cached row,
+// Archive and ApplyRetention invalidate the rows they remove if the key is the primary key.
+// The cache is bypassed in transactions and by OmitFields, OmitJoin and Unscoped.
+type Cacheable interface {
+	CacheOptions() CacheOptions
+}
+
+var modelCache Cache
+
+// Set the cache of Cacheable models, nil disables caching.
+func SetCache(cache Cache) {
+	modelCache = cache
+}
+
+// cacheKey returns the key of the row of the struct pointer of the named database in the cache,
+// empty if it shouldn't be cached.
+func cacheKey(structPtr interface{}, model *model, dbName string) (string, CacheOptions) {
+	c, ok := structPtr.(Cacheable)
+	if !ok || modelCache == nil {
+		return "", CacheOptions{}
+	}
+	opts := c.CacheOptions()
+	keyFields := model.pks
+	if len(opts.Keys) > 0 {
+		keyFields = make([]*modelField, len(opts.Keys))
+		for i, column := range opts.Keys {
+			for _, f := range model.fields {
+				if f.name == column {
+					keyFields[i] = f
+				}
+			}
+			if keyFields[i] == nil {
+				panic("cache key column " + column + " not found in table " + model.table)
+			}
+		}
+	}
+	if len(keyFields) == 0 {
+		return "", opts
+	}
+	parts := make([]string, len(keyFields))
+	for i, f := range keyFields {
+		if f.value == nil || reflect.ValueOf(f.value).IsZero() {
+			return "", opts
+		}
+		parts[i] = fmt.Sprintf("%v=%v", f.name, f.value)
+	}
+	return "qbs:" + dbName + ":" + model.table + ":" + strings.Join(parts, ":"), opts
+}
+
+// keyCondition returns the condition on the key columns of the cache options, nil if they are the primary key.
+func (opts CacheOptions) keyCondition(d Dialect, model *model) *Condition {
+	var con *Condition
+	for _, column := range opts.Keys {
+		for _, f := range model.fields {
+			if f.name != column {
+				continue
+			}
+			expr := d.quote(model.table) + "." + d.quote(column) + " = ?"
+			if con == nil {
+				con = NewCondition(expr, f.value)
+			} else {
+				con.And(expr, f.value)
+			}
+		}
+	}
+	return con
+}
+
+// findCached fills the struct pointer from the cache, it returns the key to store the found row if it's missing.
+// Unscoped finds bypass the cache, so soft deleted rows are neither returned from it nor stored into it.
+func (q *Qbs) findCached(structPtr interface{}) (key string, opts CacheOptions, hit bool) {
+	if q.tx != nil || q.criteria.condition != nil || len(q.criteria.omitFields) > 0 || q.criteria.omitJoin ||
+		q.criteria.unscoped {
+		return "", opts, false
+	}
+	key, opts = cacheKey(structPtr, q.criteria.model, q.cacheName())
+	if key == "" {
+		return "", opts, false
+	}
+	if cached, ok := modelCache.Get(key); ok {
+		reflect.ValueOf(structPtr).Elem().Set(reflect.ValueOf(cached).Elem())
+		return key, opts, true
+	}
+	if q.criteria.model.pkCondition(q.Dialect, true) == nil {
+		q.criteria.condition = opts.keyCondition(q.Dialect, q.criteria.model)
+	}
+	return key, opts, false
+}
+
+// storeCached caches a copy of the found row.
+func storeCached(key string, opts CacheOptions, structPtr interface{}) {
+	if key != "" {
+		modelCache.Set(key, copyRow(reflect.ValueOf(structPtr)).Interface(), opts.TTL)
+	}
+}
+
+// invalidateCached removes the cached row of the struct pointer after it is written, in a transaction as well.
+func (q *Qbs) invalidateCached(structPtr interface{}, model *model) {
+	if key, _ := cacheKey(structPtr, model, q.cacheName()); key != "" {
+		modelCache.Delete(key)
+	}
+}
+
+// invalidateCachedPks removes the cached rows of the primary key values of the model of the struct pointer,
+// for the rows written by a statement instead of a struct. The rows of models cached by CacheOptions.Keys
+// other than the primary key can't be found by it, they are stale until their TTL expires.
+func (q *Qbs) invalidateCachedPks(structPtr interface{}, model *model, pks [][]interface{}) {
+	c, ok := structPtr.(Cacheable)
+	if !ok || modelCache == nil || len(c.CacheOptions().Keys) > 0 {
+		return
+	}
+	for _, pk := range pks {
+		parts := make([]string, len(model.pks))
+		for i, f := range model.pks {
+			parts[i] = fmt.Sprintf("%v=%v", f.name, pk[i])
+		}
+		modelCache.Delete("qbs:" + q.cacheName() + ":" + model.table + ":" + strings.Join(parts, ":"))
+	}
+}
+
+// MemoryCache is a Cache in the memory of the process.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	structPtr interface{}
+	expires   time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]memoryCacheEntry)}
+}
+
+func (c *MemoryCache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.structPtr, true
+}
+
+// Set stores the struct pointer, a ttl of 0 never expires.
+func (c *MemoryCache) Set(key string, structPtr interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := memoryCacheEntry{structPtr: structPtr}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+	c.entries[key] = e
+}
+
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// LRUCache is a Cache in the memory of the process keeping the most recently used entries.
+type LRUCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of *lruEntry, the most recently used first
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// NewLRUCache returns a cache of at most size entries, the least recently used is evicted for a new one.
+func NewLRUCache(size int) *LRUCache {
+	if size <= 0 {
+		panic("cache size should be positive")
+	}
+	return &LRUCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *LRUCache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*lruEntry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return e.value, true
+}
+
+// Set stores the value, a ttl of 0 never expires.
+func (c *LRUCache) Set(key string, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &lruEntry{key: key, value: value}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = e
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(e)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (c *LRUCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// Len returns the number of entries, including expired ones not evicted yet.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
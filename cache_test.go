@@ -0,0 +1,146 @@
+package qbs
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type cachedUser struct {
+	Id    int64
+	Email string
+}
+
+func (*cachedUser) CacheOptions() CacheOptions {
+	return CacheOptions{TTL: time.Minute, Keys: []string{"email"}}
+}
+
+func TestCacheKey(t *testing.T) {
+	assert := NewAssert(t)
+	SetCache(NewMemoryCache())
+	defer SetCache(nil)
+	user := &cachedUser{Id: 3, Email: "a@b.c"}
+	key, opts := cacheKey(user, structPtrToModel(user, false, nil), "main")
+	assert.Equal("qbs:main:cached_user:email=a@b.c", key)
+	assert.Equal(time.Minute, opts.TTL)
+	key, _ = cacheKey(&cachedUser{Id: 3}, structPtrToModel(&cachedUser{Id: 3}, false, nil), "main")
+	assert.Equal("", key)
+	key, _ = cacheKey(&basic{Id: 3}, structPtrToModel(&basic{Id: 3}, false, nil), "main")
+	assert.Equal("", key)
+	cond := opts.keyCondition(NewMysql(), structPtrToModel(user, false, nil))
+	expr, args := cond.Merge()
+	assert.Equal("`cached_user`.`email` = ?", expr)
+	assert.Equal("[a@b.c]", args)
+}
+
+func TestFindCachedUnscoped(t *testing.T) {
+	assert := NewAssert(t)
+	SetCache(NewMemoryCache())
+	defer SetCache(nil)
+	q := NewFromDB(nil, NewMysql())
+	user := &cachedUser{Id: 3, Email: "a@b.c"}
+	q.criteria.model = structPtrToModel(user, false, nil)
+	key, opts, hit := q.findCached(user)
+	assert.True(key != "" && !hit)
+	storeCached(key, opts, user)
+	_, _, hit = q.findCached(&cachedUser{Email: "a@b.c"})
+	assert.True(hit)
+	q.criteria.unscoped = true
+	key, _, hit = q.findCached(&cachedUser{Email: "a@b.c"})
+	assert.Equal("", key)
+	assert.True(!hit)
+}
+
+type cachedRow struct {
+	Id   int64
+	Name string
+}
+
+func (*cachedRow) CacheOptions() CacheOptions {
+	return CacheOptions{TTL: time.Minute}
+}
+
+func TestInvalidateCachedPks(t *testing.T) {
+	assert := NewAssert(t)
+	SetCache(NewMemoryCache())
+	defer SetCache(nil)
+	q := NewFromDB(nil, NewMysql())
+	row := &cachedRow{Id: 3, Name: "a"}
+	model := structPtrToModel(row, false, nil)
+	key, opts := cacheKey(row, model, q.cacheName())
+	storeCached(key, opts, row)
+	q.invalidateCachedPks(row, model, [][]interface{}{{int64(2)}})
+	_, ok := modelCache.Get(key)
+	assert.True(ok)
+	q.invalidateCachedPks(row, model, [][]interface{}{{int64(2)}, {int64(3)}})
+	_, ok = modelCache.Get(key)
+	assert.True(!ok)
+}
+
+func TestMemoryCache(t *testing.T) {
+	assert := NewAssert(t)
+	c := NewMemoryCache()
+	c.Set("a", &basic{Name: "a"}, 0)
+	c.Set("c", &basic{Name: "c"}, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	v, ok := c.Get("a")
+	assert.True(ok)
+	assert.Equal("a", v.(*basic).Name)
+	_, ok = c.Get("c")
+	assert.True(!ok)
+	c.Delete("a")
+	_, ok = c.Get("a")
+	assert.True(!ok)
+}
+
+func TestLRUCache(t *testing.T) {
+	assert := NewAssert(t)
+	c := NewLRUCache(2)
+	c.Set("a", &basic{Name: "a"}, 0)
+	c.Set("b", &basic{Name: "b"}, 0)
+	_, ok := c.Get("a")
+	assert.True(ok)
+	c.Set("c", &basic{Name: "c"}, 0)
+	_, ok = c.Get("b")
+	assert.True(!ok)
+	v, ok := c.Get("a")
+	assert.True(ok)
+	assert.Equal("a", v.(*basic).Name)
+	assert.Equal(2, c.Len())
+	c.Set("d", int64(1), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	_, ok = c.Get("d")
+	assert.True(!ok)
+	c.Delete("a")
+	assert.Equal(0, c.Len())
+}
+
+func TestQueryCache(t *testing.T) {
+	assert := NewAssert(t)
+	SetQueryCache(NewLRUCache(100), time.Minute)
+	defer SetQueryCache(nil, 0)
+	q := NewFromDB(nil, NewMysql())
+	q.criteria.model = structPtrToModel(new(basic), false, nil)
+	var rows []*basic
+	key := q.resultKey(&rows, "SELECT * FROM basic WHERE id > ?", []interface{}{1})
+	assert.True(key != "")
+	assert.Equal(key, q.resultKey(&rows, "SELECT * FROM basic WHERE id > ?", []interface{}{1}))
+	assert.True(key != q.resultKey(&rows, "SELECT * FROM basic WHERE id > ?", []interface{}{2}))
+	sliceValue := reflect.ValueOf(&rows).Elem()
+	assert.True(!findCachedRows(key, sliceValue))
+	rows = append(rows, &basic{Id: 2, Name: "a"}, &basic{Id: 3, Name: "b"})
+	storeCachedRows(key, sliceValue, 1)
+	var found []*basic
+	assert.True(findCachedRows(key, reflect.ValueOf(&found).Elem()))
+	assert.Equal(1, len(found))
+	assert.Equal("b", found[0].Name)
+	assert.True(found[0] != rows[1])
+
+	other := NewFromDB(new(sql.DB), NewMysql())
+	other.criteria.model = q.criteria.model
+	assert.True(key != other.resultKey(&rows, "SELECT * FROM basic WHERE id > ?", []interface{}{1}))
+
+	invalidateQueries("basic")
+	assert.True(key != q.resultKey(&rows, "SELECT * FROM basic WHERE id > ?", []interface{}{1}))
+}
@@ -0,0 +1,110 @@
+package qbs
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+// CanaryStats counts the reads compared against a canary database.
+type CanaryStats struct {
+	Reads      int64 // compared reads
+	Mismatches int64 // reads whose rows differ on the canary
+	Errors     int64 // reads failed on the canary
+}
+
+type canaryReader struct {
+	q        *Qbs
+	fraction float64
+	stats    CanaryStats
+}
+
+// SetCanary runs a fraction, between 0 and 1, of the Find and FindAll queries also on the other Qbs,
+// which usually works on a new database or a rewritten table, compares the rows and logs the differences.
+// Rows of FindAll are compared by position, so the compared queries should be ordered.
+// The other Qbs must not be used elsewhere, call SetCanary(nil, 0) to stop comparing.
+func (q *Qbs) SetCanary(other *Qbs, fraction float64) {
+	if other == nil {
+		q.canary = nil
+		return
+	}
+	q.canary = &canaryReader{q: other, fraction: fraction}
+}
+
+// CanaryStats returns the counters of the current canary.
+func (q *Qbs) CanaryStats() CanaryStats {
+	if q.canary == nil {
+		return CanaryStats{}
+	}
+	return CanaryStats{
+		Reads:      atomic.LoadInt64(&q.canary.stats.Reads),
+		Mismatches: atomic.LoadInt64(&q.canary.stats.Mismatches),
+		Errors:     atomic.LoadInt64(&q.canary.stats.Errors),
+	}
+}
+
+func (c *canaryReader) sample() bool {
+	return c.fraction >= 1 || rand.Float64() < c.fraction
+}
+
+// compare runs the query of the criteria on the canary and compares the result with out,
+// start is the number of elements the slice had before FindAll.
+func (c *canaryReader) compare(crit *criteria, out interface{}, start int, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		return
+	}
+	atomic.AddInt64(&c.stats.Reads, 1)
+	outValue := reflect.Indirect(reflect.ValueOf(out))
+	canaryValue := reflect.New(outValue.Type())
+	c.q.criteria = crit
+	query, args := c.q.Dialect.querySql(crit)
+	var canaryErr error
+	if outValue.Kind() == reflect.Slice {
+		canaryErr = c.q.doQueryRows(canaryValue.Interface(), query, args...)
+	} else {
+		canaryErr = c.q.doQueryRow(canaryValue.Interface(), query, args...)
+	}
+	if canaryErr != nil && canaryErr != sql.ErrNoRows {
+		atomic.AddInt64(&c.stats.Errors, 1)
+		if errorLogger != nil {
+			errorLogger.Println("canary:", canaryErr)
+		}
+		return
+	}
+	var diffs []string
+	if err != canaryErr {
+		diffs = append(diffs, fmt.Sprintf("found: %v vs %v", err == nil, canaryErr == nil))
+	} else if outValue.Kind() == reflect.Slice {
+		rows, canaryRows := outValue.Slice(start, outValue.Len()), canaryValue.Elem()
+		if rows.Len() != canaryRows.Len() {
+			diffs = append(diffs, fmt.Sprintf("rows: %v vs %v", rows.Len(), canaryRows.Len()))
+		} else {
+			for i := 0; i < rows.Len(); i++ {
+				diffs = append(diffs, diffFields(crit.model, rows.Index(i).Elem(), canaryRows.Index(i).Elem())...)
+			}
+		}
+	} else if err == nil {
+		diffs = diffFields(crit.model, outValue, canaryValue.Elem())
+	}
+	if len(diffs) > 0 {
+		atomic.AddInt64(&c.stats.Mismatches, 1)
+		if errorLogger != nil {
+			errorLogger.Printf("canary: %v differs, %v", crit.model.table, strings.Join(diffs, ", "))
+		}
+	}
+}
+
+// diffFields returns the differing column values of two structs of the model.
+func diffFields(model *model, a, b reflect.Value) []string {
+	var diffs []string
+	for _, f := range model.fields {
+		va, vb := valueString(a.FieldByName(f.camelName)), valueString(b.FieldByName(f.camelName))
+		if va != vb {
+			diffs = append(diffs, f.name+": "+va+" vs "+vb)
+		}
+	}
+	return diffs
+}
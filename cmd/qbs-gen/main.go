@@ -0,0 +1,369 @@
+// Command qbs-gen generates code for qbs models.
+//
+//	qbs-gen columns [-o output.go] [-types User,Post] [-columntags db] model.go...
+//
+// The columns command emits a variable of the columns of every struct type in the files, e.g. UserCols.Email,
+// so conditions can be written as UserCols.Email.Eq(email). The condition methods of a column take values of the
+// type of its field, Eq of a *string field takes a string, except for JSON fields which are plain qbs.Column values.
+// The fields of embedded structs declared in the files are columns too, the columns are named by the tags of
+// -columntags, which should be the qbs.ColumnTagKeys of the application, or else by the default naming convention.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/coocood/qbs"
+)
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "columns" {
+		fmt.Fprintln(os.Stderr, "usage: qbs-gen columns [-o output.go] [-types User,Post] [-columntags db] model.go...")
+		os.Exit(2)
+	}
+	flags := flag.NewFlagSet("columns", flag.ExitOnError)
+	output := flags.String("o", "", "output file, qbs_columns.go in the directory of the first file by default")
+	types := flags.String("types", "", "comma separated struct types, all exported struct types by default")
+	columnTags := flags.String("columntags", strings.Join(qbs.ColumnTagKeys, ","),
+		"comma separated tag keys naming the columns, like qbs.ColumnTagKeys of the application")
+	flags.Parse(os.Args[2:])
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "no input files")
+		os.Exit(2)
+	}
+	var tags []string
+	for _, tag := range strings.Split(*columnTags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	src, err := generateColumns(flags.Args(), *types, tags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *output == "" {
+		*output = filepath.Join(filepath.Dir(flags.Arg(0)), "qbs_columns.go")
+	}
+	if err = ioutil.WriteFile(*output, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+type structColumns struct {
+	name   string
+	fields []*columnField
+}
+
+type columnField struct {
+	name   string
+	column string
+	typ    string // the type of the values of the typed methods, empty for a JSON field
+	depth  int    // the depth of the embedded structs the field is in
+}
+
+// generator generates the columns of the structs of a package.
+type generator struct {
+	structs    map[string]*ast.StructType
+	imports    map[string]string // the import paths of the packages the field types refer to, by name
+	fileImport map[*ast.StructType]map[string]string
+	columnTags []string
+}
+
+func generateColumns(files []string, types string, columnTags []string) ([]byte, error) {
+	wanted := make(map[string]bool)
+	for _, t := range strings.Split(types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			wanted[t] = true
+		}
+	}
+	g := &generator{
+		structs:    make(map[string]*ast.StructType),
+		imports:    make(map[string]string),
+		fileImport: make(map[*ast.StructType]map[string]string),
+		columnTags: columnTags,
+	}
+	fset := token.NewFileSet()
+	pkg := ""
+	var names []string
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		if pkg != "" && f.Name.Name != pkg {
+			return nil, fmt.Errorf("%v is in package %v, not %v", file, f.Name.Name, pkg)
+		}
+		pkg = f.Name.Name
+		imports := make(map[string]string)
+		for _, spec := range f.Imports {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			name := path[strings.LastIndex(path, "/")+1:]
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			imports[name] = path
+		}
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				structType, ok := typeSpec.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				g.structs[typeSpec.Name.Name] = structType
+				g.fileImport[structType] = imports
+				if typeSpec.Name.IsExported() && (len(wanted) == 0 || wanted[typeSpec.Name.Name]) {
+					names = append(names, typeSpec.Name.Name)
+				}
+			}
+		}
+	}
+	var structs []*structColumns
+	for _, name := range names {
+		fields, err := g.columnsOf(g.structs[name], 0, map[string]bool{name: true})
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", name, err)
+		}
+		if s := (&structColumns{name, promoted(fields)}); len(s.fields) > 0 {
+			structs = append(structs, s)
+		}
+	}
+	buf := new(bytes.Buffer)
+	var imports []string
+	for name, path := range g.imports {
+		if path[strings.LastIndex(path, "/")+1:] == name {
+			imports = append(imports, strconv.Quote(path))
+		} else {
+			imports = append(imports, name+" "+strconv.Quote(path))
+		}
+	}
+	sort.Strings(imports)
+	fmt.Fprintf(buf, "// Code generated by qbs-gen; DO NOT EDIT.\n\npackage %v\n\nimport (\n", pkg)
+	for _, spec := range imports {
+		fmt.Fprintf(buf, "%v\n", spec)
+	}
+	buf.WriteString("\n\"github.com/coocood/qbs\"\n)\n")
+	for _, s := range structs {
+		fmt.Fprintf(buf, "\n// %vCols are the columns of %v.\nvar %vCols = struct {\n", s.name, s.name, s.name)
+		for _, field := range s.fields {
+			fmt.Fprintf(buf, "%v %v\n", field.name, columnType(s, field))
+		}
+		buf.WriteString("}{\n")
+		for _, field := range s.fields {
+			if field.typ == "" {
+				fmt.Fprintf(buf, "%v: %q,\n", field.name, field.column)
+			} else {
+				fmt.Fprintf(buf, "%v: %v{%q},\n", field.name, columnType(s, field), field.column)
+			}
+		}
+		buf.WriteString("}\n")
+		for _, field := range s.fields {
+			if field.typ != "" {
+				writeTypedColumn(buf, columnType(s, field), field.typ)
+			}
+		}
+	}
+	return format.Source(buf.Bytes())
+}
+
+// columnType returns the type of the column of the field, a generated type with typed methods
+// or qbs.Column for a JSON field.
+func columnType(s *structColumns, field *columnField) string {
+	if field.typ == "" {
+		return "qbs.Column"
+	}
+	return strings.ToLower(s.name[:1]) + s.name[1:] + field.name + "Column"
+}
+
+// writeTypedColumn writes the type of a column embedding qbs.Column, whose condition methods take values
+// of the type of the field instead of interface{}.
+func writeTypedColumn(buf *bytes.Buffer, name, typ string) {
+	fmt.Fprintf(buf, "\ntype %v struct {\nqbs.Column\n}\n", name)
+	for _, method := range []string{"Eq", "Ne", "Gt", "Ge", "Lt", "Le"} {
+		fmt.Fprintf(buf, "\nfunc (c %v) %v(value %v) *qbs.Condition {\nreturn c.Column.%v(value)\n}\n", name, method, typ, method)
+	}
+	fmt.Fprintf(buf, "\nfunc (c %v) In(values ...%v) *qbs.Condition {\n", name, typ)
+	buf.WriteString("args := make([]interface{}, len(values))\nfor i, v := range values {\nargs[i] = v\n}\nreturn c.Column.In(args...)\n}\n")
+}
+
+// columnsOf returns the fields of the struct which qbs maps to columns, with the fields of the embedded structs,
+// the names of the structs being expanded are given to detect a struct embedding itself.
+func (g *generator) columnsOf(structType *ast.StructType, depth int, expanding map[string]bool) ([]*columnField, error) {
+	var fields []*columnField
+	for _, field := range structType.Fields.List {
+		tag := ""
+		if field.Tag != nil {
+			tag, _ = strconv.Unquote(field.Tag.Value)
+		}
+		qbsTag := reflect.StructTag(tag).Get(qbs.TagKey)
+		if qbsTag == "-" {
+			continue
+		}
+		if len(field.Names) == 0 {
+			embedded, err := g.embedded(structType, field.Type, depth, expanding)
+			if err != nil {
+				return nil, err
+			}
+			if embedded != nil {
+				fields = append(fields, embedded...)
+				continue
+			}
+		}
+		json := false
+		for _, option := range strings.Split(qbsTag, ",") {
+			json = json || option == "json"
+		}
+		if !json && !isColumnType(field.Type, g.isTime(structType, field.Type)) {
+			continue
+		}
+		column := ""
+		for _, key := range g.columnTags {
+			if column = strings.SplitN(reflect.StructTag(tag).Get(key), ",", 2)[0]; column != "" {
+				break
+			}
+		}
+		if column == "-" {
+			continue
+		}
+		typ := ""
+		if !json {
+			typ = g.typeString(structType, field.Type)
+		}
+		names := field.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{ast.NewIdent(types.ExprString(field.Type)[strings.LastIndex(types.ExprString(field.Type), ".")+1:])}
+		}
+		for _, ident := range names {
+			if !ident.IsExported() {
+				continue
+			}
+			name := column
+			if name == "" {
+				name = qbs.FieldNameToColumnName(ident.Name)
+			}
+			fields = append(fields, &columnField{ident.Name, name, typ, depth})
+		}
+	}
+	return fields, nil
+}
+
+// embedded returns the columns of an embedded struct of the files, nil if the embedded type is not a struct
+// of the files, like time.Time.
+func (g *generator) embedded(structType *ast.StructType, expr ast.Expr, depth int, expanding map[string]bool) ([]*columnField, error) {
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		if sel, ok := expr.(*ast.SelectorExpr); ok && !g.isTime(structType, sel) {
+			return nil, fmt.Errorf("the embedded struct %v is not in the files", types.ExprString(sel))
+		}
+		return nil, nil
+	}
+	embeddedType, ok := g.structs[ident.Name]
+	if !ok {
+		return nil, nil
+	}
+	if expanding[ident.Name] {
+		return nil, fmt.Errorf("struct %v embeds itself", ident.Name)
+	}
+	expanding[ident.Name] = true
+	defer delete(expanding, ident.Name)
+	return g.columnsOf(embeddedType, depth+1, expanding)
+}
+
+// isTime reports if the type of a field of the struct is time.Time or *time.Time, by the imports of its file.
+func (g *generator) isTime(structType *ast.StructType, expr ast.Expr) bool {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && sel.Sel.Name == "Time" && g.fileImport[structType][pkg.Name] == "time"
+}
+
+// typeString returns the type of the values of a field, the element type of a pointer,
+// and records the imports it refers to.
+func (g *generator) typeString(structType *ast.StructType, expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if pkg, ok := sel.X.(*ast.Ident); ok {
+				if path, ok := g.fileImport[structType][pkg.Name]; ok {
+					g.imports[pkg.Name] = path
+				}
+			}
+			return false
+		}
+		return true
+	})
+	return types.ExprString(expr)
+}
+
+// promoted returns the fields which are not hidden by fields of the same name in shallower structs,
+// like the promoted fields of Go.
+func promoted(fields []*columnField) []*columnField {
+	depths := make(map[string]int)
+	counts := make(map[string]int)
+	for _, f := range fields {
+		if d, ok := depths[f.name]; !ok || f.depth < d {
+			depths[f.name], counts[f.name] = f.depth, 1
+		} else if f.depth == d {
+			counts[f.name]++
+		}
+	}
+	var result []*columnField
+	for _, f := range fields {
+		if f.depth == depths[f.name] && counts[f.name] == 1 {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// isColumnType reports if a field type is stored in a column, join struct pointers, maps and slices
+// other than []byte are not.
+func isColumnType(expr ast.Expr, isTime bool) bool {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		if isTime {
+			return true
+		}
+		ident, ok := t.X.(*ast.Ident)
+		if !ok {
+			return false
+		}
+		switch ident.Name {
+		case "bool", "string", "int64", "float64":
+			return true
+		}
+		return false
+	case *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType, *ast.StructType:
+		return false
+	case *ast.ArrayType:
+		ident, ok := t.Elt.(*ast.Ident)
+		return t.Len == nil && ok && (ident.Name == "byte" || ident.Name == "uint8")
+	}
+	return true
+}
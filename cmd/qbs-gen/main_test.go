@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const models = `package models
+
+import (
+	"database/sql"
+	stdtime "time"
+)
+
+type timestamps struct {
+	Created stdtime.Time
+	Updated *stdtime.Time
+}
+
+type User struct {
+	Id      int64
+	Email   string ` + "`db:\"email_address\"`" + `
+	Nick    sql.NullString
+	Tags    map[string]string ` + "`qbs:\"json\"`" + `
+	Skip    string ` + "`qbs:\"-\"`" + `
+	Manager *User
+	timestamps
+	Updated string
+}
+`
+
+func TestGenerateColumns(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "models.go")
+	if err := os.WriteFile(file, []byte(models), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := generateColumns([]string{file}, "", []string{"db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"\t\"database/sql\"\n\tstdtime \"time\"\n",
+		"Email:   userEmailColumn{\"email_address\"},",
+		"Tags:    \"tags\",",
+		"func (c userNickColumn) Eq(value sql.NullString) *qbs.Condition {",
+		"func (c userCreatedColumn) Gt(value stdtime.Time) *qbs.Condition {",
+		"func (c userUpdatedColumn) In(values ...string) *qbs.Condition {",
+	} {
+		if !strings.Contains(string(src), expected) {
+			t.Errorf("the generated code doesn't contain %q:\n%s", expected, src)
+		}
+	}
+	for _, unexpected := range []string{"Skip", "Manager"} {
+		if strings.Contains(string(src), unexpected) {
+			t.Errorf("the generated code contains %v:\n%s", unexpected, src)
+		}
+	}
+}
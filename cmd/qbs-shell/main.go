@@ -0,0 +1,18 @@
+// Command qbs-shell is a REPL to inspect and change the rows of qbs models.
+//
+//	qbs-shell -driver postgres -dsn "user=app dbname=app sslmode=disable" -db app
+//
+// The models are the ones registered by shell.Register, so build a copy of this command which also imports
+// the packages registering the models of the application, e.g. `_ "example.com/app/models"`.
+// Type help in the shell for its commands.
+package main
+
+import (
+	_ "github.com/coocood/mysql"
+	"github.com/coocood/qbs/shell"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	shell.Main()
+}
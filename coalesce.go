@@ -0,0 +1,103 @@
+package qbs
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// CoalesceStats counts the Find and FindAll queries of transactions with coalescing enabled.
+type CoalesceStats struct {
+	Queries int64 // queries issued in transactions
+	Saved   int64 // queries served from the cache, the round trips saved
+}
+
+type queryCache struct {
+	results map[string][]reflect.Value
+	stats   CoalesceStats
+}
+
+// SetCoalesce makes an identical Find or FindAll query in a transaction return the rows of the previous one
+// instead of querying the database again, until a statement other than SELECT runs or the transaction ends.
+// Joined structs of the returned rows are shared with the cached rows.
+func (q *Qbs) SetCoalesce(enabled bool) {
+	if !enabled {
+		q.coalesce = nil
+	} else if q.coalesce == nil {
+		q.coalesce = &queryCache{results: make(map[string][]reflect.Value)}
+	}
+}
+
+// CoalesceStats returns the counters since coalescing was enabled.
+func (q *Qbs) CoalesceStats() CoalesceStats {
+	if q.coalesce == nil {
+		return CoalesceStats{}
+	}
+	return q.coalesce.stats
+}
+
+// coalesceKey returns the cache key of the query, empty if the query should not be cached.
+func (q *Qbs) coalesceKey(out interface{}, query string, args []interface{}) string {
+	if q.coalesce == nil || q.tx == nil {
+		return ""
+	}
+	q.coalesce.stats.Queries++
+	return fmt.Sprintf("%T %v %#v", out, query, args)
+}
+
+// invalidate empties the cache if the statement may change rows.
+func (c *queryCache) invalidate(query string) {
+	if firstKeyword(query) != "SELECT" {
+		c.reset()
+	}
+}
+
+func (c *queryCache) reset() {
+	if c != nil && len(c.results) > 0 {
+		c.results = make(map[string][]reflect.Value)
+	}
+}
+
+// fillRow copies the cached row into the struct pointer.
+func (c *queryCache) fillRow(key string, rowValue reflect.Value) (bool, error) {
+	rows, ok := c.results[key]
+	if !ok {
+		return false, nil
+	}
+	c.stats.Saved++
+	if len(rows) == 0 {
+		return true, sql.ErrNoRows
+	}
+	rowValue.Elem().Set(rows[0].Elem())
+	return true, nil
+}
+
+// fillRows appends copies of the cached rows to the slice.
+func (c *queryCache) fillRows(key string, sliceValue reflect.Value) bool {
+	rows, ok := c.results[key]
+	if !ok {
+		return false
+	}
+	c.stats.Saved++
+	for _, row := range rows {
+		sliceValue.Set(reflect.Append(sliceValue, copyRow(row)))
+	}
+	return true
+}
+
+func (c *queryCache) store(key string, rows []reflect.Value) {
+	if key == "" {
+		return
+	}
+	copies := make([]reflect.Value, len(rows))
+	for i, row := range rows {
+		copies[i] = copyRow(row)
+	}
+	c.results[key] = copies
+}
+
+func copyRow(row reflect.Value) reflect.Value {
+	c := reflect.New(row.Type().Elem())
+	c.Elem().Set(row.Elem())
+	return c
+}
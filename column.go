@@ -0,0 +1,50 @@
+package qbs
+
+// Column is a snakecase column name, the qbs-gen command generates a column embedding Column for every field
+// of a model, whose condition methods take values of the type of the field, so conditions and orders can be written
+// without string literals, e.g. UserCols.Email.Eq(email).
+type Column string
+
+func (c Column) String() string {
+	return string(c)
+}
+
+func (c Column) Eq(value interface{}) *Condition {
+	return NewEqualCondition(string(c), value)
+}
+
+func (c Column) Ne(value interface{}) *Condition {
+	return NewCondition(string(c)+" <> ?", value)
+}
+
+func (c Column) Gt(value interface{}) *Condition {
+	return NewCondition(string(c)+" > ?", value)
+}
+
+func (c Column) Ge(value interface{}) *Condition {
+	return NewCondition(string(c)+" >= ?", value)
+}
+
+func (c Column) Lt(value interface{}) *Condition {
+	return NewCondition(string(c)+" < ?", value)
+}
+
+func (c Column) Le(value interface{}) *Condition {
+	return NewCondition(string(c)+" <= ?", value)
+}
+
+func (c Column) Like(pattern string) *Condition {
+	return NewCondition(string(c)+" LIKE ?", pattern)
+}
+
+func (c Column) In(values ...interface{}) *Condition {
+	return NewInCondition(string(c), values)
+}
+
+func (c Column) IsNull() *Condition {
+	return NewCondition(string(c) + " IS NULL")
+}
+
+func (c Column) IsNotNull() *Condition {
+	return NewCondition(string(c) + " IS NOT NULL")
+}
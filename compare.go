@@ -0,0 +1,111 @@
+package qbs
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"time"
+)
+
+// The number of rows of each checksum chunk in CompareTables.
+var CompareChunkSize = 1000
+
+// ChunkMismatch is a primary key range whose rows differ between the compared tables.
+type ChunkMismatch struct {
+	AfterPk interface{} // the range starts after it, nil for the first range
+	LastPk  interface{} // the last primary key of the range
+	Rows1   int         // rows of the range in the first table
+	Rows2   int         // rows of the range in the second table
+}
+
+// CompareTables computes checksums of chunks of CompareChunkSize rows ordered by primary key on the tables of
+// the struct pointer in the two databases and returns the primary key ranges whose checksums don't match.
+// It's meant to verify an online migration, shadow writes or a copy between databases.
+// The ranges are read one at a time in the order of the first database, the rows of a range of the second
+// database are selected by the bounds of the range, so both databases compare the keys themselves.
+func CompareTables(q1, q2 *Qbs, structPtr interface{}) ([]*ChunkMismatch, error) {
+	model := structPtrToNamedModel(structPtr, false, nil, q1.naming())
+	if model.pk == nil {
+		return nil, errors.New("table " + model.table + " has no primary key to compare by")
+	}
+	var mismatches []*ChunkMismatch
+	var after interface{}
+	for {
+		sum1, rows1, last, err := chunkChecksum(q1, structPtr, model, after, nil)
+		if err != nil {
+			return nil, err
+		}
+		if rows1 == 0 {
+			break
+		}
+		sum2, rows2, _, err := chunkChecksum(q2, structPtr, model, after, last)
+		if err != nil {
+			return nil, err
+		}
+		if sum1 != sum2 || rows1 != rows2 {
+			mismatches = append(mismatches, &ChunkMismatch{after, last, rows1, rows2})
+		}
+		after = last
+	}
+	for { //the rows of the second table after the last one of the first.
+		_, rows2, last, err := chunkChecksum(q2, structPtr, model, after, nil)
+		if err != nil {
+			return nil, err
+		}
+		if rows2 == 0 {
+			return mismatches, nil
+		}
+		mismatches = append(mismatches, &ChunkMismatch{after, last, 0, rows2})
+		after = last
+	}
+}
+
+// chunkChecksum iterates the rows of the table ordered by primary key after the after key, all of them if it's nil,
+// up to the last key, or CompareChunkSize rows if it's nil. It returns the checksum and the number of the rows,
+// and the last primary key read.
+func chunkChecksum(q *Qbs, structPtr interface{}, model *model, after, last interface{}) (sum uint64, rows int, lastPk interface{}, err error) {
+	pk := q.Dialect.quote(model.pk.name)
+	var condition *Condition
+	if after != nil {
+		condition = NewCondition(pk+" > ?", after)
+	}
+	if last != nil && condition != nil {
+		condition.And(pk+" <= ?", last)
+	} else if last != nil {
+		condition = NewCondition(pk+" <= ?", last)
+	}
+	q.Unscoped().OmitJoin().OrderBy(model.pk.name)
+	if condition != nil {
+		q.Condition(condition)
+	}
+	if last == nil {
+		q.Limit(CompareChunkSize)
+	}
+	row := reflect.New(reflect.TypeOf(structPtr).Elem())
+	err = q.Iterate(row.Interface(), func() error {
+		h := fnv.New64a()
+		for _, f := range model.fields {
+			fmt.Fprint(h, valueString(row.Elem().FieldByName(f.camelName)), "|")
+		}
+		sum += h.Sum64() //the sum doesn't depend on the order of the rows of equal keys in the two databases.
+		rows++
+		lastPk = row.Elem().FieldByName(model.pk.camelName).Interface()
+		return nil
+	})
+	return sum, rows, lastPk, err
+}
+
+// valueString formats a field value the same way for every database, times are converted to UTC.
+func valueString(value reflect.Value) string {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return "NULL"
+		}
+		value = value.Elem()
+	}
+	if t, ok := value.Interface().(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value.Interface())
+}
@@ -0,0 +1,123 @@
+package qbs
+
+import (
+	"database/sql"
+)
+
+// Config is a registered database: the driver, the data source, the database name, the dialect and
+// the connection pool. Register sets the package level default used by GetQbs and GetMigration,
+// a library embedding qbs can create its own by NewConfig, which leaves the default of the application alone.
+type Config struct {
+	Driver       string
+	DriverSource string
+	DbName       string
+	Dialect      Dialect
+	database     *database
+}
+
+var defaultConfig *Config
+
+// NewConfig opens a connection pool of the database without registering it as the default.
+func NewConfig(driverName, driverSourceName, databaseName string, dialect Dialect) (*Config, error) {
+	sqlDb, err := sql.Open(driverName, driverSourceName)
+	if err != nil {
+		return nil, err
+	}
+	c := NewConfigWithDb(driverName, sqlDb, databaseName, dialect)
+	c.DriverSource = driverSourceName
+	c.database.cacheName = dsnCacheName(driverName, driverSourceName)
+	return c, nil
+}
+
+func NewConfigWithDb(driverName string, sqlDb *sql.DB, databaseName string, dialect Dialect) *Config {
+	return &Config{
+		Driver:   driverName,
+		DbName:   databaseName,
+		Dialect:  dialect,
+		database: databaseOf(sqlDb, dialect),
+	}
+}
+
+// SetCacheName names the database in the keys of the row and query caches, so the rows of databases with
+// the same tables don't collide. It is a hash of the data source name if the Config opened the database,
+// or else the address of the connection pool, so set it in every process sharing a cache like Redis.
+func (c *Config) SetCacheName(name string) {
+	c.database.cacheName = name
+}
+
+// DB returns the connection pool of the database.
+func (c *Config) DB() *sql.DB {
+	return c.database.db
+}
+
+// GetQbs returns a Qbs working on the database of the Config, it is not counted by SetConnectionLimit,
+// which limits the default database.
+func (c *Config) GetQbs() (*Qbs, error) {
+	q := new(Qbs)
+	q.Dialect = c.Dialect
+	q.database = c.database
+	q.criteria = new(criteria)
+	q.borrowed = true
+	return q, nil
+}
+
+// GetMigration returns a Migration working on the database of the Config, closing it keeps the pool open.
+func (c *Config) GetMigration() (*Migration, error) {
+	return &Migration{db: c.database.db, dbName: c.DbName, dialect: c.Dialect, shared: true}, nil
+}
+
+// Close closes the connection pool and the statements prepared on it.
+func (c *Config) Close() error {
+	c.database.closeStmts()
+	databasesMu.Lock()
+	delete(databases, c.database.db)
+	databasesMu.Unlock()
+	return c.database.db.Close()
+}
+
+// RegisterNamed registers a database by name besides the default one, e.g. an analytics or a tenant database,
+// GetQbsFor and GetMigrationFor work on it, and UseDatabase routes models to it.
+// Registering a name again replaces the database, the pool of the old one is left open.
+func RegisterNamed(name, driverName, driverSourceName, databaseName string, dialect Dialect) *Config {
+	c, err := NewConfig(driverName, driverSourceName, databaseName, dialect)
+	if err != nil {
+		panic(err)
+	}
+	return registerConfig(name, c)
+}
+
+func RegisterNamedWithDb(name, driverName string, database *sql.DB, databaseName string, dialect Dialect) *Config {
+	return registerConfig(name, NewConfigWithDb(driverName, database, databaseName, dialect))
+}
+
+func registerConfig(name string, c *Config) *Config {
+	modelDatabasesMu.Lock()
+	defer modelDatabasesMu.Unlock()
+	namedConfigs[name] = c
+	return c
+}
+
+// NamedConfig returns the database registered by the name, nil if there is none.
+func NamedConfig(name string) *Config {
+	modelDatabasesMu.RLock()
+	defer modelDatabasesMu.RUnlock()
+	return namedConfigs[name]
+}
+
+func mustNamedConfig(name string) *Config {
+	c := NamedConfig(name)
+	if c == nil {
+		panic("database " + name + " has not been registered, should call RegisterNamed first.")
+	}
+	return c
+}
+
+// GetQbsFor returns a Qbs working on the database registered by the name, should call `defer q.Close()` next.
+func GetQbsFor(name string) (*Qbs, error) {
+	return mustNamedConfig(name).GetQbs()
+}
+
+// GetMigrationFor returns a Migration working on the database registered by the name.
+func GetMigrationFor(name string) (*Migration, error) {
+	return mustNamedConfig(name).GetMigration()
+}
@@ -0,0 +1,59 @@
+package qbs
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	assert := NewAssert(t)
+	sqlDb := new(sql.DB)
+	c := NewConfigWithDb("postgres", sqlDb, "analytics", NewPostgres())
+	assert.True(c.DB() == sqlDb)
+	q, err := c.GetQbs()
+	assert.MustNil(err)
+	assert.True(q.database == c.database)
+	assert.True(q.Dialect == c.Dialect)
+	mg, err := c.GetMigration()
+	assert.MustNil(err)
+	assert.Equal("analytics", mg.dbName)
+	assert.True(mg.db == sqlDb)
+	mg.Close()
+	assert.True(q.database == databaseOf(sqlDb, c.Dialect))
+}
+
+func TestRegisterNamed(t *testing.T) {
+	assert := NewAssert(t)
+	sqlDb := new(sql.DB)
+	c := RegisterNamedWithDb("tenant_a", "postgres", sqlDb, "tenant_a", NewPostgres())
+	assert.True(NamedConfig("tenant_a") == c)
+	assert.True(NamedConfig("tenant_b") == nil)
+	q, err := GetQbsFor("tenant_a")
+	assert.MustNil(err)
+	assert.True(q.database == c.database)
+	mg, err := GetMigrationFor("tenant_a")
+	assert.MustNil(err)
+	assert.Equal("tenant_a", mg.dbName)
+	assert.True(mg.db == sqlDb)
+	RegisterDatabaseWithDb("tenant_b", new(sql.DB), NewMysql())
+	assert.Equal("", NamedConfig("tenant_b").DbName)
+}
+
+func TestRegisterWithDbKeepsLimits(t *testing.T) {
+	assert := NewAssert(t)
+	savedDb, savedDriver, savedDial, savedDatabase, savedConfig := db, driver, dial, defaultDatabase, defaultConfig
+	defer func() {
+		db, driver, dial, defaultDatabase, defaultConfig = savedDb, savedDriver, savedDial, savedDatabase, savedConfig
+		connectionLimitsSet = false
+		maxOpenConns, maxIdleConns, connMaxLifetime = 0, 100, 0
+	}()
+	sqlDb := new(sql.DB)
+	sqlDb.SetMaxOpenConns(7)
+	RegisterWithDb("postgres", sqlDb, NewPostgres())
+	assert.Equal(7, sqlDb.Stats().MaxOpenConnections)
+	SetConnectionLimits(3, 2, 0)
+	assert.Equal(3, sqlDb.Stats().MaxOpenConnections)
+	other := new(sql.DB)
+	RegisterWithDb("postgres", other, NewPostgres())
+	assert.Equal(3, other.Stats().MaxOpenConnections)
+}
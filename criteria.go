@@ -1,20 +1,30 @@
 package qbs
 
+import (
+	"strings"
+)
+
 type criteria struct {
-	model      *model
-	condition  *Condition
-	orderBys   []order
-	limit      int
-	offset     int
-	omitFields []string
-	omitJoin   bool
+	model         *model
+	condition     *Condition
+	orderBys      []order
+	groupBys      []string   //quoted, set by GroupBy
+	having        *Condition //set by Having
+	limit         int
+	offset        int
+	omitFields    []string
+	includeZero   []string //set by IncludeZero
+	omitJoin      bool
+	structPtr     interface{} //set by Qbs.Model for ToSQL
+	unscoped      bool        //include soft deleted rows
+	samplePercent float64     //set by SamplePercent
+	spill         bool        //set by Spill
+	returning     bool        //set by Returning
 }
 
 func (c *criteria) mergePkCondition(d Dialect) {
-	var con *Condition
-	if !c.model.pkZero() {
-		expr := d.quote(c.model.pk.name) + " = ?"
-		con = NewCondition(expr, c.model.pk.value)
+	con := c.model.pkCondition(d, false)
+	if con != nil {
 		con.AndCondition(c.condition)
 	} else {
 		con = c.condition
@@ -62,6 +72,66 @@ func NewInCondition(column string, values []interface{}) *Condition {
 	}
 }
 
+// NewTupleCondition compares a tuple of columns with a tuple of values using row value syntax,
+// e.g. NewTupleCondition([]string{"a", "b"}, ">", 1, 2) generates "(a, b) > (?, ?)".
+// Supported operators are "=", "<>", "<", "<=", ">" and ">=".
+func NewTupleCondition(columns []string, op string, values ...interface{}) *Condition {
+	checkTuple(columns, op, values)
+	markers := make([]string, len(columns))
+	for i := range markers {
+		markers[i] = "?"
+	}
+	expr := "(" + strings.Join(columns, ", ") + ") " + op + " (" + strings.Join(markers, ", ") + ")"
+	return NewCondition(expr, values...)
+}
+
+// NewExpandedTupleCondition is the same as NewTupleCondition but expands the comparison to plain boolean logic,
+// for databases which do not support row values, e.g. "(a, b) > (?, ?)" becomes "(a > ?) OR (a = ? AND b > ?)".
+func NewExpandedTupleCondition(columns []string, op string, values ...interface{}) *Condition {
+	checkTuple(columns, op, values)
+	switch op {
+	case "=", "<>":
+		parts := make([]string, len(columns))
+		for i, column := range columns {
+			parts[i] = column + " " + op + " ?"
+		}
+		join := " AND "
+		if op == "<>" {
+			join = " OR "
+		}
+		return NewCondition(strings.Join(parts, join), values...)
+	}
+	strict := op[:1]
+	ors := make([]string, 0, len(columns))
+	args := make([]interface{}, 0, len(columns)*(len(columns)+1)/2)
+	for i, column := range columns {
+		ands := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, columns[j]+" = ?")
+			args = append(args, values[j])
+		}
+		last := strict
+		if i == len(columns)-1 {
+			last = op
+		}
+		ands = append(ands, column+" "+last+" ?")
+		args = append(args, values[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return NewCondition(strings.Join(ors, " OR "), args...)
+}
+
+func checkTuple(columns []string, op string, values []interface{}) {
+	if len(columns) == 0 || len(columns) != len(values) {
+		panic("tuple columns and values should have the same non-zero length")
+	}
+	switch op {
+	case "=", "<>", "<", "<=", ">", ">=":
+	default:
+		panic("unsupported tuple comparison operator " + op)
+	}
+}
+
 func (c *Condition) And(expr string, args ...interface{}) *Condition {
 	if c.sub != nil {
 		c.expr, c.args = c.Merge()
@@ -130,6 +200,46 @@ func (c *Condition) Merge() (expr string, args []interface{}) {
 	return expr, args
 }
 
+// Cond is a short name for NewCondition, for composing conditions with AllOf, AnyOf and Not, e.g.
+// q.Condition(qbs.AnyOf(qbs.AllOf(qbs.Cond("age > ?", 18), qbs.Cond("name LIKE ?", "a%")), qbs.Not(qbs.Cond("vip"))))
+func Cond(expr string, args ...interface{}) *Condition {
+	return NewCondition(expr, args...)
+}
+
+// AllOf combines the conditions with AND, every condition is parenthesized.
+func AllOf(conditions ...*Condition) *Condition {
+	return joinConditions(" AND ", conditions)
+}
+
+// AnyOf combines the conditions with OR, every condition is parenthesized.
+func AnyOf(conditions ...*Condition) *Condition {
+	return joinConditions(" OR ", conditions)
+}
+
+// Not negates the condition.
+func Not(condition *Condition) *Condition {
+	expr, args := condition.Merge()
+	return NewCondition("NOT ("+expr+")", args...)
+}
+
+func joinConditions(op string, conditions []*Condition) *Condition {
+	if len(conditions) == 0 {
+		panic("no condition to combine")
+	}
+	if len(conditions) == 1 {
+		expr, args := conditions[0].Merge()
+		return NewCondition(expr, args...)
+	}
+	exprs := make([]string, 0, len(conditions))
+	var args []interface{}
+	for _, c := range conditions {
+		expr, cArgs := c.Merge()
+		exprs = append(exprs, "("+expr+")")
+		args = append(args, cArgs...)
+	}
+	return NewCondition(strings.Join(exprs, op), args...)
+}
+
 //Used for in condition.
 func StringsToInterfaces(strs ...string) []interface{} {
 	ret := make([]interface{}, len(strs))
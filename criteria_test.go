@@ -0,0 +1,56 @@
+package qbs
+
+import (
+	"testing"
+)
+
+func TestTupleCondition(t *testing.T) {
+	assert := NewAssert(t)
+	expr, args := NewTupleCondition([]string{"a", "b"}, ">", 1, 2).Merge()
+	assert.Equal("(a, b) > (?, ?)", expr)
+	assert.Equal(2, len(args))
+
+	expr, args = NewExpandedTupleCondition([]string{"a", "b", "c"}, ">=", 1, 2, 3).Merge()
+	assert.Equal("(a > ?) OR (a = ? AND b > ?) OR (a = ? AND b = ? AND c >= ?)", expr)
+	assert.Equal("[1 1 2 1 2 3]", args)
+
+	expr, args = NewExpandedTupleCondition([]string{"a", "b"}, "<>", 1, 2).Merge()
+	assert.Equal("a <> ? OR b <> ?", expr)
+	assert.Equal(2, len(args))
+}
+
+func TestTopNOrders(t *testing.T) {
+	assert := NewAssert(t)
+	type membership struct {
+		UserId  int64 `qbs:"pk"`
+		GroupId int64 `qbs:"pk"`
+		Rank    int64
+	}
+	crit := &criteria{model: structPtrToModel(new(membership), false, nil)}
+	assert.Equal("[{user_id true} {group_id true}]", topNOrders(crit))
+	crit.orderBys = []order{{"group_id", false}, {"rank", true}}
+	assert.Equal("[{group_id false} {rank true} {user_id false}]", topNOrders(crit))
+}
+
+func TestColumn(t *testing.T) {
+	assert := NewAssert(t)
+	email := Column("email")
+	expr, args := email.Eq("a").Merge()
+	assert.Equal("email = ?", expr)
+	assert.Equal(1, len(args))
+	expr, args = email.In("a", "b").Merge()
+	assert.Equal("email IN (?, ?)", expr)
+	assert.Equal(2, len(args))
+	expr, _ = email.IsNull().Merge()
+	assert.Equal("email IS NULL", expr)
+}
+
+func TestComposeConditions(t *testing.T) {
+	assert := NewAssert(t)
+	c := AnyOf(AllOf(Cond("age > ?", 18), Cond("name LIKE ?", "a%")), Not(Cond("vip = ?", true)))
+	expr, args := c.Merge()
+	assert.Equal("((age > ?) AND (name LIKE ?)) OR (NOT (vip = ?))", expr)
+	assert.Equal(3, len(args))
+	expr, _ = AllOf(Cond("a = 1")).And("b = 2").Merge()
+	assert.Equal("(a = 1) AND (b = 2)", expr)
+}
@@ -0,0 +1,248 @@
+package qbs
+
+import (
+	"database/sql"
+	"reflect"
+	"sort"
+	"sync"
+	"text/template"
+)
+
+// ColumnInfo describes a column of a model for DialectHooks.
+type ColumnInfo struct {
+	Name     string
+	Value    interface{} // the zero or current value of the struct field
+	Pk       bool
+	NotNull  bool
+	Size     int
+	Default  string
+	ColType  string       // the coltype tag
+	Nullable reflect.Kind // the element kind of a pointer field, reflect.Invalid if the field is not a pointer
+}
+
+func columnInfo(f modelField) ColumnInfo {
+	return ColumnInfo{f.name, f.value, f.pk, f.notnull, f.size, f.dfault, f.colType, f.nullable}
+}
+
+// DialectHooks overrides parts of an existing dialect, a nil hook keeps the behavior of the parent dialect.
+// Identifiers passed to the hooks are unquoted.
+type DialectHooks struct {
+	Quote               func(identifier string) string
+	SubstituteMarkers   func(query string) string
+	SqlType             func(column ColumnInfo) string
+	TypeMapper          func(goType reflect.Type) string // the declared type of the field, "" keeps the type of SqlType or the parent dialect
+	PrimaryKeySql       func(isString bool, size int) string
+	CreateTableSql      func(table string, columns []ColumnInfo, ifNotExists bool) string
+	CreateTableTemplate string // a text/template of the CREATE TABLE statement executed with CreateTableData
+	DropTableSql        func(table string) string
+	AddColumnSql        func(table string, column ColumnInfo) string
+	CreateIndexSql      func(name, table string, unique bool, columns ...string) string
+	IndexExists         func(db *sql.DB, dbName, table, index string) bool
+	ColumnsInTable      func(db *sql.DB, dbName, table string) map[string]bool
+	CatchMigrationError func(err error) bool
+	SupportsRowValues   func() bool
+	RandomSql           func() string
+	TableSampleSql      func(percent float64) string
+	LockSql             func() (lock string, unlock string)
+}
+
+// CreateTableData is the data of DialectHooks.CreateTableTemplate, e.g. the template
+// "{{.Sql}} WITH (fillfactor = 70)" adds storage parameters to the statement of the parent dialect.
+type CreateTableData struct {
+	Table       string // quoted
+	Definitions string // the column definitions and constraints inside the parentheses
+	IfNotExists bool
+	Sql         string // the statement of the parent dialect
+}
+
+// NewDialect builds a dialect for another database, like MSSQL or CockroachDB, from a parent dialect
+// whose SQL is mostly compatible, e.g. NewDialect(NewPostgres(), DialectHooks{...}).
+// The parent should be a new instance, it calls the hooks from then on.
+// It panics if a template of the hooks can't be parsed.
+func NewDialect(parent Dialect, hooks DialectHooks) Dialect {
+	d := &hookedDialect{Dialect: parent, hooks: hooks}
+	if hooks.CreateTableTemplate != "" {
+		d.createTable = template.Must(template.New("create table").Parse(hooks.CreateTableTemplate))
+	}
+	if b, ok := parent.(interface {
+		setDialect(Dialect)
+	}); ok {
+		b.setDialect(d)
+	}
+	return d
+}
+
+func (d *base) setDialect(dialect Dialect) {
+	d.dialect = dialect
+}
+
+type hookedDialect struct {
+	Dialect
+	hooks       DialectHooks
+	createTable *template.Template
+}
+
+func (d *hookedDialect) quote(s string) string {
+	if d.hooks.Quote != nil {
+		return d.hooks.Quote(s)
+	}
+	return d.Dialect.quote(s)
+}
+
+func (d *hookedDialect) substituteMarkers(query string) string {
+	if d.hooks.SubstituteMarkers != nil {
+		return d.hooks.SubstituteMarkers(query)
+	}
+	return d.Dialect.substituteMarkers(query)
+}
+
+func (d *hookedDialect) sqlType(field modelField) string {
+	if d.hooks.TypeMapper != nil && field.customColType() == "" {
+		goType := field.goType
+		if goType == nil {
+			goType = reflect.TypeOf(field.value)
+		}
+		if t := d.hooks.TypeMapper(goType); t != "" {
+			return t
+		}
+	}
+	if d.hooks.SqlType != nil {
+		return d.hooks.SqlType(columnInfo(field))
+	}
+	return d.Dialect.sqlType(field)
+}
+
+func (d *hookedDialect) primaryKeySql(isString bool, size int) string {
+	if d.hooks.PrimaryKeySql != nil {
+		return d.hooks.PrimaryKeySql(isString, size)
+	}
+	return d.Dialect.primaryKeySql(isString, size)
+}
+
+func (d *hookedDialect) createTableSql(model *model, ifNotExists bool) string {
+	if d.hooks.CreateTableSql != nil {
+		columns := make([]ColumnInfo, len(model.fields))
+		for i, f := range model.fields {
+			columns[i] = columnInfo(*f)
+		}
+		return d.hooks.CreateTableSql(model.table, columns, ifNotExists)
+	}
+	if d.createTable != nil {
+		data := CreateTableData{
+			Table:       d.quote(model.table),
+			Definitions: d.Dialect.tableDefinitionsSql(model),
+			IfNotExists: ifNotExists,
+			Sql:         d.Dialect.createTableSql(model, ifNotExists),
+		}
+		buf := getBuffer()
+		defer putBuffer(buf)
+		if err := d.createTable.Execute(buf, data); err != nil {
+			panic(err)
+		}
+		return buf.String()
+	}
+	return d.Dialect.createTableSql(model, ifNotExists)
+}
+
+func (d *hookedDialect) dropTableSql(table string) string {
+	if d.hooks.DropTableSql != nil {
+		return d.hooks.DropTableSql(table)
+	}
+	return d.Dialect.dropTableSql(table)
+}
+
+func (d *hookedDialect) addColumnSql(table string, column modelField) string {
+	if d.hooks.AddColumnSql != nil {
+		return d.hooks.AddColumnSql(table, columnInfo(column))
+	}
+	return d.Dialect.addColumnSql(table, column)
+}
+
+func (d *hookedDialect) createIndexSql(name, table string, unique bool, columns ...string) string {
+	if d.hooks.CreateIndexSql != nil {
+		return d.hooks.CreateIndexSql(name, table, unique, columns...)
+	}
+	return d.Dialect.createIndexSql(name, table, unique, columns...)
+}
+
+func (d *hookedDialect) indexExists(mg *Migration, tableName string, indexName string) bool {
+	if d.hooks.IndexExists != nil {
+		return d.hooks.IndexExists(mg.db, mg.dbName, tableName, indexName)
+	}
+	return d.Dialect.indexExists(mg, tableName, indexName)
+}
+
+func (d *hookedDialect) columnsInTable(mg *Migration, table interface{}) map[string]bool {
+	if d.hooks.ColumnsInTable != nil {
+		return d.hooks.ColumnsInTable(mg.db, mg.dbName, namedTableName(table, mg.naming()))
+	}
+	return d.Dialect.columnsInTable(mg, table)
+}
+
+func (d *hookedDialect) catchMigrationError(err error) bool {
+	if d.hooks.CatchMigrationError != nil {
+		return d.hooks.CatchMigrationError(err)
+	}
+	return d.Dialect.catchMigrationError(err)
+}
+
+func (d *hookedDialect) supportsRowValues() bool {
+	if d.hooks.SupportsRowValues != nil {
+		return d.hooks.SupportsRowValues()
+	}
+	return d.Dialect.supportsRowValues()
+}
+
+func (d *hookedDialect) randomSql() string {
+	if d.hooks.RandomSql != nil {
+		return d.hooks.RandomSql()
+	}
+	return d.Dialect.randomSql()
+}
+
+func (d *hookedDialect) tableSampleSql(percent float64) string {
+	if d.hooks.TableSampleSql != nil {
+		return d.hooks.TableSampleSql(percent)
+	}
+	return d.Dialect.tableSampleSql(percent)
+}
+
+func (d *hookedDialect) lockSql() (string, string) {
+	if d.hooks.LockSql != nil {
+		return d.hooks.LockSql()
+	}
+	return d.Dialect.lockSql()
+}
+
+var dialects = map[string]Dialect{
+	"mysql":    NewMysql(),
+	"postgres": NewPostgres(),
+	"oracle":   NewOracle(),
+}
+var dialectsMu = new(sync.RWMutex)
+
+// RegisterDialect makes a dialect available by name to DialectByName, typically the database/sql driver name.
+func RegisterDialect(name string, dialect Dialect) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	dialects[name] = dialect
+}
+
+// DialectByName returns the dialect registered by name, nil if there is none.
+func DialectByName(name string) Dialect {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	return dialects[name]
+}
+
+// DialectNames returns the sorted names of the registered dialects.
+func DialectNames() []string {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,90 @@
+package qbs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewDialect(t *testing.T) {
+	assert := NewAssert(t)
+	mssql := NewDialect(NewMysql(), DialectHooks{
+		Quote: func(identifier string) string {
+			return "[" + identifier + "]"
+		},
+		SqlType: func(column ColumnInfo) string {
+			if _, ok := column.Value.(string); ok {
+				return "nvarchar(max)"
+			}
+			return "bigint"
+		},
+	})
+	RegisterDialect("mssql", mssql)
+	assert.Equal(mssql, DialectByName("mssql"))
+	assert.True(DialectByName("none") == nil)
+	assert.Equal("mssql,mysql,oracle,postgres", strings.Join(DialectNames(), ","))
+	model := structPtrToModel(new(addColumnTestTable), false, nil)
+	assert.Equal("ALTER TABLE [add_column_test_table] ADD COLUMN [newc] nvarchar(max)", mssql.addColumnSql(model.table, *model.fields[0]))
+	crit := &criteria{model: structPtrToModel(sqlGenSampleData, false, nil), condition: NewCondition("prim = ?", 3)}
+	sql, _ := mssql.deleteSql(crit)
+	assert.Equal("DELETE FROM [sql_gen_model] WHERE prim = ?", sql)
+}
+
+type customUserId int32
+
+type typeMapperTable struct {
+	Id    int64
+	Owner customUserId
+	Label string `qbs:"coltype:char(8)"`
+}
+
+func TestTypeMapper(t *testing.T) {
+	assert := NewAssert(t)
+	dialect := NewDialect(NewPostgres(), DialectHooks{
+		TypeMapper: func(goType reflect.Type) string {
+			switch goType {
+			case reflect.TypeOf(customUserId(0)):
+				return "bigint"
+			case reflect.TypeOf(""):
+				return "citext"
+			}
+			return ""
+		},
+	})
+	model := structPtrToModel(new(typeMapperTable), false, nil)
+	assert.Equal(`ALTER TABLE "type_mapper_table" ADD COLUMN "owner" bigint`, dialect.addColumnSql(model.table, *model.fields[1]))
+	assert.Equal(`CREATE TABLE "type_mapper_table" ( "id" bigserial PRIMARY KEY, "owner" bigint, "label" char(8) )`,
+		dialect.createTableSql(model, false))
+}
+
+type typeMapperPointers struct {
+	Id   int64
+	Nick *string
+}
+
+func TestTypeMapperNilPointer(t *testing.T) {
+	assert := NewAssert(t)
+	dialect := NewDialect(NewPostgres(), DialectHooks{
+		TypeMapper: func(goType reflect.Type) string {
+			if goType.Kind() == reflect.Ptr && goType.Elem().Kind() == reflect.String {
+				return "citext"
+			}
+			return ""
+		},
+	})
+	model := structPtrToModel(new(typeMapperPointers), false, nil)
+	assert.Equal(`ALTER TABLE "type_mapper_pointers" ADD COLUMN "nick" citext`, dialect.addColumnSql(model.table, *model.fields[1]))
+}
+
+func TestCreateTableTemplate(t *testing.T) {
+	assert := NewAssert(t)
+	model := structPtrToModel(new(typeMapperTable), false, nil)
+	pg := NewDialect(NewPostgres(), DialectHooks{CreateTableTemplate: "{{.Sql}} WITH (fillfactor = 70)"})
+	assert.Equal(`CREATE TABLE IF NOT EXISTS "type_mapper_table" ( "id" bigserial PRIMARY KEY, "owner" integer, "label" char(8) ) WITH (fillfactor = 70)`,
+		pg.createTableSql(model, true))
+	mysql := NewDialect(NewMysql(), DialectHooks{
+		CreateTableTemplate: "CREATE TABLE {{if .IfNotExists}}IF NOT EXISTS {{end}}{{.Table}} ({{.Definitions}}) ENGINE=InnoDB",
+	})
+	assert.Equal("CREATE TABLE `type_mapper_table` (`id` bigint PRIMARY KEY AUTO_INCREMENT, `owner` int, `label` char(8)) ENGINE=InnoDB",
+		mysql.createTableSql(model, false))
+}
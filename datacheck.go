@@ -0,0 +1,97 @@
+package qbs
+
+import (
+	"fmt"
+	"time"
+)
+
+// DataCheck returns the query counting the rows violating a data quality guard of Migration.Assert,
+// custom checks can be written for the queries the Check functions don't cover.
+type DataCheck func(mg *Migration) (query string, args []interface{})
+
+// DataCheckError is returned by Assert if rows violate the named check.
+type DataCheckError struct {
+	Name       string
+	Violations int64
+}
+
+func (e *DataCheckError) Error() string {
+	return fmt.Sprintf("data check %v found %d violations", e.Name, e.Violations)
+}
+
+// Assert runs the named check, and returns a *DataCheckError if rows of the database violate it,
+// e.g. before setting a backfilled column NOT NULL or dropping the old column of a copied one.
+// The check is run in a dry run too, as it doesn't change the database.
+func (mg *Migration) Assert(name string, check DataCheck) error {
+	query, args := check(mg)
+	query = mg.dialect.substituteMarkers(query)
+	var violations int64
+	start := time.Now()
+	err := mg.db.QueryRow(query, args...).Scan(&violations)
+	mg.log(query, args, start, err)
+	if err != nil {
+		return err
+	}
+	if violations > 0 {
+		return &DataCheckError{name, violations}
+	}
+	return nil
+}
+
+// checkedColumn returns the quoted table of the struct and column of the field, it panics if the field has no column.
+func (mg *Migration) checkedColumn(structPtr interface{}, fieldName string) (string, string) {
+	model := structPtrToNamedModel(structPtr, false, nil, mg.naming())
+	column := model.field(fieldName)
+	if column == nil {
+		panic("no column for field " + fieldName + " of table " + model.table)
+	}
+	return mg.dialect.quote(model.table), mg.dialect.quote(column.name)
+}
+
+// CheckWhere is violated by the rows of the table of the struct matching the where clause.
+func CheckWhere(structPtr interface{}, where string, args ...interface{}) DataCheck {
+	return func(mg *Migration) (string, []interface{}) {
+		model := structPtrToNamedModel(structPtr, false, nil, mg.naming())
+		return "SELECT COUNT(*) FROM " + mg.dialect.quote(model.table) + " WHERE " + where, args
+	}
+}
+
+// CheckNotNull is violated by the rows with NULL in the column of the field.
+func CheckNotNull(structPtr interface{}, fieldName string) DataCheck {
+	return func(mg *Migration) (string, []interface{}) {
+		table, column := mg.checkedColumn(structPtr, fieldName)
+		return "SELECT COUNT(*) FROM " + table + " WHERE " + column + " IS NULL", nil
+	}
+}
+
+// CheckRange is violated by the rows with a value of the field below min or above max, NULL is in range.
+func CheckRange(structPtr interface{}, fieldName string, min, max interface{}) DataCheck {
+	return func(mg *Migration) (string, []interface{}) {
+		table, column := mg.checkedColumn(structPtr, fieldName)
+		return "SELECT COUNT(*) FROM " + table + " WHERE " + column + " < ? OR " + column + " > ?", []interface{}{min, max}
+	}
+}
+
+// CheckUnique is violated by the values of the field found in more than one row, it counts the values, not the rows.
+func CheckUnique(structPtr interface{}, fieldName string) DataCheck {
+	return func(mg *Migration) (string, []interface{}) {
+		table, column := mg.checkedColumn(structPtr, fieldName)
+		return "SELECT COUNT(*) FROM (SELECT " + column + " FROM " + table + " WHERE " + column + " IS NOT NULL GROUP BY " +
+			column + " HAVING COUNT(*) > 1) duplicated", nil
+	}
+}
+
+// CheckReferences is violated by the rows whose field refers to no primary key of the table of parentPtr,
+// like a foreign key which isn't enforced by the database.
+func CheckReferences(structPtr interface{}, fieldName string, parentPtr interface{}) DataCheck {
+	return func(mg *Migration) (string, []interface{}) {
+		table, column := mg.checkedColumn(structPtr, fieldName)
+		parent := structPtrToNamedModel(parentPtr, false, nil, mg.naming())
+		if parent.pk == nil {
+			panic("no primary key of table " + parent.table + " to reference")
+		}
+		parentPk := mg.dialect.quote("parent." + parent.pk.name) //aliased, the table may reference itself.
+		return fmt.Sprintf("SELECT COUNT(*) FROM %v LEFT JOIN %v parent ON %v.%v = %v WHERE %v.%v IS NOT NULL AND %v IS NULL",
+			table, mg.dialect.quote(parent.table), table, column, parentPk, table, column, parentPk), nil
+	}
+}
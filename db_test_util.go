@@ -1,8 +1,14 @@
 package qbs
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -238,6 +244,13 @@ func doTestForeignKey(assert *Assert) {
 		assert.MustNil(err)
 		assert.MustEqual(1, len(psts))
 		assert.Equal("john", psts[0].Author.Name)
+
+		var page []*Post
+		info, err := q.Where("author.name = ?", "john").Paginate(1, 10, &page)
+		assert.MustNil(err)
+		assert.Equal(1, info.Total)
+		assert.MustEqual(1, len(page))
+		assert.Equal("john", page[0].Author.Name)
 		return nil
 	})
 }
@@ -516,6 +529,44 @@ func doTestBulkInsert(assert *Assert) {
 	})
 }
 
+// doTestBulkInsertRouted inserts and counts the rows of a model routed by UseDatabase from a Qbs of a closed database.
+func doTestBulkInsertRouted(assert *Assert, driverName string) {
+	setupBasicDb()
+	WithQbs(func(q *Qbs) error {
+		RegisterDatabaseWithDb("routed_basic", q.database.db, q.Dialect)
+		UseDatabase("routed_basic", new(basic))
+		defer UseDatabase("", new(basic))
+		closed, err := sql.Open(driverName, "")
+		assert.MustNil(err)
+		closed.Close()
+		home := newDatabase(closed, q.Dialect)
+		routed := &Qbs{Dialect: home.dialect, database: home, criteria: new(criteria)}
+		err = routed.BulkInsert([]*basic{{Name: "a", State: 1}, {Name: "b", State: 2}})
+		assert.MustNil(err)
+		assert.Equal(2, routed.Count(new(basic)))
+		sum, err := routed.SumInt64(new(basic), "state")
+		assert.MustNil(err)
+		assert.Equal(3, sum)
+		return nil
+	})
+}
+
+func doTestBulkInsertMaxTransactionRows(assert *Assert) {
+	setupBasicDb()
+	WithQbs(func(q *Qbs) error {
+		var bulk []*basic
+		for i := 0; i < 10; i++ {
+			bulk = append(bulk, &basic{Name: "basic", State: int64(i)})
+		}
+		q.MaxTransactionRows = 3
+		err := q.BulkInsert(bulk)
+		assert.Nil(err)
+		assert.True(!q.InTransaction())
+		assert.Equal(10, q.Count("basic"))
+		return nil
+	})
+}
+
 func doTestQueryStruct(assert *Assert) {
 	setupBasicDb()
 	WithQbs(func(q *Qbs) error {
@@ -649,3 +700,1410 @@ func doTestSaveNullable(assert *Assert, mg *Migration, q *Qbs) {
 	assert.Equal(*n.Name, "foo")
 	assert.Equal(*n.Age, 99)
 }
+
+func doTestChangeEvents(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	sink := make(ChanSink, 10)
+	mg.EventSink = sink
+	mg.dropTableIfExists(&addColumn{})
+	mg.CreateTableIfNotExists(&addColumn{})
+	event := <-sink
+	assert.Equal("add_column", event.Table)
+	assert.True(event.TableCreated)
+	assert.Equal(1, len(event.CreatedIndexes))
+	mg.CreateTableIfNotExists(&addColumn{})
+	assert.Equal(0, len(sink))
+}
+
+func doTestAddColumnWithBackfill(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	type backfill struct {
+		Id   int64
+		Name string `qbs:"size:64"`
+	}
+	mg.dropTableIfExists(&backfill{})
+	mg.CreateTableIfNotExists(&backfill{})
+	for i := 0; i < 5; i++ {
+		q.Save(&backfill{Name: "row"})
+	}
+	{
+		type backfill struct {
+			Id     int64
+			Name   string `qbs:"size:64"`
+			Length int64
+			Status string `qbs:"size:16,default:'new'"`
+		}
+		err := mg.AddColumnWithBackfill(&backfill{}, "Length", func(row interface{}) interface{} {
+			return int64(len(row.(*backfill).Name)) + row.(*backfill).Id
+		}, 2)
+		assert.MustNil(err)
+		err = mg.AddColumnWithBackfill(&backfill{}, "Status", nil, 2)
+		assert.MustNil(err)
+		var rows []*backfill
+		q.OrderBy("id").FindAll(&rows)
+		assert.MustEqual(5, len(rows))
+		assert.Equal(4, rows[0].Length)
+		assert.Equal("new", rows[4].Status)
+	}
+}
+
+func doTestSetNotNull(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	type notNull struct {
+		Id   int64
+		Name *string `qbs:"size:64"`
+	}
+	mg.dropTableIfExists(&notNull{})
+	mg.CreateTableIfNotExists(&notNull{})
+	name := "a"
+	q.Save(&notNull{Name: &name})
+	q.Save(&notNull{})
+	{
+		type notNull struct {
+			Id   int64
+			Name string `qbs:"size:64"`
+		}
+		err := mg.SetNotNull(&notNull{}, "Name", nil)
+		violation, ok := err.(*NullViolationError)
+		assert.MustTrue(ok)
+		assert.Equal(1, len(violation.Pks))
+		assert.Equal(2, violation.Pks[0])
+		assert.MustNil(mg.SetNotNull(&notNull{}, "Name", "b"))
+		assert.NotNil(mg.InsertRow("not_null", map[string]interface{}{"name": nil}))
+	}
+}
+
+func doTestResizeColumn(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	type resize struct {
+		Id   int64
+		Name string `qbs:"size:64"`
+	}
+	mg.dropTableIfExists(&resize{})
+	mg.CreateTableIfNotExists(&resize{})
+	q.Save(&resize{Name: "abcdef"})
+	q.Save(&resize{Name: "abc"})
+	err := mg.ResizeColumn(&resize{}, "Name", 4, ResizeFail)
+	violation, ok := err.(*SizeViolationError)
+	assert.MustTrue(ok)
+	assert.Equal(1, len(violation.Pks))
+	assert.MustNil(mg.ResizeColumn(&resize{}, "Name", 4, ResizeTruncate))
+	r := &resize{Id: 1}
+	assert.MustNil(q.Find(r))
+	assert.Equal("abcd", r.Name)
+	assert.MustNil(mg.ResizeColumn(&resize{}, "Name", 128, ResizeFail))
+}
+
+func doTestCompareTables(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	setupBasicDb()
+	for i := 0; i < 5; i++ {
+		q.Save(&basic{Name: "basic", State: int64(i)})
+	}
+	q2, _ := GetQbs()
+	defer q2.Close()
+	mismatches, err := CompareTables(q, q2, new(basic))
+	assert.MustNil(err)
+	assert.Equal(0, len(mismatches))
+	CompareChunkSize = 2
+	defer func() {
+		CompareChunkSize = 1000
+	}()
+	mismatches, err = CompareTables(q, q2, new(basic))
+	assert.MustNil(err)
+	assert.Equal(0, len(mismatches))
+}
+
+func doTestShadow(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	setupBasicDb()
+	q2, _ := GetQbs()
+	defer q2.Close()
+	q.SetShadow(q2, ShadowSync)
+	b := &basic{Name: "basic", State: 3}
+	_, err := q.Save(b)
+	assert.MustNil(err)
+	_, err = q.Delete(b)
+	assert.MustNil(err)
+	stats := q.ShadowStats()
+	assert.Equal(2, stats.Writes)
+	assert.Equal(0, stats.Errors)
+	q.SetShadow(nil, ShadowSync)
+	assert.Equal(0, q.ShadowStats().Writes)
+}
+
+func doTestCanary(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	setupBasicDb()
+	for i := 0; i < 3; i++ {
+		q.Save(&basic{Name: "basic", State: int64(i)})
+	}
+	q2, _ := GetQbs()
+	defer q2.Close()
+	q.SetCanary(q2, 1)
+	var basics []*basic
+	assert.MustNil(q.OrderBy("id").FindAll(&basics))
+	assert.Equal(3, len(basics))
+	b := &basic{Id: basics[0].Id}
+	assert.MustNil(q.Find(b))
+	stats := q.CanaryStats()
+	assert.Equal(2, stats.Reads)
+	assert.Equal(0, stats.Mismatches)
+	assert.Equal(0, stats.Errors)
+}
+
+func doTestNewFromTx(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	setupBasicDb()
+	tx, err := q.database.db.Begin()
+	assert.MustNil(err)
+	txq := NewFromTx(tx, q.Dialect)
+	_, err = txq.Save(&basic{Name: "basic", State: 3})
+	assert.MustNil(err)
+	txq.Close()
+	assert.MustNil(tx.Rollback())
+	assert.Equal(0, NewFromDB(q.database.db, q.Dialect).Count("basic"))
+}
+
+func doTestBulkUpdate(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	setupBasicDb()
+	basics := []*basic{{Name: "a", State: 1}, {Name: "b", State: 2}, {Name: "c", State: 3}}
+	assert.MustNil(q.BulkInsert(basics))
+	for _, b := range basics {
+		assert.True(b.Id > 0)
+		b.State += 10
+	}
+	affected, err := q.BulkUpdate(basics)
+	assert.MustNil(err)
+	assert.Equal(3, affected)
+	b := &basic{Id: basics[2].Id}
+	assert.MustNil(q.Find(b))
+	assert.Equal(13, b.State)
+}
+
+func doTestQueryStructNested(assert *Assert) {
+	setupBasicDb()
+	WithQbs(func(q *Qbs) error {
+		q.Save(&basic{Name: "abc", State: 2})
+		type basicRow struct {
+			Basic     *basic
+			StateName string
+		}
+		var rows []*basicRow
+		err := q.QueryStruct(&rows, "SELECT id AS basic___id, name, state, 'two' AS state_name FROM basic")
+		assert.Nil(err)
+		assert.Equal(1, len(rows))
+		assert.Equal(1, rows[0].Basic.Id)
+		assert.Equal("abc", rows[0].Basic.Name)
+		assert.Equal(2, rows[0].Basic.State)
+		assert.Equal("two", rows[0].StateName)
+		return nil
+	})
+}
+
+func doTestAggregateBy(assert *Assert) {
+	setupBasicDb()
+	WithQbs(func(q *Qbs) error {
+		q.Save(&basic{Name: "a", State: 1})
+		q.Save(&basic{Name: "a", State: 3})
+		q.Save(&basic{Name: "b", State: 5})
+		counts, err := q.CountBy("basic", "name")
+		assert.MustNil(err)
+		assert.Equal(2, counts["a"])
+		assert.Equal(1, counts["b"])
+		sums, err := q.Where("state > ?", 1).SumBy(new(basic), "name", "state")
+		assert.MustNil(err)
+		assert.Equal(3, sums["a"])
+		assert.Equal(5, sums["b"])
+		avgs, err := q.AvgBy("basic", "name", "state")
+		assert.MustNil(err)
+		assert.Equal(2, avgs["a"])
+		return nil
+	})
+}
+
+type softDeleted struct {
+	Id      int64
+	Name    string
+	Deleted time.Time `qbs:"deleted"`
+}
+
+func doTestSoftDelete(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(new(softDeleted))
+	mg.CreateTableIfNotExists(new(softDeleted))
+	s := &softDeleted{Name: "a"}
+	_, err := q.Save(s)
+	assert.MustNil(err)
+	affected, err := q.Delete(s)
+	assert.MustNil(err)
+	assert.Equal(1, affected)
+	assert.True(!s.Deleted.IsZero())
+	assert.NotNil(q.Find(&softDeleted{Id: s.Id}))
+	var all []*softDeleted
+	assert.MustNil(q.Unscoped().FindAll(&all))
+	assert.Equal(1, len(all))
+	assert.Equal(0, q.Count(new(softDeleted)))
+	assert.Equal(1, q.Count("soft_deleted"))
+	assert.Equal(1, q.Unscoped().Count(new(softDeleted)))
+	q.Reset()
+	sum, err := q.SumInt64(new(softDeleted), "id")
+	assert.MustNil(err)
+	assert.Equal(0, sum)
+	_, err = q.Restore(s)
+	assert.MustNil(err)
+	assert.MustNil(q.Find(&softDeleted{Id: s.Id}))
+	_, err = q.Unscoped().Delete(s)
+	assert.MustNil(err)
+	assert.Equal(0, q.Count("soft_deleted"))
+
+	mg.dropTableIfExists(new(softDeletedPtr))
+	mg.CreateTableIfNotExists(new(softDeletedPtr))
+	p := &softDeletedPtr{Name: "b"}
+	_, err = q.Save(p)
+	assert.MustNil(err)
+	assert.MustNil(q.Find(&softDeletedPtr{Id: p.Id}))
+	_, err = q.Delete(p)
+	assert.MustNil(err)
+	assert.True(p.Deleted != nil)
+	assert.NotNil(q.Find(&softDeletedPtr{Id: p.Id}))
+	found := &softDeletedPtr{Id: p.Id}
+	assert.MustNil(q.Unscoped().Find(found))
+	assert.True(found.Deleted != nil && !found.Deleted.IsZero())
+	_, err = q.Restore(p)
+	assert.MustNil(err)
+	assert.True(p.Deleted == nil)
+	assert.Equal(1, q.Count(new(softDeletedPtr)))
+}
+
+type softDeletedPtr struct {
+	Id      int64
+	Name    string
+	Deleted *time.Time `qbs:"deleted"`
+}
+
+func doTestPaginate(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	setupBasicDb()
+	for i := 0; i < 5; i++ {
+		q.Save(&basic{Name: "basic", State: int64(i)})
+	}
+	var basics []*basic
+	info, err := q.Where("state > ?", 0).OrderBy("state").Paginate(2, 3, &basics)
+	assert.MustNil(err)
+	assert.Equal(4, info.Total)
+	assert.Equal(2, info.TotalPages)
+	assert.True(!info.HasNext)
+	assert.Equal(1, len(basics))
+	assert.Equal(4, basics[0].State)
+	info, err = q.Paginate(1, 3, &basics)
+	assert.MustNil(err)
+	assert.True(info.HasNext)
+	assert.Equal(4, len(basics))
+}
+
+func doTestByUnique(assert *Assert) {
+	setupBasicDb()
+	WithQbs(func(q *Qbs) error {
+		q.Save(&basic{Name: "abc", State: 2})
+		exists, err := ByUnique[basic]("id", 1).Exists(q)
+		assert.MustNil(err)
+		assert.True(exists)
+		exists, err = ByUnique[basic]("id", 2).Exists(q)
+		assert.MustNil(err)
+		assert.True(!exists)
+		b, err := ByUnique[basic]("id", 1).Find(q)
+		assert.MustNil(err)
+		assert.Equal("abc", b.Name)
+		return nil
+	})
+}
+
+func doTestPing(assert *Assert) {
+	SetConnectionLimits(10, 5, time.Minute)
+	defer SetConnectionLimits(0, 100, 0)
+	assert.MustNil(Ping())
+	assert.Equal(10, db.Stats().MaxOpenConnections)
+	mg, _ := GetMigration()
+	mg.Close()
+	assert.Nil(PingContext(context.Background()))
+}
+
+func doTestDryRun(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	type dryRunTable struct {
+		Id   int64
+		Name string `qbs:"size:64,index"`
+	}
+	mg.dropTableIfExists(&dryRunTable{})
+	statements, err := mg.DryRun(func(mg *Migration) error {
+		return mg.CreateTableIfNotExists(&dryRunTable{})
+	})
+	assert.MustNil(err)
+	assert.Equal(2, len(statements))
+	assert.Equal(0, len(mg.dialect.columnsInTable(mg, "dry_run_table")))
+}
+
+func doTestCoalesce(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	setupBasicDb()
+	q.Save(&basic{Name: "basic", State: 1})
+	q.SetCoalesce(true)
+	assert.MustNil(q.Begin())
+	var basics []*basic
+	assert.MustNil(q.Where("state = ?", 1).FindAll(&basics))
+	assert.MustNil(q.Where("state = ?", 1).FindAll(&basics))
+	assert.Equal(2, len(basics))
+	assert.True(basics[0] != basics[1])
+	b := &basic{Id: basics[0].Id}
+	assert.MustNil(q.Find(b))
+	b.State = 2
+	_, err := q.Save(b)
+	assert.MustNil(err)
+	basics = nil
+	assert.MustNil(q.Where("state = ?", 1).FindAll(&basics))
+	assert.Equal(0, len(basics))
+	assert.NotNil(q.Transaction(func(tx *Qbs) error {
+		_, err := tx.Save(&basic{Name: "rolled back", State: 3})
+		assert.MustNil(err)
+		assert.MustNil(tx.Where("state = ?", 3).FindAll(&basics))
+		assert.Equal(1, len(basics))
+		return errors.New("rollback")
+	}))
+	basics = nil
+	assert.MustNil(q.Where("state = ?", 3).FindAll(&basics))
+	assert.Equal(0, len(basics))
+	assert.MustNil(q.Commit())
+	stats := q.CoalesceStats()
+	assert.Equal(6, stats.Queries)
+	assert.Equal(1, stats.Saved)
+}
+
+func doTestMigrateBlobs(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	type blobFile struct {
+		Id   int64
+		Data []byte
+	}
+	mg.dropTableIfExists(&blobFile{})
+	mg.CreateTableIfNotExists(&blobFile{})
+	for i := 0; i < 5; i++ {
+		q.Save(&blobFile{Data: []byte{byte(i)}})
+	}
+	q.Save(&blobFile{})
+	err := mg.MigrateBlobs(&blobFile{}, "Data", func(data []byte) []byte {
+		return append(data, 'x')
+	}, 2)
+	assert.MustNil(err)
+	var files []*blobFile
+	assert.MustNil(q.OrderBy("id").FindAll(&files))
+	assert.Equal(6, len(files))
+	assert.Equal([]byte{2, 'x'}, files[2].Data)
+	assert.Nil(files[5].Data)
+}
+
+func doTestCompositePk(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(&membership{})
+	mg.CreateTableIfNotExists(&membership{})
+	_, err := q.Save(&membership{1, 2, "member"})
+	assert.MustNil(err)
+	_, err = q.Save(&membership{1, 3, "member"})
+	assert.MustNil(err)
+	_, err = q.Save(&membership{1, 2, "admin"})
+	assert.MustNil(err)
+	m := &membership{UserId: 1, GroupId: 2}
+	assert.MustNil(q.Find(m))
+	assert.Equal("admin", m.Role)
+	var all []*membership
+	assert.MustNil(q.FindAll(&all))
+	assert.Equal(2, len(all))
+	affected, err := q.Delete(&membership{UserId: 1, GroupId: 3})
+	assert.MustNil(err)
+	assert.Equal(1, affected)
+}
+
+type versionedDoc struct {
+	Id      int64
+	Title   string
+	Version int64 `qbs:"version"`
+}
+
+func doTestOptimisticLock(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(&versionedDoc{})
+	mg.CreateTableIfNotExists(&versionedDoc{})
+	doc := &versionedDoc{Title: "draft"}
+	_, err := q.Save(doc)
+	assert.MustNil(err)
+	first := &versionedDoc{Id: doc.Id}
+	assert.MustNil(q.Find(first))
+	second := &versionedDoc{Id: doc.Id}
+	assert.MustNil(q.Find(second))
+	first.Title = "first"
+	affected, err := q.Save(first)
+	assert.MustNil(err)
+	assert.Equal(1, affected)
+	assert.Equal(1, first.Version)
+	second.Title = "second"
+	_, err = q.Update(second)
+	assert.Equal(ErrStaleObject, err)
+	assert.Equal(0, second.Version)
+	assert.MustNil(q.Find(second))
+	assert.Equal("first", second.Title)
+	second.Title = "second"
+	_, err = q.Update(second)
+	assert.MustNil(err)
+	assert.Equal(2, second.Version)
+}
+
+func doTestStmtCache(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	SetStmtCacheSize(2)
+	defer SetStmtCacheSize(0)
+	before := q.StmtCacheStats()
+	for _, n := range []int{101, 102, 101, 103} {
+		var v int
+		assert.MustNil(q.QueryRow(fmt.Sprintf("SELECT %d", n)).Scan(&v))
+		assert.Equal(n, v)
+	}
+	stats := q.StmtCacheStats()
+	assert.Equal(2, stats.Size)
+	assert.Equal(1, stats.Hits-before.Hits)
+	assert.Equal(3, stats.Misses-before.Misses)
+	assert.Equal(1, stats.Evictions-before.Evictions)
+}
+
+type timestamps struct {
+	Created time.Time `qbs:"created"`
+	Updated time.Time `qbs:"updated"`
+}
+
+type stampedNote struct {
+	Id   int64
+	Text string
+	timestamps
+}
+
+func doTestEmbeddedStruct(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(&stampedNote{})
+	mg.CreateTableIfNotExists(&stampedNote{})
+	note := &stampedNote{Text: "hello"}
+	_, err := q.Save(note)
+	assert.MustNil(err)
+	assert.True(!note.Created.IsZero())
+	found := &stampedNote{Id: note.Id}
+	assert.MustNil(q.Find(found))
+	assert.Equal("hello", found.Text)
+	assert.Equal(note.Created.Unix(), found.Created.Unix())
+	assert.Equal(note.Updated.Unix(), found.Updated.Unix())
+}
+
+func doTestTransformColumn(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	type taggedPost struct {
+		Id    int64
+		Title string
+		Tag   *string
+	}
+	mg.dropTableIfExists(&taggedPost{})
+	mg.CreateTableIfNotExists(&taggedPost{})
+	tag := " go "
+	q.Save(&taggedPost{Title: " first ", Tag: &tag})
+	q.Save(&taggedPost{Title: "second "})
+	err := mg.TransformColumn(&taggedPost{}, "Title", func(old interface{}) interface{} {
+		return strings.TrimSpace(old.(string))
+	}, 1)
+	assert.MustNil(err)
+	err = mg.TransformColumn(&taggedPost{}, "Tag", func(old interface{}) interface{} {
+		if tag := old.(*string); tag != nil {
+			return strings.ToUpper(*tag)
+		}
+		return "NONE"
+	}, 0)
+	assert.MustNil(err)
+	var posts []*taggedPost
+	assert.MustNil(q.OrderBy("id").FindAll(&posts))
+	assert.Equal(2, len(posts))
+	assert.Equal("first", posts[0].Title)
+	assert.Equal(" GO ", *posts[0].Tag)
+	assert.Equal("second", posts[1].Title)
+	assert.Equal("NONE", *posts[1].Tag)
+}
+
+func doTestJSONField(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	type setting struct {
+		Theme string
+		Size  int
+	}
+	type profile struct {
+		Id       int64
+		Settings setting          `qbs:"json"`
+		Tags     []string         `qbs:"json"`
+		Extra    map[string]int64 `qbs:"json"`
+	}
+	mg.dropTableIfExists(&profile{})
+	mg.CreateTableIfNotExists(&profile{})
+	p := &profile{Settings: setting{"dark", 12}, Tags: []string{"a", "b"}}
+	_, err := q.Save(p)
+	assert.MustNil(err)
+	found := &profile{Id: p.Id}
+	assert.MustNil(q.Find(found))
+	assert.Equal("dark", found.Settings.Theme)
+	assert.Equal(12, found.Settings.Size)
+	assert.Equal("[a b]", found.Tags)
+	assert.True(found.Extra == nil)
+}
+
+func doTestSampleTransform(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	type sampledPost struct {
+		Id    int64
+		Title string
+	}
+	mg.dropTableIfExists(&sampledPost{})
+	mg.CreateTableIfNotExists(&sampledPost{})
+	for i := 0; i < 5; i++ {
+		q.Save(&sampledPost{Title: fmt.Sprintf("post %d", i)})
+	}
+	samples, err := mg.SampleTransform(&sampledPost{}, "Title", func(old interface{}) interface{} {
+		return old.(string) + "!"
+	}, 3)
+	assert.MustNil(err)
+	assert.Equal(3, len(samples))
+	for _, sample := range samples {
+		assert.Equal(sample.Before.(string)+"!", sample.After)
+	}
+	assert.Equal(0, q.Where("title LIKE ?", "%!").Count(&sampledPost{}))
+}
+
+type hookedPost struct {
+	Id    int64
+	Title string
+	calls []string
+}
+
+func (p *hookedPost) BeforeSave(q *Qbs) error {
+	if p.Title == "" {
+		return errors.New("title is required")
+	}
+	p.calls = append(p.calls, "BeforeSave")
+	return nil
+}
+
+func (p *hookedPost) AfterSave(q *Qbs) error {
+	count := q.Count(p)
+	p.calls = append(p.calls, fmt.Sprintf("AfterSave %d", count))
+	return nil
+}
+
+func (p *hookedPost) BeforeDelete(q *Qbs) error {
+	p.calls = append(p.calls, "BeforeDelete")
+	return nil
+}
+
+func (p *hookedPost) AfterDelete(q *Qbs) error {
+	p.calls = append(p.calls, "AfterDelete")
+	return nil
+}
+
+func (p *hookedPost) AfterFind(q *Qbs) error {
+	p.calls = append(p.calls, "AfterFind")
+	return nil
+}
+
+func doTestHooks(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(&hookedPost{})
+	mg.CreateTableIfNotExists(&hookedPost{})
+	_, err := q.Save(&hookedPost{})
+	assert.Equal("title is required", err.Error())
+	assert.Equal(0, q.Count(&hookedPost{}))
+
+	assert.MustNil(q.Begin())
+	post := &hookedPost{Title: "a"}
+	_, err = q.Save(post)
+	assert.MustNil(err)
+	assert.MustNil(q.Commit())
+	assert.Equal("[BeforeSave AfterSave 1]", post.calls)
+
+	found := &hookedPost{Id: post.Id}
+	assert.MustNil(q.Find(found))
+	assert.Equal("[AfterFind]", found.calls)
+	var all []*hookedPost
+	assert.MustNil(q.WhereEqual("title", "a").FindAll(&all))
+	assert.Equal(1, len(all))
+	assert.Equal("[AfterFind]", all[0].calls)
+
+	affected, err := q.Delete(found)
+	assert.MustNil(err)
+	assert.Equal(1, affected)
+	assert.Equal("[AfterFind BeforeDelete AfterDelete]", found.calls)
+}
+
+func doTestIterateNull(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	type nullableRow struct {
+		Id   int64
+		Note *string
+	}
+	mg.dropTableIfExists(&nullableRow{})
+	mg.CreateTableIfNotExists(&nullableRow{})
+	note := "first"
+	q.Save(&nullableRow{Note: &note})
+	q.Save(&nullableRow{})
+	row := new(nullableRow)
+	var notes []string
+	err := q.OrderBy("id").Iterate(row, func() error {
+		if row.Note == nil {
+			notes = append(notes, "NULL")
+		} else {
+			notes = append(notes, *row.Note)
+		}
+		return nil
+	})
+	assert.MustNil(err)
+	assert.Equal("[first NULL]", notes)
+}
+
+func doTestIntrospection(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(&addColumn{})
+	assert.Equal(0, len(mg.ColumnsInTable(&addColumn{})))
+	mg.CreateTableIfNotExists(&addColumn{})
+	assert.Equal("[amount first last prim]", mg.ColumnsInTable("add_column"))
+	assert.True(mg.IndexExists(&addColumn{}, "first_last"))
+	assert.True(!mg.IndexExists(&addColumn{}, "last"))
+	first, err := mg.Column(&addColumn{}, "first")
+	assert.MustNil(err)
+	assert.Equal("string", first.GoType())
+	assert.True(!first.Nullable)
+	amount, err := mg.Column("add_column", "amount")
+	assert.MustNil(err)
+	assert.Equal("int64", amount.GoType())
+	assert.True(amount.Nullable)
+	missing, err := mg.Column(&addColumn{}, "missing")
+	assert.MustNil(err)
+	assert.True(missing == nil)
+}
+
+type basicGroup struct {
+	Name string
+}
+
+func (*basicGroup) TableName() string {
+	return "basic"
+}
+
+func doTestAggregates(assert *Assert) {
+	setupBasicDb()
+	WithQbs(func(q *Qbs) error {
+		sum, err := q.Sum("basic", "state")
+		assert.MustNil(err)
+		assert.Equal(0, sum)
+		q.Save(&basic{Name: "a", State: 1})
+		q.Save(&basic{Name: "a", State: 3})
+		q.Save(&basic{Name: "b", State: 5})
+		sum, err = q.Sum("basic", "state")
+		assert.MustNil(err)
+		assert.Equal(9, sum)
+		total, err := q.Where("name = ?", "a").SumInt64(new(basic), "state")
+		assert.MustNil(err)
+		assert.Equal(4, total)
+		avg, err := q.Avg("basic", "state")
+		assert.MustNil(err)
+		assert.Equal(3, avg)
+		var min, max int64
+		assert.MustNil(q.Min("basic", "state", &min))
+		assert.Equal(1, min)
+		assert.MustNil(q.Max("basic", "state", &max))
+		assert.Equal(5, max)
+		maxs, err := q.MaxBy("basic", "name", "state")
+		assert.MustNil(err)
+		assert.Equal(3, maxs["a"])
+		mins, err := q.Having("COUNT(*) > ?", 1).MinBy("basic", "name", "state")
+		assert.MustNil(err)
+		assert.Equal(1, len(mins))
+		assert.Equal(1, mins["a"])
+		var groups []*basicGroup
+		err = q.GroupBy("name").Having("SUM(state) > ?", 4).FindAll(&groups)
+		assert.MustNil(err)
+		assert.Equal(1, len(groups))
+		assert.Equal("b", groups[0].Name)
+		return nil
+	})
+}
+
+// noLockDialect falls back to the lock table.
+type noLockDialect struct {
+	Dialect
+}
+
+func (d noLockDialect) lockSql() (string, string) {
+	return "", ""
+}
+
+func doTestMigrationLock(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	tableMg := &Migration{db: mg.db, dbName: mg.dbName, dialect: noLockDialect{mg.dialect}, shared: true}
+	tableMg.dropTableIfExists(new(migrationLock))
+	for _, m := range []*Migration{mg, tableMg} {
+		var holders, maxHolders int32
+		wg := new(sync.WaitGroup)
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := m.WithLock("qbs_test", func(mg *Migration) error {
+					held := atomic.AddInt32(&holders, 1)
+					if held > atomic.LoadInt32(&maxHolders) {
+						atomic.StoreInt32(&maxHolders, held)
+					}
+					time.Sleep(10 * time.Millisecond)
+					atomic.AddInt32(&holders, -1)
+					return nil
+				})
+				assert.Nil(err)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(1, maxHolders)
+	}
+	err := tableMg.WithLock("qbs_test", func(mg *Migration) error {
+		return errors.New("failed")
+	})
+	assert.Equal("failed", err.Error())
+	var count int
+	mg.db.QueryRow("SELECT COUNT(*) FROM " + MigrationLockTable).Scan(&count)
+	assert.Equal(0, count)
+}
+
+func doTestPrepareModels(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(new(basic))
+	mg.CreateTableIfNotExists(new(basic))
+	assert.MustNil(q.Prepare(new(basic)))
+	before := q.StmtCacheStats()
+	b := &basic{Name: "a", State: 1}
+	_, err := q.Save(b)
+	assert.MustNil(err)
+	assert.MustNil(q.Find(&basic{Id: b.Id}))
+	b.State = 2
+	_, err = q.Update(b)
+	assert.MustNil(err)
+	stats := q.StmtCacheStats()
+	assert.Equal(0, stats.Misses-before.Misses)
+	assert.Equal(3, stats.Hits-before.Hits)
+}
+
+type inspectAuthor struct {
+	Id   int64
+	Name string `qbs:"size:64,notnull,unique"`
+}
+
+type inspectPost struct {
+	Id              int64
+	InspectAuthorId int64 `qbs:"fk:InspectAuthor"`
+	InspectAuthor   *inspectAuthor
+	Title           string
+}
+
+func doTestInspect(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(new(inspectPost))
+	mg.dropTableIfExists(new(inspectAuthor))
+	mg.CreateTableIfNotExists(new(inspectAuthor))
+	mg.CreateTableIfNotExists(new(inspectPost))
+	tables, err := Inspect(mg.db, mg.dialect)
+	assert.MustNil(err)
+	var author, post *TableMeta
+	for _, t := range tables {
+		switch t.Name {
+		case "inspect_author":
+			author = t
+		case "inspect_post":
+			post = t
+		}
+	}
+	assert.MustNotNil(author)
+	assert.MustNotNil(post)
+	assert.Equal(2, len(author.Columns))
+	assert.Equal("id", author.Columns[0].Name)
+	assert.True(author.Columns[0].Pk)
+	assert.Equal(64, author.Columns[1].Size)
+	assert.True(!author.Columns[1].Nullable)
+	assert.Equal(1, len(author.Indexes))
+	assert.True(author.Indexes[0].Unique)
+	assert.Equal("name", author.Indexes[0].Columns[0])
+	assert.Equal(1, len(post.ForeignKeys))
+	assert.Equal("inspect_author_id", post.ForeignKeys[0].Column)
+	assert.Equal("inspect_author", post.ForeignKeys[0].RefTable)
+	assert.Equal("id", post.ForeignKeys[0].RefColumn)
+	assert.MustNil(GenerateModels(new(bytes.Buffer), []*TableMeta{author, post}, GenerateOptions{}))
+}
+
+func doTestNestedTransaction(assert *Assert) {
+	setupBasicDb()
+	WithQbs(func(q *Qbs) error {
+		err := q.Transaction(func(tx *Qbs) error {
+			_, err := tx.Save(&basic{Name: "outer"})
+			assert.MustNil(err)
+			err = tx.Transaction(func(tx *Qbs) error {
+				tx.Save(&basic{Name: "rolled back"})
+				return errors.New("inner failed")
+			})
+			assert.Equal("inner failed", err.Error())
+			return tx.Transaction(func(tx *Qbs) error {
+				_, err := tx.Save(&basic{Name: "inner"})
+				return err
+			})
+		})
+		assert.MustNil(err)
+		assert.True(!q.InTransaction())
+		var rows []*basic
+		assert.MustNil(q.OrderBy("id").FindAll(&rows))
+		assert.Equal(2, len(rows))
+		assert.Equal("outer", rows[0].Name)
+		assert.Equal("inner", rows[1].Name)
+
+		err = q.Transaction(func(tx *Qbs) error {
+			tx.Save(&basic{Name: "discarded"})
+			return errors.New("failed")
+		})
+		assert.Equal("failed", err.Error())
+		assert.Equal(2, q.Count("basic"))
+		return nil
+	})
+}
+
+func doTestManageIndexes(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(new(basic))
+	mg.CreateTableIfNotExists(new(basic))
+	assert.MustNil(mg.CreateIndexIfNotExists(new(basic), "name", false, "name"))
+	assert.MustNil(mg.RenameIndex(new(basic), "name", "basic_name"))
+	assert.True(!mg.IndexExists(new(basic), "name"))
+	assert.True(mg.IndexExists(new(basic), "basic_name"))
+	assert.MustNil(mg.DropIndex(new(basic), "basic_name"))
+	assert.True(!mg.IndexExists(new(basic), "basic_name"))
+	assert.MustNil(mg.DropIndex(new(basic), "basic_name"))
+
+	err := mg.CreatePartialIndexIfNotExists(new(basic), "active_name", true, "state > 0", "name")
+	if mg.dialect.supportsPartialIndex() {
+		assert.MustNil(err)
+		assert.True(mg.IndexExists(new(basic), "active_name"))
+	} else {
+		assert.NotNil(err)
+	}
+}
+
+func doTestAlterForeignKey(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(new(fkPost))
+	mg.dropTableIfExists(new(fkAuthor))
+	assert.MustNil(mg.CreateTablesIfNotExists(new(fkPost), new(fkAuthor)))
+	assert.MustNil(mg.AddForeignKey(new(fkPost), "FkAuthorId"))
+	assert.NotNil(mg.AddForeignKey(new(fkPost), "Id"))
+	author := &fkAuthor{Name: "a"}
+	_, err := q.Save(author)
+	assert.MustNil(err)
+	post := &fkPost{FkAuthorId: author.Id}
+	_, err = q.Save(post)
+	assert.MustNil(err)
+	_, err = q.Delete(author)
+	assert.MustNil(err)
+	out := &fkPost{Id: post.Id}
+	assert.MustNil(q.OmitJoin().Find(out))
+	assert.Equal(0, out.FkAuthorId)
+	assert.MustNil(mg.DropForeignKey(new(fkPost), "FkAuthorId"))
+}
+
+type cachedBasic struct {
+	Id    int64
+	Name  string `qbs:"size:64"`
+	State int64
+}
+
+func (*cachedBasic) TableName() string {
+	return "basic"
+}
+
+func (*cachedBasic) CacheOptions() CacheOptions {
+	return CacheOptions{TTL: time.Minute}
+}
+
+func doTestModelCache(assert *Assert) {
+	setupBasicDb()
+	SetCache(NewMemoryCache())
+	defer SetCache(nil)
+	WithQbs(func(q *Qbs) error {
+		row := &cachedBasic{Name: "cached"}
+		_, err := q.Save(row)
+		assert.MustNil(err)
+		found := &cachedBasic{Id: row.Id}
+		assert.MustNil(q.Find(found))
+		q.Exec("UPDATE basic SET name = ? WHERE id = ?", "changed", row.Id)
+		found = &cachedBasic{Id: row.Id}
+		assert.MustNil(q.Find(found))
+		assert.Equal("cached", found.Name)
+
+		found.State = 2
+		_, err = q.Save(found)
+		assert.MustNil(err)
+		q.Exec("UPDATE basic SET name = ? WHERE id = ?", "changed", row.Id)
+		found = &cachedBasic{Id: row.Id}
+		assert.MustNil(q.Find(found))
+		assert.Equal("changed", found.Name)
+		assert.Equal(2, found.State)
+
+		found.State = 3
+		_, err = q.BulkUpdate([]*cachedBasic{found})
+		assert.MustNil(err)
+		q.Exec("UPDATE basic SET name = ? WHERE id = ?", "bulk", row.Id)
+		found = &cachedBasic{Id: row.Id}
+		assert.MustNil(q.Find(found))
+		assert.Equal("bulk", found.Name)
+		assert.Equal(3, found.State)
+
+		_, err = q.Delete(found)
+		assert.MustNil(err)
+		assert.Equal(sql.ErrNoRows, q.Find(&cachedBasic{Id: row.Id}))
+		return nil
+	})
+}
+
+func doTestSnapshot(assert *Assert) {
+	setupBasicDb()
+	WithQbs(func(q *Qbs) error {
+		_, err := q.Save(&basic{Name: "a"})
+		assert.MustNil(err)
+		assert.MustNil(q.Snapshot())
+		assert.True(q.InTransaction())
+		var page []*basic
+		assert.MustNil(q.OrderBy("id").Limit(1).FindAll(&page))
+		assert.Equal(1, len(page))
+		WithQbs(func(writer *Qbs) error {
+			_, err := writer.Save(&basic{Name: "b"})
+			assert.MustNil(err)
+			return nil
+		})
+		assert.Equal(1, q.Count("basic"))
+		_, err = q.Save(&basic{Name: "c"})
+		assert.NotNil(err)
+		q.Rollback()
+		assert.Equal(2, q.Count("basic"))
+		return nil
+	})
+}
+
+func doTestSpillIterate(assert *Assert) {
+	setupBasicDb()
+	WithQbs(func(q *Qbs) error {
+		for _, name := range []string{"a", "b", ""} {
+			_, err := q.Save(&basic{Name: name, State: 1})
+			assert.MustNil(err)
+		}
+		row := new(basic)
+		var names []string
+		err := q.Spill().OrderBy("id").Iterate(row, func() error {
+			names = append(names, row.Name)
+			//the connection is free for writes while iterating.
+			_, err := q.Exec("UPDATE basic SET state = 2 WHERE id = ?", row.Id)
+			return err
+		})
+		assert.MustNil(err)
+		assert.Equal("[a b ]", fmt.Sprint(names))
+		assert.Equal(3, q.WhereEqual("state", 2).Count("basic"))
+		return nil
+	})
+}
+
+func doTestDumpSchema(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(new(inspectPost))
+	mg.dropTableIfExists(new(inspectAuthor))
+	mg.CreateTableIfNotExists(new(inspectAuthor))
+	buf := new(bytes.Buffer)
+	assert.MustNil(mg.DumpSchema(buf, "inspect_author"))
+	assert.True(strings.Contains(buf.String(), `"DataType": "int64"`))
+	mg.dropTableIfExists(new(inspectAuthor))
+	assert.MustNil(mg.LoadSchema(bytes.NewReader(buf.Bytes())))
+	assert.Equal("[id name]", fmt.Sprint(mg.ColumnsInTable("inspect_author")))
+	tables, err := Inspect(mg.db, mg.dialect)
+	assert.MustNil(err)
+	for _, t := range tables {
+		if t.Name == "inspect_author" {
+			assert.Equal(1, len(t.Indexes))
+			assert.True(t.Indexes[0].Unique)
+			assert.True(!t.Columns[1].Nullable)
+		}
+	}
+	_, err = q.Save(&inspectAuthor{Name: "a"})
+	assert.MustNil(err)
+	assert.MustNil(mg.LoadSchema(bytes.NewReader(buf.Bytes())))
+}
+
+type renameUser struct {
+	Id   int64
+	Name string `qbs:"size:64"`
+}
+
+type renameUserV2 struct {
+	Id       int64
+	FullName string `qbs:"size:64,rename_from:name"`
+}
+
+func (*renameUserV2) TableName() string {
+	return "rename_user"
+}
+
+func doTestRenameColumn(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(new(renameUser))
+	mg.CreateTableIfNotExists(new(renameUser))
+	_, err := q.Save(&renameUser{Name: "a"})
+	assert.MustNil(err)
+	assert.MustNil(mg.CreateTableIfNotExists(new(renameUserV2)))
+	assert.Equal("[full_name id]", fmt.Sprint(mg.ColumnsInTable("rename_user")))
+	user := new(renameUserV2)
+	assert.MustNil(q.WhereEqual("full_name", "a").Find(user))
+	assert.MustNil(mg.CreateTableIfNotExists(new(renameUserV2)))
+
+	assert.MustNil(mg.RenameColumn(new(renameUser), "full_name", "Name"))
+	assert.Equal("[id name]", fmt.Sprint(mg.ColumnsInTable("rename_user")))
+	assert.NotNil(mg.RenameColumn(new(renameUser), "name", "Missing"))
+}
+
+type alterAccount struct {
+	Id      int64
+	Balance string `qbs:"size:16"`
+}
+
+type alterAccountV2 struct {
+	Id      int64
+	Balance int64
+}
+
+func (*alterAccountV2) TableName() string {
+	return "alter_account"
+}
+
+func doTestAlterColumnType(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(new(alterAccount))
+	mg.CreateTableIfNotExists(new(alterAccount))
+	_, err := q.Save(&alterAccount{Balance: "42"})
+	assert.MustNil(err)
+	assert.Equal(mg.dialect.sqlType(*structPtrToModel(new(alterAccount), false, nil).field("Balance")),
+		mg.dialect.columnType(mg, "alter_account", "balance"))
+	assert.MustNil(mg.AlterColumnType(new(alterAccountV2), "Balance"))
+	assert.Equal("bigint", mg.dialect.columnType(mg, "alter_account", "balance"))
+	account := new(alterAccountV2)
+	assert.MustNil(q.WhereEqual("balance", 42).Find(account))
+	assert.Equal(42, account.Balance)
+	mg.dryRun = new([]string)
+	assert.MustNil(mg.AlterColumnType(new(alterAccountV2), "Balance"))
+	assert.Equal(0, len(*mg.dryRun))
+}
+
+func doTestUUIDPk(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	type uuidPk struct {
+		Id    string `qbs:"pk,uuid"`
+		Count int64
+	}
+	mg.dropTableIfExists(new(uuidPk))
+	mg.CreateTableIfNotExists(new(uuidPk))
+	row := &uuidPk{Count: 1}
+	affected, err := q.Save(row)
+	assert.MustNil(err)
+	assert.Equal(1, affected)
+	assert.Equal(36, len(row.Id))
+	id := row.Id
+	row.Count = 2
+	_, err = q.Save(row)
+	assert.MustNil(err)
+	assert.Equal(id, row.Id)
+	assert.Equal(1, q.Count(row))
+	rows := []*uuidPk{{Count: 3}, {Count: 4}}
+	assert.MustNil(q.BulkInsert(rows))
+	assert.True(rows[0].Id != "" && rows[0].Id != rows[1].Id)
+	found := &uuidPk{Id: id}
+	assert.MustNil(q.Find(found))
+	assert.Equal(2, found.Count)
+}
+
+func doTestQueryCache(assert *Assert) {
+	setupBasicDb()
+	SetQueryCache(NewMemoryCache(), time.Minute)
+	defer SetQueryCache(nil, 0)
+	WithQbs(func(q *Qbs) error {
+		row := &basic{Name: "cached", State: 1}
+		_, err := q.Save(row)
+		assert.MustNil(err)
+		var rows []*basic
+		assert.MustNil(q.WhereEqual("state", 1).FindAll(&rows))
+		assert.Equal(1, len(rows))
+		q.Exec("UPDATE basic SET name = ? WHERE id = ?", "changed", row.Id)
+		rows = nil
+		assert.MustNil(q.WhereEqual("state", 1).FindAll(&rows))
+		assert.Equal("cached", rows[0].Name)
+		found := &basic{Id: row.Id}
+		assert.MustNil(q.Find(found))
+		assert.Equal("changed", found.Name)
+
+		_, err = q.Save(&basic{Name: "other", State: 1})
+		assert.MustNil(err)
+		rows = nil
+		assert.MustNil(q.WhereEqual("state", 1).FindAll(&rows))
+		assert.Equal(2, len(rows))
+		assert.Equal("changed", rows[0].Name)
+		return nil
+	})
+}
+
+func doTestTempTable(assert *Assert) {
+	setupBasicDb()
+	type stagedBasic struct {
+		Id    int64
+		Name  string `qbs:"size:64"`
+		State int64
+	}
+	WithQbs(func(q *Qbs) error {
+		assert.MustNil(q.Begin())
+		assert.MustNil(q.CreateTempTable(new(stagedBasic)))
+		assert.MustNil(q.BulkInsert([]*stagedBasic{{Name: "a", State: 1}, {Name: "b", State: 2}}))
+		assert.Equal(2, q.Count(new(stagedBasic)))
+		_, err := q.Exec("INSERT INTO basic (name, state) SELECT name, state FROM staged_basic WHERE state = ?", 2)
+		assert.MustNil(err)
+		assert.MustNil(q.Commit())
+		assert.Equal(1, q.Count(new(basic)))
+		assert.MustNil(q.Begin())
+		assert.MustNil(q.CreateTempTable(new(stagedBasic)))
+		assert.Equal(0, q.Count(new(stagedBasic)))
+		return q.Rollback()
+	})
+}
+
+func doTestReturning(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	type returningRow struct {
+		Id    int64
+		Name  string `qbs:"size:32"`
+		Score int64  `qbs:"omitempty,default:7"`
+	}
+	mg.dropTableIfExists(new(returningRow))
+	mg.CreateTableIfNotExists(new(returningRow))
+	supported := q.Dialect.returningSql(structPtrToModel(new(returningRow), false, nil)) != ""
+	row := &returningRow{Name: "a"}
+	_, err := q.Returning().Save(row)
+	assert.MustNil(err)
+	assert.True(row.Id > 0)
+	result := q.LastResult()
+	assert.Equal(1, result.RowsAffected)
+	assert.Equal(row.Id, result.LastInsertId)
+	if supported {
+		assert.Equal(7, row.Score)
+		assert.Equal("[id name score]", result.Returned)
+	} else {
+		assert.Equal(0, row.Score)
+		assert.Equal(0, len(result.Returned))
+	}
+	_, err = q.Returning().Update(&returningRow{Id: row.Id, Name: "b"})
+	assert.MustNil(err)
+	assert.Equal(1, q.LastResult().RowsAffected)
+	_, err = q.Delete(row)
+	assert.MustNil(err)
+	assert.Equal(Result{RowsAffected: 1}, q.LastResult())
+}
+
+func doTestSchema(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	type tenantNote struct {
+		Id   int64
+		Body string `qbs:"size:64,index"`
+	}
+	for _, schema := range []string{"qbs_tenant_a", "qbs_tenant_b"} {
+		mg.WithSchema(schema)
+		mg.dropTableIfExists(new(tenantNote))
+		assert.MustNil(mg.CreateTableIfNotExists(new(tenantNote)))
+		assert.True(mg.IndexExists(new(tenantNote), "body"))
+		assert.Equal("[body id]", mg.ColumnsInTable(new(tenantNote)))
+		_, err := q.WithSchema(schema).Save(&tenantNote{Body: schema})
+		assert.MustNil(err)
+	}
+	var notes []*tenantNote
+	assert.MustNil(q.WithSchema("qbs_tenant_a").FindAll(&notes))
+	assert.Equal(1, len(notes))
+	assert.Equal("qbs_tenant_a", notes[0].Body)
+}
+
+func doTestSeeds(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(new(seedRecord))
+	mg.dropTableIfExists(new(basic))
+	mg.CreateTableIfNotExists(new(basic))
+	runs := 0
+	mg.Seed("states", func(q *Qbs) error {
+		runs++
+		return q.BulkInsert([]*basic{{Name: "open", State: 1}, {Name: "closed", State: 2}})
+	})
+	mg.Seed("broken", func(q *Qbs) error {
+		if _, err := q.Save(&basic{Name: "half", State: 3}); err != nil {
+			return err
+		}
+		return errors.New("missing file")
+	})
+	assert.NotNil(mg.RunSeeds("development"))
+	assert.Equal(1, runs)
+	assert.Equal(2, q.Count(new(basic)))
+	mg.seeds = mg.seeds[:1]
+	assert.MustNil(mg.RunSeeds("development"))
+	assert.Equal(1, runs)
+	assert.MustNil(mg.RunSeeds("production"))
+	assert.Equal(2, runs)
+	assert.Equal(4, q.Count(new(basic)))
+	assert.Equal(2, q.Count(new(seedRecord)))
+}
+
+type retainedEvent struct {
+	Id      int64
+	Name    string `qbs:"size:32"`
+	Created time.Time
+}
+
+func (*retainedEvent) Retention() Retention {
+	return Retention{Keep: 30 * 24 * time.Hour, Archive: new(archivedEvent)}
+}
+
+type archivedEvent struct {
+	Id      int64
+	Name    string `qbs:"size:32"`
+	Created time.Time
+}
+
+func doTestRetention(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(new(retainedEvent))
+	mg.dropTableIfExists(new(archivedEvent))
+	mg.CreateTableIfNotExists(new(retainedEvent))
+	mg.CreateTableIfNotExists(new(archivedEvent))
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		_, err := q.Save(&retainedEvent{Name: name})
+		assert.MustNil(err)
+	}
+	_, err := q.Exec("UPDATE retained_event SET created = ? WHERE name <> ?", time.Now().AddDate(0, -2, 0), "e")
+	assert.MustNil(err)
+	defer func(size int) { RetentionBatchSize = size }(RetentionBatchSize)
+	RetentionBatchSize = 3
+	deleted, err := ApplyRetention(q, new(retainedEvent))
+	assert.MustNil(err)
+	assert.Equal(4, deleted)
+	var kept []*retainedEvent
+	assert.MustNil(q.FindAll(&kept))
+	assert.Equal(1, len(kept))
+	assert.Equal("e", kept[0].Name)
+	var archived []*archivedEvent
+	assert.MustNil(q.OrderBy("id").FindAll(&archived))
+	assert.Equal(4, len(archived))
+	assert.Equal("a", archived[0].Name)
+}
+
+func doTestArchive(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(new(basic))
+	mg.dropTableIfExists("basic" + ArchiveTableSuffix)
+	mg.CreateTableIfNotExists(new(basic))
+	assert.MustNil(mg.CreateArchiveTableIfNotExists(new(basic)))
+	assert.MustNil(q.BulkInsert([]*basic{{Name: "a", State: 1}, {Name: "b", State: 2}, {Name: "c", State: 2}}))
+	moved, err := q.Archive(new(basic), NewEqualCondition("state", 2))
+	assert.MustNil(err)
+	assert.Equal(2, moved)
+	assert.Equal(1, q.Count(new(basic)))
+	assert.Equal(2, q.Count("basic"+ArchiveTableSuffix))
+	var name string
+	assert.MustNil(q.QueryRow("SELECT name FROM basic_archive WHERE state = ? ORDER BY id", 2).Scan(&name))
+	assert.Equal("b", name)
+}
+
+func doTestExplain(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(new(basic))
+	mg.CreateTableIfNotExists(new(basic))
+	assert.MustNil(q.BulkInsert([]*basic{{Name: "a", State: 1}, {Name: "b", State: 2}}))
+	plan, err := q.Model(new([]*basic)).Where("name = ?", "a").Explain()
+	assert.MustNil(err)
+	assert.True(len(plan) > 0)
+	assert.Equal("basic", plan[0].Table)
+	assert.True(plan[0].FullScan)
+}
+
+func doTestDataCheck(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(new(basic))
+	mg.CreateTableIfNotExists(new(basic))
+	assert.MustNil(q.BulkInsert([]*basic{{Name: "a", State: 1}, {Name: "b", State: 2}, {Name: "b", State: 9}}))
+	assert.MustNil(mg.Assert("names", CheckNotNull(new(basic), "Name")))
+	err := mg.Assert("unique names", CheckUnique(new(basic), "Name"))
+	assert.Equal(&DataCheckError{"unique names", 1}, err)
+	err = mg.Assert("states", CheckRange(new(basic), "State", 1, 5))
+	assert.Equal(&DataCheckError{"states", 1}, err)
+	assert.MustNil(mg.Assert("no empty names", CheckWhere(new(basic), "name = ?", "")))
+}
+
+func doTestAudit(assert *Assert, mg *Migration, q *Qbs) {
+	defer closeMigrationAndQbs(mg, q)
+	mg.dropTableIfExists(new(basic))
+	mg.dropTableIfExists(new(AuditEntry))
+	mg.CreateTableIfNotExists(new(basic))
+	assert.MustNil(mg.CreateAuditLogTableIfNotExists())
+	q.Auditor = AuditLog{}
+	b := &basic{Name: "a", State: 1}
+	_, err := q.Save(b)
+	assert.MustNil(err)
+	b.Name = "b"
+	_, err = q.Save(b)
+	assert.MustNil(err)
+	affected, err := q.Delete(b)
+	assert.MustNil(err)
+	assert.Equal(1, affected)
+	q.Auditor = nil
+	var entries []*AuditEntry
+	assert.MustNil(q.OrderBy("id").FindAll(&entries))
+	assert.Equal(3, len(entries))
+	for i, operation := range []string{AuditInsert, AuditUpdate, AuditDelete} {
+		assert.Equal(operation, entries[i].Operation)
+		assert.Equal("basic", entries[i].AuditedTable)
+		assert.Equal(fmt.Sprint(b.Id), entries[i].Pk)
+	}
+	assert.Equal("", entries[0].Before)
+	assert.True(strings.Contains(entries[1].Before, `"a"`))
+	assert.True(strings.Contains(entries[1].After, `"b"`))
+	assert.Equal("", entries[2].After)
+
+	q.Auditor = AuditLog{}
+	rows := []*basic{{Name: "c", State: 1}, {Name: "d", State: 1}}
+	assert.MustNil(q.BulkInsert(rows))
+	affected, err = q.WhereEqual("state", 1).Update(&basic{Name: "e", State: 2})
+	assert.MustNil(err)
+	assert.Equal(2, affected)
+	rows[0].Name = "f"
+	_, err = q.BulkUpdate(rows[:1])
+	assert.MustNil(err)
+	q.Auditor = nil
+	entries = nil
+	assert.MustNil(q.OrderBy("id").FindAll(&entries))
+	assert.Equal(8, len(entries))
+	for i, operation := range []string{AuditInsert, AuditInsert, AuditUpdate, AuditUpdate, AuditUpdate} {
+		assert.Equal(operation, entries[3+i].Operation)
+	}
+	assert.Equal(fmt.Sprint(rows[1].Id), entries[4].Pk)
+	assert.True(strings.Contains(entries[5].Before, `"c"`) || strings.Contains(entries[5].Before, `"d"`))
+	assert.True(strings.Contains(entries[5].After, `"e"`))
+	assert.Equal(fmt.Sprint(rows[0].Id), entries[7].Pk)
+	assert.True(strings.Contains(entries[7].Before, `"e"`))
+	assert.True(strings.Contains(entries[7].After, `"f"`))
+}
@@ -0,0 +1,57 @@
+package qbs
+
+import (
+	"reflect"
+)
+
+// ModelMeta describes the table and columns a struct is mapped to, returned by Describe.
+type ModelMeta struct {
+	Table  string       // qualified by the schema of WithSchema
+	Fields []*FieldMeta // the fields mapped to columns, the fields of embedded structs are in place of the struct
+	Pks    []*FieldMeta // more than one for a composite primary key, none if the struct has no primary key
+}
+
+// FieldMeta describes a field of a ModelMeta, the Index of a field of an embedded struct is its path.
+type FieldMeta struct {
+	reflect.StructField
+	Column string
+}
+
+// Describe returns the table and columns the struct of the struct pointer is mapped to by the naming convention
+// and schema of q, the same as Find and Save use, for tools working on any model.
+func (q *Qbs) Describe(structPtr interface{}) *ModelMeta {
+	model := structPtrToNamedModel(structPtr, false, nil, q.naming())
+	structType := reflect.TypeOf(structPtr).Elem()
+	meta := &ModelMeta{Table: model.table}
+	for _, f := range model.fields {
+		structField, _ := structType.FieldByName(f.camelName)
+		field := &FieldMeta{structField, f.name}
+		meta.Fields = append(meta.Fields, field)
+		for _, pk := range model.pks {
+			if pk == f {
+				meta.Pks = append(meta.Pks, field)
+			}
+		}
+	}
+	return meta
+}
+
+// Field returns the field of the struct field name, nil if there is no such field mapped to a column.
+func (meta *ModelMeta) Field(name string) *FieldMeta {
+	for _, f := range meta.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// FieldByColumn returns the field mapped to the column, nil if there is none.
+func (meta *ModelMeta) FieldByColumn(column string) *FieldMeta {
+	for _, f := range meta.Fields {
+		if f.Column == column {
+			return f
+		}
+	}
+	return nil
+}
@@ -1,9 +1,11 @@
 package qbs
 
 import (
+	"database/sql"
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 )
 
 type Dialect interface {
@@ -22,10 +24,20 @@ type Dialect interface {
 
 	querySql(criteria *criteria) (sql string, args []interface{})
 
+	topNSql(criteria *criteria, groupColumn string, n int) (sql string, args []interface{})
+
 	insert(q *Qbs) (int64, error)
 
 	insertSql(criteria *criteria) (sql string, args []interface{})
 
+	// Inserts the models with a single statement, returns the generated ids in order.
+	bulkInsert(q *Qbs, models []*model) ([]int64, error)
+
+	bulkInsertSql(models []*model) (sql string, args []interface{})
+
+	// The maximum number of rows of a bulk insert statement with the number of columns.
+	maxBulkInsertRows(columns int) int
+
 	update(q *Qbs) (int64, error)
 
 	updateSql(criteria *criteria) (string, []interface{})
@@ -36,19 +48,103 @@ type Dialect interface {
 
 	createTableSql(model *model, ifNotExists bool) string
 
+	// The column definitions and constraints inside the parentheses of the CREATE TABLE statement.
+	tableDefinitionsSql(model *model) string
+
 	dropTableSql(table string) string
 
 	addColumnSql(table string, column modelField) string
 
+	dropColumnSql(table, column string) string
+
+	renameColumnSql(table, oldName string, column modelField) string
+
+	// Statements that make an existing column NOT NULL and apply its default value.
+	setNotNullSql(table string, column modelField) []string
+
+	// Statements that change the type or size of an existing column, nil if the table has to be rebuilt.
+	resizeColumnSql(table string, column modelField) []string
+
+	// Statements that change the type of an existing column and convert its values, nil if the table has to be rebuilt.
+	alterColumnTypeSql(table string, column modelField) []string
+
+	// The type of the existing column as sqlType writes it, empty if unknown.
+	columnType(mg *Migration, table, column string) string
+
+	// The expression of the character length of a quoted column.
+	charLengthSql(column string) string
+
 	createIndexSql(name, table string, unique bool, columns ...string) string
 
+	// The statements adding and dropping the named foreign key constraint of an existing table, empty if not supported.
+	addForeignKeySql(table, name string, ref *reference) string
+	dropForeignKeySql(table, name string) string
+
+	dropIndexSql(table, name string) string
+
+	// The statement renaming the index, empty if not supported.
+	renameIndexSql(table, oldName, newName string) string
+
+	// Whether indexes can have a WHERE clause.
+	supportsPartialIndex() bool
+
 	indexExists(mg *Migration, tableName string, indexName string) bool
 
 	columnsInTable(mg *Migration, tableName interface{}) map[string]bool
 
 	primaryKeySql(isString bool, size int) string
 
+	// The column type of a string primary key generated as a UUID.
+	uuidType() string
+
+	// The statements creating a temporary table of the connection and dropping it at the end of the transaction,
+	// drop is empty if the table is dropped on commit by the database, create is empty if not supported.
+	tempTableSql(model *model) (create string, drop string)
+
+	// The RETURNING clause appended to an INSERT or UPDATE statement reading back the columns of the model,
+	// empty if not supported.
+	returningSql(model *model) string
+
 	catchMigrationError(err error) bool
+
+	// Whether row value comparisons like "(a, b) > (?, ?)" are supported.
+	supportsRowValues() bool
+
+	// The expression of a random number between 0 and 1.
+	randomSql() string
+
+	// The clause following the table name that samples the percent of rows, empty if not supported.
+	tableSampleSql(percent float64) string
+
+	// The statements taking and releasing the advisory lock of the name marker, empty if not supported.
+	lockSql() (lock string, unlock string)
+
+	// The isolation level of a transaction reading a consistent snapshot of the database.
+	snapshotIsolation() sql.IsolationLevel
+
+	// The statements creating, rolling back to and releasing the savepoint, release is empty if not supported.
+	savepointSql(name string) (save, rollback, release string)
+
+	// The queries of Inspect, listing the tables, their columns, indexes and foreign keys, empty if not supported.
+	inspectSqls() (tables, columns, indexes, foreignKeys string)
+
+	// The statements scheduling the named event running the statement every interval and dropping it,
+	// empty if not supported or the interval can't be scheduled.
+	scheduleEventSql(name string, every time.Duration, statement string) (string, []interface{})
+	unscheduleEventSql(name string) (string, []interface{})
+
+	// The statements making the tables of another database readable as name.table and removing them,
+	// nil if not supported.
+	attachDatabaseSqls(name string, opts AttachOptions) []string
+	detachDatabaseSqls(name string) []string
+
+	// The statement creating the schema of qualified tables if it doesn't exist, empty if not supported.
+	createSchemaSql(schema string) string
+
+	// The statement explaining the plan of the query, empty if not supported, and the step of the plan
+	// read from a row of its result by column.
+	explainSql(query string) string
+	planStep(row map[string]string) PlanStep
 }
 
 type DataSourceName struct {
@@ -0,0 +1,42 @@
+package qbs
+
+import (
+	"reflect"
+	"time"
+)
+
+// Diff compares the column fields of two struct pointers of the same type, like a row before and after an update,
+// and returns the before and after values of the columns that differ, keyed by column name.
+// A nil pointer field is a nil value, and time fields of the same instant are equal.
+func Diff(before, after interface{}) map[string][2]interface{} {
+	if reflect.TypeOf(before) != reflect.TypeOf(after) {
+		panic("can not diff " + reflect.TypeOf(before).String() + " with " + reflect.TypeOf(after).String())
+	}
+	beforeModel := structPtrToModel(before, false, nil)
+	afterModel := structPtrToModel(after, false, nil)
+	diff := make(map[string][2]interface{})
+	for i, field := range beforeModel.fields {
+		beforeValue, afterValue := diffValue(field), diffValue(afterModel.fields[i])
+		if !diffEqual(beforeValue, afterValue) {
+			diff[field.name] = [2]interface{}{beforeValue, afterValue}
+		}
+	}
+	return diff
+}
+
+// diffValue returns the value of the field, a JSON field is unwrapped.
+func diffValue(field *modelField) interface{} {
+	if j, ok := field.value.(jsonValue); ok {
+		return j.v
+	}
+	return field.value
+}
+
+func diffEqual(a, b interface{}) bool {
+	if t, ok := a.(time.Time); ok {
+		if u, ok := b.(time.Time); ok {
+			return t.Equal(u)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
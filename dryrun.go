@@ -0,0 +1,107 @@
+package qbs
+
+import (
+	sqldriver "database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// DryRun calls the task with a copy of the migration which records the statements that would change the database
+// instead of executing them, and returns them in order so they can be reviewed and applied manually.
+// The database is still queried for existing tables, columns and indexes. Parameters are inlined as literals.
+func (mg *Migration) DryRun(task func(mg *Migration) error) ([]string, error) {
+	dry := *mg
+	dry.dryRun = new([]string)
+	err := task(&dry)
+	return *dry.dryRun, err
+}
+
+// WriteScript writes the statements of a dry run as a SQL script, each on its own line terminated by a semicolon.
+func WriteScript(w io.Writer, statements []string) error {
+	for _, statement := range statements {
+		if _, err := fmt.Fprintf(w, "%v;\n", statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record adds the statement to the dry run, it returns false if the migration is not a dry run.
+func (mg *Migration) record(sql string, args ...interface{}) bool {
+	if mg.dryRun == nil {
+		return false
+	}
+	if sql = strings.TrimSpace(sql); sql != "" {
+		*mg.dryRun = append(*mg.dryRun, inlineArgs(sql, args))
+	}
+	return true
+}
+
+// inlineArgs replaces the "?" markers outside of string literals with the literals of the args.
+func inlineArgs(sql string, args []interface{}) string {
+	if len(args) == 0 {
+		return sql
+	}
+	buf := new(strings.Builder)
+	inString := false
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'':
+			inString = !inString
+		case c == '?' && !inString && len(args) > 0:
+			buf.WriteString(sqlLiteral(args[0]))
+			args = args[1:]
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	return buf.String()
+}
+
+// sqlLiteral returns the SQL literal of a parameter value.
+func sqlLiteral(arg interface{}) string {
+	if valuer, ok := arg.(sqldriver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil {
+			return "NULL"
+		}
+		arg = value
+	}
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return quoteLiteral(v)
+	case []byte:
+		return quoteLiteral(string(v))
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case time.Time:
+		return quoteLiteral(v.Format("2006-01-02 15:04:05.999999"))
+	}
+	value := reflect.ValueOf(arg)
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return "NULL"
+		}
+		return sqlLiteral(value.Elem().Interface())
+	}
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fmt.Sprint(arg)
+	case reflect.Bool:
+		return sqlLiteral(value.Bool())
+	case reflect.String:
+		return quoteLiteral(value.String())
+	}
+	return quoteLiteral(fmt.Sprint(arg))
+}
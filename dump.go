@@ -0,0 +1,95 @@
+package qbs
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"time"
+)
+
+// columnGoValues are the zero values of the column types of a dumped schema.
+var columnGoValues = map[string]interface{}{
+	"bool":      false,
+	"int64":     int64(0),
+	"float64":   float64(0),
+	"string":    "",
+	"time.Time": time.Time{},
+	"[]byte":    []byte(nil),
+}
+
+// DumpSchema writes the tables of the database, all of them if no table name is given, as JSON that LoadSchema
+// creates on any dialect, e.g. to create the current schema in tests without running every migration.
+// The data types are the Go types of the columns, like "int64" or "time.Time", defaults and foreign keys are not dumped.
+func (mg *Migration) DumpSchema(w io.Writer, tableNames ...string) error {
+	tables, err := Inspect(mg.db, mg.dialect)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool, len(tableNames))
+	for _, name := range tableNames {
+		names[name] = true
+	}
+	dumped := make([]*TableMeta, 0, len(tables))
+	for _, t := range tables {
+		if len(names) > 0 && !names[t.Name] {
+			continue
+		}
+		for _, c := range t.Columns {
+			c.DataType = columnGoType(c)
+			c.Default = ""
+		}
+		t.ForeignKeys = nil
+		dumped = append(dumped, t)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dumped)
+}
+
+// LoadSchema creates the tables and indexes written by DumpSchema if they don't exist.
+func (mg *Migration) LoadSchema(r io.Reader) error {
+	var tables []*TableMeta
+	if err := json.NewDecoder(r).Decode(&tables); err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if err := mg.exec(mg.dialect.createTableSql(tableMetaModel(t), true)); err != nil {
+			return err
+		}
+		for _, i := range t.Indexes {
+			if mg.dialect.indexExists(mg, t.Name, i.Name) {
+				continue
+			}
+			if err := mg.exec(mg.dialect.createIndexSql(i.Name, t.Name, i.Unique, i.Columns...)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tableMetaModel returns the model of the table with the zero values of the column types as its field values.
+func tableMetaModel(t *TableMeta) *model {
+	m := &model{table: t.Name}
+	for _, c := range t.Columns {
+		value, ok := columnGoValues[c.DataType]
+		if !ok {
+			value = columnGoValues[columnGoType(c)]
+		}
+		f := &modelField{name: c.Name, value: value, pk: c.Pk, notnull: !c.Nullable, size: c.Size}
+		if c.Nullable && !c.Pk {
+			switch kind := reflect.TypeOf(value).Kind(); kind {
+			case reflect.Bool, reflect.Int64, reflect.Float64, reflect.String:
+				f.nullable = kind
+			}
+		}
+		if f.pk {
+			m.pks = append(m.pks, f)
+		}
+		m.fields = append(m.fields, f)
+	}
+	if len(m.pks) == 1 {
+		m.pk = m.pks[0]
+	}
+	return m
+}
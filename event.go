@@ -0,0 +1,73 @@
+package qbs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ChangeEvent describes the schema changes a Migration has successfully applied to a table.
+type ChangeEvent struct {
+	Table          string    `json:"table"`
+	TableCreated   bool      `json:"table_created"`
+	AddedColumns   []string  `json:"added_columns,omitempty"`
+	RenamedColumns []string  `json:"renamed_columns,omitempty"` // "old_name new_name" pairs
+	CreatedIndexes []string  `json:"created_indexes,omitempty"`
+	Time           time.Time `json:"time"`
+}
+
+func (e *ChangeEvent) empty() bool {
+	return !e.TableCreated && len(e.AddedColumns) == 0 && len(e.RenamedColumns) == 0 && len(e.CreatedIndexes) == 0
+}
+
+// EventSink receives the change events of a Migration, set it to Migration.EventSink.
+// Errors returned by Publish are logged, they do not fail the migration.
+type EventSink interface {
+	Publish(event *ChangeEvent) error
+}
+
+// ChanSink publishes change events to a channel.
+type ChanSink chan *ChangeEvent
+
+func (c ChanSink) Publish(event *ChangeEvent) error {
+	c <- event
+	return nil
+}
+
+// WebhookSink posts change events as JSON to an URL.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client // http.DefaultClient is used if nil.
+}
+
+func (w *WebhookSink) Publish(event *ChangeEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %v responded %v", w.URL, resp.Status)
+	}
+	return nil
+}
+
+func (mg *Migration) publish(event *ChangeEvent) {
+	if mg.EventSink == nil || event.empty() || mg.dryRun != nil {
+		return
+	}
+	event.Time = time.Now()
+	if err := mg.EventSink.Publish(event); err != nil && errorLogger != nil {
+		errorLogger.Println(err)
+	}
+}
@@ -0,0 +1,60 @@
+package example
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	"github.com/coocood/qbs"
+)
+
+// RedisClient is the part of a redis client used by RedisCache, e.g. a thin wrapper of go-redis or redigo.
+type RedisClient interface {
+	Get(key string) ([]byte, error) // nil and no error if the key doesn't exist
+	Set(key string, value []byte, ttl time.Duration) error
+	Del(key string) error
+}
+
+// RedisCache is a qbs.Cache storing the values gob encoded in redis, so the processes of the application share
+// the cached queries and their invalidations. Register the model types and the slices of them by gob.Register.
+type RedisCache struct {
+	Client RedisClient
+}
+
+type redisValue struct {
+	Value interface{}
+}
+
+func init() {
+	gob.Register(&User{})
+	gob.Register(&[]*User{})
+	gob.Register(&Post{})
+	gob.Register(&[]*Post{})
+}
+
+func (c RedisCache) Get(key string) (interface{}, bool) {
+	data, err := c.Client.Get(key)
+	if err != nil || data == nil {
+		return nil, false
+	}
+	var v redisValue
+	if err = gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return nil, false
+	}
+	return v.Value, true
+}
+
+func (c RedisCache) Set(key string, value interface{}, ttl time.Duration) {
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(redisValue{value}); err == nil {
+		c.Client.Set(key, buf.Bytes(), ttl)
+	}
+}
+
+func (c RedisCache) Delete(key string) {
+	c.Client.Del(key)
+}
+
+func UseRedisCache(client RedisClient) {
+	qbs.SetQueryCache(RedisCache{client}, time.Minute)
+}
@@ -0,0 +1,89 @@
+package qbs
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// PlanStep is a step of the query plan returned by Explain.
+type PlanStep struct {
+	Detail   string // The plan line of postgres and sqlite3, the access type, key and extra of mysql.
+	Table    string // The table read by the step, empty if it reads no table.
+	FullScan bool   // Every row of the table is read, an index on the columns of the condition may avoid it.
+	Rows     int64  // The estimated number of rows read, 0 if not estimated.
+}
+
+// Explain returns the plan of the query FindAll would execute for the struct of Model, without executing it.
+func (q *Qbs) Explain() ([]PlanStep, error) {
+	query, args, err := q.ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	return q.explain(query, args)
+}
+
+func (q *Qbs) explain(query string, args []interface{}) ([]PlanStep, error) {
+	explain := q.Dialect.explainSql(query)
+	if explain == "" {
+		return nil, errors.New("explaining queries is not supported by the dialect")
+	}
+	rows, err := q.query(explain, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	var plan []PlanStep
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			row[column] = values[i].String
+		}
+		plan = append(plan, q.Dialect.planStep(row))
+	}
+	return plan, rows.Err()
+}
+
+// warnFullScans logs the full scans of the plan of a FindAll query estimated to read at least WarnFullScanRows rows,
+// if the Qbs logs its statements.
+func (q *Qbs) warnFullScans(query string, args []interface{}) {
+	if q.WarnFullScanRows <= 0 || (!q.Log && q.Logger == nil && q.LogLevel == 0) {
+		return
+	}
+	plan, err := q.explain(query, args)
+	if err != nil {
+		return
+	}
+	for _, step := range plan {
+		if step.FullScan && step.Rows >= q.WarnFullScanRows {
+			errorLogger.Printf("full scan: about %d rows of table %v are read by %v, an index may be missing", step.Rows, step.Table, query)
+		}
+	}
+}
+
+// planRows parses the estimated rows of a plan line like "Seq Scan on post  (cost=0.00..35.50 rows=2550 width=4)".
+func planRows(line string) int64 {
+	i := strings.Index(line, "rows=")
+	if i < 0 {
+		return 0
+	}
+	digits := line[i+len("rows="):]
+	if end := strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }); end >= 0 {
+		digits = digits[:end]
+	}
+	rows, _ := strconv.ParseInt(digits, 10, 64)
+	return rows
+}
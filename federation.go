@@ -0,0 +1,67 @@
+package qbs
+
+import (
+	"errors"
+	"strings"
+)
+
+// AttachOptions locates the database attached by Migration.AttachDatabase.
+type AttachOptions struct {
+	File     string // The database file of sqlite3.
+	Host     string // The server of postgres, the local one if empty.
+	Port     int
+	DbName   string
+	User     string
+	Password string
+	Schema   string // The schema of the tables imported by postgres, "public" if empty.
+}
+
+// AttachDatabase makes the tables of another database readable and writable as name.table, so CopyRows
+// moves rows between the databases in a single statement. It attaches the file on sqlite3, and imports
+// the tables of the server by postgres_fdw into the schema of the name on postgres.
+// The databases of the same mysql server are queried as database.table without attaching,
+// it returns an error for mysql and oracle. The password is redacted from the logged and dry run statements.
+func (mg *Migration) AttachDatabase(name string, opts AttachOptions) error {
+	sqls := mg.dialect.attachDatabaseSqls(name, opts)
+	if sqls == nil {
+		return errors.New("attaching database " + name + " is not supported by the dialect")
+	}
+	redacted := opts
+	if redacted.Password != "" {
+		redacted.Password = "***"
+	}
+	logged := mg.dialect.attachDatabaseSqls(name, redacted)
+	for i, sql := range sqls {
+		if err := mg.execRedacted(sql, logged[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DetachDatabase removes the tables attached by AttachDatabase, the tables of the other database are kept.
+func (mg *Migration) DetachDatabase(name string) error {
+	sqls := mg.dialect.detachDatabaseSqls(name)
+	if sqls == nil {
+		return errors.New("detaching database " + name + " is not supported by the dialect")
+	}
+	for _, sql := range sqls {
+		if err := mg.exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyRows inserts the rows of the table of the struct in the attached database into the table of this one,
+// the columns of the struct are copied by a single INSERT ... SELECT statement.
+func (mg *Migration) CopyRows(structPtr interface{}, from string) error {
+	model := structPtrToNamedModel(structPtr, false, nil, mg.naming())
+	columns := make([]string, len(model.fields))
+	for i, f := range model.fields {
+		columns[i] = mg.dialect.quote(f.name)
+	}
+	list := strings.Join(columns, ", ")
+	table := mg.dialect.quote(model.table)
+	return mg.exec("INSERT INTO " + table + " (" + list + ") SELECT " + list + " FROM " + mg.dialect.quote(from) + "." + table)
+}
@@ -0,0 +1,279 @@
+// Package fixtures loads YAML or JSON fixture files into the tables of qbs models, for tests.
+//
+// A fixture file maps the table names to the labeled rows of the table, and the rows map the column names to values:
+//
+//	user:
+//	  alice:
+//	    name: Alice
+//	post:
+//	  hello:
+//	    title: Hello
+//	    author: alice
+//
+// A reference field like `Author *User` of a post, which is joined by the AuthorId field or the fk or join tag,
+// is set by the label of the referenced row, which is inserted first, so the rows can be listed in any order.
+package fixtures
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coocood/qbs"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixtures loads the rows of the fixture files into the tables of the models it is created with.
+type Fixtures struct {
+	models []reflect.Type
+	rows   map[string]*row
+	loaded map[string]interface{}
+}
+
+type row struct {
+	model  reflect.Type
+	values map[string]interface{}
+}
+
+// New returns the Fixtures of the struct pointers of the models.
+func New(structPtrs ...interface{}) *Fixtures {
+	f := new(Fixtures)
+	for _, structPtr := range structPtrs {
+		t := reflect.TypeOf(structPtr)
+		if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+			panic(fmt.Sprintf("%T is not a struct pointer", structPtr))
+		}
+		f.models = append(f.models, t.Elem())
+	}
+	return f
+}
+
+// Load saves the rows of the files with q, the files ending in .json are read as JSON, the others as YAML.
+// The rows of the tables are inserted in the order of the models, and in the order of their labels in a table,
+// the referenced rows are inserted before the rows referencing them. The rows of a previous Load are forgotten.
+func (f *Fixtures) Load(q *qbs.Qbs, paths ...string) error {
+	f.rows = make(map[string]*row)
+	f.loaded = make(map[string]interface{})
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err = f.parse(q, path, data); err != nil {
+			return fmt.Errorf("fixtures %v: %v", path, err)
+		}
+	}
+	return f.insertAll(q, func(structPtr interface{}) error {
+		_, err := q.Save(structPtr)
+		return err
+	})
+}
+
+// Get returns the struct pointer of the row of the label saved by the last Load, with its generated primary key,
+// or nil if there is no row of the label.
+func (f *Fixtures) Get(label string) interface{} {
+	return f.loaded[label]
+}
+
+// Setup begins a transaction on q which is rolled back when the test ends, and loads the files in it,
+// so every test starts with the fixture rows only. The test fails if the files can't be loaded.
+func (f *Fixtures) Setup(t testing.TB, q *qbs.Qbs, paths ...string) {
+	t.Helper()
+	Rollback(t, q)
+	if err := f.Load(q, paths...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Rollback begins a transaction on q which is rolled back when the test ends, so the changes of the test
+// are undone. The test fails if the transaction can't begin.
+func Rollback(t testing.TB, q *qbs.Qbs) {
+	t.Helper()
+	if err := q.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if q.InTransaction() {
+			q.Rollback()
+		}
+	})
+}
+
+// parse adds the rows of the file data to the rows to insert.
+func (f *Fixtures) parse(q *qbs.Qbs, path string, data []byte) error {
+	var tables map[string]map[string]map[string]interface{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&tables); err != nil {
+			return err
+		}
+	} else if err := yaml.Unmarshal(data, &tables); err != nil {
+		return err
+	}
+	for table, rows := range tables {
+		model := f.model(q, table)
+		if model == nil {
+			return fmt.Errorf("no model of table %v", table)
+		}
+		for label, values := range rows {
+			if _, ok := f.rows[label]; ok {
+				return fmt.Errorf("label %v is used twice", label)
+			}
+			f.rows[label] = &row{model, values}
+		}
+	}
+	return nil
+}
+
+// model returns the model of the table name, which may be qualified by the schema of q.
+func (f *Fixtures) model(q *qbs.Qbs, table string) reflect.Type {
+	for _, model := range f.models {
+		name := q.Describe(reflect.New(model).Interface()).Table
+		if name == table || name[strings.LastIndex(name, ".")+1:] == table {
+			return model
+		}
+	}
+	return nil
+}
+
+// insertAll inserts the rows by save in the order of the models and labels.
+func (f *Fixtures) insertAll(q *qbs.Qbs, save func(structPtr interface{}) error) error {
+	labels := make([]string, 0, len(f.rows))
+	for label := range f.rows {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, model := range f.models {
+		for _, label := range labels {
+			if f.rows[label].model != model {
+				continue
+			}
+			if _, err := f.insert(q, label, save, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// insert inserts the row of the label after the rows it references, and returns its struct pointer.
+// The labels being inserted are passed to detect reference cycles.
+func (f *Fixtures) insert(q *qbs.Qbs, label string, save func(structPtr interface{}) error, inserting []string) (interface{}, error) {
+	if structPtr, ok := f.loaded[label]; ok {
+		return structPtr, nil
+	}
+	r := f.rows[label]
+	if r == nil {
+		return nil, fmt.Errorf("no row of label %v", label)
+	}
+	for _, l := range inserting {
+		if l == label {
+			return nil, fmt.Errorf("rows %v reference each other", strings.Join(append(inserting, label), " -> "))
+		}
+	}
+	inserting = append(inserting, label)
+	structPtr := reflect.New(r.model)
+	structValue := structPtr.Elem()
+	meta := q.Describe(structPtr.Interface())
+	for column, value := range r.values {
+		if columnField := meta.FieldByColumn(column); columnField != nil {
+			if err := setField(structValue.FieldByIndex(columnField.Index), value); err != nil {
+				return nil, fmt.Errorf("row %v: column %v: %v", label, column, err)
+			}
+			continue
+		}
+		name := fieldName(q, column)
+		field := structValue.FieldByName(name)
+		if !field.IsValid() {
+			return nil, fmt.Errorf("row %v: no field of column %v in %v", label, column, r.model.Name())
+		}
+		if fk := foreignKey(r.model, name); fk != "" {
+			refLabel, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("row %v: the reference %v is not a label", label, column)
+			}
+			ref, err := f.insert(q, refLabel, save, inserting)
+			if err != nil {
+				return nil, err
+			}
+			refValue := reflect.ValueOf(ref)
+			if refValue.Type() != field.Type() {
+				return nil, fmt.Errorf("row %v: the row %v referenced by %v is a %v", label, refLabel, column, refValue.Type())
+			}
+			field.Set(refValue)
+			pks := q.Describe(ref).Pks
+			if len(pks) != 1 {
+				return nil, fmt.Errorf("row %v: the row %v has no single column primary key", label, refLabel)
+			}
+			if err = setField(structValue.FieldByName(fk), refValue.Elem().FieldByIndex(pks[0].Index).Interface()); err != nil {
+				return nil, fmt.Errorf("row %v: column %v: %v", label, column, err)
+			}
+			continue
+		}
+		return nil, fmt.Errorf("row %v: no field of column %v in %v", label, column, r.model.Name())
+	}
+	if err := save(structPtr.Interface()); err != nil {
+		return nil, fmt.Errorf("row %v: %v", label, err)
+	}
+	f.loaded[label] = structPtr.Interface()
+	return structPtr.Interface(), nil
+}
+
+// setField sets the field to the value decoded from the file.
+func setField(field reflect.Value, value interface{}) error {
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	if scanner, ok := field.Addr().Interface().(sql.Scanner); ok {
+		if n, ok := value.(json.Number); ok {
+			value = string(n)
+		}
+		return scanner.Scan(value)
+	}
+	if t, ok := value.(time.Time); ok && field.Type() == reflect.TypeOf("") {
+		value = t.Format(time.RFC3339) //a YAML timestamp for a string field.
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, field.Addr().Interface())
+}
+
+// foreignKey returns the name of the field joining the reference field of the name, empty if it isn't
+// a reference field.
+func foreignKey(model reflect.Type, name string) string {
+	field, _ := model.FieldByName(name)
+	if field.Type.Kind() != reflect.Ptr || field.Type.Elem().Kind() != reflect.Struct {
+		return ""
+	}
+	for i := 0; i < model.NumField(); i++ {
+		for _, tag := range strings.Split(model.Field(i).Tag.Get(qbs.TagKey), ",") {
+			if tag == "fk:"+name || tag == "join:"+name {
+				return model.Field(i).Name
+			}
+		}
+	}
+	if fk, ok := model.FieldByName(name + "Id"); ok && (fk.Type.Kind() == reflect.Int64 || fk.Type == reflect.TypeOf(sql.NullInt64{})) {
+		return fk.Name
+	}
+	return ""
+}
+
+// fieldName returns the name of the reference field of the column, like Author of author.
+func fieldName(q *qbs.Qbs, column string) string {
+	if q.Naming != nil {
+		return q.Naming.FieldName(column)
+	}
+	return qbs.ColumnNameToFieldName(column)
+}
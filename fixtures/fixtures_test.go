@@ -0,0 +1,124 @@
+package fixtures
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coocood/qbs"
+)
+
+type user struct {
+	Id      int64
+	Name    string
+	Nick    sql.NullString
+	Created time.Time
+}
+
+type post struct {
+	Id       int64
+	Title    string
+	AuthorId int64
+	Author   *user
+	EditorId sql.NullInt64
+	Editor   *user
+}
+
+func load(t *testing.T, path, data string) (*Fixtures, []interface{}, error) {
+	f := New(new(user), new(post))
+	f.rows = make(map[string]*row)
+	f.loaded = make(map[string]interface{})
+	q := new(qbs.Qbs)
+	if err := f.parse(q, path, []byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	var saved []interface{}
+	err := f.insertAll(q, func(structPtr interface{}) error {
+		saved = append(saved, structPtr)
+		if u, ok := structPtr.(*user); ok {
+			u.Id = int64(len(saved))
+		} else {
+			structPtr.(*post).Id = int64(len(saved))
+		}
+		return nil
+	})
+	return f, saved, err
+}
+
+func TestLoadYAML(t *testing.T) {
+	f, saved, err := load(t, "blog.yml", `
+post:
+  hello:
+    title: Hello
+    author: bob
+    editor: alice
+user:
+  alice:
+    name: Alice
+    nick: al
+    created: 2020-01-02T03:04:05Z
+  bob:
+    name: Bob
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 3 {
+		t.Fatalf("saved %d rows", len(saved))
+	}
+	alice, bob := f.Get("alice").(*user), f.Get("bob").(*user)
+	if alice.Id != 1 || bob.Id != 2 || alice.Nick.String != "al" || bob.Nick.Valid {
+		t.Errorf("users are %+v and %+v", alice, bob)
+	}
+	if !alice.Created.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("created is %v", alice.Created)
+	}
+	hello := f.Get("hello").(*post)
+	if hello.Title != "Hello" || hello.Author != bob || hello.AuthorId != 2 || hello.EditorId.Int64 != 1 || !hello.EditorId.Valid {
+		t.Errorf("post is %+v", hello)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	f, saved, err := load(t, "blog.json", `{
+		"post": {"first": {"title": "First", "author": "carol"}, "second": {"title": "Second", "author": "carol"}},
+		"user": {"carol": {"name": "Carol"}}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 3 || saved[0] != f.Get("carol") {
+		t.Fatalf("saved %v", saved)
+	}
+	if second := f.Get("second").(*post); second.Author != f.Get("carol") {
+		t.Errorf("second post is %+v", second)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, _, err := load(t, "blog.yml", `
+post:
+  hello:
+    author: nobody
+`)
+	if err == nil || !strings.Contains(err.Error(), "no row of label nobody") {
+		t.Errorf("unknown label: %v", err)
+	}
+	_, _, err = load(t, "blog.yml", `
+post:
+  hello:
+    author: hello
+`)
+	if err == nil || !strings.Contains(err.Error(), "hello -> hello") {
+		t.Errorf("reference cycle: %v", err)
+	}
+	_, _, err = load(t, "blog.yml", `
+user:
+  alice:
+    age: 3
+`)
+	if err == nil || !strings.Contains(err.Error(), "no field of column age") {
+		t.Errorf("unknown column: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package qbs
+
+import (
+	"strings"
+	"testing"
+)
+
+// splitQuoted parses a dotted path of quoted identifiers, it fails if a quote is not escaped.
+func splitQuoted(quoted string, quote byte) ([]string, bool) {
+	var segs []string
+	for {
+		if len(quoted) == 0 || quoted[0] != quote {
+			return nil, false
+		}
+		seg := []byte{}
+		i := 1
+		for ; i < len(quoted); i++ {
+			if quoted[i] == quote {
+				if i+1 < len(quoted) && quoted[i+1] == quote {
+					seg = append(seg, quote)
+					i++
+					continue
+				}
+				break
+			}
+			seg = append(seg, quoted[i])
+		}
+		if i == len(quoted) {
+			return nil, false
+		}
+		segs = append(segs, string(seg))
+		quoted = quoted[i+1:]
+		if len(quoted) == 0 {
+			return segs, true
+		}
+		if quoted[0] != '.' {
+			return nil, false
+		}
+		quoted = quoted[1:]
+	}
+}
+
+var fuzzSeeds = []string{"name", "user.name", "a`b", `a"b`, "a'b", "`; DROP TABLE user; --", `"; DROP TABLE user; --`, "'); DELETE FROM user; --", `a\`, ""}
+
+func FuzzQuote(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	dialects := map[byte][]Dialect{'`': {NewMysql()}, '"': {NewPostgres(), NewOracle()}}
+	f.Fuzz(func(t *testing.T, s string) {
+		for quote, ds := range dialects {
+			for _, d := range ds {
+				quoted := d.quote(s)
+				segs, ok := splitQuoted(quoted, quote)
+				if !ok || strings.Join(segs, ".") != s {
+					t.Fatalf("%q quoted as %q", s, quoted)
+				}
+				if !strings.Contains(s, ".") && unquotePath(quoted) != s {
+					t.Fatalf("%q unquoted as %q", quoted, unquotePath(quoted))
+				}
+			}
+		}
+	})
+}
+
+func FuzzQuoteLiteral(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		quoted := quoteLiteral(s)
+		segs, ok := splitQuoted(quoted, '\'')
+		if !ok || len(segs) != 1 || segs[0] != s {
+			t.Fatalf("%q quoted as %q", s, quoted)
+		}
+	})
+}
+
+func FuzzInsertRowSql(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed, seed)
+	}
+	f.Fuzz(func(t *testing.T, column, value string) {
+		for _, d := range []Dialect{NewMysql(), NewPostgres(), NewOracle()} {
+			sql, args := insertRowSql(d, "fuzz", map[string]interface{}{column: value})
+			expected := "INSERT INTO " + d.quote("fuzz") + " (" + d.quote(column) + ") VALUES (?)"
+			if sql != expected || len(args) != 1 || args[0] != value {
+				t.Fatalf("%q %v for column %q and value %q", sql, args, column, value)
+			}
+		}
+	})
+}
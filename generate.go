@@ -0,0 +1,201 @@
+package qbs
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// GenerateOptions configures GenerateModels.
+type GenerateOptions struct {
+	Package string           // "models" if empty
+	Naming  NamingConvention // The package level naming functions are used if nil.
+}
+
+// GenerateModels writes the Go source of a struct with qbs tags for every table, e.g. returned by Inspect.
+// Single column indexes are tagged, the others are added by an Indexes method, and a foreign key column
+// named like "author_id" gets the "fk" tag with an Author pointer field if the referenced table is generated.
+// A column name the naming convention can't map back from its field name is an error,
+// unless the first of ColumnTagKeys is set to tag it.
+func GenerateModels(w io.Writer, tables []*TableMeta, opts GenerateOptions) error {
+	naming := opts.Naming
+	if naming == nil {
+		naming = globalNaming{}
+	}
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = "models"
+	}
+	structNames := make(map[string]string, len(tables))
+	for _, t := range tables {
+		structNames[t.Name] = naming.StructName(t.Name)
+	}
+	body := new(bytes.Buffer)
+	imports := make(map[string]bool)
+	for _, t := range tables {
+		if err := generateModel(body, t, naming, structNames, imports); err != nil {
+			return err
+		}
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "// Code generated by qbs.GenerateModels from the database schema.\n\npackage %v\n", pkg)
+	if len(imports) > 0 {
+		buf.WriteString("\nimport (\n")
+		if imports["time"] {
+			buf.WriteString("\"time\"\n\n")
+		}
+		if imports["github.com/coocood/qbs"] {
+			buf.WriteString("\"github.com/coocood/qbs\"\n")
+		}
+		buf.WriteString(")\n")
+	}
+	buf.Write(body.Bytes())
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+func generateModel(buf *bytes.Buffer, t *TableMeta, naming NamingConvention, structNames map[string]string, imports map[string]bool) error {
+	name := structNames[t.Name]
+	pks := 0
+	for _, c := range t.Columns {
+		if c.Pk {
+			pks++
+		}
+	}
+	indexed := make(map[string]*IndexMeta)
+	var multiIndexes []*IndexMeta
+	for _, i := range t.Indexes {
+		if len(i.Columns) == 1 {
+			indexed[i.Columns[0]] = i
+		} else {
+			multiIndexes = append(multiIndexes, i)
+		}
+	}
+	refs := make(map[string]string)
+	for _, fk := range t.ForeignKeys {
+		if refStruct, ok := structNames[fk.RefTable]; ok {
+			refs[fk.Column] = refStruct
+		}
+	}
+	fieldNames := make(map[string]bool, len(t.Columns))
+	for _, c := range t.Columns {
+		fieldNames[naming.FieldName(c.Name)] = true
+	}
+	var joins []string
+	fmt.Fprintf(buf, "\ntype %v struct {\n", name)
+	for _, c := range t.Columns {
+		field := naming.FieldName(c.Name)
+		goType := columnGoType(c)
+		if goType == "time.Time" {
+			imports["time"] = true
+		}
+		var tags []string
+		if c.Pk && !(pks == 1 && field == "Id" && goType == "int64") {
+			tags = append(tags, "pk")
+		}
+		var refField string
+		if refStruct, ok := refs[c.Name]; ok && len(field) > 2 && strings.HasSuffix(field, "Id") {
+			refField = strings.TrimSuffix(field, "Id")
+			if fieldNames[refField] {
+				refField = ""
+			} else {
+				tags = append(tags, "fk:"+refField)
+				joins = append(joins, refField+" *"+refStruct)
+			}
+		}
+		if c.Size > 0 {
+			tags = append(tags, "size:"+strconv.Itoa(c.Size))
+		}
+		if !c.Nullable && !c.Pk {
+			tags = append(tags, "notnull")
+		}
+		if c.Default != "" && !c.Pk && !strings.ContainsAny(c.Default, ",:\"`") {
+			tags = append(tags, "default:"+c.Default)
+		}
+		if i, ok := indexed[c.Name]; ok && !c.Pk && refField == "" {
+			if i.Unique {
+				tags = append(tags, "unique")
+			} else {
+				tags = append(tags, "index")
+			}
+		}
+		var structTags []string
+		if len(tags) > 0 {
+			structTags = append(structTags, TagKey+`:"`+strings.Join(tags, ",")+`"`)
+		}
+		if naming.ColumnName(field) != c.Name {
+			if len(ColumnTagKeys) == 0 {
+				return fmt.Errorf("column %v of table %v can not be mapped from the field name %v, set ColumnTagKeys to tag it",
+					c.Name, t.Name, field)
+			}
+			structTags = append(structTags, ColumnTagKeys[0]+`:"`+c.Name+`"`)
+		}
+		if c.Nullable && !c.Pk {
+			switch goType {
+			case "bool", "int64", "float64", "string":
+				goType = "*" + goType
+			}
+		}
+		fmt.Fprintf(buf, "%v %v", field, goType)
+		if len(structTags) > 0 {
+			fmt.Fprintf(buf, " `%v`", strings.Join(structTags, " "))
+		}
+		buf.WriteString("\n")
+	}
+	for _, join := range joins {
+		buf.WriteString(join + "\n")
+	}
+	buf.WriteString("}\n")
+	if naming.TableName(name) != t.Name {
+		fmt.Fprintf(buf, "\nfunc (*%v) TableName() string {\nreturn %q\n}\n", name, t.Name)
+	}
+	if len(multiIndexes) > 0 {
+		imports["github.com/coocood/qbs"] = true
+		fmt.Fprintf(buf, "\nfunc (*%v) Indexes(indexes *qbs.Indexes) {\n", name)
+		for _, i := range multiIndexes {
+			add := "Add"
+			if i.Unique {
+				add = "AddUnique"
+			}
+			quoted := make([]string, len(i.Columns))
+			for j, column := range i.Columns {
+				quoted[j] = strconv.Quote(column)
+			}
+			fmt.Fprintf(buf, "indexes.%v(%v)\n", add, strings.Join(quoted, ", "))
+		}
+		buf.WriteString("}\n")
+	}
+	return nil
+}
+
+// GoType returns the Go type of the field of the column, like "int64" or "time.Time", GenerateModels declares.
+func (c *ColumnMeta) GoType() string {
+	return columnGoType(c)
+}
+
+// columnGoType maps the data type of the column to the Go type of the field.
+func columnGoType(c *ColumnMeta) string {
+	t := strings.ToLower(c.DataType)
+	switch {
+	case strings.HasPrefix(t, "bool"):
+		return "bool"
+	case strings.HasPrefix(t, "timestamp"), t == "date", t == "datetime":
+		return "time.Time"
+	}
+	switch t {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		return "int64"
+	case "float", "double", "double precision", "real", "decimal", "numeric", "number":
+		return "float64"
+	case "bytea", "blob", "tinyblob", "mediumblob", "longblob", "binary", "varbinary":
+		return "[]byte"
+	}
+	return "string"
+}
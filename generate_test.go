@@ -0,0 +1,82 @@
+package qbs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGenerateModels(t *testing.T) {
+	assert := NewAssert(t)
+	tables := []*TableMeta{
+		{
+			Name: "author",
+			Columns: []*ColumnMeta{
+				{Name: "id", DataType: "bigint", Pk: true},
+				{Name: "name", DataType: "varchar", Size: 64},
+				{Name: "email", DataType: "varchar", Size: 128, Nullable: true},
+			},
+			Indexes: []*IndexMeta{{Name: "author_email", Columns: []string{"email"}, Unique: true}},
+		},
+		{
+			Name: "tblPosts",
+			Columns: []*ColumnMeta{
+				{Name: "id", DataType: "integer", Pk: true},
+				{Name: "author_id", DataType: "bigint"},
+				{Name: "title", DataType: "text", Default: "''"},
+				{Name: "score", DataType: "double precision", Nullable: true},
+				{Name: "created", DataType: "timestamp with time zone"},
+			},
+			Indexes:     []*IndexMeta{{Name: "tbl_posts_title_created", Columns: []string{"title", "created"}}},
+			ForeignKeys: []*ForeignKeyMeta{{Column: "author_id", RefTable: "author", RefColumn: "id"}},
+		},
+	}
+	buf := new(bytes.Buffer)
+	assert.MustNil(GenerateModels(buf, tables, GenerateOptions{Package: "blog"}))
+	assert.Equal(`// Code generated by qbs.GenerateModels from the database schema.
+
+package blog
+
+import (
+	"time"
+
+	"github.com/coocood/qbs"
+)
+
+type Author struct {
+	Id    int64
+	Name  string  `+"`qbs:\"size:64,notnull\"`"+`
+	Email *string `+"`qbs:\"size:128,unique\"`"+`
+}
+
+type TblPosts struct {
+	Id       int64
+	AuthorId int64  `+"`qbs:\"fk:Author,notnull\"`"+`
+	Title    string `+"`qbs:\"notnull,default:''\"`"+`
+	Score    *float64
+	Created  time.Time `+"`qbs:\"notnull\"`"+`
+	Author   *Author
+}
+
+func (*TblPosts) TableName() string {
+	return "tblPosts"
+}
+
+func (*TblPosts) Indexes(indexes *qbs.Indexes) {
+	indexes.Add("title", "created")
+}
+`, buf.String())
+
+	tables[0].Columns[1].Name = "fullName"
+	assert.NotNil(GenerateModels(new(bytes.Buffer), tables, GenerateOptions{}))
+}
+
+func TestTableMetaModel(t *testing.T) {
+	assert := NewAssert(t)
+	table := &TableMeta{Name: "user", Columns: []*ColumnMeta{
+		{Name: "id", DataType: "int64", Pk: true},
+		{Name: "name", DataType: "string", Size: 64},
+		{Name: "age", DataType: "integer", Nullable: true},
+	}}
+	assert.Equal("CREATE TABLE IF NOT EXISTS `user` ( `id` bigint PRIMARY KEY AUTO_INCREMENT, "+
+		"`name` varchar(64) NOT NULL, `age` bigint )", NewMysql().createTableSql(tableMetaModel(table), true))
+}
@@ -0,0 +1,53 @@
+package qbs
+
+import (
+	"reflect"
+)
+
+// BeforeSaver is called by Save and Update before the struct is written, an error aborts the write.
+type BeforeSaver interface {
+	BeforeSave(*Qbs) error
+}
+
+// AfterSaver is called by Save and Update after the struct is written.
+type AfterSaver interface {
+	AfterSave(*Qbs) error
+}
+
+// BeforeDeleter is called by Delete before the rows are deleted, an error aborts the delete.
+type BeforeDeleter interface {
+	BeforeDelete(*Qbs) error
+}
+
+// AfterDeleter is called by Delete after the rows are deleted.
+type AfterDeleter interface {
+	AfterDelete(*Qbs) error
+}
+
+// AfterFinder is called by Find and FindAll for every struct read.
+type AfterFinder interface {
+	AfterFind(*Qbs) error
+}
+
+// callHook calls the hook with the Qbs, which is in the transaction of the call if any,
+// the criteria of the call is kept while the hook runs its own queries.
+func (q *Qbs) callHook(hook func(*Qbs) error) error {
+	crit := q.criteria
+	q.criteria = new(criteria)
+	defer func() {
+		q.criteria = crit
+	}()
+	return hook(q)
+}
+
+// afterFind calls AfterFind of the struct pointers of the slice from index start.
+func (q *Qbs) afterFind(sliceValue reflect.Value, start int) error {
+	for i := start; i < sliceValue.Len(); i++ {
+		if finder, ok := sliceValue.Index(i).Interface().(AfterFinder); ok {
+			if err := q.callHook(finder.AfterFind); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package qbs
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// TableMeta describes a table of the database, returned by Inspect.
+type TableMeta struct {
+	Name        string
+	Columns     []*ColumnMeta
+	Indexes     []*IndexMeta // the indexes other than the primary key
+	ForeignKeys []*ForeignKeyMeta
+}
+
+// ColumnMeta describes a column of a TableMeta.
+type ColumnMeta struct {
+	Name     string
+	DataType string // the type name of the database, e.g. "varchar"
+	Nullable bool
+	Size     int    // the maximum length of a character column, 0 if not limited
+	Default  string // the default expression, empty if there is none
+	Pk       bool
+}
+
+// IndexMeta describes an index of a TableMeta.
+type IndexMeta struct {
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// ForeignKeyMeta describes a single column foreign key of a TableMeta.
+type ForeignKeyMeta struct {
+	Column    string
+	RefTable  string
+	RefColumn string
+}
+
+// Inspect reads the tables of the current database or schema, with their columns, indexes and foreign keys,
+// e.g. to generate the structs of a legacy database with GenerateModels.
+// The tables and columns are ordered by name and position.
+func Inspect(db *sql.DB, dialect Dialect) ([]*TableMeta, error) {
+	tablesSql, columnsSql, indexesSql, foreignKeysSql := dialect.inspectSqls()
+	if tablesSql == "" {
+		return nil, errors.New("the dialect doesn't support Inspect")
+	}
+	var tables []*TableMeta
+	byName := make(map[string]*TableMeta)
+	err := inspectRows(db, tablesSql, func(scan func(...interface{}) error) error {
+		t := new(TableMeta)
+		if err := scan(&t.Name); err != nil {
+			return err
+		}
+		tables = append(tables, t)
+		byName[t.Name] = t
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = inspectRows(db, columnsSql, func(scan func(...interface{}) error) error {
+		var table, nullable string
+		var size sql.NullInt64
+		var dfault sql.NullString
+		var pk sql.NullBool
+		c := new(ColumnMeta)
+		if err := scan(&table, &c.Name, &c.DataType, &nullable, &size, &dfault, &pk); err != nil {
+			return err
+		}
+		if t := byName[table]; t != nil {
+			c.Nullable = nullable == "YES"
+			if strings.Contains(strings.ToLower(c.DataType), "char") {
+				c.Size = int(size.Int64)
+			}
+			c.Default = dfault.String
+			c.Pk = pk.Bool
+			t.Columns = append(t.Columns, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = inspectRows(db, indexesSql, func(scan func(...interface{}) error) error {
+		var table, name, column string
+		var unique sql.NullBool
+		if err := scan(&table, &name, &column, &unique); err != nil {
+			return err
+		}
+		t := byName[table]
+		if t == nil {
+			return nil
+		}
+		if n := len(t.Indexes); n > 0 && t.Indexes[n-1].Name == name {
+			t.Indexes[n-1].Columns = append(t.Indexes[n-1].Columns, column)
+		} else {
+			t.Indexes = append(t.Indexes, &IndexMeta{name, []string{column}, unique.Bool})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = inspectRows(db, foreignKeysSql, func(scan func(...interface{}) error) error {
+		var table string
+		fk := new(ForeignKeyMeta)
+		if err := scan(&table, &fk.Column, &fk.RefTable, &fk.RefColumn); err != nil {
+			return err
+		}
+		if t := byName[table]; t != nil {
+			t.ForeignKeys = append(t.ForeignKeys, fk)
+		}
+		return nil
+	})
+	return tables, err
+}
+
+func inspectRows(db *sql.DB, query string, row func(scan func(...interface{}) error) error) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = row(rows.Scan); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
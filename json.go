@@ -0,0 +1,62 @@
+package qbs
+
+import (
+	sqldriver "database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// jsonValue is the value of a `qbs:"json"` field, it's written as JSON text, a nil map, slice or pointer as NULL.
+type jsonValue struct {
+	v interface{}
+}
+
+func (j jsonValue) Value() (sqldriver.Value, error) {
+	value := reflect.ValueOf(j.v)
+	switch value.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Ptr:
+		if value.IsNil() {
+			return nil, nil
+		}
+	}
+	data, err := json.Marshal(j.v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (j jsonValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.v)
+}
+
+func (j jsonValue) String() string {
+	data, _ := j.MarshalJSON()
+	return string(data)
+}
+
+// isJSONField reports if the struct field is tagged `qbs:"json"`.
+func isJSONField(field reflect.StructField) bool {
+	for _, option := range strings.Split(field.Tag.Get(TagKey), ",") {
+		if option == "json" {
+			return true
+		}
+	}
+	return false
+}
+
+// setJSONValue unmarshals the JSON text scanned from a `qbs:"json"` column into the field.
+func setJSONValue(driverValue, fieldValue reflect.Value) error {
+	var data []byte
+	switch v := driverValue.Elem().Interface().(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("can not unmarshal %T of a json column", v)
+	}
+	return json.Unmarshal(data, fieldValue.Addr().Interface())
+}
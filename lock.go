@@ -0,0 +1,105 @@
+package qbs
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// MigrationLockTable is the table holding the locks of WithLock for the databases without advisory locks.
+var MigrationLockTable = "qbs_migration_lock"
+
+// LockPollInterval is how often WithLock retries to take a lock held in the MigrationLockTable.
+var LockPollInterval = 100 * time.Millisecond
+
+type migrationLock struct {
+	Name string `qbs:"pk,size:255"`
+}
+
+func (*migrationLock) TableName() string {
+	return MigrationLockTable
+}
+
+// WithLock runs the task while holding the named lock of the database, so when multiple instances
+// migrate at boot, only one of them migrates at a time while the others wait for it.
+// The task should skip the changes already applied, e.g. with CreateTableIfNotExists.
+// Mysql and postgres use advisory locks, which are released if the connection is lost,
+// other databases insert a row into the MigrationLockTable, which has to be deleted manually
+// if the process dies while holding the lock. No lock is taken in a dry run.
+func (mg *Migration) WithLock(name string, task func(mg *Migration) error) (err error) {
+	if mg.dryRun != nil {
+		return task(mg)
+	}
+	ctx := context.Background()
+	conn, err := mg.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = mg.lock(ctx, conn, name); err != nil {
+		return err
+	}
+	defer func() {
+		if unlockErr := mg.unlock(ctx, conn, name); err == nil {
+			err = unlockErr
+		}
+	}()
+	return task(mg)
+}
+
+func (mg *Migration) lock(ctx context.Context, conn *sql.Conn, name string) error {
+	lockSql, _ := mg.dialect.lockSql()
+	if lockSql != "" {
+		var result interface{}
+		return mg.lockExec(ctx, conn, lockSql, name, &result)
+	}
+	if err := mg.CreateTableIfNotExists(new(migrationLock)); err != nil {
+		return err
+	}
+	table := mg.dialect.quote(MigrationLockTable)
+	column := mg.dialect.quote("name")
+	released := false
+	for {
+		err := mg.lockExec(ctx, conn, "INSERT INTO "+table+" ("+column+") VALUES (?)", name, nil)
+		if err == nil {
+			return nil
+		}
+		var held int64
+		if mg.lockExec(ctx, conn, "SELECT COUNT(*) FROM "+table+" WHERE "+column+" = ?", name, &held) != nil {
+			return err
+		}
+		if held == 0 {
+			//the insert failed for another reason than the held lock, unless the holder released it meanwhile.
+			if released {
+				return err
+			}
+			released = true
+			continue
+		}
+		released = false
+		time.Sleep(LockPollInterval)
+	}
+}
+
+func (mg *Migration) unlock(ctx context.Context, conn *sql.Conn, name string) error {
+	_, unlockSql := mg.dialect.lockSql()
+	if unlockSql != "" {
+		var result interface{}
+		return mg.lockExec(ctx, conn, unlockSql, name, &result)
+	}
+	table := mg.dialect.quote(MigrationLockTable)
+	return mg.lockExec(ctx, conn, "DELETE FROM "+table+" WHERE "+mg.dialect.quote("name")+" = ?", name, nil)
+}
+
+// lockExec executes the statement on the connection holding the lock, the single result is scanned into dest if not nil.
+func (mg *Migration) lockExec(ctx context.Context, conn *sql.Conn, query, name string, dest interface{}) error {
+	start := time.Now()
+	var err error
+	if dest == nil {
+		_, err = conn.ExecContext(ctx, mg.dialect.substituteMarkers(query), name)
+	} else {
+		err = conn.QueryRowContext(ctx, mg.dialect.substituteMarkers(query), name).Scan(dest)
+	}
+	mg.log(query, []interface{}{name}, start, err)
+	return err
+}
@@ -0,0 +1,197 @@
+package qbs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// LogLevel selects the statements logged by a Qbs or Migration, levels can be combined, e.g. LogDDL|LogErrors.
+type LogLevel int
+
+const (
+	LogErrors LogLevel = 1 << iota // failed statements
+	LogDDL                         // CREATE, ALTER and DROP statements
+	LogDML                         // SELECT, INSERT, UPDATE and DELETE statements
+	LogTx                          // transaction boundaries
+	LogAll    = LogErrors | LogDDL | LogDML | LogTx
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogErrors:
+		return "error"
+	case LogDDL:
+		return "ddl"
+	case LogDML:
+		return "dml"
+	case LogTx:
+		return "tx"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// statementLevel returns the level of a statement by its first keyword.
+func statementLevel(query string) LogLevel {
+	switch firstKeyword(query) {
+	case "CREATE", "ALTER", "DROP", "TRUNCATE", "RENAME", "COMMENT":
+		return LogDDL
+	case "BEGIN", "COMMIT", "ROLLBACK", "SAVEPOINT", "RELEASE":
+		return LogTx
+	}
+	return LogDML
+}
+
+func firstKeyword(query string) string {
+	return strings.ToUpper(strings.SplitN(strings.TrimSpace(query), " ", 2)[0])
+}
+
+// Logger receives every statement executed by a Qbs or Migration whose LogLevel is enabled,
+// e.g. to trace the queries of a request.
+type Logger interface {
+	LogQuery(sql string, args []interface{}, duration time.Duration, err error)
+}
+
+// NewWriterLogger writes a line per statement, or a JSON object if json is true.
+func NewWriterLogger(w io.Writer, json bool) Logger {
+	return writerLogger{w, json}
+}
+
+// NewStdLogger prints statements with a log.Logger.
+func NewStdLogger(logger *log.Logger) Logger {
+	return writerLogger{loggerWriter{logger}, false}
+}
+
+// NewSlogLogger logs statements at info level, failed statements at error level.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return slogLogger{logger}
+}
+
+// SlowQueryLogger passes only failed statements and statements that took at least threshold to the logger.
+func SlowQueryLogger(logger Logger, threshold time.Duration) Logger {
+	return slowQueryLogger{logger, threshold}
+}
+
+type logEntry struct {
+	Time       time.Time     `json:"time"`
+	Level      string        `json:"level"`
+	SQL        string        `json:"sql"`
+	Args       []interface{} `json:"args,omitempty"`
+	DurationMs float64       `json:"duration_ms"`
+	Error      string        `json:"error,omitempty"`
+}
+
+type writerLogger struct {
+	output io.Writer
+	json   bool
+}
+
+func (l writerLogger) LogQuery(query string, args []interface{}, duration time.Duration, err error) {
+	if l.json {
+		entry := logEntry{Time: time.Now(), Level: statementLevel(query).String(), SQL: query, Args: args}
+		entry.DurationMs = float64(duration) / float64(time.Millisecond)
+		if err != nil {
+			entry.Level = LogErrors.String()
+			entry.Error = err.Error()
+		}
+		line, _ := json.Marshal(entry)
+		l.output.Write(append(line, '\n'))
+		return
+	}
+	line := query
+	if len(args) > 0 {
+		line += " " + fmt.Sprint(args)
+	}
+	if err != nil {
+		line += " error: " + err.Error()
+	}
+	fmt.Fprintln(l.output, line)
+}
+
+// loggerWriter writes lines with the prefix and flags of a log.Logger.
+type loggerWriter struct {
+	logger *log.Logger
+}
+
+func (w loggerWriter) Write(p []byte) (int, error) {
+	w.logger.Print(string(p))
+	return len(p), nil
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (l slogLogger) LogQuery(query string, args []interface{}, duration time.Duration, err error) {
+	attrs := []slog.Attr{slog.String("sql", query), slog.Any("args", args), slog.Duration("duration", duration)}
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	l.logger.LogAttrs(context.Background(), level, "qbs: "+statementLevel(query).String(), attrs...)
+}
+
+type slowQueryLogger struct {
+	logger    Logger
+	threshold time.Duration
+}
+
+func (l slowQueryLogger) LogQuery(query string, args []interface{}, duration time.Duration, err error) {
+	if err != nil || duration >= l.threshold {
+		l.logger.LogQuery(query, args, duration, err)
+	}
+}
+
+// logEnabled reports if the statement, or LogErrors for a failed statement, is in the level.
+func logEnabled(level LogLevel, query string, err error) bool {
+	return level&statementLevel(query) != 0 || (err != nil && level&LogErrors != 0)
+}
+
+func (q *Qbs) log(query string, args []interface{}, start time.Time, err error) {
+	level := q.LogLevel
+	if level == 0 && (q.Log || q.Logger != nil) {
+		level = LogAll
+	}
+	if !logEnabled(level, query, err) {
+		return
+	}
+	logger := q.Logger
+	if logger == nil {
+		if q.LogOutput != nil {
+			logger = writerLogger{q.LogOutput, q.LogJSON}
+		} else if queryLogger == nil {
+			return
+		} else if q.LogJSON {
+			logger = writerLogger{queryLogger.Writer(), true}
+		} else {
+			logger = NewStdLogger(queryLogger)
+		}
+	}
+	logger.LogQuery(query, args, time.Since(start), err)
+}
+
+func (mg *Migration) log(query string, args []interface{}, start time.Time, err error) {
+	level := mg.LogLevel
+	if level == 0 && (mg.Log || mg.Logger != nil) {
+		level = LogAll
+	}
+	if !logEnabled(level, query, err) {
+		return
+	}
+	logger := mg.Logger
+	if logger == nil {
+		output := mg.LogOutput
+		if output == nil {
+			output = os.Stdout
+		}
+		logger = writerLogger{output, mg.LogJSON}
+	}
+	logger.LogQuery(query, args, time.Since(start), err)
+}
@@ -0,0 +1,78 @@
+package qbs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogLevel(t *testing.T) {
+	assert := NewAssert(t)
+	assert.Equal(LogDDL, statementLevel("CREATE TABLE a (id bigint)"))
+	assert.Equal(LogDDL, statementLevel(" alter table a add column b int"))
+	assert.Equal(LogTx, statementLevel("COMMIT"))
+	assert.Equal(LogDML, statementLevel("SELECT 1"))
+
+	buf := new(bytes.Buffer)
+	q := &Qbs{LogLevel: LogDDL | LogErrors, LogOutput: buf}
+	q.log("SELECT 1", nil, time.Now(), nil)
+	q.log("BEGIN", nil, time.Now(), nil)
+	assert.Equal("", buf.String())
+	q.log("DROP TABLE a", nil, time.Now(), nil)
+	q.log("SELECT ?", []interface{}{1}, time.Now(), errors.New("failed"))
+	assert.Equal("DROP TABLE a\nSELECT ? [1] error: failed\n", buf.String())
+
+	buf.Reset()
+	q = &Qbs{Log: true, LogOutput: buf, LogJSON: true}
+	q.log("BEGIN", nil, time.Now(), nil)
+	q.log("INSERT INTO a (b) VALUES (?)", []interface{}{"c"}, time.Now(), nil)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(2, len(lines))
+	var entry logEntry
+	assert.MustNil(json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal("dml", entry.Level)
+	assert.Equal("INSERT INTO a (b) VALUES (?)", entry.SQL)
+	assert.Equal("c", entry.Args[0])
+	assert.Equal("", entry.Error)
+}
+
+type recordingLogger struct {
+	queries   []string
+	durations []time.Duration
+}
+
+func (l *recordingLogger) LogQuery(sql string, args []interface{}, duration time.Duration, err error) {
+	l.queries = append(l.queries, sql)
+	l.durations = append(l.durations, duration)
+}
+
+func TestLogger(t *testing.T) {
+	assert := NewAssert(t)
+	recorder := new(recordingLogger)
+	q := &Qbs{Logger: recorder}
+	q.log("SELECT 1", nil, time.Now().Add(-time.Second), nil)
+	assert.Equal(1, len(recorder.queries))
+	assert.True(recorder.durations[0] >= time.Second)
+
+	recorder = new(recordingLogger)
+	mg := &Migration{Logger: SlowQueryLogger(recorder, 100*time.Millisecond), LogLevel: LogDDL | LogErrors}
+	mg.log("CREATE TABLE a (id bigint)", nil, time.Now(), nil)
+	mg.log("CREATE TABLE b (id bigint)", nil, time.Now().Add(-time.Second), nil)
+	mg.log("INSERT INTO b (id) VALUES (1)", nil, time.Now().Add(-time.Second), nil)
+	mg.log("INSERT INTO b (id) VALUES (1)", nil, time.Now(), errors.New("duplicate"))
+	assert.Equal(2, len(recorder.queries))
+	assert.Equal("CREATE TABLE b (id bigint)", recorder.queries[0])
+
+	buf := new(bytes.Buffer)
+	q = &Qbs{Logger: NewSlogLogger(slog.New(slog.NewJSONHandler(buf, nil)))}
+	q.log("DELETE FROM a WHERE id = ?", []interface{}{3}, time.Now(), errors.New("failed"))
+	var record map[string]interface{}
+	assert.MustNil(json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal("ERROR", record["level"])
+	assert.Equal("DELETE FROM a WHERE id = ?", record["sql"])
+	assert.Equal("failed", record["error"])
+}
@@ -2,61 +2,203 @@ package qbs
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 )
 
 type Migration struct {
-	db      *sql.DB
-	dbName  string
-	dialect Dialect
-	Log     bool
+	db        *sql.DB
+	dbName    string
+	dialect   Dialect
+	Log       bool
+	LogLevel  LogLevel         //The statements to log, LogAll if Log is true and LogLevel is 0.
+	LogOutput io.Writer        //Standard output is used if nil.
+	LogJSON   bool             //Write a JSON object per statement instead of plain text.
+	Logger    Logger           //Receives the logged statements instead of LogOutput.
+	EventSink EventSink        //Receives a ChangeEvent for every table changed by the migration.
+	Naming    NamingConvention //The package level naming functions are used if nil.
+	shared    bool             //the db is the registered one and not closed by Close.
+	dryRun    *[]string        //the statements recorded by DryRun.
+	schema    string           //the schema set by WithSchema.
+	seeds     []seed           //the seeds added by Seed in order.
 }
 
 // CreateTableIfNotExists creates a new table and its indexes based on the table struct type
 // It will panic if table creation failed, and it will return error if the index creation failed.
 func (mg *Migration) CreateTableIfNotExists(structPtr interface{}) error {
-	model := structPtrToModel(structPtr, true, nil)
-	sql := mg.dialect.createTableSql(model, true)
-	if mg.Log {
-		fmt.Println(sql)
+	return mg.createTableIfNotExists(structPtrToNamedModel(structPtr, true, nil, mg.naming()))
+}
+
+func (mg *Migration) createTableIfNotExists(model *model) error {
+	event := &ChangeEvent{Table: model.table}
+	if mg.EventSink != nil {
+		event.TableCreated = len(mg.dialect.columnsInTable(mg, model.table)) == 0
 	}
+	mg.createSchemaIfNotExists(model.table)
+	sql := mg.dialect.createTableSql(model, true)
 	sqls := strings.Split(sql, ";")
 	for _, v := range sqls {
+		if mg.record(v) {
+			continue
+		}
+		start := time.Now()
 		_, err := mg.db.Exec(v)
+		mg.log(v, nil, start, err)
 		if err != nil && !mg.dialect.catchMigrationError(err) {
 			panic(err)
 		}
 	}
 	columns := mg.dialect.columnsInTable(mg, model.table)
-	if len(model.fields) > len(columns) {
+	notCreated := mg.dryRun != nil && len(columns) == 0 //the table is not created in a dry run.
+	if (len(model.fields) > len(columns) || renamesColumns(model, columns)) && !notCreated {
 		oldFields := []*modelField{}
 		newFields := []*modelField{}
+		renamedFields := []*modelField{}
 		for _, v := range model.fields {
 			if _, ok := columns[v.name]; ok {
 				oldFields = append(oldFields, v)
+			} else if _, ok := columns[v.renameFrom]; ok && v.renameFrom != "" {
+				renamedFields = append(renamedFields, v)
 			} else {
 				newFields = append(newFields, v)
 			}
 		}
-		if len(oldFields) != len(columns) {
-			panic("Column name has changed, rename column migration is not supported.")
+		if len(oldFields)+len(renamedFields) != len(columns) {
+			panic("Column name has changed, tag the field with rename_from to rename the column.")
+		}
+		for _, v := range renamedFields {
+			if err := mg.renameColumn(model.table, v.renameFrom, v); err != nil {
+				panic(err)
+			}
+			event.RenamedColumns = append(event.RenamedColumns, v.renameFrom+" "+v.name)
 		}
 		for _, v := range newFields {
 			mg.addColumn(model.table, v)
+			event.AddedColumns = append(event.AddedColumns, v.name)
 		}
 	}
 	var indexErr error
 	for _, i := range model.indexes {
-		indexErr = mg.CreateIndexIfNotExists(model.table, i.name, i.unique, i.columns...)
+		var created bool
+		created, indexErr = mg.createIndexIfNotExists(model.table, i.name, i.unique, i.where, i.columns...)
+		if created {
+			event.CreatedIndexes = append(event.CreatedIndexes, unqualified(model.table)+"_"+i.name)
+		}
+	}
+	if indexErr == nil {
+		mg.publish(event)
 	}
 	return indexErr
 }
 
+// CreateTableSQL returns the statements CreateTableIfNotExists executes for a new table of the struct,
+// including its schema and indexes, as a SQL script of one statement per line terminated by a semicolon.
+// The database is not queried, so it can be called on a migration without a connection.
+// Partial indexes are left out on the dialects not supporting them.
+func (mg *Migration) CreateTableSQL(structPtr interface{}) string {
+	model := structPtrToNamedModel(structPtr, true, nil, mg.naming())
+	var sqls []string
+	if schema, _ := splitSchema(model.table); schema != "" {
+		sqls = append(sqls, mg.dialect.createSchemaSql(schema))
+	}
+	sqls = append(sqls, strings.Split(mg.dialect.createTableSql(model, true), ";")...)
+	for _, i := range model.indexes {
+		if i.where != "" && !mg.dialect.supportsPartialIndex() {
+			continue
+		}
+		sql := mg.dialect.createIndexSql(unqualified(model.table)+"_"+i.name, model.table, i.unique, i.columns...)
+		if i.where != "" {
+			sql += " WHERE " + i.where
+		}
+		sqls = append(sqls, sql)
+	}
+	var statements []string
+	for _, sql := range sqls {
+		if sql = strings.TrimSpace(sql); sql != "" {
+			statements = append(statements, sql)
+		}
+	}
+	script := new(strings.Builder)
+	WriteScript(script, statements)
+	return script.String()
+}
+
+// CreateTablesIfNotExists creates the tables of the struct pointers like CreateTableIfNotExists,
+// tables referenced by a `qbs:"fk"` field are created first, so the order of the arguments doesn't matter.
+func (mg *Migration) CreateTablesIfNotExists(structPtrs ...interface{}) error {
+	ordered, err := mg.orderByReferences(structPtrs)
+	if err != nil {
+		return err
+	}
+	for _, structPtr := range ordered {
+		if err := mg.CreateTableIfNotExists(structPtr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderByReferences sorts the struct pointers topologically by their foreign key references to each other,
+// references to tables which are not in the slice are ignored.
+func (mg *Migration) orderByReferences(structPtrs []interface{}) ([]interface{}, error) {
+	models := make([]*model, len(structPtrs))
+	byTable := make(map[string]int, len(structPtrs))
+	for i, structPtr := range structPtrs {
+		models[i] = structPtrToNamedModel(structPtr, true, nil, mg.naming())
+		byTable[models[i].table] = i
+	}
+	const visiting, visited = 1, 2
+	states := make([]int, len(models))
+	ordered := make([]interface{}, 0, len(structPtrs))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch states[i] {
+		case visiting:
+			return errors.New("circular foreign key references of table " + models[i].table)
+		case visited:
+			return nil
+		}
+		states[i] = visiting
+		names := make([]string, 0, len(models[i].refs))
+		for name := range models[i].refs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			ref := models[i].refs[name]
+			if j, ok := byTable[ref.model.table]; ok && ref.foreignKey && j != i {
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+		states[i] = visited
+		ordered = append(ordered, structPtrs[i])
+		return nil
+	}
+	for i := range models {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
 // this is only used for testing.
 func (mg *Migration) dropTableIfExists(structPtr interface{}) {
-	tn := tableName(structPtr)
-	_, err := mg.db.Exec(mg.dialect.dropTableSql(tn))
+	tn := namedTableName(structPtr, mg.naming())
+	sql := mg.dialect.dropTableSql(tn)
+	if mg.record(sql) {
+		return
+	}
+	start := time.Now()
+	_, err := mg.db.Exec(sql)
+	mg.log(sql, nil, start, err)
 	if err != nil && !mg.dialect.catchMigrationError(err) {
 		panic(err)
 	}
@@ -71,37 +213,799 @@ func (mg *Migration) DropTable(strutPtr interface{}) {
 	mg.dropTableIfExists(strutPtr)
 }
 
+// renamesColumns reports if a field is tagged rename_from a column of the table which is not renamed yet.
+func renamesColumns(model *model, columns map[string]bool) bool {
+	for _, v := range model.fields {
+		if v.renameFrom != "" && columns[v.renameFrom] && !columns[v.name] {
+			return true
+		}
+	}
+	return false
+}
+
+// RenameColumn renames the column oldName of the table of the struct to the column of the field.
+// CreateTableIfNotExists and AutoDiff rename the column of a field tagged `qbs:"rename_from:old_name"` as well.
+func (mg *Migration) RenameColumn(structPtr interface{}, oldName, fieldName string) error {
+	model := structPtrToNamedModel(structPtr, false, nil, mg.naming())
+	column := model.field(fieldName)
+	if column == nil {
+		return errors.New("no column for field " + fieldName)
+	}
+	return mg.renameColumn(model.table, oldName, column)
+}
+
+func (mg *Migration) renameColumn(table, oldName string, column *modelField) error {
+	return mg.exec(mg.dialect.renameColumnSql(table, oldName, *column))
+}
+
 func (mg *Migration) addColumn(table string, column *modelField) {
 	sql := mg.dialect.addColumnSql(table, *column)
-	if mg.Log {
-		fmt.Println(sql)
+	if mg.record(sql) {
+		return
 	}
+	start := time.Now()
 	_, err := mg.db.Exec(sql)
+	mg.log(sql, nil, start, err)
 	if err != nil {
 		panic(err)
 	}
 }
 
+// AutoDiff compares two versions of the struct of a table and returns the ALTER TABLE statements which turn the
+// table of prev into the table of curr: added and dropped columns, columns whose type changed, and renamed columns.
+// A dropped column and an added column of the same type are considered a rename if one name is the other
+// name with a suffix, like "name" and "name_v2", or the added one is tagged `qbs:"rename_from"` the dropped one. If table is empty, the table name of curr is used.
+// An error is returned if the dialect can not change a column type in place.
+func (mg *Migration) AutoDiff(table string, prev, curr interface{}) ([]string, error) {
+	prevModel := structPtrToNamedModel(prev, false, nil, mg.naming())
+	currModel := structPtrToNamedModel(curr, false, nil, mg.naming())
+	if table == "" {
+		table = currModel.table
+	}
+	prevFields := make(map[string]*modelField)
+	for _, f := range prevModel.fields {
+		prevFields[f.name] = f
+	}
+	currFields := make(map[string]bool)
+	for _, f := range currModel.fields {
+		currFields[f.name] = true
+	}
+	var dropped []*modelField
+	for _, f := range prevModel.fields {
+		if !currFields[f.name] {
+			dropped = append(dropped, f)
+		}
+	}
+	var statements []string
+	for _, f := range currModel.fields {
+		old, ok := prevFields[f.name]
+		if !ok {
+			if i := renamedColumn(mg.dialect, dropped, f); i >= 0 {
+				statements = append(statements, mg.dialect.renameColumnSql(table, dropped[i].name, *f))
+				dropped = append(dropped[:i], dropped[i+1:]...)
+			} else {
+				statements = append(statements, mg.dialect.addColumnSql(table, *f))
+			}
+			continue
+		}
+		if f.pk || mg.dialect.sqlType(*old) == mg.dialect.sqlType(*f) {
+			continue
+		}
+		sqls := mg.dialect.resizeColumnSql(table, *f)
+		if sqls == nil {
+			return nil, errors.New("can not change the type of column " + f.name + " of table " + table + " in place")
+		}
+		statements = append(statements, sqls...)
+	}
+	for _, f := range dropped {
+		statements = append(statements, mg.dialect.dropColumnSql(table, f.name))
+	}
+	return statements, nil
+}
+
+// renamedColumn returns the index of the dropped column which the added column is renamed from, or -1.
+func renamedColumn(dialect Dialect, dropped []*modelField, added *modelField) int {
+	for i, f := range dropped {
+		if added.renameFrom != "" && f.name == added.renameFrom {
+			return i
+		}
+	}
+	found := -1
+	for i, f := range dropped {
+		if dialect.sqlType(*f) != dialect.sqlType(*added) {
+			continue
+		}
+		if strings.HasPrefix(added.name, f.name+"_") || strings.HasPrefix(f.name, added.name+"_") {
+			if found >= 0 {
+				return -1
+			}
+			found = i
+		}
+	}
+	return found
+}
+
+// ApplyAutoDiff executes the statements returned by AutoDiff.
+func (mg *Migration) ApplyAutoDiff(table string, prev, curr interface{}) error {
+	statements, err := mg.AutoDiff(table, prev, curr)
+	if err != nil {
+		return err
+	}
+	for _, sql := range statements {
+		if err = mg.exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddColumnWithBackfill adds the column of a struct field to an existing table in three phases which are safe for
+// large tables: the column is added as nullable, existing rows are backfilled in batches of batchSize rows,
+// each batch in its own transaction, then NOT NULL and the default value are applied.
+// If valueFn is nil, rows are backfilled with the default tag value of the field, otherwise valueFn is called
+// with every row as a struct pointer and returns the value of the new column.
+func (mg *Migration) AddColumnWithBackfill(structPtr interface{}, fieldName string, valueFn func(structPtr interface{}) interface{}, batchSize int) error {
+	model := structPtrToNamedModel(structPtr, false, nil, mg.naming())
+	column := model.field(fieldName)
+	if column == nil {
+		return errors.New("no column for field " + fieldName)
+	}
+	if model.pk == nil {
+		return errors.New("backfill needs a primary key on table " + model.table)
+	}
+	if valueFn == nil && column.dfault == "" {
+		return errors.New("field " + fieldName + " needs either a valueFn or a default tag to backfill")
+	}
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	existing := mg.dialect.columnsInTable(mg, model.table)
+	if !existing[column.name] {
+		if err := mg.exec(mg.dialect.addColumnSql(model.table, *column)); err != nil {
+			return err
+		}
+		existing[column.name] = true
+	}
+	var missing []string //the fields of the columns not added yet are not read.
+	for _, field := range model.fields {
+		if !existing[field.name] {
+			missing = append(missing, field.camelName)
+		}
+	}
+	quotedColumn := mg.dialect.quote(column.name)
+	update := "UPDATE " + mg.dialect.quote(model.table) + " SET " + quotedColumn + " = "
+	if mg.dryRun != nil {
+		if valueFn != nil {
+			return errors.New("backfill of field " + fieldName + " with a valueFn can not be dry run")
+		}
+		if err := mg.exec(update + column.dfault + " WHERE " + quotedColumn + " IS NULL"); err != nil {
+			return err
+		}
+		return mg.setNotNullColumn(model.table, column)
+	}
+	q := mg.newQbs()
+	sliceType := reflect.SliceOf(reflect.TypeOf(structPtr))
+	for {
+		rows := reflect.New(sliceType)
+		err := q.OmitJoin().OmitFields(missing...).Where(quotedColumn + " IS NULL").OrderBy(model.pk.name).Limit(batchSize).FindAll(rows.Interface())
+		if err != nil {
+			return err
+		}
+		slice := rows.Elem()
+		if slice.Len() == 0 {
+			break
+		}
+		if err = q.Begin(); err != nil {
+			return err
+		}
+		pks := make([]interface{}, slice.Len())
+		for i := 0; i < slice.Len(); i++ {
+			row := slice.Index(i)
+			pks[i] = row.Elem().FieldByName(model.pk.camelName).Interface()
+			if valueFn == nil {
+				continue
+			}
+			value := valueFn(row.Interface())
+			if value == nil {
+				q.Rollback()
+				return errors.New("backfill value of field " + fieldName + " can not be nil")
+			}
+			if _, err = q.Exec(update+"? WHERE "+mg.dialect.quote(model.pk.name)+" = ?", value, pks[i]); err != nil {
+				q.Rollback()
+				return err
+			}
+		}
+		if valueFn == nil {
+			in := NewInCondition(mg.dialect.quote(model.pk.name), pks)
+			if _, err = q.Exec(update+column.dfault+" WHERE "+in.expr, pks...); err != nil {
+				q.Rollback()
+				return err
+			}
+		}
+		if err = q.Commit(); err != nil {
+			return err
+		}
+		if slice.Len() < batchSize {
+			break
+		}
+	}
+	return mg.setNotNullColumn(model.table, column)
+}
+
+func (mg *Migration) setNotNullColumn(table string, column *modelField) error {
+	for _, sql := range mg.dialect.setNotNullSql(table, *column) {
+		if err := mg.exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateBlobs rewrites the []byte column of a field with transform, e.g. to re-encode or re-encrypt stored files.
+// Rows are read by primary key in chunks of chunk rows loading only the primary key and the column,
+// each chunk is updated row by row in its own transaction. NULL values are not transformed.
+func (mg *Migration) MigrateBlobs(structPtr interface{}, fieldName string, transform func([]byte) []byte, chunk int) error {
+	return mg.rewriteColumn(structPtr, fieldName, "blob migration", chunk, func(old reflect.Value) (interface{}, bool) {
+		blob, ok := old.Interface().([]byte)
+		if !ok || blob == nil {
+			return nil, false
+		}
+		return transform(blob), true
+	})
+}
+
+// TransformColumn rewrites the column of a field with transform, which is called with the old value as the type
+// of the field and returns the new value, e.g. strings.TrimSpace wrapped for a string field.
+// A NULL value of a pointer field is a nil pointer. Rows are read and updated in chunks as in MigrateBlobs.
+func (mg *Migration) TransformColumn(structPtr interface{}, fieldName string, transform func(old interface{}) interface{}, chunk int) error {
+	return mg.rewriteColumn(structPtr, fieldName, "column transform", chunk, func(old reflect.Value) (interface{}, bool) {
+		return transform(old.Interface()), true
+	})
+}
+
+// TransformSample is the value of the column of a row before and after a transform.
+type TransformSample struct {
+	Pk     interface{}
+	Before interface{}
+	After  interface{}
+}
+
+// SampleTransform calls transform with the values of the column of n random rows and returns them with the results,
+// the table is not changed, so a transform can be checked before TransformColumn runs it on all the rows.
+func (mg *Migration) SampleTransform(structPtr interface{}, fieldName string, transform func(old interface{}) interface{}, n int) ([]TransformSample, error) {
+	model := structPtrToNamedModel(structPtr, false, nil, mg.naming())
+	column := model.field(fieldName)
+	if column == nil {
+		return nil, errors.New("no column for field " + fieldName)
+	}
+	if model.pk == nil {
+		return nil, errors.New("transform sample needs a primary key on table " + model.table)
+	}
+	field, _ := reflect.TypeOf(structPtr).Elem().FieldByName(fieldName)
+	query := fmt.Sprintf("SELECT %v, %v FROM %v ORDER BY %v LIMIT ?", mg.dialect.quote(model.pk.name),
+		mg.dialect.quote(column.name), mg.dialect.quote(model.table), mg.dialect.randomSql())
+	pks, values, err := mg.readColumn(mg.dialect.substituteMarkers(query), []interface{}{n}, field.Type)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]TransformSample, len(pks))
+	for i, old := range values {
+		samples[i] = TransformSample{Pk: pks[i], Before: old.Interface(), After: transform(old.Interface())}
+	}
+	return samples, nil
+}
+
+// rewriteColumn updates the column of the field for every row rewrite returns true for,
+// the old values are scanned as the type of the field.
+func (mg *Migration) rewriteColumn(structPtr interface{}, fieldName, task string, chunk int, rewrite func(old reflect.Value) (interface{}, bool)) error {
+	model := structPtrToNamedModel(structPtr, false, nil, mg.naming())
+	column := model.field(fieldName)
+	if column == nil {
+		return errors.New("no column for field " + fieldName)
+	}
+	if model.pk == nil {
+		return errors.New(task + " needs a primary key on table " + model.table)
+	}
+	if mg.dryRun != nil {
+		return errors.New(task + " of field " + fieldName + " can not be dry run")
+	}
+	if chunk <= 0 {
+		chunk = 100
+	}
+	field, _ := reflect.TypeOf(structPtr).Elem().FieldByName(fieldName)
+	table, pk, quotedColumn := mg.dialect.quote(model.table), mg.dialect.quote(model.pk.name), mg.dialect.quote(column.name)
+	update := mg.dialect.substituteMarkers(fmt.Sprintf("UPDATE %v SET %v = ? WHERE %v = ?", table, quotedColumn, pk))
+	var last interface{}
+	for {
+		query := fmt.Sprintf("SELECT %v, %v FROM %v", pk, quotedColumn, table)
+		args := []interface{}{}
+		if last != nil {
+			query += " WHERE " + pk + " > ?"
+			args = append(args, last)
+		}
+		query += " ORDER BY " + pk + " LIMIT ?"
+		args = append(args, chunk)
+		pks, values, err := mg.readColumn(mg.dialect.substituteMarkers(query), args, field.Type)
+		if err != nil {
+			return err
+		}
+		if len(pks) == 0 {
+			return nil
+		}
+		tx, err := mg.db.Begin()
+		if err != nil {
+			return err
+		}
+		for i, old := range values {
+			value, ok := rewrite(old)
+			if !ok {
+				continue
+			}
+			logged := value
+			if _, ok := value.([]byte); ok {
+				logged = "<blob>"
+			}
+			start := time.Now()
+			_, err = tx.Exec(update, value, pks[i])
+			mg.log(update, []interface{}{logged, pks[i]}, start, err)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		if len(pks) < chunk {
+			return nil
+		}
+		last = pks[len(pks)-1]
+	}
+}
+
+// readColumn reads the primary key and a column of valueType from every row.
+func (mg *Migration) readColumn(query string, args []interface{}, valueType reflect.Type) (pks []interface{}, values []reflect.Value, err error) {
+	start := time.Now()
+	rows, err := mg.db.Query(query, args...)
+	mg.log(query, args, start, err)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pk interface{}
+		value := reflect.New(valueType)
+		if err = rows.Scan(&pk, value.Interface()); err != nil {
+			return nil, nil, err
+		}
+		pks = append(pks, pk)
+		values = append(values, value.Elem())
+	}
+	return pks, values, rows.Err()
+}
+
+// NullViolationError is returned by SetNotNull if rows have NULL in the column, Pks are the primary keys of these rows.
+type NullViolationError struct {
+	Table  string
+	Column string
+	Pks    []interface{}
+}
+
+func (e *NullViolationError) Error() string {
+	return fmt.Sprintf("%d rows of table %v have NULL %v, primary keys: %v", len(e.Pks), e.Table, e.Column, e.Pks)
+}
+
+// SizeViolationError is returned by ResizeColumn if values in the column exceed the new size,
+// Pks are the primary keys of these rows.
+type SizeViolationError struct {
+	Table  string
+	Column string
+	Size   int
+	Pks    []interface{}
+}
+
+func (e *SizeViolationError) Error() string {
+	return fmt.Sprintf("%d rows of table %v exceed size %d of %v, primary keys: %v", len(e.Pks), e.Table, e.Size, e.Column, e.Pks)
+}
+
+// violatingPks returns the primary keys of the rows matching the where clause,
+// if the table has no primary key, a nil element is returned for every row.
+func (mg *Migration) violatingPks(model *model, where string, args ...interface{}) ([]interface{}, error) {
+	selected := "NULL"
+	if model.pk != nil {
+		selected = mg.dialect.quote(model.pk.name)
+	}
+	query := "SELECT " + selected + " FROM " + mg.dialect.quote(model.table) + " WHERE " + where
+	rows, err := mg.db.Query(mg.dialect.substituteMarkers(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pks []interface{}
+	for rows.Next() {
+		var pk interface{}
+		if err = rows.Scan(&pk); err != nil {
+			return nil, err
+		}
+		if b, ok := pk.([]byte); ok {
+			pk = string(b)
+		}
+		pks = append(pks, pk)
+	}
+	return pks, nil
+}
+
+// SetNotNull applies NOT NULL and the default value tag to the existing column of a struct field.
+// Rows violating the constraint are looked up first, if fixValue is nil a *NullViolationError
+// reporting their primary keys is returned, otherwise they are updated to fixValue.
+// On postgres the constraint is validated before it is applied to minimize locking.
+func (mg *Migration) SetNotNull(structPtr interface{}, fieldName string, fixValue interface{}) error {
+	model := structPtrToNamedModel(structPtr, false, nil, mg.naming())
+	column := model.field(fieldName)
+	if column == nil {
+		return errors.New("no column for field " + fieldName)
+	}
+	isNull := mg.dialect.quote(column.name) + " IS NULL"
+	pks, err := mg.violatingPks(model, isNull)
+	if err != nil {
+		return err
+	}
+	if len(pks) > 0 {
+		if fixValue == nil {
+			return &NullViolationError{Table: model.table, Column: column.name, Pks: pks}
+		}
+		err = mg.exec("UPDATE "+mg.dialect.quote(model.table)+" SET "+mg.dialect.quote(column.name)+" = ? WHERE "+isNull, fixValue)
+		if err != nil {
+			return err
+		}
+	}
+	for _, sql := range mg.dialect.setNotNullSql(model.table, *column) {
+		if err := mg.exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type ResizeStrategy int
+
+const (
+	// ResizeFail makes ResizeColumn return a *SizeViolationError if values exceed the new size.
+	ResizeFail ResizeStrategy = iota
+	// ResizeTruncate makes ResizeColumn truncate values exceeding the new size.
+	ResizeTruncate
+)
+
+// ResizeColumn changes the size of the varchar column of a struct field to newSize, data is preserved.
+// Values longer than the new size are handled according to the strategy.
+// On databases which can't alter a column, the table is rebuilt and the rows are copied.
+func (mg *Migration) ResizeColumn(structPtr interface{}, fieldName string, newSize int, strategy ResizeStrategy) error {
+	model := structPtrToNamedModel(structPtr, true, nil, mg.naming())
+	column := model.field(fieldName)
+	if column == nil {
+		return errors.New("no column for field " + fieldName)
+	}
+	column.size = newSize
+	quotedColumn := mg.dialect.quote(column.name)
+	exceeds := mg.dialect.charLengthSql(quotedColumn) + " > ?"
+	pks, err := mg.violatingPks(model, exceeds, newSize)
+	if err != nil {
+		return err
+	}
+	if len(pks) > 0 {
+		if strategy == ResizeFail {
+			return &SizeViolationError{Table: model.table, Column: column.name, Size: newSize, Pks: pks}
+		}
+		update := "UPDATE " + mg.dialect.quote(model.table) + " SET " + quotedColumn + " = SUBSTR(" + quotedColumn + ", 1, ?) WHERE " + exceeds
+		if err = mg.exec(update, newSize, newSize); err != nil {
+			return err
+		}
+	}
+	sqls := mg.dialect.resizeColumnSql(model.table, *column)
+	if sqls == nil {
+		return mg.rebuildTable(model)
+	}
+	for _, sql := range sqls {
+		if err := mg.exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AlterColumnType changes the type of the column of a struct field to the type the field maps to, e.g. after
+// the field type changed from int32 to string, the values are converted by the database.
+// Nothing is executed if the column already has the type, and the table is rebuilt on databases
+// which can't alter a column.
+func (mg *Migration) AlterColumnType(structPtr interface{}, fieldName string) error {
+	model := structPtrToNamedModel(structPtr, true, nil, mg.naming())
+	column := model.field(fieldName)
+	if column == nil {
+		return errors.New("no column for field " + fieldName)
+	}
+	if mg.dialect.columnType(mg, model.table, column.name) == mg.dialect.sqlType(*column) {
+		return nil
+	}
+	sqls := mg.dialect.alterColumnTypeSql(model.table, *column)
+	if sqls == nil {
+		return mg.rebuildTable(model)
+	}
+	for _, sql := range sqls {
+		if err := mg.exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildTable creates a new table for the model, copies the rows of the existing table into it,
+// then replaces the existing table with it, for databases which can't alter columns.
+func (mg *Migration) rebuildTable(model *model) error {
+	existing := mg.dialect.columnsInTable(mg, model.table)
+	columns := make([]string, 0, len(model.fields))
+	for _, f := range model.fields {
+		if existing[f.name] {
+			columns = append(columns, mg.dialect.quote(f.name))
+		}
+	}
+	rebuilt := *model
+	rebuilt.table = model.table + "_qbs_rebuild"
+	sqls := strings.Split(mg.dialect.createTableSql(&rebuilt, false), ";")
+	sqls = append(sqls,
+		fmt.Sprintf("INSERT INTO %v (%v) SELECT %v FROM %v", mg.dialect.quote(rebuilt.table),
+			strings.Join(columns, ", "), strings.Join(columns, ", "), mg.dialect.quote(model.table)),
+		mg.dialect.dropTableSql(model.table),
+		"ALTER TABLE "+mg.dialect.quote(rebuilt.table)+" RENAME TO "+mg.dialect.quote(model.table),
+	)
+	if mg.dryRun != nil {
+		for _, sql := range sqls {
+			mg.record(sql)
+		}
+		return mg.createIndexes(model)
+	}
+	start := time.Now()
+	tx, err := mg.db.Begin()
+	mg.log("BEGIN", nil, start, err)
+	if err != nil {
+		return err
+	}
+	for _, sql := range sqls {
+		start = time.Now()
+		_, err = tx.Exec(sql)
+		mg.log(sql, nil, start, err)
+		if err != nil {
+			start = time.Now()
+			rollbackErr := tx.Rollback()
+			mg.log("ROLLBACK", nil, start, rollbackErr)
+			return err
+		}
+	}
+	start = time.Now()
+	err = tx.Commit()
+	mg.log("COMMIT", nil, start, err)
+	if err != nil {
+		return err
+	}
+	return mg.createIndexes(model)
+}
+
+func (mg *Migration) createIndexes(model *model) error {
+	for _, i := range model.indexes {
+		if _, err := mg.createIndexIfNotExists(model.table, i.name, i.unique, i.where, i.columns...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mg *Migration) exec(sql string, args ...interface{}) error {
+	return mg.execRedacted(sql, sql, args...)
+}
+
+// execRedacted executes the sql but logs and records the redacted one, for statements with secrets in them.
+func (mg *Migration) execRedacted(sql, redacted string, args ...interface{}) error {
+	if mg.record(redacted, args...) {
+		return nil
+	}
+	start := time.Now()
+	_, err := mg.db.Exec(mg.dialect.substituteMarkers(sql), args...)
+	mg.log(redacted, args, start, err)
+	return err
+}
+
+// InsertRow inserts a row of column values into the table, the values are passed as parameters,
+// for seeding data in migrations without a struct type.
+func (mg *Migration) InsertRow(table string, row map[string]interface{}) error {
+	sql, args := insertRowSql(mg.dialect, table, row)
+	return mg.exec(sql, args...)
+}
+
+func insertRowSql(d Dialect, table string, row map[string]interface{}) (string, []interface{}) {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	quoted := make([]string, len(columns))
+	markers := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		quoted[i] = d.quote(column)
+		markers[i] = "?"
+		args[i] = row[column]
+	}
+	sql := fmt.Sprintf("INSERT INTO %v (%v) VALUES (%v)", d.quote(table), strings.Join(quoted, ", "), strings.Join(markers, ", "))
+	return sql, args
+}
+
+// newQbs returns a Qbs working on the database of the migration.
+func (mg *Migration) newQbs() *Qbs {
+	q := NewFromDB(mg.db, mg.dialect)
+	q.Log = mg.Log
+	q.LogLevel = mg.LogLevel
+	q.LogOutput = mg.LogOutput
+	q.LogJSON = mg.LogJSON
+	q.Logger = mg.Logger
+	q.Naming = mg.Naming
+	q.schema = mg.schema
+	return q
+}
+
 // CreateIndex creates the specified index on table.
 // Some databases like mysql do not support this feature directly,
 // So dialect may need to query the database schema table to find out if an index exists.
 // Normally you don't need to do it explicitly, it will be created automatically in CreateTableIfNotExists method.
+// A column in parentheses like "(lower(email))" is an expression, which is not quoted.
 func (mg *Migration) CreateIndexIfNotExists(table interface{}, name string, unique bool, columns ...string) error {
-	tn := tableName(table)
-	name = tn + "_" + name
+	_, err := mg.createIndexIfNotExists(table, name, unique, "", columns...)
+	return err
+}
+
+// CreatePartialIndexIfNotExists is the same as CreateIndexIfNotExists but only indexes the rows meet the where clause,
+// it returns an error if the dialect doesn't support partial indexes, like mysql.
+func (mg *Migration) CreatePartialIndexIfNotExists(table interface{}, name string, unique bool, where string, columns ...string) error {
+	_, err := mg.createIndexIfNotExists(table, name, unique, where, columns...)
+	return err
+}
+
+func (mg *Migration) createIndexIfNotExists(table interface{}, name string, unique bool, where string, columns ...string) (bool, error) {
+	tn := namedTableName(table, mg.naming())
+	name = unqualified(tn) + "_" + name
 	if !mg.dialect.indexExists(mg, tn, name) {
 		sql := mg.dialect.createIndexSql(name, tn, unique, columns...)
-		if mg.Log {
-			fmt.Println(sql)
+		if where != "" {
+			if !mg.dialect.supportsPartialIndex() {
+				return false, errors.New("partial index " + name + " is not supported by the dialect")
+			}
+			sql += " WHERE " + where
+		}
+		if mg.record(sql) {
+			return true, nil
 		}
+		start := time.Now()
 		_, err := mg.db.Exec(sql)
-		return err
+		mg.log(sql, nil, start, err)
+		return err == nil, err
 	}
-	return nil
+	return false, nil
+}
+
+// AddForeignKey adds the constraint of the `qbs:"fk"` field to the existing table, with the actions of
+// its ondelete and onupdate tags, it is named "{table name}_{column name}_fkey".
+// It returns an error if the dialect can't alter constraints, like sqlite3.
+func (mg *Migration) AddForeignKey(structPtr interface{}, fieldName string) error {
+	model := structPtrToNamedModel(structPtr, true, nil, mg.naming())
+	column := model.field(fieldName)
+	if column == nil || column.fk == "" || model.refs[column.fk] == nil {
+		return errors.New("no foreign key field " + fieldName)
+	}
+	sql := mg.dialect.addForeignKeySql(model.table, unqualified(model.table)+"_"+column.name+"_fkey", model.refs[column.fk])
+	if sql == "" {
+		return errors.New("adding foreign keys is not supported by the dialect")
+	}
+	return mg.exec(sql)
+}
+
+// DropForeignKey drops the constraint of the field added by AddForeignKey.
+func (mg *Migration) DropForeignKey(structPtr interface{}, fieldName string) error {
+	model := structPtrToNamedModel(structPtr, false, nil, mg.naming())
+	column := model.field(fieldName)
+	if column == nil {
+		return errors.New("no column for field " + fieldName)
+	}
+	sql := mg.dialect.dropForeignKeySql(model.table, unqualified(model.table)+"_"+column.name+"_fkey")
+	if sql == "" {
+		return errors.New("dropping foreign keys is not supported by the dialect")
+	}
+	return mg.exec(sql)
+}
+
+// ScheduleEvent schedules the statement to run in the database every interval as the named event, e.g. to purge
+// expired rows, as a mysql EVENT or a postgres pg_cron job. An event of the same name is kept by mysql and replaced by pg_cron.
+// It returns an error if the dialect has no scheduler or can't schedule the interval.
+func (mg *Migration) ScheduleEvent(name string, every time.Duration, statement string) error {
+	sql, args := mg.dialect.scheduleEventSql(name, every, statement)
+	if sql == "" {
+		return errors.New("scheduling event " + name + " every " + every.String() + " is not supported by the dialect")
+	}
+	return mg.exec(sql, args...)
+}
+
+// UnscheduleEvent drops the event of the name given to ScheduleEvent.
+func (mg *Migration) UnscheduleEvent(name string) error {
+	sql, args := mg.dialect.unscheduleEventSql(name)
+	if sql == "" {
+		return errors.New("scheduling events is not supported by the dialect")
+	}
+	return mg.exec(sql, args...)
+}
+
+// DropIndex drops the index of the name given to CreateIndexIfNotExists from the table if it exists.
+func (mg *Migration) DropIndex(table interface{}, name string) error {
+	tn := namedTableName(table, mg.naming())
+	name = unqualified(tn) + "_" + name
+	if !mg.dialect.indexExists(mg, tn, name) {
+		return nil
+	}
+	return mg.exec(mg.dialect.dropIndexSql(tn, name))
+}
+
+// RenameIndex renames the index of the name given to CreateIndexIfNotExists if it exists,
+// it returns an error if the dialect can't rename indexes, like sqlite3.
+func (mg *Migration) RenameIndex(table interface{}, oldName, newName string) error {
+	tn := namedTableName(table, mg.naming())
+	oldName, newName = unqualified(tn)+"_"+oldName, unqualified(tn)+"_"+newName
+	if !mg.dialect.indexExists(mg, tn, oldName) {
+		return nil
+	}
+	sql := mg.dialect.renameIndexSql(tn, oldName, newName)
+	if sql == "" {
+		return errors.New("renaming index " + oldName + " is not supported by the dialect")
+	}
+	return mg.exec(sql)
+}
+
+// ColumnsInTable returns the sorted column names of the table in the database, none if the table doesn't exist.
+// The table parameter can be either a string or a struct pointer.
+func (mg *Migration) ColumnsInTable(table interface{}) []string {
+	columns := make([]string, 0)
+	for column := range mg.dialect.columnsInTable(mg, table) {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// Column returns the column of the table in the database described like by Inspect, nil if it doesn't exist.
+// The table parameter can be either a string or a struct pointer.
+func (mg *Migration) Column(table interface{}, name string) (*ColumnMeta, error) {
+	tables, err := Inspect(mg.db, mg.dialect)
+	if err != nil {
+		return nil, err
+	}
+	tn := unqualified(namedTableName(table, mg.naming()))
+	for _, t := range tables {
+		if t.Name != tn {
+			continue
+		}
+		for _, c := range t.Columns {
+			if c.Name == name {
+				return c, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// IndexExists reports if the index of the name given to CreateIndexIfNotExists exists on the table.
+// The table parameter can be either a string or a struct pointer.
+func (mg *Migration) IndexExists(table interface{}, name string) bool {
+	tn := namedTableName(table, mg.naming())
+	return mg.dialect.indexExists(mg, tn, unqualified(tn)+"_"+name)
 }
 
 func (mg *Migration) Close() {
-	if mg.db != nil {
+	if mg.db != nil && !mg.shared {
 		err := mg.db.Close()
 		if err != nil {
 			panic(err)
@@ -110,15 +1014,12 @@ func (mg *Migration) Close() {
 }
 
 // Get a Migration instance should get closed like Qbs instance.
+// It works on the connection pool of the registered database.
 func GetMigration() (mg *Migration, err error) {
 	if driver == "" || dial == nil {
 		panic("database driver has not been registered, should call Register first.")
 	}
-	db, err := sql.Open(driver, driverSource)
-	if err != nil {
-		return nil, err
-	}
-	return &Migration{db, dbName, dial, false}, nil
+	return &Migration{db: db, dbName: dbName, dialect: dial, shared: true}, nil
 }
 
 // A safe and easy way to work with Migration instance without the need to open and close it.
@@ -1,12 +1,14 @@
 package qbs
 
 import (
-	"bytes"
 	"database/sql"
+	"fmt"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
 type TableNamer interface {
@@ -32,11 +34,19 @@ var ColumnNameToFieldName func(string) string = snakeToUpperCamel
 //convert table name to struct name.
 var TableNameToStructName func(string) string = snakeToUpperCamel
 
+//The struct tag key of qbs tags, change it if the "qbs" key conflicts with another library.
+var TagKey = "qbs"
+
+//Struct tag keys whose value is the column name of the field, e.g. "db" for structs shared with sqlx.
+//The first non-empty value is used, options after a comma are ignored, "-" ignores the field.
+var ColumnTagKeys []string
+
 // Index represents a table index and is returned via the Indexed interface.
 type index struct {
 	name    string
 	columns []string
 	unique  bool
+	where   string // the condition of a partial index
 }
 
 // Indexes represents an array of indexes.
@@ -48,48 +58,122 @@ type Indexed interface {
 
 // Add adds an index
 func (ix *Indexes) Add(columns ...string) {
-	name := strings.Join(columns, "_")
-	*ix = append(*ix, &index{name: name, columns: columns, unique: false})
+	*ix = append(*ix, &index{name: indexName(columns), columns: columns, unique: false})
 }
 
 // AddUnique adds an unique index
 func (ix *Indexes) AddUnique(columns ...string) {
+	*ix = append(*ix, &index{name: indexName(columns), columns: columns, unique: true})
+}
+
+// AddPartial adds an index of the rows meet the where clause, e.g. AddPartial("deleted IS NULL", "email"),
+// on the dialects supporting partial indexes.
+func (ix *Indexes) AddPartial(where string, columns ...string) {
+	*ix = append(*ix, &index{name: indexName(columns), columns: columns, where: where})
+}
+
+// AddUniquePartial adds an unique index of the rows meet the where clause.
+func (ix *Indexes) AddUniquePartial(where string, columns ...string) {
+	*ix = append(*ix, &index{name: indexName(columns), columns: columns, unique: true, where: where})
+}
+
+// AddNamedPartial adds an index of the rows meet the where clause with the name instead of the one joining the columns,
+// e.g. AddNamedPartial("active_email", "deleted IS NULL", "email").
+func (ix *Indexes) AddNamedPartial(name, where string, columns ...string) {
+	*ix = append(*ix, &index{name: name, columns: columns, where: where})
+}
+
+// AddExpression adds an index of the expression, e.g. AddExpression("lower(email)"), named by the words of it.
+func (ix *Indexes) AddExpression(expr string) {
+	if !strings.HasPrefix(expr, "(") {
+		expr = "(" + expr + ")"
+	}
+	*ix = append(*ix, &index{name: indexName([]string{expr}), columns: []string{expr}})
+}
+
+// indexName joins the columns with underscores, the symbols of an expression like "(lower(email))" are replaced.
+func indexName(columns []string) string {
 	name := strings.Join(columns, "_")
-	*ix = append(*ix, &index{name: name, columns: columns, unique: true})
+	if !strings.Contains(name, "(") {
+		return name
+	}
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "_")
 }
 
 // ModelField represents a schema field of a parsed model.
 type modelField struct {
-	name      string // Column name
-	camelName string
-	value     interface{} // Value
-	pk        bool
-	notnull   bool
-	index     bool
-	unique    bool
-	updated   bool
-	created   bool
-	size      int
-	dfault    string
-	fk        string
-	join      string
-	colType   string
-	nullable  reflect.Kind
+	name        string // Column name
+	camelName   string
+	value       interface{} // Value
+	pk          bool
+	notnull     bool
+	index       bool
+	unique      bool
+	updated     bool
+	created     bool
+	deleted     bool
+	version     bool
+	json        bool
+	omitempty   bool //zero values are not written unless included by IncludeZero.
+	uuid        bool //a string primary key generated by Save if empty.
+	includeZero bool
+	size        int
+	dfault      string
+	fk          string
+	onDelete    string // the SQL actions of the fk constraint
+	onUpdate    string
+	min, max    *float64 // the bounds of a number or the length of a string checked before Save
+	match       *regexp.Regexp
+	in          []string
+	renameFrom  string // the old column name, renamed by migrations
+	join        string
+	colType     string
+	tz          *time.Location // the location the time is written in
+	precision   *int           // the fractional second digits of a time column
+	nullable    reflect.Kind
+	goType      reflect.Type // the declared type of the struct field
 }
 
 // Model represents a parsed schema interface{}.
 type model struct {
 	pk      *modelField
+	pks     []*modelField // more than one for a composite primary key, then pk is nil
 	table   string
 	fields  []*modelField
 	refs    map[string]*reference
 	indexes Indexes
+	naming  NamingConvention
 }
 
 type reference struct {
 	refKey     string
 	model      *model
 	foreignKey bool
+	onDelete   string // the SQL action of the ondelete tag, CASCADE if not tagged
+	onUpdate   string // the SQL action of the onupdate tag
+}
+
+var foreignKeyActions = map[string]string{
+	"cascade":  "CASCADE",
+	"setnull":  "SET NULL",
+	"restrict": "RESTRICT",
+	"noaction": "NO ACTION",
+}
+
+// actionsSql returns the ON DELETE and ON UPDATE clauses of the foreign key constraint.
+func (ref *reference) actionsSql() string {
+	onDelete := ref.onDelete
+	if onDelete == "" {
+		onDelete = "CASCADE"
+	}
+	sql := " ON DELETE " + onDelete
+	if ref.onUpdate != "" {
+		sql += " ON UPDATE " + ref.onUpdate
+	}
+	return sql
 }
 
 func (model *model) columnsAndValues(forUpdate bool) ([]string, []interface{}) {
@@ -103,7 +187,7 @@ func (model *model) columnsAndValues(forUpdate bool) ([]string, []interface{}) {
 			include = true
 			if column.value == nil && column.nullable == reflect.Invalid {
 				include = false
-			} else if column.pk {
+			} else if column.pk && model.pk != nil { //columns of a composite key are always inserted
 				if intValue, ok := column.value.(int64); ok {
 					include = intValue != 0
 				} else if strValue, ok := column.value.(string); ok {
@@ -111,17 +195,78 @@ func (model *model) columnsAndValues(forUpdate bool) ([]string, []interface{}) {
 				}
 			}
 		}
+		if t, ok := column.value.(time.Time); ok && column.deleted && t.IsZero() {
+			include = false //NULL until soft deleted.
+		}
+		if column.omitempty && !column.pk && !column.includeZero && column.isEmpty() {
+			include = false
+		}
 		if include {
 			columns = append(columns, column.name)
-			values = append(values, column.value)
+			values = append(values, column.writeValue())
 		}
 	}
 	return columns, values
 }
 
+// typedValue returns the value of the field for its column type, the zero time of a nil *time.Time.
+func (f *modelField) typedValue() interface{} {
+	if f.value == nil && f.nullable == reflect.Struct {
+		return time.Time{}
+	}
+	return f.value
+}
+
+// isEmpty reports if the field is unset, a nil pointer or a zero value.
+func (f *modelField) isEmpty() bool {
+	if f.value == nil {
+		return true
+	}
+	return f.nullable == reflect.Invalid && reflect.ValueOf(f.value).IsZero()
+}
+
+// includeZero makes the omitempty fields of the struct field names write their zero values.
+func (model *model) includeZero(camelNames []string) {
+	for _, name := range camelNames {
+		if f := model.field(name); f != nil {
+			f.includeZero = true
+		}
+	}
+}
+
+// field returns the model field of the struct field name, nil if not found.
+func (model *model) field(camelName string) *modelField {
+	for _, v := range model.fields {
+		if v.camelName == camelName {
+			return v
+		}
+	}
+	return nil
+}
+
+// deletedField returns the soft delete field, nil if the model has none.
+func (model *model) deletedField() *modelField {
+	for _, v := range model.fields {
+		if v.deleted {
+			return v
+		}
+	}
+	return nil
+}
+
+// versionField returns the int64 optimistic locking field, nil if the model has none.
+func (model *model) versionField() *modelField {
+	for _, v := range model.fields {
+		if _, ok := v.value.(int64); ok && v.version && v.nullable == reflect.Invalid {
+			return v
+		}
+	}
+	return nil
+}
+
 func (model *model) timeField(name string) *modelField {
 	for _, v := range model.fields {
-		if _, ok := v.value.(time.Time); ok {
+		if _, ok := v.value.(time.Time); ok && v.nullable == reflect.Invalid {
 			if name == "created" {
 				if v.created {
 					return v
@@ -143,35 +288,73 @@ func (model *model) pkZero() bool {
 	if model.pk == nil {
 		return true
 	}
-	switch model.pk.value.(type) {
-	case string:
-		return model.pk.value.(string) == ""
-	case int8:
-		return model.pk.value.(int8) == 0
-	case int16:
-		return model.pk.value.(int16) == 0
-	case int32:
-		return model.pk.value.(int32) == 0
-	case int64:
-		return model.pk.value.(int64) == 0
-	case uint8:
-		return model.pk.value.(uint8) == 0
-	case uint16:
-		return model.pk.value.(uint16) == 0
-	case uint32:
-		return model.pk.value.(uint32) == 0
-	case uint64:
-		return model.pk.value.(uint64) == 0
-	}
-	return true
+	return pkValueZero(model.pk.value)
+}
+
+// pkValueZero reports if the primary key value is zero, a value of an unsupported type is zero.
+func pkValueZero(value interface{}) bool {
+	zero, _ := pkZeroValue(value)
+	return zero
+}
+
+// pkZeroValue reports if the primary key value is zero, ok is false if its type can't be a primary key.
+func pkZeroValue(value interface{}) (zero, ok bool) {
+	if t, isTime := value.(time.Time); isTime {
+		return t.IsZero(), true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Invalid:
+		return true, true //a nil pointer.
+	case reflect.String:
+		return v.String() == "", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0, true
+	}
+	return true, false
+}
+
+// pkCondition returns the condition on all primary key columns, nil if a primary key value is zero,
+// columns are qualified with the table name if qualify is true.
+func (model *model) pkCondition(d Dialect, qualify bool) *Condition {
+	if len(model.pks) == 0 {
+		return nil
+	}
+	var con *Condition
+	for _, pk := range model.pks {
+		zero, ok := pkZeroValue(pk.value)
+		if !ok && len(model.pks) > 1 {
+			panic(fmt.Sprintf("unsupported type %T of the composite primary key field %v", pk.value, pk.camelName))
+		}
+		if zero {
+			return nil
+		}
+		column := d.quote(pk.name)
+		if qualify {
+			column = d.quote(model.table) + "." + column
+		}
+		if con == nil {
+			con = NewCondition(column+" = ?", pk.value)
+		} else {
+			con.AndCondition(NewCondition(column+" = ?", pk.value))
+		}
+	}
+	return con
 }
 
 func structPtrToModel(f interface{}, root bool, omitFields []string) *model {
+	return structPtrToNamedModel(f, root, omitFields, globalNaming{})
+}
+
+func structPtrToNamedModel(f interface{}, root bool, omitFields []string, naming NamingConvention) *model {
 	model := &model{
 		pk:      nil,
-		table:   tableName(f),
+		table:   namedTableName(f, naming),
 		fields:  []*modelField{},
 		indexes: Indexes{},
+		naming:  naming,
 	}
 	structType := reflect.TypeOf(f).Elem()
 	structValue := reflect.ValueOf(f).Elem()
@@ -180,8 +363,8 @@ func structPtrToModel(f interface{}, root bool, omitFields []string) *model {
 			panic("did you pass a pointer to a pointer to a struct?")
 		}
 	}
-	for i := 0; i < structType.NumField(); i++ {
-		structField := structType.Field(i)
+	var idPk *modelField
+	for _, structField := range structFields(structType) {
 		omit := false
 		for _, v := range omitFields {
 			if v == structField.Name {
@@ -191,15 +374,20 @@ func structPtrToModel(f interface{}, root bool, omitFields []string) *model {
 		if omit {
 			continue
 		}
-		fieldValue := structValue.FieldByName(structField.Name)
+		fieldValue := structValue.FieldByIndex(structField.Index)
 		if !fieldValue.CanInterface() {
 			continue
 		}
-		sqlTag := structField.Tag.Get("qbs")
+		sqlTag := structField.Tag.Get(TagKey)
 		if sqlTag == "-" {
 			continue
 		}
+		columnName, tagged := taggedColumnName(structField)
+		if columnName == "-" {
+			continue
+		}
 		fieldIsNullable := false
+		jsonField := isJSONField(structField)
 		kind := structField.Type.Kind()
 		switch kind {
 		case reflect.Ptr:
@@ -207,22 +395,38 @@ func structPtrToModel(f interface{}, root bool, omitFields []string) *model {
 			case reflect.Bool, reflect.String, reflect.Int64, reflect.Float64:
 				kind = structField.Type.Elem().Kind()
 				fieldIsNullable = true
+			case reflect.Struct:
+				if structField.Type.Elem() == reflect.TypeOf(time.Time{}) && !jsonField {
+					kind = reflect.Struct //a nullable time.
+					fieldIsNullable = true
+				} else if !jsonField {
+					continue
+				}
 			default:
-				continue
+				if !jsonField {
+					continue
+				}
 			}
 		case reflect.Map:
-			continue
+			if !jsonField {
+				continue
+			}
 		case reflect.Slice:
 			elemKind := structField.Type.Elem().Kind()
-			if elemKind != reflect.Uint8 {
+			if elemKind != reflect.Uint8 && !jsonField {
 				continue
 			}
 		}
 
 		fd := new(modelField)
-		parseTags(fd, sqlTag)
+		parseCachedTags(fd, sqlTag)
 		fd.camelName = structField.Name
-		fd.name = FieldNameToColumnName(structField.Name)
+		fd.goType = structField.Type
+		if tagged {
+			fd.name = columnName
+		} else {
+			fd.name = naming.ColumnName(structField.Name)
+		}
 		if fieldIsNullable {
 			fd.nullable = kind
 			if fieldValue.IsNil() {
@@ -234,11 +438,15 @@ func structPtrToModel(f interface{}, root bool, omitFields []string) *model {
 			//not nullable case
 			fd.value = fieldValue.Interface()
 		}
-		if _, ok := fd.value.(int64); ok && fd.camelName == "Id" {
-			fd.pk = true
+		if jsonField {
+			fd.nullable = reflect.Invalid
+			fd.value = jsonValue{fieldValue.Interface()}
 		}
 		if fd.pk {
-			model.pk = fd
+			model.pks = append(model.pks, fd)
+		} else if _, ok := fd.value.(int64); ok && fd.camelName == "Id" {
+			fd.pk = true
+			idPk = fd
 		}
 
 		model.fields = append(model.fields, fd)
@@ -277,9 +485,11 @@ func structPtrToModel(f interface{}, root bool, omitFields []string) *model {
 						if fieldValue.IsNil() {
 							fieldValue.Set(reflect.New(field.Type.Elem()))
 						}
-						refModel := structPtrToModel(fieldValue.Interface(), false, nil)
+						refModel := structPtrToNamedModel(fieldValue.Interface(), false, nil, naming)
 						ref := new(reference)
 						ref.foreignKey = fk
+						ref.onDelete = fd.onDelete
+						ref.onUpdate = fd.onUpdate
 						ref.model = refModel
 						ref.refKey = fd.name
 						if model.refs == nil {
@@ -300,6 +510,14 @@ func structPtrToModel(f interface{}, root bool, omitFields []string) *model {
 			}
 		}
 	}
+	if len(model.pks) == 0 && idPk != nil { //the int64 Id field is the primary key if no field is tagged pk.
+		model.pks = append(model.pks, idPk)
+	} else if idPk != nil {
+		idPk.pk = false
+	}
+	if len(model.pks) == 1 {
+		model.pk = model.pks[0]
+	}
 	if root {
 		if indexed, ok := f.(Indexed); ok {
 			indexed.Indexes(&model.indexes)
@@ -308,9 +526,51 @@ func structPtrToModel(f interface{}, root bool, omitFields []string) *model {
 	return model
 }
 
+// structFields returns the fields of the struct type with the fields of anonymous embedded structs flattened,
+// as if they were declared in the struct, a field shadowed by another one of the same name is left out.
+func structFields(structType reflect.Type) []reflect.StructField {
+	fields := make([]reflect.StructField, 0, structType.NumField())
+	for _, field := range embeddedFields(structType, nil) {
+		if promoted, ok := structType.FieldByName(field.Name); ok && len(promoted.Index) == len(field.Index) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func embeddedFields(structType reflect.Type, index []int) []reflect.StructField {
+	fields := make([]reflect.StructField, 0, structType.NumField())
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		field.Index = append(append([]int{}, index...), i)
+		if isEmbeddedStruct(field) {
+			fields = append(fields, embeddedFields(field.Type, field.Index)...)
+		} else {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// isEmbeddedStruct reports if the field is an anonymous struct whose fields are columns of the parent table.
+func isEmbeddedStruct(field reflect.StructField) bool {
+	if !field.Anonymous || field.Type.Kind() != reflect.Struct || field.Tag.Get(TagKey) == "-" {
+		return false
+	}
+	if field.Type == reflect.TypeOf(time.Time{}) {
+		return false
+	}
+	_, scanner := reflect.New(field.Type).Interface().(sql.Scanner)
+	return !scanner
+}
+
 func tableName(talbe interface{}) string {
+	return namedTableName(talbe, globalNaming{})
+}
+
+func namedTableName(talbe interface{}, naming NamingConvention) string {
 	if t, ok := talbe.(string); ok {
-		return t
+		return qualify(t, naming)
 	}
 	t := reflect.TypeOf(talbe).Elem()
 	for {
@@ -325,18 +585,60 @@ func tableName(talbe interface{}) string {
 		}
 	}
 	if tn, ok := talbe.(TableNamer); ok {
-		return tn.TableName()
+		return qualify(tn.TableName(), naming)
 	}
-	return StructNameToTableName(t.Name())
+	return naming.TableName(t.Name())
+}
+
+// taggedColumnName returns the column name in the ColumnTagKeys tags of the struct field.
+func taggedColumnName(structField reflect.StructField) (string, bool) {
+	for _, key := range ColumnTagKeys {
+		name := structField.Tag.Get(key)
+		if i := strings.Index(name, ","); i >= 0 {
+			name = name[:i]
+		}
+		if name != "" {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// fieldByColumn returns the field of the struct value the column is mapped to.
+func fieldByColumn(structValue reflect.Value, column string, naming NamingConvention) reflect.Value {
+	field, ok := structFieldByColumn(structValue.Type(), column, naming)
+	if !ok {
+		return reflect.Value{}
+	}
+	return structValue.FieldByIndex(field.Index)
+}
+
+// structFieldByColumn returns the field of the struct type the column is mapped to.
+func structFieldByColumn(structType reflect.Type, column string, naming NamingConvention) (reflect.StructField, bool) {
+	if len(ColumnTagKeys) > 0 {
+		for _, field := range structFields(structType) {
+			if name, ok := taggedColumnName(field); ok && name == column {
+				return field, true
+			}
+		}
+	}
+	return structType.FieldByName(naming.FieldName(column))
 }
 
 func parseTags(fd *modelField, s string) {
 	if s == "" {
 		return
 	}
-	c := strings.Split(s, ",")
+	// the regexp of match may contain commas and colons, so it has to be the last tag.
+	if i := strings.Index(s, "match:"); i == 0 || i > 0 && s[i-1] == ',' {
+		fd.match = compileMatch(s[i+len("match:"):])
+		if s = strings.TrimSuffix(s[:i], ","); s == "" {
+			return
+		}
+	}
+	c := splitTags(s)
 	for _, v := range c {
-		c2 := strings.Split(v, ":")
+		c2 := strings.SplitN(v, ":", 2)
 		if len(c2) == 2 {
 			switch c2[0] {
 			case "fk":
@@ -349,6 +651,38 @@ func parseTags(fd *modelField, s string) {
 				fd.join = c2[1]
 			case "coltype":
 				fd.colType = c2[1]
+			case "tz":
+				fd.tz = tagLocation(c2[1])
+			case "precision":
+				precision, err := strconv.Atoi(c2[1])
+				if err != nil || precision < 0 || precision > 6 {
+					panic(c2[0] + " tag syntax error")
+				}
+				fd.precision = &precision
+			case "min", "max":
+				bound, err := strconv.ParseFloat(c2[1], 64)
+				if err != nil {
+					panic(c2[0] + " tag syntax error")
+				}
+				if c2[0] == "min" {
+					fd.min = &bound
+				} else {
+					fd.max = &bound
+				}
+			case "in":
+				fd.in = strings.Split(c2[1], "|")
+			case "rename_from":
+				fd.renameFrom = c2[1]
+			case "ondelete", "onupdate":
+				action, ok := foreignKeyActions[c2[1]]
+				if !ok {
+					panic("unknown foreign key action " + c2[1])
+				}
+				if c2[0] == "ondelete" {
+					fd.onDelete = action
+				} else {
+					fd.onUpdate = action
+				}
 			default:
 				panic(c2[0] + " tag syntax error")
 			}
@@ -360,6 +694,16 @@ func parseTags(fd *modelField, s string) {
 				fd.pk = true
 			case "updated":
 				fd.updated = true
+			case "deleted":
+				fd.deleted = true
+			case "version":
+				fd.version = true
+			case "json":
+				fd.json = true
+			case "omitempty":
+				fd.omitempty = true
+			case "uuid":
+				fd.uuid = true
 			case "index":
 				fd.index = true
 			case "unique":
@@ -374,8 +718,43 @@ func parseTags(fd *modelField, s string) {
 	return
 }
 
+// splitTags splits the tag by the commas outside parentheses, like in "coltype:decimal(10,2),notnull".
+func splitTags(s string) []string {
+	var tags []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				tags = append(tags, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(tags, s[start:])
+}
+
+// customColType returns the coltype tag if it is a SQL type used as it is, like "decimal(10,2)" or "uuid",
+// rather than one of the QBS_COLTYPE types mapped by the dialect.
+func (f *modelField) customColType() string {
+	switch f.colType {
+	case "", QBS_COLTYPE_INT, QBS_COLTYPE_BOOL, QBS_COLTYPE_BIGINT, QBS_COLTYPE_DOUBLE, QBS_COLTYPE_TIME, QBS_COLTYPE_TEXT:
+		return ""
+	}
+	return f.colType
+}
+
 func toSnake(s string) string {
-	buf := new(bytes.Buffer)
+	return snakeNames.get(s)
+}
+
+func convertToSnake(s string) string {
+	var buf strings.Builder
+	buf.Grow(len(s) + 4)
 	for i := 0; i < len(s); i++ {
 		c := s[i]
 		if c >= 'A' && c <= 'Z' {
@@ -391,7 +770,12 @@ func toSnake(s string) string {
 }
 
 func snakeToUpperCamel(s string) string {
-	buf := new(bytes.Buffer)
+	return camelNames.get(s)
+}
+
+func convertSnakeToUpperCamel(s string) string {
+	var buf strings.Builder
+	buf.Grow(len(s))
 	first := true
 	for i := 0; i < len(s); i++ {
 		c := s[i]
@@ -409,16 +793,30 @@ func snakeToUpperCamel(s string) string {
 }
 
 var ValidTags = map[string]bool{
-	"pk":      true, //primary key
-	"fk":      true, //foreign key
-	"size":    true,
-	"default": true,
-	"join":    true,
-	"-":       true, //ignore
-	"index":   true,
-	"unique":  true,
-	"notnull": true,
-	"updated": true,
-	"created": true,
-	"coltype": true,
+	"pk":          true, //primary key
+	"fk":          true, //foreign key
+	"size":        true,
+	"default":     true,
+	"join":        true,
+	"-":           true, //ignore
+	"index":       true,
+	"unique":      true,
+	"notnull":     true,
+	"updated":     true,
+	"created":     true,
+	"deleted":     true, //soft delete timestamp
+	"coltype":     true,
+	"min":         true, //validated before Save
+	"max":         true,
+	"match":       true,
+	"in":          true,
+	"rename_from": true, //the old column name
+	"uuid":        true, //generated string primary key
+	"tz":          true, //the location times are written in
+	"precision":   true, //fractional second digits of a time
+	"version":     true, //optimistic lock version
+	"json":        true, //stored as a JSON document
+	"omitempty":   true, //not written if zero
+	"ondelete":    true, //foreign key action
+	"onupdate":    true,
 }
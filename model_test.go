@@ -1,6 +1,7 @@
 package qbs
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 	"time"
@@ -15,6 +16,10 @@ func TestParseTags(t *testing.T) {
 	parseTags(fd, `notnull,default:'banana'`)
 	assert.True(fd.notnull)
 	assert.Equal("'banana'", fd.dfault)
+	fd = new(modelField)
+	parseTags(fd, `fk:User,ondelete:setnull,onupdate:cascade`)
+	assert.Equal("SET NULL", fd.onDelete)
+	assert.Equal("CASCADE", fd.onUpdate)
 }
 
 func TestFieldOmit(t *testing.T) {
@@ -64,6 +69,17 @@ func (table *indexedTable) Indexes(indexes *Indexes) {
 	indexes.AddUnique("col_var_char", "col_time")
 }
 
+type expressionIndexedTable struct {
+	Id      int64
+	Email   string
+	Created time.Time
+}
+
+func (table *expressionIndexedTable) Indexes(indexes *Indexes) {
+	indexes.AddNamedPartial("recent", "created > '2020-01-01'", "email")
+	indexes.AddExpression("lower(email)")
+}
+
 func TestInterfaceToModel(t *testing.T) {
 	assert := NewAssert(t)
 	now := time.Now()
@@ -98,6 +114,16 @@ func TestInterfaceToModel(t *testing.T) {
 	assert.Equal(now, tm)
 }
 
+func TestNamedPartialAndExpressionIndexes(t *testing.T) {
+	assert := NewAssert(t)
+	m := structPtrToModel(new(expressionIndexedTable), true, nil)
+	assert.Equal(2, len(m.indexes))
+	assert.Equal("recent", m.indexes[0].name)
+	assert.Equal("created > '2020-01-01'", m.indexes[0].where)
+	assert.Equal("lower_email", m.indexes[1].name)
+	assert.Equal("[(lower(email))]", m.indexes[1].columns)
+}
+
 func TestInterfaceToSubModel(t *testing.T) {
 	assert := NewAssert(t)
 	type User struct {
@@ -166,3 +192,403 @@ func TestModelFieldsIndicateNullable(t *testing.T) {
 		}
 	}
 }
+
+func TestValidTags(t *testing.T) {
+	assert := NewAssert(t)
+	for _, tag := range []string{"version", "json", "omitempty", "ondelete", "onupdate", "uuid", "tz", "precision"} {
+		assert.True(ValidTags[tag])
+	}
+}
+
+func TestTagKeys(t *testing.T) {
+	assert := NewAssert(t)
+	type sharedTags struct {
+		Id       int64
+		UserName string `db:"login,omitempty" sql:"size:64"`
+		Skipped  string `db:"-"`
+	}
+	TagKey, ColumnTagKeys = "sql", []string{"db"}
+	defer func() {
+		TagKey, ColumnTagKeys = "qbs", nil
+	}()
+	model := structPtrToModel(new(sharedTags), true, nil)
+	assert.Equal(2, len(model.fields))
+	assert.Equal("login", model.fields[1].name)
+	assert.Equal(64, model.fields[1].size)
+	s := new(sharedTags)
+	fieldByColumn(reflect.ValueOf(s).Elem(), "login", SnakeCase).SetString("a")
+	assert.Equal("a", s.UserName)
+}
+
+func TestNamingConvention(t *testing.T) {
+	assert := NewAssert(t)
+	type UserProfile struct {
+		Id       int64
+		NickName string
+	}
+	model := structPtrToNamedModel(new(UserProfile), false, nil, Prefixed("app_", LowerCamel))
+	assert.Equal("app_userProfile", model.table)
+	assert.Equal("nickName", model.fields[1].name)
+	assert.Equal("UserProfile", Prefixed("app_", LowerCamel).StructName("app_userProfile"))
+	assert.Equal("NickName", SameCase.FieldName("NickName"))
+	assert.Equal("nick_name", SnakeCase.ColumnName("NickName"))
+}
+
+func TestQueryStructPath(t *testing.T) {
+	assert := NewAssert(t)
+	type author struct {
+		Id   int64
+		Name string
+	}
+	type post struct {
+		Id    int64
+		Title string
+	}
+	type postRow struct {
+		Post      post
+		Author    *author
+		Published time.Time
+	}
+	q := new(Qbs)
+	rowType := reflect.TypeOf(postRow{})
+	assert.Equal([]int{0, 1}, q.queryStructPath(rowType, "title"))
+	assert.Equal([]int{1, 1}, q.queryStructPath(rowType, "name"))
+	assert.Equal([]int{2}, q.queryStructPath(rowType, "published"))
+	assert.True(q.queryStructPath(rowType, "id") == nil)
+	assert.Equal([]int{1, 0}, q.queryStructPath(rowType, "author___id"))
+	row := new(postRow)
+	fieldByPath(reflect.ValueOf(row).Elem(), []int{1, 1}).SetString("a")
+	assert.Equal("a", row.Author.Name)
+}
+
+func TestByUnique(t *testing.T) {
+	assert := NewAssert(t)
+	type uniqueUser struct {
+		Id    int64
+		Email string `qbs:"unique"`
+		Name  string
+	}
+	ValidateUnique[uniqueUser]("id", "email")
+	assert.Equal("email", ByUnique[uniqueUser]("email", "a@b.c").column)
+	defer func() {
+		assert.True(recover() != nil)
+	}()
+	ByUnique[uniqueUser]("name", "a")
+}
+
+func TestCompositePk(t *testing.T) {
+	assert := NewAssert(t)
+	type membership struct {
+		Id      int64
+		UserId  int64 `qbs:"pk"`
+		GroupId int64 `qbs:"pk"`
+	}
+	m := structPtrToModel(&membership{1, 2, 0}, false, nil)
+	assert.True(m.pk == nil)
+	assert.Equal(2, len(m.pks))
+	assert.True(m.pkCondition(NewMysql(), false) == nil)
+	m.pks[1].value = int64(3)
+	expr, args := m.pkCondition(NewMysql(), true).Merge()
+	assert.Equal("(`membership`.`user_id` = ?) AND (`membership`.`group_id` = ?)", expr)
+	assert.Equal(2, len(args))
+	columns, _ := m.columnsAndValues(false)
+	assert.Equal(3, len(columns))
+
+	type single struct {
+		Id   int64
+		Code string `qbs:"pk"`
+	}
+	m = structPtrToModel(&single{}, false, nil)
+	assert.Equal("code", m.pk.name)
+	assert.Equal(1, len(m.pks))
+
+	type dated struct {
+		Region uint      `qbs:"pk"`
+		Seq    int       `qbs:"pk"`
+		Day    time.Time `qbs:"pk"`
+	}
+	m = structPtrToModel(&dated{1, 2, time.Time{}}, false, nil)
+	assert.True(m.pkCondition(NewMysql(), false) == nil)
+	m = structPtrToModel(&dated{1, 2, time.Now()}, false, nil)
+	_, args = m.pkCondition(NewMysql(), false).Merge()
+	assert.Equal(3, len(args))
+
+	type floating struct {
+		Lat float64 `qbs:"pk"`
+		Lng float64 `qbs:"pk"`
+	}
+	defer func() {
+		assert.True(recover() != nil)
+	}()
+	structPtrToModel(&floating{1, 2}, false, nil).pkCondition(NewMysql(), false)
+}
+
+func TestVersionField(t *testing.T) {
+	assert := NewAssert(t)
+	type doc struct {
+		Id      int64
+		Title   string
+		Version int64 `qbs:"version"`
+	}
+	m := structPtrToModel(&doc{1, "a", 3}, true, nil)
+	assert.Equal("version", m.versionField().name)
+	q := &Qbs{Dialect: NewMysql(), criteria: new(criteria)}
+	q.criteria.model = m
+	q.criteria.mergePkCondition(q.Dialect)
+	version := q.lockVersion(m)
+	sql, args := q.Dialect.updateSql(q.criteria)
+	assert.Equal("UPDATE `doc` SET `title` = ?, `version` = ? WHERE (`id` = ?) AND (`version` = ?)", sql)
+	assert.Equal("[a 4 1 3]", args)
+	assert.Equal(4, version.value)
+	assert.True(structPtrToModel(&struct{ Version int64 }{}, true, nil).versionField() == nil)
+}
+
+func TestOrderByReferences(t *testing.T) {
+	assert := NewAssert(t)
+	type author struct {
+		Id   int64
+		Name string
+	}
+	type post struct {
+		Id       int64
+		AuthorId int64 `qbs:"fk:Author"`
+		Author   *author
+	}
+	type comment struct {
+		Id     int64
+		PostId int64 `qbs:"fk:Post"`
+		Post   *post
+	}
+	c, p, a := new(comment), new(post), new(author)
+	ordered, err := new(Migration).orderByReferences([]interface{}{c, p, a})
+	assert.MustNil(err)
+	assert.Equal(3, len(ordered))
+	assert.True(ordered[0] == a && ordered[1] == p && ordered[2] == c)
+	ordered, err = new(Migration).orderByReferences([]interface{}{c, a})
+	assert.MustNil(err)
+	assert.True(ordered[0] == c && ordered[1] == a)
+}
+
+func TestEmbeddedStruct(t *testing.T) {
+	assert := NewAssert(t)
+	type article struct {
+		Id   int64
+		Name string
+		timestamps
+		Skipped timestamps `qbs:"-"`
+	}
+	now := time.Now()
+	a := &article{Id: 1, Name: "a"}
+	a.Created = now
+	m := structPtrToModel(a, true, nil)
+	assert.Equal(4, len(m.fields))
+	assert.Equal("created", m.timeField("created").name)
+	assert.Equal("updated", m.timeField("updated").name)
+	assert.Equal(now, m.field("Created").value)
+	columns, _ := m.columnsAndValues(false)
+	assert.Equal("[id name created updated]", columns)
+
+	type shadowing struct {
+		Id int64
+		timestamps
+		Updated string
+	}
+	m = structPtrToModel(&shadowing{}, true, nil)
+	assert.Equal(3, len(m.fields))
+	assert.Equal("", m.field("Updated").value)
+}
+
+func TestDescribe(t *testing.T) {
+	assert := NewAssert(t)
+	type membership struct {
+		UserId  int64  `qbs:"pk"`
+		GroupId int64  `qbs:"pk"`
+		Role    string `db:"member_role"`
+		timestamps
+	}
+	ColumnTagKeys = []string{"db"}
+	defer func() {
+		ColumnTagKeys = nil
+	}()
+	meta := new(Qbs).WithSchema("tenant_a").Describe(new(membership))
+	assert.Equal("tenant_a.membership", meta.Table)
+	assert.Equal(5, len(meta.Fields))
+	assert.Equal(2, len(meta.Pks))
+	assert.Equal("GroupId", meta.Pks[1].Name)
+	assert.Equal("member_role", meta.Field("Role").Column)
+	created := meta.FieldByColumn("created")
+	assert.Equal("Created", created.Name)
+	assert.Equal("[3 0]", created.Index)
+	assert.True(meta.Field("Missing") == nil)
+}
+
+func TestJSONField(t *testing.T) {
+	assert := NewAssert(t)
+	type point struct {
+		X, Y int
+	}
+	type shape struct {
+		Id     int64
+		Origin point             `qbs:"json"`
+		Points []point           `qbs:"json"`
+		Attrs  map[string]string `qbs:"json"`
+		Parent *point            `qbs:"json"`
+	}
+	m := structPtrToModel(&shape{Origin: point{1, 2}, Attrs: map[string]string{"a": "b"}}, true, nil)
+	assert.Equal(5, len(m.fields))
+	origin, _ := m.field("Origin").value.(jsonValue).Value()
+	assert.Equal(`{"X":1,"Y":2}`, origin)
+	attrs, _ := m.field("Attrs").value.(jsonValue).Value()
+	assert.Equal(`{"a":"b"}`, attrs)
+	points, _ := m.field("Points").value.(jsonValue).Value()
+	assert.True(points == nil)
+	assert.Equal("json", NewMysql().sqlType(*m.field("Points")))
+	assert.Equal("jsonb", NewPostgres().sqlType(*m.field("Parent")))
+
+	s := new(shape)
+	var driverValue interface{} = []byte(`[{"X":3,"Y":4}]`)
+	assert.MustNil(setJSONValue(reflect.ValueOf(&driverValue).Elem(), reflect.ValueOf(s).Elem().FieldByName("Points")))
+	assert.Equal(1, len(s.Points))
+	assert.Equal(4, s.Points[0].Y)
+	driverValue = `{"X":5,"Y":6}`
+	assert.MustNil(setJSONValue(reflect.ValueOf(&driverValue).Elem(), reflect.ValueOf(s).Elem().FieldByName("Parent")))
+	assert.Equal(5, s.Parent.X)
+}
+
+func TestOmitEmpty(t *testing.T) {
+	assert := NewAssert(t)
+	type profile struct {
+		Id    int64
+		Name  string `qbs:"omitempty"`
+		Age   int64  `qbs:"omitempty"`
+		Score *int64 `qbs:"omitempty"`
+		Bio   string
+	}
+	zero := int64(0)
+	m := structPtrToModel(&profile{Id: 1, Name: "a", Score: &zero}, true, nil)
+	columns, _ := m.columnsAndValues(true)
+	assert.Equal("[name score bio]", fmt.Sprint(columns))
+	columns, _ = m.columnsAndValues(false)
+	assert.Equal("[id name score bio]", fmt.Sprint(columns))
+	m.includeZero([]string{"Age"})
+	columns, _ = m.columnsAndValues(true)
+	assert.Equal("[name age score bio]", fmt.Sprint(columns))
+}
+
+func TestDiff(t *testing.T) {
+	assert := NewAssert(t)
+	type account struct {
+		Id      int64
+		Name    string
+		Nick    *string
+		Tags    []string `qbs:"json"`
+		Created time.Time
+	}
+	now := time.Now()
+	nick := "b"
+	before := &account{Id: 1, Name: "a", Tags: []string{"x"}, Created: now}
+	after := &account{Id: 1, Name: "b", Nick: &nick, Tags: []string{"x"}, Created: now.In(time.UTC)}
+	diff := Diff(before, after)
+	assert.Equal(2, len(diff))
+	assert.Equal("[a b]", fmt.Sprint(diff["name"]))
+	assert.Equal("[<nil> b]", fmt.Sprint(diff["nick"]))
+	after.Tags = append(after.Tags, "y")
+	assert.Equal("[[x] [x y]]", fmt.Sprint(Diff(before, after)["tags"]))
+	assert.Equal(0, len(Diff(before, before)))
+}
+
+func TestValidate(t *testing.T) {
+	assert := NewAssert(t)
+	type member struct {
+		Id    int64
+		Name  string  `qbs:"size:20,min:2,max:5"`
+		Age   int64   `qbs:"min:0,max:150"`
+		Role  string  `qbs:"in:admin|user"`
+		Email *string `qbs:"notnull,match:^[^@,]+@[a-z]+\\.[a-z]{2,3}$"`
+		Note  string  `qbs:"omitempty,min:3"`
+	}
+	email := "a@b.com"
+	m := structPtrToModel(&member{Name: "bob", Age: 20, Role: "user", Email: &email}, true, nil)
+	assert.Nil(m.validate())
+	assert.Equal(20, m.field("Name").size)
+
+	m = structPtrToModel(&member{Name: "b", Age: 200, Role: "root"}, true, nil)
+	err := m.validate()
+	errs, ok := err.(ValidationErrors)
+	assert.True(ok)
+	assert.Equal(4, len(errs))
+	assert.Equal("length must be at least 2", errs["Name"])
+	assert.Equal("must be at most 150", errs["Age"])
+	assert.Equal("must be one of admin, user", errs["Role"])
+	assert.Equal("must not be null", errs["Email"])
+	assert.Equal("Age must be at most 150, Email must not be null, Name length must be at least 2, Role must be one of admin, user", err.Error())
+
+	bad := "a,b@c.com"
+	m = structPtrToModel(&member{Name: "bob", Role: "admin", Email: &bad, Note: "x"}, true, nil)
+	errs = m.validate().(ValidationErrors)
+	assert.Equal(`must match ^[^@,]+@[a-z]+\.[a-z]{2,3}$`, errs["Email"])
+	assert.Equal("length must be at least 3", errs["Note"])
+}
+
+func TestSplitTags(t *testing.T) {
+	assert := NewAssert(t)
+	assert.Equal("[coltype:decimal(10,2) notnull]", fmt.Sprint(splitTags("coltype:decimal(10,2),notnull")))
+	fd := new(modelField)
+	parseTags(fd, "coltype:numeric(12,4),default:'00:00'")
+	assert.Equal("numeric(12,4)", fd.customColType())
+	assert.Equal("'00:00'", fd.dfault)
+	fd.colType = QBS_COLTYPE_TEXT
+	assert.Equal("", fd.customColType())
+}
+
+func TestParseCachedTags(t *testing.T) {
+	assert := NewAssert(t)
+	for i := 0; i < 2; i++ {
+		fd := new(modelField)
+		parseCachedTags(fd, `size:32,index,in:a|b`)
+		assert.Equal(32, fd.size)
+		assert.True(fd.index)
+		assert.Equal("[a b]", fmt.Sprint(fd.in))
+		fd.size = 64
+	}
+}
+
+func TestNameCache(t *testing.T) {
+	assert := NewAssert(t)
+	assert.Equal("user_name", toSnake("UserName"))
+	assert.Equal("user_name", toSnake("UserName"))
+	assert.Equal("UserName", snakeToUpperCamel("user_name"))
+	c := newNameCache(convertToSnake)
+	for i := 0; i < maxCachedNames+10; i++ {
+		assert.Equal(fmt.Sprintf("log_%d", i), c.get(fmt.Sprintf("Log_%d", i)))
+	}
+	assert.True(len(c.names) <= maxCachedNames)
+}
+
+func TestTimeZoneTags(t *testing.T) {
+	assert := NewAssert(t)
+	type event struct {
+		Id    int64
+		At    time.Time `qbs:"tz:utc"`
+		Local time.Time
+	}
+	zone := time.FixedZone("UTC+8", 8*3600)
+	at := time.Date(2024, 3, 1, 8, 0, 0, 0, zone)
+	m := structPtrToModel(&event{At: at, Local: at}, false, nil)
+	assert.Equal(time.UTC, m.fields[1].tz)
+	assert.Equal(time.UTC, m.fields[1].writeValue().(time.Time).Location())
+	assert.Equal(zone, m.fields[2].writeValue().(time.Time).Location())
+	StoreUTC = true
+	assert.Equal(time.UTC, m.fields[2].writeValue().(time.Time).Location())
+	StoreUTC = false
+
+	row := reflect.ValueOf(&event{At: at, Local: at.UTC()}).Elem()
+	ScanLocation = zone
+	for _, name := range []string{"At", "Local"} {
+		structField, _ := row.Type().FieldByName(name)
+		scanLocation(row.FieldByName(name), structField)
+	}
+	ScanLocation = nil
+	assert.Equal(time.UTC, row.FieldByName("At").Interface().(time.Time).Location())
+	assert.Equal(zone, row.FieldByName("Local").Interface().(time.Time).Location())
+}
@@ -0,0 +1,60 @@
+package qbs
+
+import (
+	"database/sql"
+	"reflect"
+	"sync"
+)
+
+var namedConfigs = make(map[string]*Config)
+var modelDatabases = make(map[reflect.Type]string)
+var modelDatabasesMu = new(sync.RWMutex)
+
+// Register a database by name besides the default one, e.g. an analytics database, the name is what UseDatabase takes.
+// Use RegisterNamed to set the database name needed by its migrations.
+func RegisterDatabase(name, driverName, driverSourceName string, dialect Dialect) {
+	RegisterNamed(name, driverName, driverSourceName, "", dialect)
+}
+
+func RegisterDatabaseWithDb(name string, database *sql.DB, dialect Dialect) {
+	RegisterNamedWithDb(name, "", database, "", dialect)
+}
+
+// Route the models of the struct pointers to the registered database of the name, the reads and writes of them,
+// like Save, Find, BulkInsert, Iterate and Count, use it instead of the database of the Qbs.
+// An empty name routes them back.
+func UseDatabase(name string, structPtrs ...interface{}) {
+	modelDatabasesMu.Lock()
+	defer modelDatabasesMu.Unlock()
+	for _, structPtr := range structPtrs {
+		if name == "" {
+			delete(modelDatabases, modelType(structPtr))
+		} else {
+			modelDatabases[modelType(structPtr)] = name
+		}
+	}
+}
+
+// modelDatabase returns the database the model of the struct pointer or slice pointer is routed to, nil if none.
+func modelDatabase(structPtr interface{}) *database {
+	modelDatabasesMu.RLock()
+	defer modelDatabasesMu.RUnlock()
+	name, ok := modelDatabases[modelType(structPtr)]
+	if !ok {
+		return nil
+	}
+	c, ok := namedConfigs[name]
+	if !ok {
+		panic("database " + name + " has not been registered, should call RegisterDatabase first.")
+	}
+	return c.database
+}
+
+// modelType returns the struct type of a struct pointer or a pointer to a slice of them.
+func modelType(structPtr interface{}) reflect.Type {
+	t := reflect.TypeOf(structPtr)
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t
+}
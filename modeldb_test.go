@@ -0,0 +1,30 @@
+package qbs
+
+import (
+	"database/sql"
+	"testing"
+)
+
+type analyticsEvent struct {
+	Id   int64
+	Name string
+}
+
+func TestUseDatabase(t *testing.T) {
+	assert := NewAssert(t)
+	RegisterDatabaseWithDb("analytics", new(sql.DB), NewPostgres())
+	UseDatabase("analytics", new(analyticsEvent))
+	defer UseDatabase("", new(analyticsEvent))
+	home := newDatabase(new(sql.DB), NewMysql())
+	q := &Qbs{Dialect: home.dialect, database: home, criteria: new(criteria)}
+
+	q.route(new(analyticsEvent))
+	assert.True(q.database == namedConfigs["analytics"].database)
+	assert.True(q.Dialect == namedConfigs["analytics"].database.dialect)
+	q.route(&[]*analyticsEvent{})
+	assert.True(q.database == namedConfigs["analytics"].database)
+	q.route(new(basic))
+	assert.True(q.database == home)
+	assert.True(q.Dialect == home.dialect)
+	assert.True(q.routedFrom == nil)
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -33,7 +35,10 @@ func (d mysql) parseBool(value reflect.Value) bool {
 }
 
 func (d mysql) sqlType(field modelField) string {
-	f := field.value
+	if t := field.customColType(); t != "" {
+		return t
+	}
+	f := field.typedValue()
 	fieldValue := reflect.ValueOf(f)
 	kind := fieldValue.Kind()
 	if field.nullable != reflect.Invalid {
@@ -63,7 +68,9 @@ func (d mysql) sqlType(field modelField) string {
 	case reflect.Struct:
 		switch fieldValue.Interface().(type) {
 		case time.Time:
-			return "timestamp"
+			return mysqlTimeType(field)
+		case jsonValue:
+			return "json"
 		case sql.NullBool:
 			return "boolean"
 		case sql.NullInt64:
@@ -94,15 +101,154 @@ func (d mysql) sqlType(field modelField) string {
 	panic("invalid sql type for field:" + field.name)
 }
 
+func (d mysql) renameColumnSql(table, oldName string, column modelField) string {
+	sql := fmt.Sprintf(
+		"ALTER TABLE %v CHANGE %v %v %v",
+		d.quote(table),
+		d.quote(oldName),
+		d.quote(column.name),
+		d.sqlType(column),
+	)
+	if column.notnull {
+		sql += " NOT NULL"
+	}
+	if column.dfault != "" {
+		sql += " DEFAULT " + column.dfault
+	}
+	return sql
+}
+
+func (d mysql) lockSql() (string, string) {
+	return "SELECT GET_LOCK(?, -1)", "SELECT RELEASE_LOCK(?)"
+}
+
+func (d mysql) inspectSqls() (string, string, string, string) {
+	return "SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES " +
+			"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME",
+		"SELECT TABLE_NAME, COLUMN_NAME, DATA_TYPE, IS_NULLABLE, CHARACTER_MAXIMUM_LENGTH, COLUMN_DEFAULT, COLUMN_KEY = 'PRI' " +
+			"FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = DATABASE() ORDER BY TABLE_NAME, ORDINAL_POSITION",
+		"SELECT TABLE_NAME, INDEX_NAME, COLUMN_NAME, NON_UNIQUE = 0 FROM INFORMATION_SCHEMA.STATISTICS " +
+			"WHERE TABLE_SCHEMA = DATABASE() AND INDEX_NAME <> 'PRIMARY' ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX",
+		"SELECT TABLE_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE " +
+			"WHERE TABLE_SCHEMA = DATABASE() AND REFERENCED_TABLE_NAME IS NOT NULL ORDER BY TABLE_NAME, ORDINAL_POSITION"
+}
+
+func (d mysql) randomSql() string {
+	return "RAND()"
+}
+
 func (d mysql) indexExists(mg *Migration, tableName, indexName string) bool {
 	var row *sql.Row
 	var name string
+	schema, tableName := mysqlSchema(mg, tableName)
 	row = mg.db.QueryRow("SELECT INDEX_NAME FROM INFORMATION_SCHEMA.STATISTICS "+
-		"WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND INDEX_NAME = ?", mg.dbName, tableName, indexName)
+		"WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND INDEX_NAME = ?", schema, tableName, indexName)
 	row.Scan(&name)
 	return name != ""
 }
 
+func (d mysql) columnType(mg *Migration, table, column string) string {
+	var columnType string
+	schema, table := mysqlSchema(mg, table)
+	mg.db.QueryRow("SELECT COLUMN_TYPE FROM INFORMATION_SCHEMA.COLUMNS "+
+		"WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND COLUMN_NAME = ?", schema, table, column).Scan(&columnType)
+	return mysqlColumnType(columnType)
+}
+
+// createSchemaSql creates the database of the schema, a mysql schema is a database.
+func (d mysql) createSchemaSql(schema string) string {
+	return "CREATE DATABASE IF NOT EXISTS " + d.dialect.quote(schema)
+}
+
+// planStep reads a row of EXPLAIN, the access type ALL reads every row of the table.
+func (d mysql) planStep(row map[string]string) PlanStep {
+	rows, _ := strconv.ParseInt(row["rows"], 10, 64)
+	detail := strings.TrimSpace(row["type"] + " " + row["key"] + " " + row["Extra"])
+	return PlanStep{Detail: detail, Table: row["table"], FullScan: row["type"] == "ALL", Rows: rows}
+}
+
+// mysqlTimeType stores the times of a tz tag as datetime, which isn't converted to the time zone of the session
+// like timestamp is.
+func mysqlTimeType(field modelField) string {
+	sqlType := "timestamp"
+	if field.tz != nil {
+		sqlType = "datetime"
+	}
+	if field.precision != nil {
+		sqlType += fmt.Sprintf("(%d)", *field.precision)
+	}
+	return sqlType
+}
+
+// mysqlSchema splits the table name qualified by a database, which is the database of the migration if not qualified.
+func mysqlSchema(mg *Migration, table string) (string, string) {
+	schema, table := splitSchema(table)
+	if schema == "" {
+		schema = mg.dbName
+	}
+	return schema, table
+}
+
+// mysqlColumnType maps the COLUMN_TYPE of INFORMATION_SCHEMA to the type of sqlType,
+// boolean is stored as tinyint(1), and the display widths of integers are dropped.
+func mysqlColumnType(columnType string) string {
+	columnType = strings.ToLower(columnType)
+	if columnType == "tinyint(1)" {
+		return "boolean"
+	}
+	if i := strings.Index(columnType, "int("); i >= 0 {
+		if j := strings.Index(columnType[i:], ")"); j >= 0 {
+			columnType = columnType[:i+3] + columnType[i+j+1:]
+		}
+	}
+	return columnType
+}
+
+func (d mysql) dropForeignKeySql(table, name string) string {
+	return "ALTER TABLE " + d.dialect.quote(table) + " DROP FOREIGN KEY " + d.dialect.quote(name)
+}
+
+func (d mysql) dropIndexSql(table, name string) string {
+	return "DROP INDEX " + d.dialect.quote(name) + " ON " + d.dialect.quote(table)
+}
+
+// scheduleEventSql creates an EVENT, which only runs if the event_scheduler of the server is ON.
+func (d mysql) scheduleEventSql(name string, every time.Duration, statement string) (string, []interface{}) {
+	if every < time.Second || every%time.Second != 0 {
+		return "", nil
+	}
+	interval, unit := int64(every/time.Second), "SECOND"
+	for _, u := range []struct {
+		seconds int64
+		name    string
+	}{{86400, "DAY"}, {3600, "HOUR"}, {60, "MINUTE"}} {
+		if interval%u.seconds == 0 {
+			interval, unit = interval/u.seconds, u.name
+			break
+		}
+	}
+	return fmt.Sprintf("CREATE EVENT IF NOT EXISTS %v ON SCHEDULE EVERY %d %v DO %v", d.dialect.quote(name), interval, unit, statement), nil
+}
+
+func (d mysql) unscheduleEventSql(name string) (string, []interface{}) {
+	return "DROP EVENT IF EXISTS " + d.dialect.quote(name), nil
+}
+
+func (d mysql) renameIndexSql(table, oldName, newName string) string {
+	return "ALTER TABLE " + d.dialect.quote(table) + " RENAME INDEX " + d.dialect.quote(oldName) + " TO " + d.dialect.quote(newName)
+}
+
+func (d mysql) supportsPartialIndex() bool {
+	return false
+}
+
+// tempTableSql drops the table by DROP TEMPORARY TABLE, which never drops a permanent table of the same name
+// and doesn't commit the transaction.
+func (d mysql) tempTableSql(model *model) (string, string) {
+	create, _ := d.base.tempTableSql(model)
+	return create, "DROP TEMPORARY TABLE " + d.dialect.quote(model.table)
+}
+
 func (d mysql) primaryKeySql(isString bool, size int) string {
 	if isString {
 		return fmt.Sprintf("varchar(%d) PRIMARY KEY", size)
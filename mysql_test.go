@@ -141,6 +141,16 @@ func TestMysqlBulkInsert(t *testing.T) {
 	doTestBulkInsert(NewAssert(t))
 }
 
+func TestMysqlBulkInsertRouted(t *testing.T) {
+	registerMysqlTest()
+	doTestBulkInsertRouted(NewAssert(t), "mysql")
+}
+
+func TestMysqlBulkInsertMaxTransactionRows(t *testing.T) {
+	registerMysqlTest()
+	doTestBulkInsertMaxTransactionRows(NewAssert(t))
+}
+
 func TestMysqlQueryStruct(t *testing.T) {
 	registerMysqlTest()
 	doTestQueryStruct(NewAssert(t))
@@ -204,6 +214,417 @@ func TestMysqlDropTableSQL(t *testing.T) {
 	doTestDropTableSQL(NewAssert(t), mysqlSyntax)
 }
 
+func TestMysqlChangeEvents(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestChangeEvents(NewAssert(t), mg, q)
+}
+
+func TestMysqlTopNSQL(t *testing.T) {
+	doTestTopNSQL(NewAssert(t), NewMysql(),
+		"SELECT `comment`.`id`, `comment`.`post_id`, `comment`.`body` FROM `comment` WHERE (body <> ?) AND (SELECT COUNT(*) FROM `comment` AS `qbs_top` WHERE `qbs_top`.`post_id` = `comment`.`post_id` AND ((`qbs_top`.`id` > `comment`.`id`)) AND (body <> ?)) < ? ORDER BY `comment`.`post_id`, `comment`.`id` DESC")
+}
+
+func TestMysqlAutoDiffSQL(t *testing.T) {
+	doTestAutoDiffSQL(NewAssert(t), NewMysql(), []string{
+		"ALTER TABLE `user` MODIFY COLUMN `name` varchar(128)",
+		"ALTER TABLE `user` MODIFY COLUMN `age` bigint",
+		"ALTER TABLE `user` CHANGE `email` `email_v2` longtext",
+		"ALTER TABLE `user` ADD COLUMN `nick` longtext",
+	})
+}
+
+func TestMysqlSampleSQL(t *testing.T) {
+	doTestSampleSQL(NewAssert(t), NewMysql(), "SELECT `id`, `body` FROM `comment` ORDER BY RAND() LIMIT ?",
+		"SELECT `id`, `body` FROM `comment` WHERE (RAND() < ?) AND (body = ?)")
+}
+
+func TestMysqlDryRunSQL(t *testing.T) {
+	doTestDryRunSQL(NewAssert(t), NewMysql(), "ALTER TABLE `user` ADD COLUMN `nick` longtext;\n"+
+		"INSERT INTO `user` (`id`, `name`) VALUES (3, 'o''neil');\n")
+}
+
+func TestMysqlCompositePkSQL(t *testing.T) {
+	doTestCompositePkSQL(NewAssert(t), NewMysql(),
+		"CREATE TABLE `membership` ( `user_id` bigint NOT NULL, `group_id` bigint NOT NULL, `role` longtext, PRIMARY KEY (`user_id`, `group_id`) )",
+		"UPDATE `membership` SET `role` = ? WHERE (`user_id` = ?) AND (`group_id` = ?)")
+}
+
+func TestMysqlSoftDeleteToSQL(t *testing.T) {
+	doTestSoftDeleteToSQL(NewAssert(t), NewMysql(), "SELECT `id`, `name`, `deleted` FROM `soft_deleted_ptr` WHERE `soft_deleted_ptr`.`deleted` IS NULL")
+}
+
+func TestMysqlToSQL(t *testing.T) {
+	doTestToSQL(NewAssert(t), NewMysql(), "SELECT `id`, `body` FROM `comment` WHERE body = ? ORDER BY `id` LIMIT ?")
+}
+
+func TestMysqlGroupBySQL(t *testing.T) {
+	doTestGroupBySQL(NewAssert(t), NewMysql(), "SELECT `author_id` FROM `post` WHERE title <> ? GROUP BY `author_id` HAVING COUNT(*) > ? ORDER BY `author_id`")
+}
+
+func TestMysqlWarmUpSQL(t *testing.T) {
+	doTestWarmUpSQL(NewAssert(t), NewMysql(),
+		"INSERT INTO `sql_gen_model` (`first`, `last`, `amount`) VALUES (?, ?, ?)",
+		"SELECT `prim`, `first`, `last`, `amount` FROM `sql_gen_model` WHERE `sql_gen_model`.`prim` = ? LIMIT ?",
+		"UPDATE `sql_gen_model` SET `first` = ?, `last` = ?, `amount` = ? WHERE `prim` = ?")
+}
+
+func TestMysqlIndexSQL(t *testing.T) {
+	doTestIndexSQL(NewAssert(t), NewMysql(),
+		"CREATE UNIQUE INDEX `user_lower_email_tenant` ON `user` ((lower(email)), `tenant`)",
+		"DROP INDEX `user_name` ON `user`",
+		"ALTER TABLE `user` RENAME INDEX `user_name` TO `user_full_name`",
+		false)
+}
+
+func TestMysqlForeignKeySQL(t *testing.T) {
+	doTestForeignKeySQL(NewAssert(t), NewMysql(),
+		"CREATE TABLE `fk_post` ( `id` bigint PRIMARY KEY AUTO_INCREMENT, `fk_author_id` bigint, "+
+			"FOREIGN KEY (`fk_author_id`) REFERENCES `fk_author` (`id`) ON DELETE SET NULL ON UPDATE CASCADE )",
+		"ALTER TABLE `fk_post` ADD CONSTRAINT `fk_post_fk_author_id_fkey` FOREIGN KEY (`fk_author_id`) "+
+			"REFERENCES `fk_author` (`id`) ON DELETE SET NULL ON UPDATE CASCADE",
+		"ALTER TABLE `fk_post` DROP FOREIGN KEY `fk_post_fk_author_id_fkey`")
+}
+
+func TestMysqlScheduleEventSQL(t *testing.T) {
+	doTestScheduleEventSQL(NewAssert(t), NewMysql(),
+		"CREATE EVENT IF NOT EXISTS `purge_sessions` ON SCHEDULE EVERY 2 HOUR DO DELETE FROM session WHERE expired < NOW() []",
+		"DROP EVENT IF EXISTS `purge_sessions` []")
+}
+
+func TestMysqlAlterColumnTypeSQL(t *testing.T) {
+	doTestAlterColumnTypeSQL(NewAssert(t), NewMysql(), "ALTER TABLE `account` MODIFY COLUMN `balance` double")
+}
+
+func TestMysqlColumnType(t *testing.T) {
+	assert := NewAssert(t)
+	assert.Equal("boolean", mysqlColumnType("tinyint(1)"))
+	assert.Equal("bigint", mysqlColumnType("bigint(20)"))
+	assert.Equal("int unsigned", mysqlColumnType("INT(10) UNSIGNED"))
+	assert.Equal("varchar(64)", mysqlColumnType("varchar(64)"))
+}
+
+func TestMysqlColTypeSQL(t *testing.T) {
+	doTestColTypeSQL(NewAssert(t), NewMysql(),
+		"CREATE TABLE `invoice` ( `id` char(36) PRIMARY KEY, `total` decimal(10,2) NOT NULL DEFAULT 0 )",
+		"ALTER TABLE `invoice` ADD COLUMN `total` decimal(10,2)")
+}
+
+func TestMysqlUUIDPkSQL(t *testing.T) {
+	doTestUUIDPkSQL(NewAssert(t), NewMysql(), "CREATE TABLE `device` ( `id` char(36) PRIMARY KEY, `name` varchar(64) )")
+}
+
+func TestMysqlTempTableSQL(t *testing.T) {
+	doTestTempTableSQL(NewAssert(t), NewMysql(),
+		"CREATE TEMPORARY TABLE `staging` ( `id` bigint PRIMARY KEY AUTO_INCREMENT, `name` varchar(64) )",
+		"DROP TEMPORARY TABLE `staging`")
+}
+
+func TestMysqlAttachDatabaseSQL(t *testing.T) {
+	doTestAttachDatabaseSQL(NewAssert(t), NewMysql(), "", "",
+		"INSERT INTO `customer` (`id`, `name`) SELECT `id`, `name` FROM `legacy`.`customer`")
+}
+
+func TestMysqlReturningSQL(t *testing.T) {
+	doTestReturningSQL(NewAssert(t), NewMysql(),
+		"INSERT INTO `account` (`id`, `balance`) VALUES (?, ?)",
+		"UPDATE `account` SET `balance` = ? WHERE `id` = ?")
+}
+
+func TestMysqlSchemaSQL(t *testing.T) {
+	doTestSchemaSQL(NewAssert(t), NewMysql(), "CREATE DATABASE IF NOT EXISTS `tenant_a`",
+		"SELECT `tenant_a`.`essay`.`id`, `tenant_a`.`essay`.`title`, `tenant_a`.`essay`.`writer_id`, "+
+			"`writer`.`id` AS writer___id, `writer`.`name` AS writer___name FROM `tenant_a`.`essay` "+
+			"LEFT JOIN `tenant_a`.`writer` AS `writer` ON `tenant_a`.`essay`.`writer_id` = `writer`.`id`",
+		"DROP INDEX `essay_title` ON `tenant_a`.`essay`")
+}
+
+func TestMysqlCreateTableScriptSQL(t *testing.T) {
+	doTestCreateTableScriptSQL(NewAssert(t), NewMysql(), "CREATE DATABASE IF NOT EXISTS `shop`;\n"+
+		"CREATE TABLE IF NOT EXISTS `shop`.`script_product` ( `id` bigint PRIMARY KEY AUTO_INCREMENT, "+
+		"`sku` varchar(32), `name` varchar(64), `deleted` timestamp );\n"+
+		"CREATE UNIQUE INDEX `script_product_sku` ON `shop`.`script_product` (`sku`);\n"+
+		"CREATE INDEX `script_product_lower_name` ON `shop`.`script_product` ((lower(name)));\n")
+}
+
+func TestMysqlPlanStepSQL(t *testing.T) {
+	doTestPlanStepSQL(NewAssert(t), NewMysql(), "EXPLAIN SELECT `id` FROM `post` WHERE `title` = ?",
+		map[string]string{"id": "1", "select_type": "SIMPLE", "table": "post", "type": "ALL", "key": "", "rows": "2550", "Extra": "Using where"},
+		PlanStep{Detail: "ALL  Using where", Table: "post", FullScan: true, Rows: 2550})
+}
+
+func TestMysqlDataCheckSQL(t *testing.T) {
+	doTestDataCheckSQL(NewAssert(t), NewMysql(),
+		"SELECT COUNT(*) FROM `checked_item` WHERE `code` IS NULL",
+		"SELECT COUNT(*) FROM `checked_item` WHERE `price` < ? OR `price` > ?",
+		"SELECT COUNT(*) FROM (SELECT `code` FROM `checked_item` WHERE `code` IS NOT NULL GROUP BY `code` HAVING COUNT(*) > 1) duplicated",
+		"SELECT COUNT(*) FROM `checked_item` LEFT JOIN `checked_item` parent ON `checked_item`.`parent_id` = `parent`.`id` "+
+			"WHERE `checked_item`.`parent_id` IS NOT NULL AND `parent`.`id` IS NULL",
+		"SELECT COUNT(*) FROM `checked_item` WHERE code = ?")
+}
+
+func TestMysqlTimeTypeSQL(t *testing.T) {
+	doTestTimeTypeSQL(NewAssert(t), NewMysql(), "timestamp", "timestamp(3)", "datetime(6)")
+}
+
+func TestMysqlBulkInsertSQL(t *testing.T) {
+	doTestBulkInsertSQL(NewAssert(t), NewMysql(), "INSERT INTO `sql_gen_model` (`prim`, `first`, `last`, `amount`) VALUES (?, ?, ?, ?), (?, ?, ?, ?)")
+}
+
+func TestMysqlAddColumnWithBackfill(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestAddColumnWithBackfill(NewAssert(t), mg, q)
+}
+
+func TestMysqlSetNotNull(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestSetNotNull(NewAssert(t), mg, q)
+}
+
+func TestMysqlResizeColumn(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestResizeColumn(NewAssert(t), mg, q)
+}
+
+func TestMysqlCompareTables(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestCompareTables(NewAssert(t), mg, q)
+}
+
+func TestMysqlShadow(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestShadow(NewAssert(t), mg, q)
+}
+
+func TestMysqlCanary(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestCanary(NewAssert(t), mg, q)
+}
+
+func TestMysqlNewFromTx(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestNewFromTx(NewAssert(t), mg, q)
+}
+
+func TestMysqlBulkUpdate(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestBulkUpdate(NewAssert(t), mg, q)
+}
+
+func TestMysqlQueryStructNested(t *testing.T) {
+	registerMysqlTest()
+	doTestQueryStructNested(NewAssert(t))
+}
+
+func TestMysqlAggregateBy(t *testing.T) {
+	registerMysqlTest()
+	doTestAggregateBy(NewAssert(t))
+}
+
+func TestMysqlSoftDelete(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestSoftDelete(NewAssert(t), mg, q)
+}
+
+func TestMysqlPaginate(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestPaginate(NewAssert(t), mg, q)
+}
+
+func TestMysqlByUnique(t *testing.T) {
+	registerMysqlTest()
+	doTestByUnique(NewAssert(t))
+}
+
+func TestMysqlPing(t *testing.T) {
+	registerMysqlTest()
+	doTestPing(NewAssert(t))
+}
+
+func TestMysqlDryRun(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestDryRun(NewAssert(t), mg, q)
+}
+
+func TestMysqlCoalesce(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestCoalesce(NewAssert(t), mg, q)
+}
+
+func TestMysqlMigrateBlobs(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestMigrateBlobs(NewAssert(t), mg, q)
+}
+
+func TestMysqlCompositePk(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestCompositePk(NewAssert(t), mg, q)
+}
+
+func TestMysqlOptimisticLock(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestOptimisticLock(NewAssert(t), mg, q)
+}
+
+func TestMysqlStmtCache(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestStmtCache(NewAssert(t), mg, q)
+}
+
+func TestMysqlEmbeddedStruct(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestEmbeddedStruct(NewAssert(t), mg, q)
+}
+
+func TestMysqlTransformColumn(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestTransformColumn(NewAssert(t), mg, q)
+}
+
+func TestMysqlJSONField(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestJSONField(NewAssert(t), mg, q)
+}
+
+func TestMysqlSampleTransform(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestSampleTransform(NewAssert(t), mg, q)
+}
+
+func TestMysqlHooks(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestHooks(NewAssert(t), mg, q)
+}
+
+func TestMysqlIterateNull(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestIterateNull(NewAssert(t), mg, q)
+}
+
+func TestMysqlIntrospection(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestIntrospection(NewAssert(t), mg, q)
+}
+
+func TestMysqlAggregates(t *testing.T) {
+	registerMysqlTest()
+	doTestAggregates(NewAssert(t))
+}
+
+func TestMysqlMigrationLock(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestMigrationLock(NewAssert(t), mg, q)
+}
+
+func TestMysqlPrepareModels(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestPrepareModels(NewAssert(t), mg, q)
+}
+
+func TestMysqlInspect(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestInspect(NewAssert(t), mg, q)
+}
+
+func TestMysqlNestedTransaction(t *testing.T) {
+	registerMysqlTest()
+	doTestNestedTransaction(NewAssert(t))
+}
+
+func TestMysqlManageIndexes(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestManageIndexes(NewAssert(t), mg, q)
+}
+
+func TestMysqlAlterForeignKey(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestAlterForeignKey(NewAssert(t), mg, q)
+}
+
+func TestMysqlModelCache(t *testing.T) {
+	registerMysqlTest()
+	doTestModelCache(NewAssert(t))
+}
+
+func TestMysqlSnapshot(t *testing.T) {
+	registerMysqlTest()
+	doTestSnapshot(NewAssert(t))
+}
+
+func TestMysqlSpillIterate(t *testing.T) {
+	registerMysqlTest()
+	doTestSpillIterate(NewAssert(t))
+}
+
+func TestMysqlDumpSchema(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestDumpSchema(NewAssert(t), mg, q)
+}
+
+func TestMysqlRenameColumn(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestRenameColumn(NewAssert(t), mg, q)
+}
+
+func TestMysqlAlterColumnType(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestAlterColumnType(NewAssert(t), mg, q)
+}
+
+func TestMysqlUUIDPk(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestUUIDPk(NewAssert(t), mg, q)
+}
+
+func TestMysqlQueryCache(t *testing.T) {
+	registerMysqlTest()
+	doTestQueryCache(NewAssert(t))
+}
+
+func TestMysqlTempTable(t *testing.T) {
+	registerMysqlTest()
+	doTestTempTable(NewAssert(t))
+}
+
+func TestMysqlReturning(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestReturning(NewAssert(t), mg, q)
+}
+
+func TestMysqlSchema(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestSchema(NewAssert(t), mg, q)
+}
+
+func TestMysqlSeeds(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestSeeds(NewAssert(t), mg, q)
+}
+
+func TestMysqlRetention(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestRetention(NewAssert(t), mg, q)
+}
+
+func TestMysqlArchive(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestArchive(NewAssert(t), mg, q)
+}
+
+func TestMysqlExplain(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestExplain(NewAssert(t), mg, q)
+}
+
+func TestMysqlDataCheck(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestDataCheck(NewAssert(t), mg, q)
+}
+
+func TestMysqlAudit(t *testing.T) {
+	mg, q := setupMysqlDb()
+	doTestAudit(NewAssert(t), mg, q)
+}
+
 func TestMysqlDataSourceName(t *testing.T) {
 	dsn := new(DataSourceName)
 	dsn.DbName = "abc"
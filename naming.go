@@ -0,0 +1,138 @@
+package qbs
+
+import (
+	"strings"
+	"sync"
+)
+
+// NamingConvention converts between struct/field names and table/column names.
+// Set it to Qbs.Naming or Migration.Naming to use a different convention per instance,
+// if not set the package level FieldNameToColumnName, StructNameToTableName,
+// ColumnNameToFieldName and TableNameToStructName functions are used.
+type NamingConvention interface {
+	ColumnName(fieldName string) string
+	TableName(structName string) string
+	FieldName(columnName string) string
+	StructName(tableName string) string
+}
+
+var (
+	// SnakeCase maps "UserName" to "user_name".
+	SnakeCase NamingConvention = snakeCase{}
+	// LowerCamel maps "UserName" to "userName".
+	LowerCamel NamingConvention = lowerCamel{}
+	// SameCase uses struct and field names as table and column names.
+	SameCase NamingConvention = sameCase{}
+)
+
+// Prefixed prepends the prefix to the table names of the base convention, e.g. Prefixed("app_", SnakeCase).
+func Prefixed(prefix string, base NamingConvention) NamingConvention {
+	return prefixed{prefix, base}
+}
+
+type globalNaming struct{}
+
+func (globalNaming) ColumnName(fieldName string) string { return FieldNameToColumnName(fieldName) }
+func (globalNaming) TableName(structName string) string { return StructNameToTableName(structName) }
+func (globalNaming) FieldName(columnName string) string { return ColumnNameToFieldName(columnName) }
+func (globalNaming) StructName(tableName string) string { return TableNameToStructName(tableName) }
+
+type snakeCase struct{}
+
+func (snakeCase) ColumnName(fieldName string) string { return toSnake(fieldName) }
+func (snakeCase) TableName(structName string) string { return toSnake(structName) }
+func (snakeCase) FieldName(columnName string) string { return snakeToUpperCamel(columnName) }
+func (snakeCase) StructName(tableName string) string { return snakeToUpperCamel(tableName) }
+
+type lowerCamel struct{}
+
+func (lowerCamel) ColumnName(fieldName string) string { return lowerFirst(fieldName) }
+func (lowerCamel) TableName(structName string) string { return lowerFirst(structName) }
+func (lowerCamel) FieldName(columnName string) string { return upperFirst(columnName) }
+func (lowerCamel) StructName(tableName string) string { return upperFirst(tableName) }
+
+type sameCase struct{}
+
+func (sameCase) ColumnName(fieldName string) string { return fieldName }
+func (sameCase) TableName(structName string) string { return structName }
+func (sameCase) FieldName(columnName string) string { return columnName }
+func (sameCase) StructName(tableName string) string { return tableName }
+
+type prefixed struct {
+	prefix string
+	base   NamingConvention
+}
+
+func (p prefixed) ColumnName(fieldName string) string { return p.base.ColumnName(fieldName) }
+func (p prefixed) TableName(structName string) string { return p.prefix + p.base.TableName(structName) }
+func (p prefixed) FieldName(columnName string) string { return p.base.FieldName(columnName) }
+func (p prefixed) StructName(tableName string) string {
+	return p.base.StructName(strings.TrimPrefix(tableName, p.prefix))
+}
+
+func lowerFirst(s string) string {
+	if s == "" || s[0] < 'A' || s[0] > 'Z' {
+		return s
+	}
+	return string(s[0]+32) + s[1:]
+}
+
+func upperFirst(s string) string {
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		return s
+	}
+	return string(s[0]-32) + s[1:]
+}
+
+func (q *Qbs) naming() NamingConvention {
+	return withSchema(q.Naming, q.schema)
+}
+
+func (mg *Migration) naming() NamingConvention {
+	return withSchema(mg.Naming, mg.schema)
+}
+
+func withSchema(naming NamingConvention, schema string) NamingConvention {
+	if naming == nil {
+		naming = globalNaming{}
+	}
+	if schema != "" {
+		return schemaNaming{schema, naming}
+	}
+	return naming
+}
+
+// The most names a nameCache keeps.
+const maxCachedNames = 4096
+
+var snakeNames = newNameCache(convertToSnake)
+var camelNames = newNameCache(convertSnakeToUpperCamel)
+
+// nameCache memoizes a name conversion, the struct, field, table and column names of an application are a small set.
+// It is emptied when it is full, so names built at run time, like tables with a date suffix, can't grow it without bound.
+type nameCache struct {
+	mu      sync.RWMutex
+	names   map[string]string
+	convert func(string) string
+}
+
+func newNameCache(convert func(string) string) *nameCache {
+	return &nameCache{names: make(map[string]string), convert: convert}
+}
+
+func (c *nameCache) get(name string) string {
+	c.mu.RLock()
+	converted, ok := c.names[name]
+	c.mu.RUnlock()
+	if ok {
+		return converted
+	}
+	converted = c.convert(name)
+	c.mu.Lock()
+	if len(c.names) >= maxCachedNames {
+		c.names = make(map[string]string)
+	}
+	c.names[name] = converted
+	c.mu.Unlock()
+	return converted
+}
@@ -22,15 +22,21 @@ func (d oracle) quote(s string) string {
 	a := []string{}
 	c := strings.Split(s, sep)
 	for _, v := range c {
-		a = append(a, fmt.Sprintf(`"%s"`, v))
+		a = append(a, `"`+strings.Replace(v, `"`, `""`, -1)+`"`)
 	}
 	return strings.Join(a, sep)
 }
 
 func (d oracle) sqlType(field modelField) string {
-	f := field.value
+	if t := field.customColType(); t != "" {
+		return t
+	}
+	f := field.typedValue()
 	switch f.(type) {
 	case time.Time:
+		if field.precision != nil {
+			return fmt.Sprintf("TIMESTAMP(%d)", *field.precision)
+		}
 		return "DATE"
 	/*
 		        case bool:
@@ -51,6 +57,8 @@ func (d oracle) sqlType(field modelField) string {
 			return fmt.Sprintf("VARCHAR2(%d)", field.size)
 		}
 		return "CLOB"
+	case jsonValue:
+		return "CLOB"
 	default:
 		if len(field.colType) != 0 {
 			switch field.colType {
@@ -80,6 +88,10 @@ func (d oracle) sqlType(field modelField) string {
 
 func (d oracle) insert(q *Qbs) (int64, error) {
 	sql, args := d.dialect.insertSql(q.criteria)
+	if q.criteria.model.pk == nil {
+		_, err := q.Exec(sql, args...)
+		return 0, err
+	}
 	row := q.QueryRow(sql, args...)
 	value := q.criteria.model.pk.value
 	var err error
@@ -95,10 +107,42 @@ func (d oracle) insert(q *Qbs) (int64, error) {
 
 func (d oracle) insertSql(criteria *criteria) (string, []interface{}) {
 	sql, values := d.base.insertSql(criteria)
-	sql += " RETURNING " + d.dialect.quote(criteria.model.pk.name)
+	if criteria.model.pk != nil {
+		sql += " RETURNING " + d.dialect.quote(criteria.model.pk.name)
+	}
 	return sql, values
 }
 
+// bulkInsert inserts a single row, as oracle does not support multi-row VALUES.
+func (d oracle) bulkInsert(q *Qbs, models []*model) ([]int64, error) {
+	q.criteria.model = models[0]
+	id, err := d.insert(q)
+	if err != nil {
+		return nil, err
+	}
+	return []int64{id}, nil
+}
+
+func (d oracle) maxBulkInsertRows(columns int) int {
+	return 1
+}
+
+func (d oracle) setNotNullSql(table string, column modelField) []string {
+	dfault := ""
+	if column.dfault != "" {
+		dfault = " DEFAULT " + column.dfault
+	}
+	return []string{fmt.Sprintf("ALTER TABLE %v MODIFY (%v%v NOT NULL)", d.dialect.quote(table), d.dialect.quote(column.name), dfault)}
+}
+
+func (d oracle) resizeColumnSql(table string, column modelField) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %v MODIFY (%v %v)", d.dialect.quote(table), d.dialect.quote(column.name), d.dialect.sqlType(column))}
+}
+
+func (d oracle) charLengthSql(column string) string {
+	return "LENGTH(" + column + ")"
+}
+
 func (d oracle) indexExists(mg *Migration, tableName, indexName string) bool {
 	var row *sql.Row
 	var name string
@@ -110,6 +154,10 @@ func (d oracle) indexExists(mg *Migration, tableName, indexName string) bool {
 	return name != ""
 }
 
+func (d oracle) supportsPartialIndex() bool {
+	return false
+}
+
 func (d oracle) substituteMarkers(query string) string {
 	position := 1
 	chunks := make([]string, 0, len(query)*2)
@@ -125,7 +173,7 @@ func (d oracle) substituteMarkers(query string) string {
 }
 
 func (d oracle) columnsInTable(mg *Migration, table interface{}) map[string]bool {
-	tn := tableName(table)
+	tn := namedTableName(table, mg.naming())
 	columns := make(map[string]bool)
 	query := "SELECT COLUMN_NAME FROM USER_TAB_COLUMNS WHERE TABLE_NAME = ?"
 	query = mg.dialect.substituteMarkers(query)
@@ -154,8 +202,20 @@ func (d oracle) primaryKeySql(isString bool, size int) string {
 	return fmt.Sprintf("NUMBER(%d) PRIMARY KEY NOT NULL", size)
 }
 
+// tempTableSql is not supported, temporary tables of oracle are created once like other tables.
+func (d oracle) tempTableSql(model *model) (string, string) {
+	return "", ""
+}
+
+func (d oracle) uuidType() string {
+	return "CHAR(36)"
+}
+
 func (d oracle) createTableSql(model *model, ifNotExists bool) string {
 	baseSql := d.base.createTableSql(model, false)
+	if model.pk == nil {
+		return baseSql
+	}
 	if _, isString := model.pk.value.(string); isString {
 		return baseSql
 	}
@@ -180,3 +240,30 @@ func (d oracle) dropTableSql(table string) string {
 	a = append(a, d.dialect.quote(table))
 	return strings.Join(a, " ")
 }
+
+func (d oracle) supportsRowValues() bool {
+	return false
+}
+
+// snapshotIsolation is serializable, which reads the snapshot at the start of the transaction in oracle.
+func (d oracle) snapshotIsolation() sql.IsolationLevel {
+	return sql.LevelSerializable
+}
+
+// savepointSql has no release statement, oracle releases savepoints at the end of the transaction.
+func (d oracle) savepointSql(name string) (string, string, string) {
+	name = d.dialect.quote(name)
+	return "SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name, ""
+}
+
+func (d oracle) explainSql(query string) string {
+	return ""
+}
+
+func (d oracle) randomSql() string {
+	return "DBMS_RANDOM.VALUE"
+}
+
+func (d oracle) tableSampleSql(percent float64) string {
+	return fmt.Sprintf("SAMPLE (%v)", percent)
+}
@@ -0,0 +1,25 @@
+//go:build parquet
+
+package qbs
+
+import (
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// ExportParquet writes the rows of the table of the struct matching the criteria to w as a Parquet file,
+// e.g. a snapshot of the table for analytics tools or a backup before a migration. The rows are read one at a time
+// by Iterate. The schema is derived from the struct by parquet-go, so the columns are named by the `parquet` tags,
+// or else the field names, and the fields must be of the types parquet-go supports.
+// It is only built with the parquet build tag, so the dependency is optional.
+func (q *Qbs) ExportParquet(w io.Writer, structPtr interface{}) error {
+	writer := parquet.NewWriter(w, parquet.SchemaOf(structPtr))
+	err := q.Iterate(structPtr, func() error {
+		return writer.Write(structPtr)
+	})
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
@@ -0,0 +1,93 @@
+package qbs
+
+import (
+	"bytes"
+	"sync"
+)
+
+// The models and criteria are not pooled, they outlive the queries in hooks, caches and shadow writes,
+// the allocations reused are the ones never leaking out of a call.
+
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// getBuffer returns an empty buffer from the pool, put it back by putBuffer after its content is copied.
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+var parsedTags = new(sync.Map)
+
+// parseCachedTags sets the attributes of the tag to the new field, each distinct tag is parsed only once.
+func parseCachedTags(fd *modelField, s string) {
+	if s == "" {
+		return
+	}
+	if parsed, ok := parsedTags.Load(s); ok {
+		*fd = *parsed.(*modelField)
+		return
+	}
+	parseTags(fd, s)
+	parsed := *fd
+	parsedTags.Store(s, &parsed)
+}
+
+// Pool reuses the Qbs instances of a database for short units of work like HTTP requests, Get one per goroutine
+// and Put it back when done. The dialect, naming, logger and criteria are fields of the Qbs, so distinct instances
+// can be used by different goroutines at the same time, one instance must not be shared by them.
+type Pool struct {
+	Setup  func(q *Qbs) // Configures every Qbs returned by Get, like its Naming, Logger or Retry.
+	config *Config      // The default database if nil.
+	pool   sync.Pool
+}
+
+// NewPool returns a pool of Qbs working on the registered database, Get is limited by SetConnectionLimit like GetQbs.
+func NewPool() *Pool {
+	return new(Pool)
+}
+
+// NewPool returns a pool of Qbs working on the database of the Config.
+func (c *Config) NewPool() *Pool {
+	return &Pool{config: c}
+}
+
+func (p *Pool) Get() (*Qbs, error) {
+	q, _ := p.pool.Get().(*Qbs)
+	if q == nil {
+		var err error
+		if p.config != nil {
+			q, err = p.config.GetQbs()
+		} else {
+			q, err = GetQbs()
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else if !q.borrowed {
+		if err := acquireConnection(); err != nil {
+			p.pool.Put(q)
+			return nil, err
+		}
+	}
+	if p.Setup != nil {
+		p.Setup(q)
+	}
+	return q, nil
+}
+
+// Put closes the Qbs, rolling back a transaction left open, and clears it for a later Get,
+// it must not be used after that.
+func (p *Pool) Put(q *Qbs) {
+	q.Close()
+	if p.config != nil {
+		*q = Qbs{Dialect: p.config.Dialect, database: p.config.database, borrowed: true}
+	} else {
+		*q = Qbs{Dialect: dial, database: defaultDatabase}
+	}
+	q.criteria = new(criteria)
+	p.pool.Put(q)
+}
@@ -0,0 +1,41 @@
+package qbs
+
+import (
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	assert := NewAssert(t)
+	c := NewConfigWithDb("postgres", new(sql.DB), "analytics", NewPostgres())
+	pool := c.NewPool()
+	pool.Setup = func(q *Qbs) {
+		q.LogOutput = os.Stderr
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			q, err := pool.Get()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			q.Log = i%2 == 0
+			q.Limit(i).Offset(i)
+			assert.Equal(i, q.criteria.limit)
+			pool.Put(q)
+		}(i)
+	}
+	wg.Wait()
+	q, err := pool.Get()
+	assert.MustNil(err)
+	assert.True(q.database == c.database)
+	assert.True(q.LogOutput == os.Stderr)
+	assert.True(!q.Log)
+	assert.Equal(0, q.criteria.limit)
+	pool.Put(q)
+}
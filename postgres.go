@@ -31,19 +31,23 @@ func DefaultPostgresDataSourceName(dbName string) *DataSourceName {
 
 func (d postgres) quote(s string) string {
 	segs := strings.Split(s, ".")
-	buf := new(bytes.Buffer)
+	buf := getBuffer()
+	defer putBuffer(buf)
 	buf.WriteByte('"')
-	buf.WriteString(segs[0])
+	buf.WriteString(strings.Replace(segs[0], `"`, `""`, -1))
 	for i := 1; i < len(segs); i++ {
 		buf.WriteString(`"."`)
-		buf.WriteString(segs[i])
+		buf.WriteString(strings.Replace(segs[i], `"`, `""`, -1))
 	}
 	buf.WriteByte('"')
 	return buf.String()
 }
 
 func (d postgres) sqlType(field modelField) string {
-	f := field.value
+	if t := field.customColType(); t != "" {
+		return t
+	}
+	f := field.typedValue()
 	fieldValue := reflect.ValueOf(f)
 	kind := fieldValue.Kind()
 	if field.nullable != reflect.Invalid {
@@ -73,7 +77,12 @@ func (d postgres) sqlType(field modelField) string {
 	case reflect.Struct:
 		switch fieldValue.Interface().(type) {
 		case time.Time:
+			if field.precision != nil {
+				return fmt.Sprintf("timestamp(%d) with time zone", *field.precision)
+			}
 			return "timestamp with time zone"
+		case jsonValue:
+			return "jsonb"
 		case sql.NullBool:
 			return "boolean"
 		case sql.NullInt64:
@@ -111,8 +120,53 @@ func (d postgres) sqlType(field modelField) string {
 	panic("invalid sql type for field:" + field.name)
 }
 
+// topNSql selects the first n rows of every group with a LATERAL join on the distinct group values.
+func (d postgres) topNSql(criteria *criteria, groupColumn string, n int) (string, []interface{}) {
+	model := criteria.model
+	table := d.dialect.quote(model.table)
+	alias := d.dialect.quote("qbs_top")
+	groups := d.dialect.quote("qbs_group")
+	group := d.dialect.quote(groupColumn)
+	columns := make([]string, 0, len(model.fields))
+	outerColumns := make([]string, 0, len(model.fields))
+	for _, f := range model.fields {
+		columns = append(columns, table+"."+d.dialect.quote(f.name))
+		outerColumns = append(outerColumns, alias+"."+d.dialect.quote(f.name))
+	}
+	innerOrders := make([]string, 0, len(criteria.orderBys)+1)
+	outerOrders := []string{alias + "." + group}
+	for _, o := range topNOrders(criteria) {
+		desc := ""
+		if o.desc {
+			desc = " DESC"
+		}
+		innerOrders = append(innerOrders, table+"."+d.dialect.quote(o.path)+desc)
+		outerOrders = append(outerOrders, alias+"."+d.dialect.quote(o.path)+desc)
+	}
+	var args []interface{}
+	groupWhere, where := "", ""
+	if criteria.condition != nil {
+		cexpr, cargs := criteria.condition.Merge()
+		groupWhere = " WHERE " + cexpr
+		where = " AND (" + cexpr + ")"
+		args = append(args, cargs...)
+		args = append(args, cargs...)
+	}
+	args = append(args, n)
+	query := fmt.Sprintf("SELECT %v FROM (SELECT DISTINCT %v FROM %v%v) AS %v "+
+		"CROSS JOIN LATERAL (SELECT %v FROM %v WHERE %v.%v = %v.%v%v ORDER BY %v LIMIT ?) AS %v ORDER BY %v",
+		strings.Join(outerColumns, ", "), group, table, groupWhere, groups,
+		strings.Join(columns, ", "), table, table, group, groups, group, where, strings.Join(innerOrders, ", "), alias,
+		strings.Join(outerOrders, ", "))
+	return d.dialect.substituteMarkers(query), args
+}
+
 func (d postgres) insert(q *Qbs) (int64, error) {
 	sql, args := d.dialect.insertSql(q.criteria)
+	if q.criteria.model.pk == nil {
+		_, err := q.Exec(sql, args...)
+		return 0, err
+	}
 	row := q.QueryRow(sql, args...)
 	value := q.criteria.model.pk.value
 	var err error
@@ -128,17 +182,203 @@ func (d postgres) insert(q *Qbs) (int64, error) {
 
 func (d postgres) insertSql(criteria *criteria) (string, []interface{}) {
 	sql, values := d.base.insertSql(criteria)
-	sql += " RETURNING " + d.dialect.quote(criteria.model.pk.name)
+	if criteria.model.pk != nil && !criteria.returning {
+		sql += " RETURNING " + d.dialect.quote(criteria.model.pk.name)
+	}
 	return sql, values
 }
 
+func (d postgres) bulkInsert(q *Qbs, models []*model) ([]int64, error) {
+	sql, args := d.dialect.bulkInsertSql(models)
+	rows, err := q.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int64, 0, len(models))
+	_, isInt := models[0].pk.value.(int64)
+	for rows.Next() {
+		var id int64
+		if isInt {
+			err = rows.Scan(&id)
+		} else {
+			var str string
+			err = rows.Scan(&str)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (d postgres) bulkInsertSql(models []*model) (string, []interface{}) {
+	sql, values := d.base.bulkInsertSql(models)
+	sql += " RETURNING " + d.dialect.quote(models[0].pk.name)
+	return sql, values
+}
+
+// setNotNullSql validates a NOT VALID check constraint first, which doesn't block writes,
+// so SET NOT NULL can use the constraint instead of scanning the table with an exclusive lock.
+func (d postgres) setNotNullSql(table string, column modelField) []string {
+	alterTable := "ALTER TABLE " + d.dialect.quote(table)
+	alterColumn := alterTable + " ALTER COLUMN " + d.dialect.quote(column.name)
+	check := d.dialect.quote(unqualified(table) + "_" + column.name + "_not_null")
+	sqls := []string{}
+	if column.dfault != "" {
+		sqls = append(sqls, alterColumn+" SET DEFAULT "+column.dfault)
+	}
+	return append(sqls,
+		alterTable+" ADD CONSTRAINT "+check+" CHECK ("+d.dialect.quote(column.name)+" IS NOT NULL) NOT VALID",
+		alterTable+" VALIDATE CONSTRAINT "+check,
+		alterColumn+" SET NOT NULL",
+		alterTable+" DROP CONSTRAINT "+check,
+	)
+}
+
+func (d postgres) resizeColumnSql(table string, column modelField) []string {
+	return []string{fmt.Sprintf(
+		"ALTER TABLE %v ALTER COLUMN %v TYPE %v",
+		d.dialect.quote(table),
+		d.dialect.quote(column.name),
+		d.dialect.sqlType(column),
+	)}
+}
+
+// alterColumnTypeSql converts the values by a cast, postgres doesn't convert between types like text and integer implicitly.
+func (d postgres) alterColumnTypeSql(table string, column modelField) []string {
+	columnType := d.dialect.sqlType(column)
+	quoted := d.dialect.quote(column.name)
+	return []string{fmt.Sprintf("ALTER TABLE %v ALTER COLUMN %v TYPE %v USING %v::%v",
+		d.dialect.quote(table), quoted, columnType, quoted, columnType)}
+}
+
+func (d postgres) columnType(mg *Migration, table, column string) string {
+	var columnType string
+	query := "SELECT format_type(atttypid, atttypmod) FROM pg_attribute " +
+		"WHERE attrelid = to_regclass(?) AND attname = ? AND NOT attisdropped"
+	mg.db.QueryRow(d.substituteMarkers(query), d.dialect.quote(table), column).Scan(&columnType)
+	return strings.Replace(columnType, "character varying", "varchar", 1)
+}
+
+func (d postgres) lockSql() (string, string) {
+	return "SELECT pg_advisory_lock(hashtext(?))", "SELECT pg_advisory_unlock(hashtext(?))"
+}
+
+// scheduleEventSql schedules a pg_cron job, which replaces the job of the same name.
+// The interval is either seconds below a minute, or minutes or hours dividing an hour or a day evenly, or a day.
+func (d postgres) scheduleEventSql(name string, every time.Duration, statement string) (string, []interface{}) {
+	var schedule string
+	switch {
+	case every <= 0 || every%time.Second != 0:
+	case every < time.Minute:
+		schedule = fmt.Sprintf("%d seconds", every/time.Second)
+	case every%time.Minute == 0 && every < time.Hour && time.Hour%every == 0:
+		schedule = fmt.Sprintf("*/%d * * * *", every/time.Minute)
+	case every%time.Hour == 0 && every < 24*time.Hour && 24*time.Hour%every == 0:
+		schedule = fmt.Sprintf("0 */%d * * *", every/time.Hour)
+	case every == 24*time.Hour:
+		schedule = "0 0 * * *"
+	}
+	if schedule == "" {
+		return "", nil
+	}
+	return "SELECT cron.schedule(?, ?, ?)", []interface{}{name, schedule, statement}
+}
+
+func (d postgres) unscheduleEventSql(name string) (string, []interface{}) {
+	return "SELECT cron.unschedule(?)", []interface{}{name}
+}
+
+// attachDatabaseSqls creates a postgres_fdw server of the other database and imports its tables as foreign tables
+// into the schema of the name.
+func (d postgres) attachDatabaseSqls(name string, opts AttachOptions) []string {
+	var server, mapping []string
+	if opts.Host != "" {
+		server = append(server, "host "+quoteLiteral(opts.Host))
+	}
+	if opts.Port > 0 {
+		server = append(server, "port "+quoteLiteral(strconv.Itoa(opts.Port)))
+	}
+	if opts.DbName != "" {
+		server = append(server, "dbname "+quoteLiteral(opts.DbName))
+	}
+	if opts.User != "" {
+		mapping = append(mapping, "user "+quoteLiteral(opts.User))
+	}
+	if opts.Password != "" {
+		mapping = append(mapping, "password "+quoteLiteral(opts.Password))
+	}
+	remote := opts.Schema
+	if remote == "" {
+		remote = "public"
+	}
+	name = d.dialect.quote(name)
+	sqls := []string{"CREATE EXTENSION IF NOT EXISTS postgres_fdw", "CREATE SERVER " + name + " FOREIGN DATA WRAPPER postgres_fdw"}
+	if len(server) > 0 {
+		sqls[1] += " OPTIONS (" + strings.Join(server, ", ") + ")"
+	}
+	mappingSql := "CREATE USER MAPPING FOR CURRENT_USER SERVER " + name
+	if len(mapping) > 0 {
+		mappingSql += " OPTIONS (" + strings.Join(mapping, ", ") + ")"
+	}
+	return append(sqls, mappingSql, "CREATE SCHEMA "+name,
+		"IMPORT FOREIGN SCHEMA "+d.dialect.quote(remote)+" FROM SERVER "+name+" INTO "+name)
+}
+
+func (d postgres) detachDatabaseSqls(name string) []string {
+	name = d.dialect.quote(name)
+	return []string{"DROP SCHEMA IF EXISTS " + name + " CASCADE", "DROP SERVER IF EXISTS " + name + " CASCADE"}
+}
+
+func (d postgres) createSchemaSql(schema string) string {
+	return "CREATE SCHEMA IF NOT EXISTS " + d.dialect.quote(schema)
+}
+
+// planStep parses a line of the text format, like "Seq Scan on post  (cost=0.00..35.50 rows=2550 width=4)".
+func (d postgres) planStep(row map[string]string) PlanStep {
+	line := strings.TrimSpace(row["QUERY PLAN"])
+	step := PlanStep{Detail: strings.TrimPrefix(line, "->  "), Rows: planRows(line)}
+	if i := strings.Index(line, " on "); i >= 0 && strings.Contains(line[:i], "Scan") {
+		step.Table = strings.SplitN(line[i+len(" on "):], " ", 2)[0]
+		step.FullScan = strings.Contains(line[:i], "Seq Scan")
+	}
+	return step
+}
+
+func (d postgres) inspectSqls() (string, string, string, string) {
+	return "SELECT table_name FROM information_schema.tables " +
+			"WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name",
+		"SELECT c.table_name, c.column_name, c.data_type, c.is_nullable, c.character_maximum_length, c.column_default, " +
+			"EXISTS (SELECT 1 FROM information_schema.table_constraints t JOIN information_schema.key_column_usage k " +
+			"ON k.constraint_name = t.constraint_name AND k.table_schema = t.table_schema " +
+			"WHERE t.constraint_type = 'PRIMARY KEY' AND t.table_schema = c.table_schema " +
+			"AND k.table_name = c.table_name AND k.column_name = c.column_name) " +
+			"FROM information_schema.columns c WHERE c.table_schema = current_schema() ORDER BY c.table_name, c.ordinal_position",
+		"SELECT t.relname, i.relname, a.attname, x.indisunique FROM pg_index x " +
+			"JOIN pg_class t ON t.oid = x.indrelid JOIN pg_class i ON i.oid = x.indexrelid " +
+			"JOIN pg_namespace n ON n.oid = t.relnamespace JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = ANY(x.indkey) " +
+			"WHERE n.nspname = current_schema() AND NOT x.indisprimary " +
+			"ORDER BY t.relname, i.relname, array_position(x.indkey::int2[], a.attnum)",
+		"SELECT k.table_name, k.column_name, u.table_name, u.column_name FROM information_schema.table_constraints t " +
+			"JOIN information_schema.key_column_usage k ON k.constraint_name = t.constraint_name AND k.table_schema = t.table_schema " +
+			"JOIN information_schema.constraint_column_usage u ON u.constraint_name = t.constraint_name AND u.table_schema = t.table_schema " +
+			"WHERE t.constraint_type = 'FOREIGN KEY' AND t.table_schema = current_schema() ORDER BY k.table_name, k.ordinal_position"
+}
+
+func (d postgres) tableSampleSql(percent float64) string {
+	return fmt.Sprintf("TABLESAMPLE BERNOULLI (%v)", percent)
+}
+
 func (d postgres) indexExists(mg *Migration, tableName, indexName string) bool {
 	var row *sql.Row
 	var name string
+	schema, tableName := splitSchema(tableName)
 	query := "SELECT indexname FROM pg_indexes "
-	query += "WHERE tablename = ? AND indexname = ?"
+	query += "WHERE schemaname = COALESCE(NULLIF(?, ''), current_schema()) AND tablename = ? AND indexname = ?"
 	query = d.substituteMarkers(query)
-	row = mg.db.QueryRow(query, tableName, indexName)
+	row = mg.db.QueryRow(query, schema, tableName, indexName)
 	row.Scan(&name)
 	return name != ""
 }
@@ -146,9 +386,13 @@ func (d postgres) indexExists(mg *Migration, tableName, indexName string) bool {
 func (d postgres) substituteMarkers(query string) string {
 	position := 1
 	buf := new(bytes.Buffer)
+	quoted := false
 	for i := 0; i < len(query); i++ {
 		c := query[i]
-		if c == '?' {
+		if c == '\'' {
+			quoted = !quoted //a '?' in a string literal, like a password of AttachDatabase, is not a marker.
+		}
+		if c == '?' && !quoted {
 			buf.WriteByte('$')
 			buf.WriteString(strconv.Itoa(position))
 			position++
@@ -160,11 +404,11 @@ func (d postgres) substituteMarkers(query string) string {
 }
 
 func (d postgres) columnsInTable(mg *Migration, table interface{}) map[string]bool {
-	tn := tableName(table)
+	schema, tn := splitSchema(namedTableName(table, mg.naming()))
 	columns := make(map[string]bool)
-	query := "SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_NAME = ?"
+	query := "SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), current_schema()) AND TABLE_NAME = ?"
 	query = mg.dialect.substituteMarkers(query)
-	rows, err := mg.db.Query(query, tn)
+	rows, err := mg.db.Query(query, schema, tn)
 	defer rows.Close()
 	if err != nil {
 		panic(err)
@@ -179,6 +423,23 @@ func (d postgres) columnsInTable(mg *Migration, table interface{}) map[string]bo
 	return columns
 }
 
+func (d postgres) returningSql(model *model) string {
+	columns := make([]string, len(model.fields))
+	for i, f := range model.fields {
+		columns[i] = d.dialect.quote(f.name)
+	}
+	return " RETURNING " + strings.Join(columns, ", ")
+}
+
+func (d postgres) tempTableSql(model *model) (string, string) {
+	create, _ := d.base.tempTableSql(model)
+	return create + " ON COMMIT DROP", ""
+}
+
+func (d postgres) uuidType() string {
+	return "uuid"
+}
+
 func (d postgres) primaryKeySql(isString bool, size int) string {
 	if isString {
 		return "text PRIMARY KEY"
@@ -136,6 +136,16 @@ func TestPgBulkInsert(t *testing.T) {
 	doTestBulkInsert(NewAssert(t))
 }
 
+func TestPgBulkInsertRouted(t *testing.T) {
+	registerPgTest()
+	doTestBulkInsertRouted(NewAssert(t), "postgres")
+}
+
+func TestPgBulkInsertMaxTransactionRows(t *testing.T) {
+	registerPgTest()
+	doTestBulkInsertMaxTransactionRows(NewAssert(t))
+}
+
 func TestPgQueryStruct(t *testing.T) {
 	registerPgTest()
 	doTestQueryStruct(NewAssert(t))
@@ -192,6 +202,426 @@ func TestPgSaveNullable(t *testing.T) {
 	doTestSaveNullable(NewAssert(t), mg, q)
 }
 
+func TestPgChangeEvents(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestChangeEvents(NewAssert(t), mg, q)
+}
+
+func TestPgTopNSQL(t *testing.T) {
+	doTestTopNSQL(NewAssert(t), NewPostgres(),
+		`SELECT "qbs_top"."id", "qbs_top"."post_id", "qbs_top"."body" FROM (SELECT DISTINCT "post_id" FROM "comment" WHERE body <> $1) AS "qbs_group" CROSS JOIN LATERAL (SELECT "comment"."id", "comment"."post_id", "comment"."body" FROM "comment" WHERE "comment"."post_id" = "qbs_group"."post_id" AND (body <> $2) ORDER BY "comment"."id" DESC LIMIT $3) AS "qbs_top" ORDER BY "qbs_top"."post_id", "qbs_top"."id" DESC`)
+}
+
+func TestPgAutoDiffSQL(t *testing.T) {
+	doTestAutoDiffSQL(NewAssert(t), NewPostgres(), []string{
+		`ALTER TABLE "user" ALTER COLUMN "name" TYPE varchar(128)`,
+		`ALTER TABLE "user" ALTER COLUMN "age" TYPE bigint`,
+		`ALTER TABLE "user" RENAME COLUMN "email" TO "email_v2"`,
+		`ALTER TABLE "user" ADD COLUMN "nick" text`,
+	})
+}
+
+func TestPgSampleSQL(t *testing.T) {
+	doTestSampleSQL(NewAssert(t), NewPostgres(), `SELECT "id", "body" FROM "comment" ORDER BY RANDOM() LIMIT $1`,
+		`SELECT "id", "body" FROM "comment" TABLESAMPLE BERNOULLI (10) WHERE body = $1`)
+}
+
+func TestPgDryRunSQL(t *testing.T) {
+	doTestDryRunSQL(NewAssert(t), NewPostgres(), `ALTER TABLE "user" ADD COLUMN "nick" text;`+"\n"+
+		`INSERT INTO "user" ("id", "name") VALUES (3, 'o''neil');`+"\n")
+}
+
+func TestPgCompositePkSQL(t *testing.T) {
+	doTestCompositePkSQL(NewAssert(t), NewPostgres(),
+		`CREATE TABLE "membership" ( "user_id" bigint NOT NULL, "group_id" bigint NOT NULL, "role" text, PRIMARY KEY ("user_id", "group_id") )`,
+		`UPDATE "membership" SET "role" = $1 WHERE ("user_id" = $2) AND ("group_id" = $3)`)
+}
+
+func TestPgSoftDeleteToSQL(t *testing.T) {
+	doTestSoftDeleteToSQL(NewAssert(t), NewPostgres(), `SELECT "id", "name", "deleted" FROM "soft_deleted_ptr" WHERE "soft_deleted_ptr"."deleted" IS NULL`)
+}
+
+func TestPgToSQL(t *testing.T) {
+	doTestToSQL(NewAssert(t), NewPostgres(), `SELECT "id", "body" FROM "comment" WHERE body = $1 ORDER BY "id" LIMIT $2`)
+}
+
+func TestPgGroupBySQL(t *testing.T) {
+	doTestGroupBySQL(NewAssert(t), NewPostgres(), `SELECT "author_id" FROM "post" WHERE title <> $1 GROUP BY "author_id" HAVING COUNT(*) > $2 ORDER BY "author_id"`)
+}
+
+func TestPgWarmUpSQL(t *testing.T) {
+	doTestWarmUpSQL(NewAssert(t), NewPostgres(),
+		`INSERT INTO "sql_gen_model" ("first", "last", "amount") VALUES ($1, $2, $3) RETURNING "prim"`,
+		`SELECT "prim", "first", "last", "amount" FROM "sql_gen_model" WHERE "sql_gen_model"."prim" = $1 LIMIT $2`,
+		`UPDATE "sql_gen_model" SET "first" = $1, "last" = $2, "amount" = $3 WHERE "prim" = $4`)
+}
+
+func TestPgIndexSQL(t *testing.T) {
+	doTestIndexSQL(NewAssert(t), NewPostgres(),
+		`CREATE UNIQUE INDEX "user_lower_email_tenant" ON "user" ((lower(email)), "tenant")`,
+		`DROP INDEX "user_name"`,
+		`ALTER INDEX "user_name" RENAME TO "user_full_name"`,
+		true)
+}
+
+func TestPgForeignKeySQL(t *testing.T) {
+	doTestForeignKeySQL(NewAssert(t), NewPostgres(),
+		`CREATE TABLE "fk_post" ( "id" bigserial PRIMARY KEY, "fk_author_id" bigint, `+
+			`FOREIGN KEY ("fk_author_id") REFERENCES "fk_author" ("id") ON DELETE SET NULL ON UPDATE CASCADE )`,
+		`ALTER TABLE "fk_post" ADD CONSTRAINT "fk_post_fk_author_id_fkey" FOREIGN KEY ("fk_author_id") `+
+			`REFERENCES "fk_author" ("id") ON DELETE SET NULL ON UPDATE CASCADE`,
+		`ALTER TABLE "fk_post" DROP CONSTRAINT "fk_post_fk_author_id_fkey"`)
+}
+
+func TestPgScheduleEventSQL(t *testing.T) {
+	doTestScheduleEventSQL(NewAssert(t), NewPostgres(),
+		"SELECT cron.schedule(?, ?, ?) [purge_sessions 0 */2 * * * DELETE FROM session WHERE expired < NOW()]",
+		"SELECT cron.unschedule(?) [purge_sessions]")
+}
+
+func TestPgAlterColumnTypeSQL(t *testing.T) {
+	doTestAlterColumnTypeSQL(NewAssert(t), NewPostgres(),
+		`ALTER TABLE "account" ALTER COLUMN "balance" TYPE double precision USING "balance"::double precision`)
+}
+
+func TestPgColTypeSQL(t *testing.T) {
+	doTestColTypeSQL(NewAssert(t), NewPostgres(),
+		`CREATE TABLE "invoice" ( "id" char(36) PRIMARY KEY, "total" decimal(10,2) NOT NULL DEFAULT 0 )`,
+		`ALTER TABLE "invoice" ADD COLUMN "total" decimal(10,2)`)
+}
+
+func TestPgUUIDPkSQL(t *testing.T) {
+	doTestUUIDPkSQL(NewAssert(t), NewPostgres(), `CREATE TABLE "device" ( "id" uuid PRIMARY KEY, "name" varchar(64) )`)
+}
+
+func TestPgTempTableSQL(t *testing.T) {
+	doTestTempTableSQL(NewAssert(t), NewPostgres(),
+		`CREATE TEMPORARY TABLE "staging" ( "id" bigserial PRIMARY KEY, "name" varchar(64) ) ON COMMIT DROP`, "")
+}
+
+func TestPgAttachDatabaseSQL(t *testing.T) {
+	doTestAttachDatabaseSQL(NewAssert(t), NewPostgres(), "CREATE EXTENSION IF NOT EXISTS postgres_fdw; "+
+		`CREATE SERVER "legacy" FOREIGN DATA WRAPPER postgres_fdw OPTIONS (host 'old-db', port '5432', dbname 'shop'); `+
+		`CREATE USER MAPPING FOR CURRENT_USER SERVER "legacy" OPTIONS (user 'app', password 'it''s?'); `+
+		`CREATE SCHEMA "legacy"; IMPORT FOREIGN SCHEMA "public" FROM SERVER "legacy" INTO "legacy"`,
+		`DROP SCHEMA IF EXISTS "legacy" CASCADE; DROP SERVER IF EXISTS "legacy" CASCADE`,
+		`INSERT INTO "customer" ("id", "name") SELECT "id", "name" FROM "legacy"."customer"`)
+}
+
+func TestPgReturningSQL(t *testing.T) {
+	doTestReturningSQL(NewAssert(t), NewPostgres(),
+		`INSERT INTO "account" ("id", "balance") VALUES ($1, $2) RETURNING "id", "balance"`,
+		`UPDATE "account" SET "balance" = $1 WHERE "id" = $2 RETURNING "id", "balance"`)
+}
+
+func TestPgSchemaSQL(t *testing.T) {
+	doTestSchemaSQL(NewAssert(t), NewPostgres(), `CREATE SCHEMA IF NOT EXISTS "tenant_a"`,
+		`SELECT "tenant_a"."essay"."id", "tenant_a"."essay"."title", "tenant_a"."essay"."writer_id", `+
+			`"writer"."id" AS writer___id, "writer"."name" AS writer___name FROM "tenant_a"."essay" `+
+			`LEFT JOIN "tenant_a"."writer" AS "writer" ON "tenant_a"."essay"."writer_id" = "writer"."id"`,
+		`DROP INDEX "tenant_a"."essay_title"`)
+}
+
+func TestPgSetNotNullSQL(t *testing.T) {
+	assert := NewAssert(t)
+	sqls := NewPostgres().setNotNullSql("tenant_a.essay", modelField{name: "title"})
+	assert.Equal(4, len(sqls))
+	assert.Equal(`ALTER TABLE "tenant_a"."essay" ADD CONSTRAINT "essay_title_not_null" CHECK ("title" IS NOT NULL) NOT VALID`, sqls[0])
+	assert.Equal(`ALTER TABLE "tenant_a"."essay" VALIDATE CONSTRAINT "essay_title_not_null"`, sqls[1])
+	assert.Equal(`ALTER TABLE "tenant_a"."essay" DROP CONSTRAINT "essay_title_not_null"`, sqls[3])
+}
+
+func TestPgCreateTableScriptSQL(t *testing.T) {
+	doTestCreateTableScriptSQL(NewAssert(t), NewPostgres(), `CREATE SCHEMA IF NOT EXISTS "shop";`+"\n"+
+		`CREATE TABLE IF NOT EXISTS "shop"."script_product" ( "id" bigserial PRIMARY KEY, `+
+		`"sku" varchar(32), "name" varchar(64), "deleted" timestamp with time zone );`+"\n"+
+		`CREATE UNIQUE INDEX "script_product_sku" ON "shop"."script_product" ("sku");`+"\n"+
+		`CREATE INDEX "script_product_live_name" ON "shop"."script_product" ("name") WHERE deleted IS NULL;`+"\n"+
+		`CREATE INDEX "script_product_lower_name" ON "shop"."script_product" ((lower(name)));`+"\n")
+}
+
+func TestPgPlanStepSQL(t *testing.T) {
+	doTestPlanStepSQL(NewAssert(t), NewPostgres(), "EXPLAIN SELECT `id` FROM `post` WHERE `title` = ?",
+		map[string]string{"QUERY PLAN": "  ->  Seq Scan on post  (cost=0.00..35.50 rows=2550 width=4)"},
+		PlanStep{Detail: "Seq Scan on post  (cost=0.00..35.50 rows=2550 width=4)", Table: "post", FullScan: true, Rows: 2550})
+	doTestPlanStepSQL(NewAssert(t), NewPostgres(), "EXPLAIN SELECT `id` FROM `post` WHERE `title` = ?",
+		map[string]string{"QUERY PLAN": "Index Scan using post_title on post  (cost=0.15..8.17 rows=1 width=4)"},
+		PlanStep{Detail: "Index Scan using post_title on post  (cost=0.15..8.17 rows=1 width=4)", Table: "post", Rows: 1})
+}
+
+func TestPgDataCheckSQL(t *testing.T) {
+	doTestDataCheckSQL(NewAssert(t), NewPostgres(),
+		`SELECT COUNT(*) FROM "checked_item" WHERE "code" IS NULL`,
+		`SELECT COUNT(*) FROM "checked_item" WHERE "price" < $1 OR "price" > $2`,
+		`SELECT COUNT(*) FROM (SELECT "code" FROM "checked_item" WHERE "code" IS NOT NULL GROUP BY "code" HAVING COUNT(*) > 1) duplicated`,
+		`SELECT COUNT(*) FROM "checked_item" LEFT JOIN "checked_item" parent ON "checked_item"."parent_id" = "parent"."id" `+
+			`WHERE "checked_item"."parent_id" IS NOT NULL AND "parent"."id" IS NULL`,
+		`SELECT COUNT(*) FROM "checked_item" WHERE code = $1`)
+}
+
+func TestPgTimeTypeSQL(t *testing.T) {
+	doTestTimeTypeSQL(NewAssert(t), NewPostgres(), "timestamp with time zone", "timestamp(3) with time zone", "timestamp(6) with time zone")
+}
+
+func TestPgBulkInsertSQL(t *testing.T) {
+	doTestBulkInsertSQL(NewAssert(t), NewPostgres(), `INSERT INTO "sql_gen_model" ("prim", "first", "last", "amount") VALUES ($1, $2, $3, $4), ($5, $6, $7, $8) RETURNING "prim"`)
+}
+
+func TestPgAddColumnWithBackfill(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestAddColumnWithBackfill(NewAssert(t), mg, q)
+}
+
+func TestPgSetNotNull(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestSetNotNull(NewAssert(t), mg, q)
+}
+
+func TestPgResizeColumn(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestResizeColumn(NewAssert(t), mg, q)
+}
+
+func TestPgCompareTables(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestCompareTables(NewAssert(t), mg, q)
+}
+
+func TestPgShadow(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestShadow(NewAssert(t), mg, q)
+}
+
+func TestPgCanary(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestCanary(NewAssert(t), mg, q)
+}
+
+func TestPgNewFromTx(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestNewFromTx(NewAssert(t), mg, q)
+}
+
+func TestPgBulkUpdate(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestBulkUpdate(NewAssert(t), mg, q)
+}
+
+func TestPgQueryStructNested(t *testing.T) {
+	registerPgTest()
+	doTestQueryStructNested(NewAssert(t))
+}
+
+func TestPgAggregateBy(t *testing.T) {
+	registerPgTest()
+	doTestAggregateBy(NewAssert(t))
+}
+
+func TestPgSoftDelete(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestSoftDelete(NewAssert(t), mg, q)
+}
+
+func TestPgPaginate(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestPaginate(NewAssert(t), mg, q)
+}
+
+func TestPgByUnique(t *testing.T) {
+	registerPgTest()
+	doTestByUnique(NewAssert(t))
+}
+
+func TestPgPing(t *testing.T) {
+	registerPgTest()
+	doTestPing(NewAssert(t))
+}
+
+func TestPgDryRun(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestDryRun(NewAssert(t), mg, q)
+}
+
+func TestPgCoalesce(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestCoalesce(NewAssert(t), mg, q)
+}
+
+func TestPgMigrateBlobs(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestMigrateBlobs(NewAssert(t), mg, q)
+}
+
+func TestPgCompositePk(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestCompositePk(NewAssert(t), mg, q)
+}
+
+func TestPgOptimisticLock(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestOptimisticLock(NewAssert(t), mg, q)
+}
+
+func TestPgStmtCache(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestStmtCache(NewAssert(t), mg, q)
+}
+
+func TestPgEmbeddedStruct(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestEmbeddedStruct(NewAssert(t), mg, q)
+}
+
+func TestPgTransformColumn(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestTransformColumn(NewAssert(t), mg, q)
+}
+
+func TestPgJSONField(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestJSONField(NewAssert(t), mg, q)
+}
+
+func TestPgSampleTransform(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestSampleTransform(NewAssert(t), mg, q)
+}
+
+func TestPgHooks(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestHooks(NewAssert(t), mg, q)
+}
+
+func TestPgIterateNull(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestIterateNull(NewAssert(t), mg, q)
+}
+
+func TestPgIntrospection(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestIntrospection(NewAssert(t), mg, q)
+}
+
+func TestPgAggregates(t *testing.T) {
+	registerPgTest()
+	doTestAggregates(NewAssert(t))
+}
+
+func TestPgMigrationLock(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestMigrationLock(NewAssert(t), mg, q)
+}
+
+func TestPgPrepareModels(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestPrepareModels(NewAssert(t), mg, q)
+}
+
+func TestPgInspect(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestInspect(NewAssert(t), mg, q)
+}
+
+func TestPgNestedTransaction(t *testing.T) {
+	registerPgTest()
+	doTestNestedTransaction(NewAssert(t))
+}
+
+func TestPgManageIndexes(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestManageIndexes(NewAssert(t), mg, q)
+}
+
+func TestPgAlterForeignKey(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestAlterForeignKey(NewAssert(t), mg, q)
+}
+
+func TestPgModelCache(t *testing.T) {
+	registerPgTest()
+	doTestModelCache(NewAssert(t))
+}
+
+func TestPgSnapshot(t *testing.T) {
+	registerPgTest()
+	doTestSnapshot(NewAssert(t))
+}
+
+func TestPgSpillIterate(t *testing.T) {
+	registerPgTest()
+	doTestSpillIterate(NewAssert(t))
+}
+
+func TestPgDumpSchema(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestDumpSchema(NewAssert(t), mg, q)
+}
+
+func TestPgRenameColumn(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestRenameColumn(NewAssert(t), mg, q)
+}
+
+func TestPgAlterColumnType(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestAlterColumnType(NewAssert(t), mg, q)
+}
+
+func TestPgUUIDPk(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestUUIDPk(NewAssert(t), mg, q)
+}
+
+func TestPgQueryCache(t *testing.T) {
+	registerPgTest()
+	doTestQueryCache(NewAssert(t))
+}
+
+func TestPgTempTable(t *testing.T) {
+	registerPgTest()
+	doTestTempTable(NewAssert(t))
+}
+
+func TestPgReturning(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestReturning(NewAssert(t), mg, q)
+}
+
+func TestPgSchema(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestSchema(NewAssert(t), mg, q)
+}
+
+func TestPgSeeds(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestSeeds(NewAssert(t), mg, q)
+}
+
+func TestPgRetention(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestRetention(NewAssert(t), mg, q)
+}
+
+func TestPgArchive(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestArchive(NewAssert(t), mg, q)
+}
+
+func TestPgExplain(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestExplain(NewAssert(t), mg, q)
+}
+
+func TestPgDataCheck(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestDataCheck(NewAssert(t), mg, q)
+}
+
+func TestPgAudit(t *testing.T) {
+	mg, q := setupPgDb()
+	doTestAudit(NewAssert(t), mg, q)
+}
+
 func TestPgDataSourceName(t *testing.T) {
 	dsn := new(DataSourceName)
 	dsn.DbName = "abc"
@@ -1,14 +1,15 @@
 package qbs
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"reflect"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -18,26 +19,72 @@ var connectionLimit chan struct{}
 var blockingOnLimit bool
 var ConnectionLimitError = errors.New("Connection limit reached")
 var db *sql.DB
-var stmtMap map[string]*sql.Stmt
-var mu *sync.RWMutex
+var maxOpenConns, maxIdleConns = 0, 100
+var connMaxLifetime time.Duration
+var connectionLimitsSet bool
+var defaultDatabase *database
 var queryLogger *log.Logger = log.New(os.Stderr, "qbs:", log.LstdFlags)
 var errorLogger *log.Logger = log.New(os.Stderr, "qbs:", log.LstdFlags)
 
 type Qbs struct {
-	Dialect      Dialect
-	Log          bool //Set to true to print out sql statement.
-	tx           *sql.Tx
-	txStmtMap    map[string]*sql.Stmt
-	criteria     *criteria
-	firstTxError error
+	Dialect   Dialect
+	Log       bool             //Set to true to print out sql statement.
+	Naming    NamingConvention //The package level naming functions are used if nil.
+	LogLevel  LogLevel         //The statements to log, LogAll if Log is true and LogLevel is 0.
+	LogOutput io.Writer        //The query logger is used if nil.
+	LogJSON   bool             //Write a JSON object per statement instead of plain text.
+	Logger    Logger           //Receives the logged statements instead of LogOutput.
+	//If greater than 0, BulkInsert commits every MaxTransactionRows rows instead of
+	//inserting all rows in a single transaction. It has no effect if a transaction has already began.
+	MaxTransactionRows int
+	Retry              *RetryPolicy //Retries the SELECT queries failed by transient errors if set.
+	WarnFullScanRows   int64        //If greater than 0, a logging Qbs logs the full scans of FindAll estimated to read as many rows.
+	Auditor            Auditor      //Receives the changes of Save and Delete in their transaction if set.
+	database           *database
+	tx                 *sql.Tx
+	txStmtMap          map[string]*sql.Stmt
+	savepoints         int //the depth of the nested Transaction calls.
+	criteria           *criteria
+	firstTxError       error
+	shadow             *shadowWriter
+	canary             *canaryReader
+	coalesce           *queryCache
+	borrowed           bool      //created by NewFromDB or NewFromTx, the connection belongs to other code.
+	routedFrom         *database //the database of the Qbs while a model routed by UseDatabase or to a shard is used.
+	pinned             bool      //the database is not routed, e.g. for the shard queries of FindAllShards.
+	tempTables         []string  //the statements dropping the temporary tables of the transaction.
+	lastResult         Result
+	schema             string //the schema set by WithSchema.
 }
 
 type Validator interface {
 	Validate(*Qbs) error
 }
 
+// database is a connection pool together with the prepared statements cached for it.
+type database struct {
+	db        *sql.DB
+	dialect   Dialect
+	stmts     *stmtCache
+	cacheName string //names the database in the keys of the row and query caches.
+}
+
+func newDatabase(sqlDb *sql.DB, dialect Dialect) *database {
+	return &database{
+		db:        sqlDb,
+		dialect:   dialect,
+		stmts:     newStmtCache(stmtCacheSize),
+		cacheName: fmt.Sprintf("%p", sqlDb),
+	}
+}
+
+func (d *database) closeStmts() {
+	d.stmts.clear()
+}
+
 //Register a database, should be call at the beginning of the application.
-func Register(driverName, driverSourceName, databaseName string, dialect Dialect) {
+// The returned Config is the default used by GetQbs and GetMigration, use NewConfig to not change the default.
+func Register(driverName, driverSourceName, databaseName string, dialect Dialect) *Config {
 	driverSource = driverSourceName
 	dbName = databaseName
 	if db == nil {
@@ -48,16 +95,23 @@ func Register(driverName, driverSourceName, databaseName string, dialect Dialect
 			panic(err)
 		}
 		RegisterWithDb(driverName, database, dialect)
+		defaultDatabase.cacheName = dsnCacheName(driverName, driverSourceName)
 	}
+	return defaultConfig
 }
 
-func RegisterWithDb(driverName string, database *sql.DB, dialect Dialect) {
+func RegisterWithDb(driverName string, database *sql.DB, dialect Dialect) *Config {
 	driver = driverName
 	dial = dialect
 	db = database
-	db.SetMaxIdleConns(100)
-	stmtMap = make(map[string]*sql.Stmt)
-	mu = new(sync.RWMutex)
+	if connectionLimitsSet {
+		applyConnectionLimits()
+	} else {
+		db.SetMaxIdleConns(maxIdleConns)
+	}
+	defaultDatabase = databaseOf(db, dialect)
+	defaultConfig = &Config{Driver: driver, DriverSource: driverSource, DbName: dbName, Dialect: dial, database: defaultDatabase}
+	return defaultConfig
 }
 
 //A safe and easy way to work with *Qbs instance without the need to open and close it.
@@ -84,28 +138,91 @@ func GetQbs() (q *Qbs, err error) {
 	if driver == "" || dial == nil {
 		panic("database driver has not been registered, should call Register first.")
 	}
-	if connectionLimit != nil {
-		if blockingOnLimit {
-			connectionLimit <- struct{}{}
-		} else {
-			select {
-			case connectionLimit <- struct{}{}:
-			default:
-				return nil, ConnectionLimitError
-			}
-		}
+	if err = acquireConnection(); err != nil {
+		return nil, err
 	}
 	q = new(Qbs)
 	q.Dialect = dial
+	q.database = defaultDatabase
 	q.criteria = new(criteria)
 	return q, nil
 }
 
+// acquireConnection takes a place of the connection limit, it's released by Close.
+func acquireConnection() error {
+	if connectionLimit == nil {
+		return nil
+	}
+	if blockingOnLimit {
+		connectionLimit <- struct{}{}
+		return nil
+	}
+	select {
+	case connectionLimit <- struct{}{}:
+		return nil
+	default:
+		return ConnectionLimitError
+	}
+}
+
+//Get a Qbs instance working on a connection pool owned by other code, it does not need Register
+//and is not counted by the connection limit.
+func NewFromDB(sqlDb *sql.DB, dialect Dialect) *Qbs {
+	q := new(Qbs)
+	q.Dialect = dialect
+	q.database = databaseOf(sqlDb, dialect)
+	q.criteria = new(criteria)
+	q.borrowed = true
+	return q
+}
+
+//Get a Qbs instance working in a transaction owned by other code.
+//The owner of the transaction commits or rolls it back, Close does not roll it back.
+func NewFromTx(tx *sql.Tx, dialect Dialect) *Qbs {
+	q := new(Qbs)
+	q.Dialect = dialect
+	q.tx = tx
+	q.txStmtMap = make(map[string]*sql.Stmt)
+	q.criteria = new(criteria)
+	q.borrowed = true
+	return q
+}
+
 //The default connection pool size is 100.
 func ChangePoolSize(size int) {
+	maxIdleConns = size
 	db.SetMaxIdleConns(size)
 }
 
+//Set the limits of the connection pool of the registered database, can be called before Register.
+//Without it RegisterWithDb keeps the limits of the *sql.DB, except for the maxIdle of 100.
+//maxOpen and maxLifetime of 0 mean unlimited, the default maxIdle is 100.
+func SetConnectionLimits(maxOpen, maxIdle int, maxLifetime time.Duration) {
+	maxOpenConns, maxIdleConns, connMaxLifetime = maxOpen, maxIdle, maxLifetime
+	connectionLimitsSet = true
+	if db != nil {
+		applyConnectionLimits()
+	}
+}
+
+func applyConnectionLimits() {
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxIdleConns)
+	db.SetConnMaxLifetime(connMaxLifetime)
+}
+
+//Check that the registered database is reachable, for health checks.
+func Ping() error {
+	return PingContext(context.Background())
+}
+
+func PingContext(ctx context.Context) error {
+	if db == nil {
+		return errors.New("database driver has not been registered, should call Register first")
+	}
+	return db.PingContext(ctx)
+}
+
 func SetLogger(query *log.Logger, err *log.Logger) {
 	queryLogger = query
 	errorLogger = err
@@ -132,10 +249,25 @@ func (q *Qbs) Reset() {
 // no matter it is in transaction or not.
 // It panics if it's already in a transaction.
 func (q *Qbs) Begin() error {
+	return q.begin(nil, "BEGIN")
+}
+
+// Snapshot starts a read only transaction at the repeatable read isolation level, serializable on oracle,
+// so the queries until Commit or Rollback read the same snapshot of the database, e.g. the pages of an export
+// by Paginate, even while other connections write.
+// It panics if it's already in a transaction.
+func (q *Qbs) Snapshot() error {
+	return q.begin(&sql.TxOptions{Isolation: q.Dialect.snapshotIsolation(), ReadOnly: true}, "BEGIN SNAPSHOT")
+}
+
+func (q *Qbs) begin(opts *sql.TxOptions, query string) error {
 	if q.tx != nil {
 		panic("cannot start nested transaction")
 	}
-	tx, err := db.Begin()
+	start := time.Now()
+	tx, err := q.database.db.BeginTx(context.Background(), opts)
+	q.log(query, nil, start, err)
+	q.coalesce.reset()
 	q.tx = tx
 	q.txStmtMap = make(map[string]*sql.Stmt)
 	return err
@@ -161,7 +293,11 @@ func (q *Qbs) updateTxError(e error) error {
 // Commit commits a started transaction and will report the first error that
 // occurred inside the transaction.
 func (q *Qbs) Commit() error {
+	q.dropTempTables()
+	start := time.Now()
 	err := q.tx.Commit()
+	q.log("COMMIT", nil, start, err)
+	q.coalesce.reset()
 	q.updateTxError(err)
 	q.tx = nil
 	for _, v := range q.txStmtMap {
@@ -173,7 +309,11 @@ func (q *Qbs) Commit() error {
 
 // Rollback rolls back a started transaction.
 func (q *Qbs) Rollback() error {
+	q.dropTempTables()
+	start := time.Now()
 	err := q.tx.Rollback()
+	q.log("ROLLBACK", nil, start, err)
+	q.coalesce.reset()
 	q.tx = nil
 	for _, v := range q.txStmtMap {
 		v.Close()
@@ -182,6 +322,68 @@ func (q *Qbs) Rollback() error {
 	return q.updateTxError(err)
 }
 
+// Transaction runs the task in a transaction, which is committed if the task returns nil,
+// or rolled back if it returns an error or panics.
+// Called in a transaction, the task runs in a savepoint instead, so only its changes are rolled back.
+func (q *Qbs) Transaction(task func(tx *Qbs) error) (err error) {
+	if q.tx != nil {
+		return q.savepoint(task)
+	}
+	if err = q.Begin(); err != nil {
+		q.tx = nil
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			q.Rollback()
+			panic(p)
+		}
+	}()
+	if err = task(q); err != nil {
+		q.Rollback()
+		return err
+	}
+	return q.Commit()
+}
+
+func (q *Qbs) savepoint(task func(tx *Qbs) error) (err error) {
+	q.savepoints++
+	defer func() { q.savepoints-- }()
+	save, rollback, release := q.Dialect.savepointSql(fmt.Sprintf("qbs_savepoint_%d", q.savepoints))
+	if err = q.execTx(save); err != nil {
+		return err
+	}
+	firstTxError := q.firstTxError
+	defer func() {
+		if p := recover(); p != nil {
+			q.execTx(rollback)
+			q.firstTxError = firstTxError
+			panic(p)
+		}
+	}()
+	if err = task(q); err != nil {
+		if rollbackErr := q.execTx(rollback); rollbackErr != nil {
+			return rollbackErr
+		}
+		q.firstTxError = firstTxError //the errors of the task are rolled back with it.
+		return err
+	}
+	if release != "" {
+		err = q.execTx(release)
+	}
+	return err
+}
+
+// execTx executes a transaction control or DDL statement without preparing it,
+// the coalesced rows are dropped as a rolled back savepoint may have changed them.
+func (q *Qbs) execTx(query string) error {
+	q.coalesce.reset()
+	start := time.Now()
+	_, err := q.tx.Exec(query)
+	q.log(query, nil, start, err)
+	return q.updateTxError(err)
+}
+
 // Where is a shortcut method to call Condtion(NewCondtition(expr, args...)).
 func (q *Qbs) Where(expr string, args ...interface{}) *Qbs {
 	q.criteria.condition = NewCondition(expr, args...)
@@ -199,6 +401,17 @@ func (q *Qbs) WhereIn(column string, values []interface{}) *Qbs {
 	return q
 }
 
+// WhereTuple compares a tuple of snakecase columns with a tuple of values, e.g. for keyset pagination
+// on a composite key. It uses row value syntax if the dialect supports it, otherwise the comparison is expanded.
+func (q *Qbs) WhereTuple(columns []string, op string, values ...interface{}) *Qbs {
+	if q.Dialect.supportsRowValues() {
+		q.criteria.condition = NewTupleCondition(columns, op, values...)
+	} else {
+		q.criteria.condition = NewExpandedTupleCondition(columns, op, values...)
+	}
+	return q
+}
+
 //Condition defines the SQL "WHERE" clause
 //If other condition can be inferred by the struct argument in
 //Find method, it will be merged with AND
@@ -227,17 +440,64 @@ func (q *Qbs) OrderByDesc(path string) *Qbs {
 	return q
 }
 
+// GroupBy groups the rows of FindAll by the snakecase columns, the struct should only have the grouped columns.
+func (q *Qbs) GroupBy(paths ...string) *Qbs {
+	for _, path := range paths {
+		q.criteria.groupBys = append(q.criteria.groupBys, q.Dialect.quote(path))
+	}
+	return q
+}
+
+// Having filters the groups of GroupBy, CountBy, SumBy, AvgBy, MinBy and MaxBy, e.g. Having("COUNT(*) > ?", 3).
+func (q *Qbs) Having(expr string, args ...interface{}) *Qbs {
+	q.criteria.having = NewCondition(expr, args...)
+	return q
+}
+
 // Camel case field names
 func (q *Qbs) OmitFields(fieldName ...string) *Qbs {
 	q.criteria.omitFields = fieldName
 	return q
 }
 
+// IncludeZero makes Save and Update write the zero values of the `qbs:"omitempty"` fields of the camel case
+// field names, which are left out as unset otherwise.
+func (q *Qbs) IncludeZero(fieldName ...string) *Qbs {
+	q.criteria.includeZero = fieldName
+	return q
+}
+
 func (q *Qbs) OmitJoin() *Qbs {
 	q.criteria.omitJoin = true
 	return q
 }
 
+//Model sets the struct pointer or pointer of slice of struct pointer ToSQL compiles the query for.
+func (q *Qbs) Model(structPtr interface{}) *Qbs {
+	q.criteria.structPtr = structPtr
+	return q
+}
+
+//ToSQL compiles the query FindAll would execute for the struct of Model into SQL and args,
+//without executing it, the markers are substituted for the dialect.
+func (q *Qbs) ToSQL() (string, []interface{}, error) {
+	defer q.Reset()
+	if q.criteria.structPtr == nil {
+		return "", nil, errors.New("no model to compile the query for, should call Model first")
+	}
+	t := reflect.TypeOf(q.criteria.structPtr)
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return "", nil, errors.New("model must be a struct pointer or pointer of slice of struct pointer")
+	}
+	q.criteria.model = structPtrToNamedModel(reflect.New(t).Interface(), !q.criteria.omitJoin, q.criteria.omitFields, q.naming())
+	q.scopeDeleted(true)
+	query, args := q.Dialect.querySql(q.criteria)
+	return query, args, nil
+}
+
 // Perform select query by parsing the struct's type and then fill the values into the struct
 // All fields of supported types in the struct will be added in select clause.
 // If Id value is provided, it will be added into the where clause
@@ -246,19 +506,41 @@ func (q *Qbs) OmitJoin() *Qbs {
 // the values obtained by the query.
 // If not found, "sql.ErrNoRows" will be returned.
 func (q *Qbs) Find(structPtr interface{}) error {
-	q.criteria.model = structPtrToModel(structPtr, !q.criteria.omitJoin, q.criteria.omitFields)
+	q.route(structPtr)
+	q.criteria.model = structPtrToNamedModel(structPtr, !q.criteria.omitJoin, q.criteria.omitFields, q.naming())
 	q.criteria.limit = 1
-	if !q.criteria.model.pkZero() {
-		idPath := q.Dialect.quote(q.criteria.model.table) + "." + q.Dialect.quote(q.criteria.model.pk.name)
-		idCondition := NewCondition(idPath+" = ?", q.criteria.model.pk.value)
+	key, cacheOpts, hit := q.findCached(structPtr)
+	if hit {
+		q.Reset()
+		if finder, ok := structPtr.(AfterFinder); ok {
+			return q.callHook(finder.AfterFind)
+		}
+		return nil
+	}
+	if idCondition := q.criteria.model.pkCondition(q.Dialect, true); idCondition != nil {
 		if q.criteria.condition == nil {
 			q.criteria.condition = idCondition
 		} else {
 			q.criteria.condition = idCondition.AndCondition(q.criteria.condition)
 		}
 	}
+	q.scopeDeleted(true)
 	query, args := q.Dialect.querySql(q.criteria)
-	return q.doQueryRow(structPtr, query, args...)
+	var err error
+	if q.canary != nil && q.canary.sample() {
+		crit := q.criteria
+		err = q.doQueryRow(structPtr, query, args...)
+		q.canary.compare(crit, structPtr, 0, err)
+	} else {
+		err = q.doQueryRow(structPtr, query, args...)
+	}
+	if err == nil {
+		storeCached(key, cacheOpts, structPtr)
+	}
+	if finder, ok := structPtr.(AfterFinder); ok && err == nil {
+		err = q.callHook(finder.AfterFind)
+	}
+	return err
 }
 
 // Similar to Find, except that FindAll accept pointer of slice of struct pointer,
@@ -266,20 +548,105 @@ func (q *Qbs) Find(structPtr interface{}) error {
 func (q *Qbs) FindAll(ptrOfSliceOfStructPtr interface{}) error {
 	strucType := reflect.TypeOf(ptrOfSliceOfStructPtr).Elem().Elem().Elem()
 	strucPtr := reflect.New(strucType).Interface()
-	q.criteria.model = structPtrToModel(strucPtr, !q.criteria.omitJoin, q.criteria.omitFields)
+	q.route(strucPtr)
+	q.criteria.model = structPtrToNamedModel(strucPtr, !q.criteria.omitJoin, q.criteria.omitFields, q.naming())
+	q.scopeDeleted(true)
 	query, args := q.Dialect.querySql(q.criteria)
+	q.warnFullScans(query, args)
+	sliceValue := reflect.Indirect(reflect.ValueOf(ptrOfSliceOfStructPtr))
+	start := sliceValue.Len()
+	var err error
+	if q.canary != nil && q.canary.sample() {
+		crit := q.criteria
+		err = q.doQueryRows(ptrOfSliceOfStructPtr, query, args...)
+		q.canary.compare(crit, ptrOfSliceOfStructPtr, start, err)
+	} else {
+		err = q.doQueryRows(ptrOfSliceOfStructPtr, query, args...)
+	}
+	if _, ok := strucPtr.(AfterFinder); ok && err == nil {
+		err = q.afterFind(sliceValue, start)
+	}
+	return err
+}
+
+// PageInfo describes the page fetched by Paginate.
+type PageInfo struct {
+	Page       int
+	PerPage    int
+	Total      int64 // total rows meet the condition
+	TotalPages int
+	HasNext    bool
+}
+
+// Paginate fetches the page of perPage rows into the slice like FindAll, pages start from 1.
+// It counts the rows meet the condition first, the page is not queried if it is beyond the last page.
+// The rows are counted from the query FindAll would execute without its order, limit and offset, so the condition
+// can refer to the joined tables.
+func (q *Qbs) Paginate(page, perPage int, ptrOfSliceOfStructPtr interface{}) (*PageInfo, error) {
+	if page < 1 || perPage < 1 {
+		panic("page and perPage should be positive")
+	}
+	strucType := reflect.TypeOf(ptrOfSliceOfStructPtr).Elem().Elem().Elem()
+	strucPtr := reflect.New(strucType).Interface()
+	q.route(strucPtr)
+	pageCriteria := *q.criteria
+	q.criteria.model = structPtrToNamedModel(strucPtr, !q.criteria.omitJoin, q.criteria.omitFields, q.naming())
+	q.scopeDeleted(true)
+	q.criteria.orderBys, q.criteria.limit, q.criteria.offset = nil, 0, 0
+	rowsSql, args := q.Dialect.querySql(q.criteria)
+	info := &PageInfo{Page: page, PerPage: perPage}
+	rows, err := q.query("SELECT COUNT(*) FROM ("+rowsSql+") qbs_page", args...)
+	if err == nil {
+		if rows.Next() {
+			err = rows.Scan(&info.Total)
+		} else {
+			err = rows.Err()
+		}
+		rows.Close()
+	}
+	if err != nil {
+		q.Reset()
+		return nil, q.updateTxError(err)
+	}
+	info.TotalPages = int((info.Total + int64(perPage) - 1) / int64(perPage))
+	info.HasNext = page < info.TotalPages
+	if page > info.TotalPages {
+		q.Reset()
+		return info, nil
+	}
+	q.criteria = &pageCriteria
+	q.criteria.limit = perPage
+	q.criteria.offset = (page - 1) * perPage
+	return info, q.FindAll(ptrOfSliceOfStructPtr)
+}
+
+// FindAllTopN fetches at most n rows for every distinct value of the snakecase groupColumn in a single query,
+// e.g. the latest 3 comments of every post. Rows of a group are ranked by the OrderBy/OrderByDesc columns,
+// by the primary key descending if no order is given. Join fields are not filled in.
+func (q *Qbs) FindAllTopN(ptrOfSliceOfStructPtr interface{}, groupColumn string, n int) error {
+	strucType := reflect.TypeOf(ptrOfSliceOfStructPtr).Elem().Elem().Elem()
+	strucPtr := reflect.New(strucType).Interface()
+	q.route(strucPtr)
+	q.criteria.model = structPtrToNamedModel(strucPtr, false, q.criteria.omitFields, q.naming())
+	q.scopeDeleted(false)
+	query, args := q.Dialect.topNSql(q.criteria, groupColumn, n)
 	return q.doQueryRows(ptrOfSliceOfStructPtr, query, args...)
 }
 
 func (q *Qbs) doQueryRow(out interface{}, query string, args ...interface{}) error {
 	defer q.Reset()
 	rowValue := reflect.ValueOf(out)
-	q.log(query, args...)
-	stmt, err := q.prepare(query)
-	if err != nil {
-		return q.updateTxError(err)
+	key := q.coalesceKey(out, query, args)
+	if key != "" {
+		if hit, err := q.coalesce.fillRow(key, rowValue); hit {
+			return err
+		}
 	}
-	rows, err := stmt.Query(args...)
+	resultKey := q.resultKey(out, query, args)
+	if findCachedRow(resultKey, rowValue) {
+		return nil
+	}
+	rows, err := q.query(query, args...)
 	if err != nil {
 		return q.updateTxError(err)
 	}
@@ -290,8 +657,11 @@ func (q *Qbs) doQueryRow(out interface{}, query string, args ...interface{}) err
 			return err
 		}
 	} else {
+		q.coalesce.store(key, nil)
 		return sql.ErrNoRows
 	}
+	q.coalesce.store(key, []reflect.Value{rowValue})
+	storeCachedRow(resultKey, rowValue)
 	return nil
 }
 
@@ -299,16 +669,21 @@ func (q *Qbs) doQueryRows(out interface{}, query string, args ...interface{}) er
 	defer q.Reset()
 	sliceValue := reflect.Indirect(reflect.ValueOf(out))
 	structType := sliceValue.Type().Elem().Elem()
-	q.log(query, args...)
-	stmt, err := q.prepare(query)
-	if err != nil {
-		return q.updateTxError(err)
+	key := q.coalesceKey(out, query, args)
+	if key != "" && q.coalesce.fillRows(key, sliceValue) {
+		return nil
 	}
-	rows, err := stmt.Query(args...)
+	resultKey := q.resultKey(out, query, args)
+	if findCachedRows(resultKey, sliceValue) {
+		return nil
+	}
+	start := sliceValue.Len()
+	rows, err := q.query(query, args...)
 	if err != nil {
 		return q.updateTxError(err)
 	}
 	defer rows.Close()
+	var scanned []reflect.Value
 	for rows.Next() {
 		rowValue := reflect.New(structType)
 		err = q.scanRows(rowValue, rows)
@@ -316,7 +691,24 @@ func (q *Qbs) doQueryRows(out interface{}, query string, args ...interface{}) er
 			return err
 		}
 		sliceValue.Set(reflect.Append(sliceValue, rowValue))
+		if key != "" {
+			scanned = append(scanned, rowValue)
+		}
+	}
+	q.coalesce.store(key, scanned)
+	storeCachedRows(resultKey, sliceValue, start)
+	return nil
+}
+
+// setFieldValue sets a scanned value to the field, the JSON text of a `qbs:"json"` field is unmarshaled.
+func (q *Qbs) setFieldValue(value, field reflect.Value, structField reflect.StructField) error {
+	if isJSONField(structField) {
+		return setJSONValue(value, field)
 	}
+	if err := q.Dialect.setModelValue(value, field); err != nil {
+		return err
+	}
+	scanLocation(field, structField)
 	return nil
 }
 
@@ -339,21 +731,19 @@ func (q *Qbs) scanRows(rowValue reflect.Value, rows *sql.Rows) (err error) {
 		key := cols[i]
 		paths := strings.Split(key, "___")
 		if len(paths) == 2 {
-			subStruct := rowValue.Elem().FieldByName(TableNameToStructName(paths[0]))
+			subStruct := rowValue.Elem().FieldByName(q.naming().StructName(paths[0]))
 			if subStruct.IsNil() {
 				subStruct.Set(reflect.New(subStruct.Type().Elem()))
 			}
-			subField := subStruct.Elem().FieldByName(ColumnNameToFieldName(paths[1]))
-			if subField.IsValid() {
-				err = q.Dialect.setModelValue(value, subField)
+			if subField, ok := structFieldByColumn(subStruct.Type().Elem(), paths[1], q.naming()); ok {
+				err = q.setFieldValue(value, subStruct.Elem().FieldByIndex(subField.Index), subField)
 				if err != nil {
 					return
 				}
 			}
 		} else {
-			field := rowValue.Elem().FieldByName(ColumnNameToFieldName(key))
-			if field.IsValid() {
-				err = q.Dialect.setModelValue(value, field)
+			if field, ok := structFieldByColumn(rowValue.Type().Elem(), key, q.naming()); ok {
+				err = q.setFieldValue(value, rowValue.Elem().FieldByIndex(field.Index), field)
 				if err != nil {
 					return
 				}
@@ -367,12 +757,15 @@ func (q *Qbs) scanRows(rowValue reflect.Value, rows *sql.Rows) (err error) {
 func (q *Qbs) Exec(query string, args ...interface{}) (sql.Result, error) {
 	defer q.Reset()
 	query = q.Dialect.substituteMarkers(query)
-	q.log(query, args...)
-	stmt, err := q.prepare(query)
+	start := time.Now()
+	stmt, cached, err := q.prepare(query)
 	if err != nil {
+		q.log(query, args, start, err)
 		return nil, q.updateTxError(err)
 	}
+	defer cached.release()
 	result, err := stmt.Exec(args...)
+	q.log(query, args, start, err)
 	if err != nil {
 		return nil, q.updateTxError(err)
 	}
@@ -381,30 +774,62 @@ func (q *Qbs) Exec(query string, args ...interface{}) (sql.Result, error) {
 
 // Same as sql.Db.QueryRow or sql.Tx.QueryRow depends on if transaction has began
 func (q *Qbs) QueryRow(query string, args ...interface{}) *sql.Row {
-	q.log(query, args...)
 	query = q.Dialect.substituteMarkers(query)
-	stmt, err := q.prepare(query)
+	start := time.Now()
+	stmt, cached, err := q.prepare(query)
+	q.log(query, args, start, err)
 	if err != nil {
 		q.updateTxError(err)
 		return nil
 	}
+	defer cached.release()
 	return stmt.QueryRow(args...)
 }
 
 // Same as sql.Db.Query or sql.Tx.Query depends on if transaction has began
 func (q *Qbs) Query(query string, args ...interface{}) (rows *sql.Rows, err error) {
-	q.log(query, args...)
 	query = q.Dialect.substituteMarkers(query)
-	stmt, err := q.prepare(query)
+	start := time.Now()
+	stmt, cached, err := q.prepare(query)
 	if err != nil {
+		q.log(query, args, start, err)
 		q.updateTxError(err)
 		return
 	}
-	return stmt.Query(args...)
+	defer cached.release()
+	rows, err = stmt.Query(args...)
+	q.log(query, args, start, err)
+	return
+}
+
+// query prepares and runs the query with markers already substituted, and logs it.
+// A SELECT query is retried by the Retry policy outside of a transaction.
+func (q *Qbs) query(query string, args ...interface{}) (*sql.Rows, error) {
+	if q.Retry != nil && q.tx == nil && firstKeyword(query) == "SELECT" {
+		return q.Retry.query(func() (*sql.Rows, error) {
+			return q.queryOnce(query, args...)
+		})
+	}
+	return q.queryOnce(query, args...)
+}
+
+func (q *Qbs) queryOnce(query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	stmt, cached, err := q.prepare(query)
+	if err != nil {
+		q.log(query, args, start, err)
+		return nil, err
+	}
+	defer cached.release()
+	rows, err := stmt.Query(args...)
+	q.log(query, args, start, err)
+	return rows, err
 }
 
 // Same as sql.Db.Prepare or sql.Tx.Prepare depends on if transaction has began
-func (q *Qbs) prepare(query string) (stmt *sql.Stmt, err error) {
+// Outside of a transaction the statement is cached for the connection pool, cached must be released after use.
+func (q *Qbs) prepare(query string) (stmt *sql.Stmt, cached *cachedStmt, err error) {
+	q.coalesce.invalidate(query)
 	var ok bool
 	if q.tx != nil {
 		stmt, ok = q.txStmtMap[query]
@@ -418,21 +843,18 @@ func (q *Qbs) prepare(query string) (stmt *sql.Stmt, err error) {
 		}
 		q.txStmtMap[query] = stmt
 	} else {
-		mu.RLock()
-		stmt, ok = stmtMap[query]
-		mu.RUnlock()
-		if ok {
-			return
+		d := q.database
+		if cached = d.stmts.get(query); cached != nil {
+			return cached.stmt, cached, nil
 		}
 
-		stmt, err = db.Prepare(query + ";")
+		stmt, err = d.db.Prepare(query + ";")
 		if err != nil {
 			q.updateTxError(err)
 			return
 		}
-		mu.Lock()
-		stmtMap[query] = stmt
-		mu.Unlock()
+		cached = d.stmts.add(query, stmt)
+		stmt = cached.stmt
 	}
 	return
 }
@@ -442,18 +864,41 @@ func (q *Qbs) prepare(query string) (stmt *sql.Stmt, err error) {
 // If Id value is provided, save will do a query count first to see if the row exists, if not then insert it,
 // otherwise update it.
 // If struct implements Validator interface, it will be validated first
+// The notnull, min, max, match and in tags are checked before any SQL is executed, ValidationErrors is returned
+// if they are broken.
+// If the struct has a `qbs:"version"` int64 field, the update is done as in Update.
+// An empty string primary key tagged `qbs:"pk,uuid"` is set to a new UUID and the row is inserted.
 func (q *Qbs) Save(structPtr interface{}) (affected int64, err error) {
+	if q.Auditor != nil && q.tx == nil { //the change and its audit are committed together.
+		err = q.Transaction(func(tx *Qbs) error {
+			affected, err = tx.Save(structPtr)
+			return err
+		})
+		return
+	}
 	if v, ok := structPtr.(Validator); ok {
 		err = v.Validate(q)
 		if err != nil {
 			return
 		}
 	}
-	model := structPtrToModel(structPtr, true, q.criteria.omitFields)
-	if model.pk == nil {
+	if v, ok := structPtr.(BeforeSaver); ok {
+		if err = q.callHook(v.BeforeSave); err != nil {
+			return
+		}
+	}
+	q.route(structPtr)
+	model := structPtrToNamedModel(structPtr, true, q.criteria.omitFields, q.naming())
+	model.includeZero(q.criteria.includeZero)
+	if len(model.pks) == 0 {
 		panic("no primary key field")
 	}
+	if err = model.validate(); err != nil {
+		return
+	}
+	generated := model.generatePk(reflect.ValueOf(structPtr))
 	q.criteria.model = model
+	crit := q.criteria //the criteria is reset after execution.
 	now := time.Now()
 	var id int64 = 0
 	updateModelField := model.timeField("updated")
@@ -462,44 +907,105 @@ func (q *Qbs) Save(structPtr interface{}) (affected int64, err error) {
 	}
 	createdModelField := model.timeField("created")
 	var isInsert bool
-	if !model.pkZero() && q.WhereEqual(model.pk.name, model.pk.value).Count(model.table) > 0 { //id is given, can be an update operation.
-		affected, err = q.Dialect.update(q)
+	var version *modelField
+	var before []map[string]interface{}
+	var returned []string
+	returning := q.useReturning()
+	if pkCondition := model.pkCondition(q.Dialect, false); !generated && pkCondition != nil && q.Condition(pkCondition).Count(model.table) > 0 { //id is given, can be an update operation.
+		version = q.lockVersion(model)
+		if q.Auditor != nil {
+			if before, err = q.auditedRows(model); err != nil {
+				return 0, q.updateTxError(err)
+			}
+		}
+		if returning {
+			query, args := q.Dialect.updateSql(q.criteria)
+			affected, returned, err = q.execReturning(structPtr, query, args)
+		} else {
+			affected, err = q.Dialect.update(q)
+		}
+		if err == nil && version != nil && affected == 0 {
+			err = ErrStaleObject
+		}
 	} else {
 		if createdModelField != nil {
 			createdModelField.value = now
 		}
-		id, err = q.Dialect.insert(q)
-		isInsert = true
-		if err == nil {
-			affected = 1
+		if returning {
+			query, args := q.Dialect.insertSql(q.criteria)
+			affected, returned, err = q.execReturning(structPtr, query, args)
+		} else {
+			id, err = q.Dialect.insert(q)
+			if err == nil {
+				affected = 1
+			}
 		}
+		isInsert = true
 	}
+	q.lastResult = Result{RowsAffected: affected, Returned: returned}
 	if err == nil {
 		structValue := reflect.Indirect(reflect.ValueOf(structPtr))
-		if _, ok := model.pk.value.(int64); ok && id != 0 {
-			idField := structValue.FieldByName(model.pk.camelName)
-			idField.SetInt(id)
+		if model.pk != nil { //a composite key is given by the fields.
+			if _, ok := model.pk.value.(int64); ok && id != 0 {
+				idField := structValue.FieldByName(model.pk.camelName)
+				idField.SetInt(id)
+			}
+			if pk, ok := structValue.FieldByName(model.pk.camelName).Interface().(int64); ok && isInsert {
+				q.lastResult.LastInsertId = pk
+			}
+		}
+		if returned != nil {
+			updateModelField, createdModelField = nil, nil //the values of the database are kept.
 		}
 		if updateModelField != nil {
 			updateField := structValue.FieldByName(updateModelField.camelName)
 			updateField.Set(reflect.ValueOf(now))
 		}
+		if version != nil {
+			setVersion(structPtr, version)
+		}
+		q.invalidateCached(structPtr, model)
+		invalidateQueries(model.table)
 		if isInsert {
 			if createdModelField != nil {
 				createdField := structValue.FieldByName(createdModelField.camelName)
 				createdField.Set(reflect.ValueOf(now))
 			}
 		}
+		if q.Auditor != nil {
+			operation := AuditUpdate
+			if isInsert {
+				operation = AuditInsert
+			}
+			err = q.audit(model, operation, before, auditedValues(model, structValue))
+		}
+		if q.shadow != nil && err == nil {
+			q.shadow.mirror(structPtr, nil, crit, affected, shadowSave)
+		}
+		if v, ok := structPtr.(AfterSaver); ok && err == nil {
+			err = q.callHook(v.AfterSave)
+		}
 	}
 	return affected, q.updateTxError(err)
 }
 
+// BulkInsert inserts all the struct pointers in the slice in a transaction with multi-row INSERT statements,
+// if MaxTransactionRows is set, the rows will be committed in multiple transactions.
+// The generated ids are filled in the structs.
 func (q *Qbs) BulkInsert(sliceOfStructPtr interface{}) error {
 	defer q.Reset()
 	var err error
-	if q.tx == nil {
+	sliceValue := reflect.ValueOf(sliceOfStructPtr)
+	if sliceValue.Len() > 0 {
+		q.route(sliceValue.Index(0).Interface())
+	}
+	ownTx := q.tx == nil
+	if ownTx {
 		q.Begin()
 		defer func() {
+			if q.tx == nil {
+				return
+			}
 			if err != nil {
 				q.Rollback()
 			} else {
@@ -507,73 +1013,288 @@ func (q *Qbs) BulkInsert(sliceOfStructPtr interface{}) error {
 			}
 		}()
 	}
-	sliceValue := reflect.ValueOf(sliceOfStructPtr)
-	for i := 0; i < sliceValue.Len(); i++ {
-		structPtr := sliceValue.Index(i)
-		structPtrInter := structPtr.Interface()
+	models := make([]*model, sliceValue.Len())
+	for i := range models {
+		structPtrInter := sliceValue.Index(i).Interface()
 		if v, ok := structPtrInter.(Validator); ok {
 			err = v.Validate(q)
 			if err != nil {
 				return q.updateTxError(err)
 			}
 		}
-		model := structPtrToModel(structPtrInter, false, nil)
-		if model.pk == nil {
+		models[i] = structPtrToNamedModel(structPtrInter, false, nil, q.naming())
+		if models[i].pk == nil {
 			panic("no primary key field")
 		}
-		q.criteria.model = model
-		var id int64
-		id, err = q.Dialect.insert(q)
+		models[i].generatePk(sliceValue.Index(i))
+	}
+	for i := 0; i < len(models); {
+		if ownTx && q.MaxTransactionRows > 0 && i > 0 && i%q.MaxTransactionRows == 0 {
+			if err = q.Commit(); err != nil {
+				return err
+			}
+			if err = q.Begin(); err != nil {
+				return q.updateTxError(err)
+			}
+		}
+		end := len(models)
+		if ownTx && q.MaxTransactionRows > 0 {
+			end = (i/q.MaxTransactionRows + 1) * q.MaxTransactionRows
+			if end > len(models) {
+				end = len(models)
+			}
+		}
+		n := q.bulkInsertRows(models[i:end])
+		var ids []int64
+		ids, err = q.Dialect.bulkInsert(q, models[i:i+n])
 		if err != nil {
 			return q.updateTxError(err)
 		}
-		if _, ok := model.pk.value.(int64); ok && id != 0 {
-			idField := structPtr.Elem().FieldByName(model.pk.camelName)
-			idField.SetInt(id)
+		for j, id := range ids {
+			if _, ok := models[i+j].pk.value.(int64); ok && id != 0 && models[i+j].pkZero() {
+				idField := sliceValue.Index(i + j).Elem().FieldByName(models[i+j].pk.camelName)
+				idField.SetInt(id)
+			}
+		}
+		for j := i; j < i+n && q.Auditor != nil; j++ {
+			if err = q.audit(models[j], AuditInsert, nil, auditedValues(models[j], sliceValue.Index(j).Elem())); err != nil {
+				return q.updateTxError(err)
+			}
 		}
+		i += n
+	}
+	if len(models) > 0 {
+		invalidateQueries(models[0].table)
+	}
+	if q.shadow != nil {
+		q.shadow.mirrorRows(sliceOfStructPtr, int64(len(models)), shadowBulkInsert)
 	}
 	return nil
 }
 
+// bulkInsertRows returns the number of leading models which can be inserted by one statement,
+// they have the same columns and don't exceed the dialect limit.
+func (q *Qbs) bulkInsertRows(models []*model) int {
+	columns, _ := models[0].columnsAndValues(false)
+	max := q.Dialect.maxBulkInsertRows(len(columns))
+	n := 1
+	for ; n < len(models) && n < max; n++ {
+		c, _ := models[n].columnsAndValues(false)
+		if strings.Join(c, ",") != strings.Join(columns, ",") {
+			break
+		}
+	}
+	return n
+}
+
+// BulkUpdate updates all the struct pointers in the slice by their primary keys in a transaction,
+// if MaxTransactionRows is set, the rows will be committed in multiple transactions.
+// The update statement is prepared once for rows with the same columns. It returns the total affected rows.
+func (q *Qbs) BulkUpdate(sliceOfStructPtr interface{}) (affected int64, err error) {
+	defer q.Reset()
+	sliceValue := reflect.ValueOf(sliceOfStructPtr)
+	if sliceValue.Len() > 0 {
+		q.route(sliceValue.Index(0).Interface())
+	}
+	ownTx := q.tx == nil
+	if ownTx {
+		q.Begin()
+		defer func() {
+			if q.tx == nil {
+				return
+			}
+			if err != nil {
+				q.Rollback()
+			} else {
+				q.Commit()
+			}
+		}()
+	}
+	for i := 0; i < sliceValue.Len(); i++ {
+		if ownTx && q.MaxTransactionRows > 0 && i > 0 && i%q.MaxTransactionRows == 0 {
+			if err = q.Commit(); err != nil {
+				return
+			}
+			if err = q.Begin(); err != nil {
+				return affected, q.updateTxError(err)
+			}
+		}
+		structPtrInter := sliceValue.Index(i).Interface()
+		if v, ok := structPtrInter.(Validator); ok {
+			if err = v.Validate(q); err != nil {
+				return affected, q.updateTxError(err)
+			}
+		}
+		model := structPtrToNamedModel(structPtrInter, false, nil, q.naming())
+		if model.pkCondition(q.Dialect, false) == nil {
+			panic("BulkUpdate requires primary key values")
+		}
+		q.criteria.model = model
+		q.criteria.condition = nil
+		q.criteria.mergePkCondition(q.Dialect)
+		version := q.lockVersion(model)
+		var before []map[string]interface{}
+		if q.Auditor != nil {
+			if before, err = q.auditedRows(model); err != nil {
+				return affected, q.updateTxError(err)
+			}
+		}
+		var n int64
+		n, err = q.Dialect.update(q)
+		if err == nil && version != nil && n == 0 {
+			err = ErrStaleObject
+		}
+		if err == nil && q.Auditor != nil {
+			err = q.auditUpdated(model, before, writtenValues(model))
+		}
+		if err != nil {
+			return affected, q.updateTxError(err)
+		}
+		if version != nil {
+			setVersion(structPtrInter, version)
+		}
+		q.invalidateCached(structPtrInter, model)
+		invalidateQueries(model.table)
+		affected += n
+	}
+	if q.shadow != nil {
+		q.shadow.mirrorRows(sliceOfStructPtr, affected, shadowBulkUpdate)
+	}
+	return
+}
+
 // If the struct type implements Validator interface, values will be validated before update.
 // In order to avoid inadvertently update the struct field to zero value, it is better to define a
 // temporary struct in function, only define the fields that should be updated.
 // But the temporary struct can not implement Validator interface, we have to validate values manually.
 // The update condition can be inferred by the Id value of the struct.
 // If neither Id value or condition are provided, it would cause runtime panic
+// If the struct has a `qbs:"version"` int64 field, only the row of that version is updated and the version is
+// incremented, ErrStaleObject is returned if no row is affected.
 func (q *Qbs) Update(structPtr interface{}) (affected int64, err error) {
+	if q.Auditor != nil && q.tx == nil { //the change and its audit are committed together.
+		err = q.Transaction(func(tx *Qbs) error {
+			affected, err = tx.Update(structPtr)
+			return err
+		})
+		return
+	}
 	if v, ok := structPtr.(Validator); ok {
 		err := v.Validate(q)
 		if err != nil {
 			return 0, err
 		}
 	}
-	model := structPtrToModel(structPtr, true, q.criteria.omitFields)
+	if v, ok := structPtr.(BeforeSaver); ok {
+		if err = q.callHook(v.BeforeSave); err != nil {
+			return
+		}
+	}
+	q.route(structPtr)
+	model := structPtrToNamedModel(structPtr, true, q.criteria.omitFields, q.naming())
+	model.includeZero(q.criteria.includeZero)
 	q.criteria.model = model
 	q.criteria.mergePkCondition(q.Dialect)
 	if q.criteria.condition == nil {
 		panic("Can not update without condition")
 	}
-	return q.Dialect.update(q)
+	version := q.lockVersion(model)
+	crit := q.criteria //the criteria is reset after execution.
+	var before []map[string]interface{}
+	if q.Auditor != nil {
+		if before, err = q.auditedRows(model); err != nil {
+			return 0, q.updateTxError(err)
+		}
+	}
+	var returned []string
+	if q.useReturning() {
+		query, args := q.Dialect.updateSql(q.criteria)
+		affected, returned, err = q.execReturning(structPtr, query, args)
+	} else {
+		affected, err = q.Dialect.update(q)
+	}
+	q.lastResult = Result{RowsAffected: affected, Returned: returned}
+	if err == nil && version != nil {
+		if affected == 0 {
+			return 0, ErrStaleObject
+		}
+		setVersion(structPtr, version)
+	}
+	if err == nil {
+		q.invalidateCached(structPtr, model)
+		invalidateQueries(model.table)
+	}
+	if err == nil && q.Auditor != nil {
+		err = q.auditUpdated(model, before, writtenValues(model))
+	}
+	if err == nil && q.shadow != nil {
+		q.shadow.mirror(structPtr, crit.condition, crit, affected, shadowUpdate)
+	}
+	if v, ok := structPtr.(AfterSaver); ok && err == nil {
+		err = q.callHook(v.AfterSave)
+	}
+	return
 }
 
 // The delete condition can be inferred by the Id value of the struct
 // If neither Id value or condition are provided, it would cause runtime panic
+// If the struct has a `qbs:"deleted"` time field, the rows are soft deleted by setting it to the current time,
+// call Unscoped first to remove them.
 func (q *Qbs) Delete(structPtr interface{}) (affected int64, err error) {
-	model := structPtrToModel(structPtr, true, q.criteria.omitFields)
+	if q.Auditor != nil && q.tx == nil { //the change and its audit are committed together.
+		err = q.Transaction(func(tx *Qbs) error {
+			affected, err = tx.Delete(structPtr)
+			return err
+		})
+		return
+	}
+	if v, ok := structPtr.(BeforeDeleter); ok {
+		if err = q.callHook(v.BeforeDelete); err != nil {
+			return
+		}
+	}
+	q.route(structPtr)
+	model := structPtrToNamedModel(structPtr, true, q.criteria.omitFields, q.naming())
 	q.criteria.model = model
 	q.criteria.mergePkCondition(q.Dialect)
 	if q.criteria.condition == nil {
 		panic("Can not delete without condition")
 	}
-	return q.Dialect.delete(q)
+	crit := q.criteria //the criteria is reset after execution.
+	var before []map[string]interface{}
+	if q.Auditor != nil {
+		if before, err = q.auditedRows(model); err != nil {
+			return 0, q.updateTxError(err)
+		}
+	}
+	if deleted := model.deletedField(); deleted != nil && !q.criteria.unscoped {
+		affected, err = q.softDelete(structPtr, deleted)
+	} else {
+		affected, err = q.Dialect.delete(q)
+	}
+	q.lastResult = Result{RowsAffected: affected}
+	if err == nil {
+		q.invalidateCached(structPtr, model)
+		invalidateQueries(model.table)
+	}
+	if err == nil && q.Auditor != nil {
+		err = q.audit(model, AuditDelete, before, nil)
+	}
+	if err == nil && q.shadow != nil {
+		q.shadow.mirror(structPtr, crit.condition, crit, affected, shadowDelete)
+	}
+	if v, ok := structPtr.(AfterDeleter); ok && err == nil {
+		err = q.callHook(v.AfterDelete)
+	}
+	return
 }
 
 // This method can be used to validate unique column before trying to save
 // The table parameter can be either a string or a struct pointer
 func (q *Qbs) ContainsValue(table interface{}, column string, value interface{}) bool {
+	q.routeTable(table)
 	quotedColumn := q.Dialect.quote(column)
-	quotedTable := q.Dialect.quote(tableName(table))
+	quotedTable := q.Dialect.quote(namedTableName(table, q.naming()))
 	query := fmt.Sprintf("SELECT %v FROM %v WHERE %v = ?", quotedColumn, quotedTable, quotedColumn)
 	row := q.QueryRow(query, value)
 	var result interface{}
@@ -584,10 +1305,20 @@ func (q *Qbs) ContainsValue(table interface{}, column string, value interface{})
 
 // If the connection pool is not full, the Db will be sent back into the pool, otherwise the Db will get closed.
 func (q *Qbs) Close() error {
-	if connectionLimit != nil {
+	if q.shadow != nil {
+		q.SetShadow(nil, q.shadow.mode)
+	}
+	if connectionLimit != nil && !q.borrowed {
 		<-connectionLimit
 	}
 	if q.tx != nil {
+		if q.database == nil { //the transaction of NewFromTx belongs to its owner.
+			for _, v := range q.txStmtMap {
+				v.Close()
+			}
+			q.txStmtMap = nil
+			return nil
+		}
 		return q.Rollback()
 	}
 	return nil
@@ -595,12 +1326,14 @@ func (q *Qbs) Close() error {
 
 //Query the count of rows in a table the talbe parameter can be either a string or struct pointer.
 //If condition is given, the count will be the count of rows meet that condition.
+//The soft deleted rows of a struct pointer are not counted unless Unscoped is called.
 func (q *Qbs) Count(table interface{}) int64 {
-	quotedTable := q.Dialect.quote(tableName(table))
+	q.routeTable(table)
+	quotedTable := q.Dialect.quote(namedTableName(table, q.naming()))
 	query := "SELECT COUNT(*) FROM " + quotedTable
 	var row *sql.Row
-	if q.criteria.condition != nil {
-		conditionSql, args := q.criteria.condition.Merge()
+	if condition := q.tableCondition(table); condition != nil {
+		conditionSql, args := condition.Merge()
 		query += " WHERE " + conditionSql
 		row = q.QueryRow(query, args...)
 	} else {
@@ -616,6 +1349,143 @@ func (q *Qbs) Count(table interface{}) int64 {
 	return count
 }
 
+//Query the count of rows of every distinct value of the snakecase groupColumn, the table parameter can be
+//either a string or struct pointer. If condition is given, only rows meet that condition are counted.
+//Values are converted to strings as the keys of the map, NULL is converted to "".
+func (q *Qbs) CountBy(table interface{}, groupColumn string) (map[string]int64, error) {
+	values, err := q.aggregateBy(table, groupColumn, "COUNT", "")
+	counts := make(map[string]int64, len(values))
+	for k, v := range values {
+		counts[k] = int64(v)
+	}
+	return counts, err
+}
+
+//Same as CountBy but sums the snakecase column for every group.
+func (q *Qbs) SumBy(table interface{}, groupColumn, column string) (map[string]float64, error) {
+	return q.aggregateBy(table, groupColumn, "SUM", column)
+}
+
+//Same as CountBy but averages the snakecase column for every group.
+func (q *Qbs) AvgBy(table interface{}, groupColumn, column string) (map[string]float64, error) {
+	return q.aggregateBy(table, groupColumn, "AVG", column)
+}
+
+// Same as CountBy but finds the minimum of the snakecase column for every group.
+func (q *Qbs) MinBy(table interface{}, groupColumn, column string) (map[string]float64, error) {
+	return q.aggregateBy(table, groupColumn, "MIN", column)
+}
+
+// Same as CountBy but finds the maximum of the snakecase column for every group.
+func (q *Qbs) MaxBy(table interface{}, groupColumn, column string) (map[string]float64, error) {
+	return q.aggregateBy(table, groupColumn, "MAX", column)
+}
+
+// Query the sum of the snakecase column of the rows meet the condition, 0 if no row meets it.
+func (q *Qbs) Sum(table interface{}, column string) (float64, error) {
+	var sum sql.NullFloat64
+	err := q.aggregate(table, "SUM", column, &sum)
+	return sum.Float64, err
+}
+
+// Same as Sum for an integer column.
+func (q *Qbs) SumInt64(table interface{}, column string) (int64, error) {
+	var sum sql.NullInt64
+	err := q.aggregate(table, "SUM", column, &sum)
+	return sum.Int64, err
+}
+
+// Query the average of the snakecase column of the rows meet the condition, 0 if no row meets it.
+func (q *Qbs) Avg(table interface{}, column string) (float64, error) {
+	var avg sql.NullFloat64
+	err := q.aggregate(table, "AVG", column, &avg)
+	return avg.Float64, err
+}
+
+// Scan the minimum of the snakecase column of the rows meet the condition into ptr,
+// which should be able to hold NULL if no row may meet it, e.g. a *sql.NullInt64.
+func (q *Qbs) Min(table interface{}, column string, ptr interface{}) error {
+	return q.aggregate(table, "MIN", column, ptr)
+}
+
+// Same as Min but scans the maximum.
+func (q *Qbs) Max(table interface{}, column string, ptr interface{}) error {
+	return q.aggregate(table, "MAX", column, ptr)
+}
+
+// aggregateSql applies the aggregate function to the column quoted by the dialect of the routed table, to all rows if it's empty.
+func (q *Qbs) aggregateSql(function, column string) string {
+	if column == "" {
+		return function + "(*)"
+	}
+	return function + "(" + q.Dialect.quote(column) + ")"
+}
+
+func (q *Qbs) aggregate(table interface{}, function, column string, ptr interface{}) error {
+	defer q.Reset()
+	q.routeTable(table)
+	query := "SELECT " + q.aggregateSql(function, column) + " FROM " + q.Dialect.quote(namedTableName(table, q.naming()))
+	var args []interface{}
+	if condition := q.tableCondition(table); condition != nil {
+		var conditionSql string
+		conditionSql, args = condition.Merge()
+		query += " WHERE " + conditionSql
+	}
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return q.updateTxError(err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return q.updateTxError(rows.Err())
+	}
+	return q.updateTxError(rows.Scan(ptr))
+}
+
+func (q *Qbs) aggregateBy(table interface{}, groupColumn, function, column string) (map[string]float64, error) {
+	defer q.Reset()
+	q.routeTable(table)
+	quotedGroup := q.Dialect.quote(groupColumn)
+	query := "SELECT " + quotedGroup + ", " + q.aggregateSql(function, column) + " FROM " + q.Dialect.quote(namedTableName(table, q.naming()))
+	var args []interface{}
+	if condition := q.tableCondition(table); condition != nil {
+		var conditionSql string
+		conditionSql, args = condition.Merge()
+		query += " WHERE " + conditionSql
+	}
+	query += " GROUP BY " + quotedGroup
+	if q.criteria.having != nil {
+		havingSql, havingArgs := q.criteria.having.Merge()
+		query += " HAVING " + havingSql
+		args = append(args, havingArgs...)
+	}
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, q.updateTxError(err)
+	}
+	defer rows.Close()
+	result := make(map[string]float64)
+	for rows.Next() {
+		var group interface{}
+		var value sql.NullFloat64
+		if err = rows.Scan(&group, &value); err != nil {
+			return nil, q.updateTxError(err)
+		}
+		key := ""
+		switch g := group.(type) {
+		case nil:
+		case []byte:
+			key = string(g)
+		case time.Time:
+			key = g.Format(time.RFC3339)
+		default:
+			key = fmt.Sprint(g)
+		}
+		result[key] = value.Float64
+	}
+	return result, q.updateTxError(rows.Err())
+}
+
 //Query raw sql and return a map.
 func (q *Qbs) QueryMap(query string, args ...interface{}) (map[string]interface{}, error) {
 	mapSlice, err := q.doQueryMap(query, true, args...)
@@ -633,11 +1503,7 @@ func (q *Qbs) QueryMapSlice(query string, args ...interface{}) ([]map[string]int
 
 func (q *Qbs) doQueryMap(query string, once bool, args ...interface{}) ([]map[string]interface{}, error) {
 	query = q.Dialect.substituteMarkers(query)
-	stmt, err := q.prepare(query)
-	if err != nil {
-		return nil, q.updateTxError(err)
-	}
-	rows, err := stmt.Query(args...)
+	rows, err := q.query(query, args...)
 	if err != nil {
 		return nil, q.updateTxError(err)
 	}
@@ -675,14 +1541,13 @@ func (q *Qbs) doQueryMap(query string, once bool, args ...interface{}) ([]map[st
 
 //Do a raw sql query and set the result values in dest parameter.
 //The dest parameter can be either a struct pointer or a pointer of struct pointer.slice
-//This method do not support pointer field in the struct.
+//This method do not support pointer field in the struct except pointers of nested structs.
+//Columns can be scanned into the fields of nested struct fields, e.g. struct{ Article Article; AuthorName string },
+//a column is matched to a nested field if no top level field matches and only one nested struct has the field,
+//otherwise name the column "prefix___column" like "article___title" to disambiguate.
 func (q *Qbs) QueryStruct(dest interface{}, query string, args ...interface{}) error {
 	query = q.Dialect.substituteMarkers(query)
-	stmt, err := q.prepare(query)
-	if err != nil {
-		return q.updateTxError(err)
-	}
-	rows, err := stmt.Query(args...)
+	rows, err := q.query(query, args...)
 	if err != nil {
 		return q.updateTxError(err)
 	}
@@ -698,15 +1563,9 @@ func (q *Qbs) QueryStruct(dest interface{}, query string, args ...interface{}) e
 		single = true
 	}
 	columns, _ := rows.Columns()
-	fieldNames := make([]string, len(columns))
+	fieldPaths := make([][]int, len(columns))
 	for i, v := range columns {
-		upper := snakeToUpperCamel(v)
-		_, ok := structType.FieldByName(upper)
-		if ok {
-			fieldNames[i] = upper
-		} else {
-			fieldNames[i] = "-"
-		}
+		fieldPaths[i] = q.queryStructPath(structType, v)
 	}
 	for rows.Next() {
 		var rowStructPointer reflect.Value
@@ -717,12 +1576,11 @@ func (q *Qbs) QueryStruct(dest interface{}, query string, args ...interface{}) e
 		}
 		dests := make([]interface{}, len(columns))
 		for i := 0; i < len(dests); i++ {
-			fieldName := fieldNames[i]
-			if fieldName == "-" {
+			if fieldPaths[i] == nil {
 				var placeholder interface{}
 				dests[i] = &placeholder
 			} else {
-				field := rowStructPointer.Elem().FieldByName(fieldName)
+				field := fieldByPath(rowStructPointer.Elem(), fieldPaths[i])
 				dests[i] = field.Addr().Interface()
 			}
 		}
@@ -738,25 +1596,86 @@ func (q *Qbs) QueryStruct(dest interface{}, query string, args ...interface{}) e
 	return nil
 }
 
+// queryStructPath returns the index path of the field a column of QueryStruct is scanned into, nil if none.
+func (q *Qbs) queryStructPath(structType reflect.Type, column string) []int {
+	if paths := strings.SplitN(column, "___", 2); len(paths) == 2 {
+		field, ok := structType.FieldByName(q.naming().StructName(paths[0]))
+		if !ok || nestedStructType(field.Type) == nil {
+			return nil
+		}
+		sub := q.queryStructPath(nestedStructType(field.Type), paths[1])
+		if sub == nil {
+			return nil
+		}
+		return append(append([]int{}, field.Index...), sub...)
+	}
+	fieldName := q.naming().FieldName(column)
+	if field, ok := structType.FieldByName(fieldName); ok {
+		return field.Index
+	}
+	var path []int
+	for i := 0; i < structType.NumField(); i++ {
+		nested := nestedStructType(structType.Field(i).Type)
+		if nested == nil {
+			continue
+		}
+		if field, ok := nested.FieldByName(fieldName); ok {
+			if path != nil {
+				return nil //ambiguous, a prefix is required.
+			}
+			path = append([]int{i}, field.Index...)
+		}
+	}
+	return path
+}
+
+// nestedStructType returns the type of a struct or struct pointer field QueryStruct can scan into, nil otherwise.
+func nestedStructType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		return nil
+	}
+	return t
+}
+
+// fieldByPath returns the field of the index path, allocating nil struct pointers on the way.
+func fieldByPath(v reflect.Value, path []int) reflect.Value {
+	for i, index := range path {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(index)
+	}
+	return v
+}
+
 //Iterate the rows, the first parameter is a struct pointer, the second parameter is a fucntion
 //which will get called on each row, the in `do` function the structPtr's value will be set to the current row's value..
 //if `do` function returns an error, the iteration will be stopped.
+// The struct is reset to its zero value before every row is scanned, so NULL columns don't keep the previous values.
 func (q *Qbs) Iterate(structPtr interface{}, do func() error) error {
-	q.criteria.model = structPtrToModel(structPtr, !q.criteria.omitJoin, q.criteria.omitFields)
+	q.route(structPtr)
+	q.criteria.model = structPtrToNamedModel(structPtr, !q.criteria.omitJoin, q.criteria.omitFields, q.naming())
+	q.scopeDeleted(true)
 	query, args := q.Dialect.querySql(q.criteria)
-	q.log(query, args...)
 	defer q.Reset()
-	stmt, err := q.prepare(query)
-	if err != nil {
-		return q.updateTxError(err)
+	if q.criteria.spill {
+		return q.iterateSpilled(structPtr, do, query, args)
 	}
-	rows, err := stmt.Query(args...)
+	rows, err := q.query(query, args...)
 	if err != nil {
 		return q.updateTxError(err)
 	}
 	rowValue := reflect.ValueOf(structPtr)
+	zero := reflect.Zero(rowValue.Elem().Type())
 	defer rows.Close()
 	for rows.Next() {
+		rowValue.Elem().Set(zero)
 		err = q.scanRows(rowValue, rows)
 		if err != nil {
 			return err
@@ -767,10 +1686,3 @@ func (q *Qbs) Iterate(structPtr interface{}, do func() error) error {
 	}
 	return nil
 }
-
-func (q *Qbs) log(query string, args ...interface{}) {
-	if q.Log && queryLogger != nil {
-		queryLogger.Print(query)
-		queryLogger.Println(args...)
-	}
-}
@@ -0,0 +1,119 @@
+package qbs
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+var resultCache Cache
+var resultCacheTTL time.Duration
+
+// SetQueryCache caches the rows found by Find and FindAll outside transactions for the ttl, keyed by the query
+// and its arguments, nil disables it. Save, Update, Delete and BulkInsert of a table invalidate the cached
+// queries of the table and the ones joining it, rows written by Exec or other processes are seen after the ttl,
+// as are the old rows cached by a query running while the writing transaction commits.
+// Joined structs of the returned rows are shared with the cached rows of an in-memory cache.
+func SetQueryCache(cache Cache, ttl time.Duration) {
+	resultCache, resultCacheTTL = cache, ttl
+}
+
+// resultKey returns the cache key of the query of the criteria model, empty if it shouldn't be cached.
+// The key contains the generations of the tables queried, so bumping one invalidates the queries of the table.
+func (q *Qbs) resultKey(out interface{}, query string, args []interface{}) string {
+	if resultCache == nil || q.tx != nil || q.criteria.model == nil {
+		return ""
+	}
+	tables := []string{q.criteria.model.table}
+	for _, ref := range q.criteria.model.refs {
+		tables = append(tables, ref.model.table)
+	}
+	sort.Strings(tables)
+	h := sha1.New()
+	fmt.Fprintf(h, "%v %T %v %#v", q.cacheName(), out, query, args)
+	for _, table := range tables {
+		fmt.Fprintf(h, " %v=%v", table, tableGeneration(table))
+	}
+	return "qbs:query:" + q.criteria.model.table + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheName names the database of the Qbs in the cache keys, a Qbs of NewFromTx has none.
+func (q *Qbs) cacheName() string {
+	if q.database == nil {
+		return ""
+	}
+	return q.database.cacheName
+}
+
+// dsnCacheName is the cache name of the database of the data source, hashed to keep its password out of the keys.
+func dsnCacheName(driverName, driverSourceName string) string {
+	h := sha1.Sum([]byte(driverName + " " + driverSourceName))
+	return hex.EncodeToString(h[:8])
+}
+
+func tableGeneration(table string) int64 {
+	key := "qbs:generation:" + table
+	if gen, ok := resultCache.Get(key); ok {
+		return gen.(int64)
+	}
+	gen := time.Now().UnixNano()
+	resultCache.Set(key, gen, 0)
+	return gen
+}
+
+// invalidateQueries starts a new generation of the table, the cached queries of the old one are never read again.
+func invalidateQueries(table string) {
+	if resultCache != nil {
+		resultCache.Set("qbs:generation:"+table, time.Now().UnixNano(), 0)
+	}
+}
+
+// findCachedRow copies the cached row into the struct pointer.
+func findCachedRow(key string, rowValue reflect.Value) bool {
+	if key == "" {
+		return false
+	}
+	cached, ok := resultCache.Get(key)
+	if !ok {
+		return false
+	}
+	rowValue.Elem().Set(reflect.ValueOf(cached).Elem())
+	return true
+}
+
+// findCachedRows appends copies of the cached rows to the slice.
+func findCachedRows(key string, sliceValue reflect.Value) bool {
+	if key == "" {
+		return false
+	}
+	cached, ok := resultCache.Get(key)
+	if !ok {
+		return false
+	}
+	rows := reflect.ValueOf(cached).Elem()
+	for i := 0; i < rows.Len(); i++ {
+		sliceValue.Set(reflect.Append(sliceValue, copyRow(rows.Index(i))))
+	}
+	return true
+}
+
+func storeCachedRow(key string, rowValue reflect.Value) {
+	if key != "" {
+		resultCache.Set(key, copyRow(rowValue).Interface(), resultCacheTTL)
+	}
+}
+
+// storeCachedRows caches a pointer to a slice of copies of the rows appended to the slice from start.
+func storeCachedRows(key string, sliceValue reflect.Value, start int) {
+	if key == "" {
+		return
+	}
+	copies := reflect.New(sliceValue.Type())
+	for i := start; i < sliceValue.Len(); i++ {
+		copies.Elem().Set(reflect.Append(copies.Elem(), copyRow(sliceValue.Index(i))))
+	}
+	resultCache.Set(key, copies.Interface(), resultCacheTTL)
+}
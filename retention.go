@@ -0,0 +1,125 @@
+package qbs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RetentionBatchSize is the number of expired rows ApplyRetention deletes in a transaction.
+var RetentionBatchSize = 1000
+
+// Retainer is implemented by the models whose rows expire, the Retention of the model is applied by ApplyRetention.
+type Retainer interface {
+	Retention() Retention
+}
+
+// Retention is the data retention policy of a model with a primary key and a `qbs:"created"` or Created time field.
+type Retention struct {
+	Keep    time.Duration // How long the rows are kept after they are created, e.g. 90 * 24 * time.Hour.
+	Archive interface{}   // The struct pointer of the table the expired rows are copied to before they are deleted, nil to only delete them.
+}
+
+// ApplyRetention deletes the rows of the models created before the Keep duration of their Retention,
+// RetentionBatchSize rows at a time in the order of the primary key, and copies them to the Archive table
+// in the same transaction if it is set. The columns of the archive table are copied from the columns of the same name.
+// The deleted rows are removed from the cache of Cacheable models.
+// It returns the number of rows deleted, and panics if a model doesn't implement Retainer.
+func ApplyRetention(q *Qbs, structPtrs ...interface{}) (int64, error) {
+	var total int64
+	for _, structPtr := range structPtrs {
+		retainer, ok := structPtr.(Retainer)
+		if !ok {
+			panic(fmt.Sprintf("%T doesn't implement Retainer", structPtr))
+		}
+		policy := retainer.Retention()
+		cutoff := time.Now().Add(-policy.Keep)
+		deleted, err := q.applyRetention(structPtr, policy, cutoff)
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+		if q.shadow != nil { //the shadow expires the rows of the same cutoff.
+			q.shadow.mirror(structPtr, nil, new(criteria), deleted, func(shadow *Qbs, structPtr interface{}) (int64, error) {
+				return shadow.applyRetention(structPtr, policy, cutoff)
+			})
+		}
+	}
+	return total, nil
+}
+
+func (q *Qbs) applyRetention(structPtr interface{}, policy Retention, cutoff time.Time) (int64, error) {
+	q.route(structPtr)
+	model := structPtrToNamedModel(structPtr, false, nil, q.naming())
+	created := model.timeField("created")
+	if created == nil || model.pk == nil {
+		return 0, errors.New("retention needs a created field and a primary key on table " + model.table)
+	}
+	table, pk := q.Dialect.quote(model.table), q.Dialect.quote(model.pk.name)
+	expired := q.Dialect.quote(created.name) + " < ? AND " + pk + " <= ?"
+	var archive string
+	if policy.Archive != nil {
+		archiveModel := structPtrToNamedModel(policy.Archive, false, nil, q.naming())
+		archive = insertSelectSql(q.Dialect, archiveModel, table, expired)
+		defer invalidateQueries(archiveModel.table)
+	}
+	defer invalidateQueries(model.table)
+	query := fmt.Sprintf("SELECT %v FROM %v WHERE %v < ? ORDER BY %v LIMIT ?", pk, table, q.Dialect.quote(created.name), pk)
+	var total int64
+	for {
+		pks, err := q.expiredPks(query, cutoff)
+		if err != nil || len(pks) == 0 {
+			return total, err
+		}
+		last := pks[len(pks)-1][0]
+		err = q.Transaction(func(tx *Qbs) error {
+			var before []map[string]interface{}
+			if tx.Auditor != nil {
+				var err error
+				if before, err = tx.QueryMapSlice("SELECT * FROM "+table+" WHERE "+expired, cutoff, last); err != nil {
+					return err
+				}
+			}
+			if archive != "" {
+				if _, err := tx.Exec(archive, cutoff, last); err != nil {
+					return err
+				}
+			}
+			result, err := tx.Exec("DELETE FROM "+table+" WHERE "+expired, cutoff, last)
+			if err != nil {
+				return err
+			}
+			deleted, err := result.RowsAffected()
+			total += deleted
+			if err == nil && tx.Auditor != nil {
+				err = tx.audit(model, AuditDelete, before, nil)
+			}
+			return err
+		})
+		q.invalidateCachedPks(structPtr, model, pks)
+		if err != nil || len(pks) < RetentionBatchSize {
+			return total, err
+		}
+	}
+}
+
+// expiredPks returns the primary keys of the next batch of expired rows in order.
+func (q *Qbs) expiredPks(query string, cutoff time.Time) ([][]interface{}, error) {
+	rows, err := q.Query(query, cutoff, RetentionBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pks [][]interface{}
+	for rows.Next() {
+		var pk interface{}
+		if err = rows.Scan(&pk); err != nil {
+			return nil, err
+		}
+		if b, ok := pk.([]byte); ok {
+			pk = string(b)
+		}
+		pks = append(pks, []interface{}{pk})
+	}
+	return pks, rows.Err()
+}
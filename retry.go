@@ -0,0 +1,90 @@
+package qbs
+
+import (
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+// RetryPolicy retries the SELECT queries of Find, FindAll, Iterate, QueryStruct and QueryMap failed by
+// transient errors, like connection resets when a proxy fails over, set it to Qbs.Retry.
+// Queries in a transaction are never retried, the transaction is lost with the connection.
+type RetryPolicy struct {
+	MaxAttempts int                  // The attempts including the first one, 3 if 0.
+	BaseDelay   time.Duration        // The delay before the first retry, doubled for every later one, 50ms if 0.
+	MaxDelay    time.Duration        // The limit of the delay, 1s if 0.
+	IsTransient func(err error) bool // IsTransientError is used if nil.
+}
+
+var transientMessages = []string{
+	"bad connection",
+	"invalid connection",
+	"broken pipe",
+	"connection reset",
+	"connection refused",
+	"server closed the connection",
+	"terminating connection",
+	"the database system is shutting down",
+}
+
+// IsTransientError reports if the error is a lost or refused connection, which may succeed on another one.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, sqldriver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, m := range transientMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the delay before the retry, the exponential backoff is jittered between half and all of it.
+func (p *RetryPolicy) delay(retry int) time.Duration {
+	d, max := p.BaseDelay, p.MaxDelay
+	if d <= 0 {
+		d = 50 * time.Millisecond
+	}
+	if max <= 0 {
+		max = time.Second
+	}
+	for i := 1; i < retry && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (p *RetryPolicy) query(run func() (*sql.Rows, error)) (*sql.Rows, error) {
+	attempts := p.MaxAttempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	isTransient := p.IsTransient
+	if isTransient == nil {
+		isTransient = IsTransientError
+	}
+	for retry := 1; ; retry++ {
+		rows, err := run()
+		if err == nil || retry >= attempts || !isTransient(err) {
+			return rows, err
+		}
+		time.Sleep(p.delay(retry))
+	}
+}
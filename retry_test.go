@@ -0,0 +1,55 @@
+package qbs
+
+import (
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestIsTransientError(t *testing.T) {
+	assert := NewAssert(t)
+	assert.True(IsTransientError(sqldriver.ErrBadConn))
+	assert.True(IsTransientError(fmt.Errorf("query: %w", sqldriver.ErrBadConn)))
+	assert.True(IsTransientError(errors.New("read tcp 10.0.0.1:5432: connection reset by peer")))
+	assert.True(IsTransientError(errors.New("pq: terminating connection due to administrator command")))
+	assert.True(!IsTransientError(errors.New("pq: syntax error at or near \"SELEC\"")))
+	assert.True(!IsTransientError(nil))
+}
+
+func TestRetryPolicy(t *testing.T) {
+	assert := NewAssert(t)
+	p := &RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: 4 * time.Millisecond}
+	for retry := 1; retry < 6; retry++ {
+		d := p.delay(retry)
+		assert.True(d >= time.Millisecond/2 && d <= 4*time.Millisecond, d)
+	}
+	attempts := 0
+	_, err := p.query(func() (*sql.Rows, error) {
+		attempts++
+		return nil, sqldriver.ErrBadConn
+	})
+	assert.Equal(sqldriver.ErrBadConn, err)
+	assert.Equal(3, attempts)
+
+	attempts = 0
+	_, err = p.query(func() (*sql.Rows, error) {
+		attempts++
+		if attempts < 2 {
+			return nil, sqldriver.ErrBadConn
+		}
+		return nil, nil
+	})
+	assert.Nil(err)
+	assert.Equal(2, attempts)
+
+	attempts = 0
+	_, err = p.query(func() (*sql.Rows, error) {
+		attempts++
+		return nil, sql.ErrNoRows
+	})
+	assert.Equal(sql.ErrNoRows, err)
+	assert.Equal(1, attempts)
+}
@@ -0,0 +1,53 @@
+package qbs
+
+import (
+	"reflect"
+)
+
+// Result describes the last row written by Save, Update or Delete.
+type Result struct {
+	RowsAffected int64
+	LastInsertId int64    // The int64 primary key of the row inserted by Save, 0 otherwise.
+	Returned     []string // The columns read back into the struct by Returning.
+}
+
+// LastResult returns the result of the last Save, Update or Delete.
+func (q *Qbs) LastResult() Result {
+	return q.lastResult
+}
+
+// Returning makes the next Save or Update read all the columns of the written row back into the struct
+// in the same round trip by a RETURNING clause, e.g. the defaults, serials and values set by triggers.
+// It is supported by postgres and sqlite, other dialects write the row as usual.
+func (q *Qbs) Returning() *Qbs {
+	q.criteria.returning = true
+	return q
+}
+
+// useReturning reports if the statement of the criteria can have the RETURNING clause.
+func (q *Qbs) useReturning() bool {
+	return q.criteria.returning && q.Dialect.returningSql(q.criteria.model) != ""
+}
+
+// execReturning runs the statement with the RETURNING clause and scans the first row returned into the struct,
+// it returns the number of rows returned and the columns.
+func (q *Qbs) execReturning(structPtr interface{}, query string, args []interface{}) (int64, []string, error) {
+	defer q.Reset()
+	query = q.Dialect.substituteMarkers(query + q.Dialect.returningSql(q.criteria.model))
+	rows, err := q.queryOnce(query, args...)
+	if err != nil {
+		return 0, nil, q.updateTxError(err)
+	}
+	defer rows.Close()
+	columns, _ := rows.Columns()
+	var affected int64
+	for rows.Next() {
+		if affected == 0 {
+			if err = q.scanRows(reflect.ValueOf(structPtr), rows); err != nil {
+				return 0, nil, q.updateTxError(err)
+			}
+		}
+		affected++
+	}
+	return affected, columns, q.updateTxError(rows.Err())
+}
@@ -0,0 +1,16 @@
+package qbs
+
+// Sample limits the query to n random rows, ordered by the random function of the database.
+// It reads the whole table, use SamplePercent for large tables.
+func (q *Qbs) Sample(n int) *Qbs {
+	q.criteria.orderBys = append(q.criteria.orderBys, order{q.Dialect.randomSql(), false})
+	q.criteria.limit = n
+	return q
+}
+
+// SamplePercent selects about the percent (0 to 100) of rows, with TABLESAMPLE where supported,
+// otherwise with a random filter, the number of rows varies between queries.
+func (q *Qbs) SamplePercent(percent float64) *Qbs {
+	q.criteria.samplePercent = percent
+	return q
+}
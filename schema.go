@@ -0,0 +1,77 @@
+package qbs
+
+import (
+	"strings"
+)
+
+// schemaNaming qualifies the table names of the base convention with the schema.
+type schemaNaming struct {
+	schema string
+	NamingConvention
+}
+
+func (s schemaNaming) TableName(structName string) string {
+	return s.schema + "." + s.NamingConvention.TableName(structName)
+}
+
+func (s schemaNaming) StructName(tableName string) string {
+	return s.NamingConvention.StructName(strings.TrimPrefix(tableName, s.schema+"."))
+}
+
+// qualify prefixes the table name with the schema of the naming convention if it isn't qualified yet.
+func qualify(table string, naming NamingConvention) string {
+	if s, ok := naming.(schemaNaming); ok && !strings.Contains(table, ".") {
+		return s.schema + "." + table
+	}
+	return table
+}
+
+// splitSchema splits a qualified table name, the schema is empty if the name isn't qualified.
+func splitSchema(table string) (schema, name string) {
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		return table[:i], table[i+1:]
+	}
+	return "", table
+}
+
+// unqualified returns the table name without the schema, which names the indexes, constraints and join aliases of the table.
+func unqualified(table string) string {
+	_, name := splitSchema(table)
+	return name
+}
+
+// qualifiedIndex qualifies the index name with the schema of the table.
+func qualifiedIndex(table, index string) string {
+	if schema, _ := splitSchema(table); schema != "" {
+		return schema + "." + index
+	}
+	return index
+}
+
+// WithSchema makes the Qbs read and write the tables in the schema, e.g. the schema of a tenant,
+// the tables are referenced as "tenant_a"."article" instead of the search path or the database of the connection.
+// Tables named by TableNamer with a schema already, like "audit.log", are kept.
+func (q *Qbs) WithSchema(schema string) *Qbs {
+	q.schema = schema
+	return q
+}
+
+// WithSchema makes the migration create and alter the tables in the schema, CreateTableIfNotExists creates the schema
+// if it doesn't exist.
+func (mg *Migration) WithSchema(schema string) *Migration {
+	mg.schema = schema
+	return mg
+}
+
+// createSchemaIfNotExists creates the schema of the table if it's qualified and the dialect supports creating schemas.
+func (mg *Migration) createSchemaIfNotExists(table string) {
+	schema, _ := splitSchema(table)
+	if schema == "" {
+		return
+	}
+	if sql := mg.dialect.createSchemaSql(schema); sql != "" {
+		if err := mg.exec(sql); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Package schematest provides assertions on the tables, columns and indexes in the database,
+// for tests of migrations.
+package schematest
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/coocood/qbs"
+)
+
+// AssertTable fails the test if the table doesn't exist.
+// The table parameter can be either a string or a struct pointer.
+func AssertTable(t testing.TB, mg *qbs.Migration, table interface{}) {
+	t.Helper()
+	if len(mg.ColumnsInTable(table)) == 0 {
+		t.Errorf("table %v doesn't exist", tableName(table))
+	}
+}
+
+// ColumnType is the type of a column expected by AssertColumn, the data types of the dialects are mapped
+// to the Go types of the fields like by qbs.GenerateModels.
+type ColumnType string
+
+const (
+	TypeBool  ColumnType = "bool"
+	TypeInt   ColumnType = "int64"
+	TypeFloat ColumnType = "float64"
+	TypeText  ColumnType = "string"
+	TypeTime  ColumnType = "time.Time"
+	TypeBytes ColumnType = "[]byte"
+)
+
+// Nullability is whether a column expected by AssertColumn allows NULL.
+type Nullability bool
+
+const (
+	NotNull  Nullability = false
+	Nullable Nullability = true
+)
+
+// ColumnOption is a ColumnType or a Nullability expected of the column by AssertColumn.
+type ColumnOption interface {
+	checkColumn(c *qbs.ColumnMeta) string
+}
+
+func (typ ColumnType) checkColumn(c *qbs.ColumnMeta) string {
+	if ColumnType(c.GoType()) != typ {
+		return fmt.Sprintf("has type %v, expected %v", c.DataType, typ)
+	}
+	return ""
+}
+
+func (nullable Nullability) checkColumn(c *qbs.ColumnMeta) string {
+	if c.Nullable && !bool(nullable) {
+		return "is nullable, expected NOT NULL"
+	}
+	if !c.Nullable && bool(nullable) {
+		return "is NOT NULL, expected nullable"
+	}
+	return ""
+}
+
+// AssertColumn fails the test if the column doesn't exist in the table, or doesn't have the type and nullability
+// of the options, e.g. AssertColumn(t, mg, "article", "content", TypeText, NotNull).
+func AssertColumn(t testing.TB, mg *qbs.Migration, table interface{}, column string, options ...ColumnOption) {
+	t.Helper()
+	if len(options) == 0 {
+		if !hasColumn(mg, table, column) {
+			t.Errorf("table %v has no column %v, columns: %v", tableName(table), column, mg.ColumnsInTable(table))
+		}
+		return
+	}
+	c, err := mg.Column(table, column)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == nil {
+		t.Errorf("table %v has no column %v, columns: %v", tableName(table), column, mg.ColumnsInTable(table))
+		return
+	}
+	for _, option := range options {
+		if failure := option.checkColumn(c); failure != "" {
+			t.Errorf("column %v of table %v %v", column, tableName(table), failure)
+		}
+	}
+}
+
+// AssertNoColumn fails the test if the column exists in the table.
+func AssertNoColumn(t testing.TB, mg *qbs.Migration, table interface{}, column string) {
+	t.Helper()
+	if hasColumn(mg, table, column) {
+		t.Errorf("table %v still has column %v", tableName(table), column)
+	}
+}
+
+// AssertColumns fails the test if the columns of the table are not exactly the columns, in any order.
+func AssertColumns(t testing.TB, mg *qbs.Migration, table interface{}, columns ...string) {
+	t.Helper()
+	actual := mg.ColumnsInTable(table)
+	missing := map[string]bool{}
+	for _, column := range columns {
+		missing[column] = true
+	}
+	for _, column := range actual {
+		delete(missing, column)
+	}
+	if len(missing) > 0 || len(actual) != len(columns) {
+		t.Errorf("table %v has columns %v, expected %v", tableName(table), actual, columns)
+	}
+}
+
+// AssertIndex fails the test if the index of the name given to CreateIndexIfNotExists doesn't exist on the table.
+func AssertIndex(t testing.TB, mg *qbs.Migration, table interface{}, name string) {
+	t.Helper()
+	if !mg.IndexExists(table, name) {
+		t.Errorf("table %v has no index %v", tableName(table), name)
+	}
+}
+
+func hasColumn(mg *qbs.Migration, table interface{}, column string) bool {
+	for _, c := range mg.ColumnsInTable(table) {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+func tableName(table interface{}) string {
+	if name, ok := table.(string); ok {
+		return name
+	}
+	return reflect.TypeOf(table).Elem().Name()
+}
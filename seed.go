@@ -0,0 +1,73 @@
+package qbs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SeedTable is the table recording the seeds applied by RunSeeds in each environment.
+var SeedTable = "qbs_seed"
+
+type seedRecord struct {
+	Id      int64
+	Name    string    `qbs:"size:255"`
+	Env     string    `qbs:"size:64"`
+	Applied time.Time `qbs:"created"`
+}
+
+func (*seedRecord) TableName() string {
+	return SeedTable
+}
+
+func (*seedRecord) Indexes(indexes *Indexes) {
+	indexes.AddUnique("name", "env")
+}
+
+type seed struct {
+	name string
+	fn   func(q *Qbs) error
+}
+
+// Seed adds the named seed of reference data, like countries, roles or the admin user, which RunSeeds applies
+// in the order added. The name is recorded in the SeedTable, so it shouldn't change once the seed is applied.
+func (mg *Migration) Seed(name string, fn func(q *Qbs) error) *Migration {
+	for _, s := range mg.seeds {
+		if s.name == name {
+			panic("seed " + name + " is added twice")
+		}
+	}
+	mg.seeds = append(mg.seeds, seed{name, fn})
+	return mg
+}
+
+// RunSeeds applies the seeds not applied in the environment yet, like "development" or "production",
+// each in a transaction recording it in the SeedTable, so a seed is applied exactly once per environment.
+// The seeds run while holding the lock of the SeedTable, and it stops at the first seed returning an error.
+func (mg *Migration) RunSeeds(env string) error {
+	if mg.dryRun != nil {
+		return errors.New("seeds can not be dry run")
+	}
+	return mg.WithLock(SeedTable, func(mg *Migration) error {
+		if err := mg.CreateTableIfNotExists(new(seedRecord)); err != nil {
+			return err
+		}
+		q := mg.newQbs()
+		for _, s := range mg.seeds {
+			if q.Condition(NewEqualCondition("name", s.name).AndEqual("env", env)).Count(new(seedRecord)) > 0 {
+				continue
+			}
+			err := q.Transaction(func(tx *Qbs) error {
+				if err := s.fn(tx); err != nil {
+					return err
+				}
+				_, err := tx.Save(&seedRecord{Name: s.name, Env: env})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("seed %v: %v", s.name, err)
+			}
+		}
+		return nil
+	})
+}
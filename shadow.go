@@ -0,0 +1,153 @@
+package qbs
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+type ShadowMode int
+
+const (
+	// ShadowSync mirrors a write before the write method returns.
+	ShadowSync ShadowMode = iota
+	// ShadowAsync mirrors writes in order in a background goroutine.
+	ShadowAsync
+)
+
+// ShadowStats counts the writes mirrored to a shadow database.
+type ShadowStats struct {
+	Writes      int64 // mirrored writes
+	Errors      int64 // mirrored writes failed on the shadow
+	Divergences int64 // mirrored writes affected a different number of rows on the shadow
+}
+
+type shadowWriter struct {
+	q     *Qbs
+	mode  ShadowMode
+	ops   chan func()
+	done  chan struct{}
+	stats ShadowStats
+}
+
+// SetShadow mirrors every successful Save, Update, Delete, Restore, BulkInsert, BulkUpdate, Archive and
+// ApplyRetention to the other Qbs, which usually works on a new database or a new table version, so it can be
+// validated before cutover. The statements run by Exec and the changes of a Migration are not mirrored.
+// Writes are mirrored as they are issued, a rolled back transaction on q is not rolled back on the shadow.
+// The other Qbs must not be used elsewhere, call SetShadow(nil, mode) or Close to stop mirroring,
+// which waits for pending asynchronous writes.
+func (q *Qbs) SetShadow(other *Qbs, mode ShadowMode) {
+	if q.shadow != nil {
+		q.shadow.stop()
+		q.shadow = nil
+	}
+	if other == nil {
+		return
+	}
+	s := &shadowWriter{q: other, mode: mode}
+	if mode == ShadowAsync {
+		s.ops = make(chan func(), 1024)
+		s.done = make(chan struct{})
+		go func() {
+			for op := range s.ops {
+				op()
+			}
+			close(s.done)
+		}()
+	}
+	q.shadow = s
+}
+
+// ShadowStats returns the counters of the current shadow.
+func (q *Qbs) ShadowStats() ShadowStats {
+	if q.shadow == nil {
+		return ShadowStats{}
+	}
+	return ShadowStats{
+		Writes:      atomic.LoadInt64(&q.shadow.stats.Writes),
+		Errors:      atomic.LoadInt64(&q.shadow.stats.Errors),
+		Divergences: atomic.LoadInt64(&q.shadow.stats.Divergences),
+	}
+}
+
+func (s *shadowWriter) stop() {
+	if s.ops != nil {
+		close(s.ops)
+		<-s.done
+	}
+}
+
+// mirror runs the write on the shadow Qbs with a copy of the struct the primary has written,
+// under the condition and the options of the criteria of the primary write.
+func (s *shadowWriter) mirror(structPtr interface{}, condition *Condition, crit *criteria, affected int64,
+	write func(q *Qbs, structPtr interface{}) (int64, error)) {
+	structCopy := reflect.New(reflect.TypeOf(structPtr).Elem())
+	structCopy.Elem().Set(reflect.ValueOf(structPtr).Elem())
+	omitFields, includeZero, unscoped := crit.omitFields, crit.includeZero, crit.unscoped
+	s.run(affected, func(q *Qbs) (int64, error) {
+		q.criteria.condition = condition
+		q.criteria.omitFields = omitFields
+		q.criteria.includeZero = includeZero
+		q.criteria.unscoped = unscoped
+		return write(q, structCopy.Interface())
+	})
+}
+
+// mirrorRows runs the bulk write on the shadow Qbs with copies of the structs of the slice the primary has written.
+func (s *shadowWriter) mirrorRows(sliceOfStructPtr interface{}, affected int64,
+	write func(q *Qbs, sliceOfStructPtr interface{}) (int64, error)) {
+	sliceValue := reflect.ValueOf(sliceOfStructPtr)
+	copies := reflect.MakeSlice(sliceValue.Type(), sliceValue.Len(), sliceValue.Len())
+	for i := 0; i < sliceValue.Len(); i++ {
+		copies.Index(i).Set(copyRow(sliceValue.Index(i)))
+	}
+	s.run(affected, func(q *Qbs) (int64, error) {
+		return write(q, copies.Interface())
+	})
+}
+
+// run runs the write on the shadow Qbs and counts it, before it returns or in order in the background.
+func (s *shadowWriter) run(affected int64, write func(q *Qbs) (int64, error)) {
+	op := func() {
+		atomic.AddInt64(&s.stats.Writes, 1)
+		shadowAffected, err := write(s.q)
+		s.q.Reset()
+		if err != nil {
+			atomic.AddInt64(&s.stats.Errors, 1)
+			if errorLogger != nil {
+				errorLogger.Println("shadow:", err)
+			}
+		} else if shadowAffected != affected {
+			atomic.AddInt64(&s.stats.Divergences, 1)
+		}
+	}
+	if s.ops != nil {
+		s.ops <- op
+	} else {
+		op()
+	}
+}
+
+func shadowSave(q *Qbs, structPtr interface{}) (int64, error) {
+	return q.Save(structPtr)
+}
+
+func shadowUpdate(q *Qbs, structPtr interface{}) (int64, error) {
+	return q.Update(structPtr)
+}
+
+func shadowDelete(q *Qbs, structPtr interface{}) (int64, error) {
+	return q.Delete(structPtr)
+}
+
+func shadowRestore(q *Qbs, structPtr interface{}) (int64, error) {
+	return q.Restore(structPtr)
+}
+
+func shadowBulkInsert(q *Qbs, sliceOfStructPtr interface{}) (int64, error) {
+	err := q.BulkInsert(sliceOfStructPtr)
+	return int64(reflect.ValueOf(sliceOfStructPtr).Len()), err
+}
+
+func shadowBulkUpdate(q *Qbs, sliceOfStructPtr interface{}) (int64, error) {
+	return q.BulkUpdate(sliceOfStructPtr)
+}
@@ -0,0 +1,38 @@
+package qbs
+
+import (
+	"testing"
+)
+
+func TestShadowMirrorCriteria(t *testing.T) {
+	assert := NewAssert(t)
+	s := &shadowWriter{q: &Qbs{criteria: new(criteria)}}
+	var mirrored criteria
+	write := func(q *Qbs, structPtr interface{}) (int64, error) {
+		mirrored = *q.criteria
+		return 1, nil
+	}
+	crit := &criteria{omitFields: []string{"Name"}, includeZero: []string{"State"}, unscoped: true}
+	s.mirror(&basic{Id: 3}, nil, crit, 1, write)
+	assert.Equal("[Name]", mirrored.omitFields)
+	assert.Equal("[State]", mirrored.includeZero)
+	assert.True(mirrored.unscoped)
+	assert.Equal(1, s.stats.Writes)
+	assert.Equal(0, s.stats.Divergences)
+}
+
+func TestShadowMirrorRows(t *testing.T) {
+	assert := NewAssert(t)
+	s := &shadowWriter{q: &Qbs{criteria: new(criteria)}}
+	rows := []*basic{{Id: 1, Name: "a"}, {Id: 2, Name: "b"}}
+	var mirrored []*basic
+	s.mirrorRows(rows, 2, func(q *Qbs, sliceOfStructPtr interface{}) (int64, error) {
+		mirrored = sliceOfStructPtr.([]*basic)
+		return 1, nil
+	})
+	assert.Equal(2, len(mirrored))
+	assert.True(mirrored[0] != rows[0])
+	assert.Equal("b", mirrored[1].Name)
+	assert.Equal(1, s.stats.Writes)
+	assert.Equal(1, s.stats.Divergences)
+}
@@ -0,0 +1,250 @@
+package qbs
+
+import (
+	"database/sql"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ShardRouter decides which registered shard a model or a query belongs to.
+// An empty shard name means the router can't tell, the database of the Qbs is used then.
+type ShardRouter interface {
+	// ShardForModel extracts the shard key from the struct pointer passed to Save, Find, Update or Delete.
+	ShardForModel(structPtr interface{}) string
+
+	// ShardForCondition extracts the shard key from the where clause of a query on the table.
+	ShardForCondition(table string, condition *Condition) string
+}
+
+var shardRouter ShardRouter
+var shards = make(map[string]*database)
+var shardsMu = new(sync.RWMutex)
+
+//Register a shard by name, the name is what the ShardRouter returns.
+func RegisterShard(name, driverName, driverSourceName string, dialect Dialect) {
+	database, err := sql.Open(driverName, driverSourceName)
+	if err != nil {
+		panic(err)
+	}
+	RegisterShardWithDb(name, database, dialect)
+}
+
+func RegisterShardWithDb(name string, database *sql.DB, dialect Dialect) {
+	shardsMu.Lock()
+	defer shardsMu.Unlock()
+	shards[name] = databaseOf(database, dialect)
+	shards[name].cacheName = "shard:" + name
+}
+
+//Set the router used by Save, Find, Update, Delete and FindAllShards, nil disables shard routing.
+func SetShardRouter(router ShardRouter) {
+	shardRouter = router
+}
+
+func getShard(name string) *database {
+	shardsMu.RLock()
+	defer shardsMu.RUnlock()
+	d, ok := shards[name]
+	if !ok {
+		panic("shard " + name + " has not been registered, should call RegisterShard first.")
+	}
+	return d
+}
+
+// route points the Qbs to the database the model is routed to by UseDatabase, or else to the shard of
+// the struct pointer or the current condition, or back to its own database if neither applies.
+// It does nothing in a transaction, as a transaction can't span databases.
+func (q *Qbs) route(structPtr interface{}) {
+	if q.tx != nil || q.pinned {
+		return
+	}
+	q.unroute()
+	d := modelDatabase(structPtr)
+	if d == nil && shardRouter != nil {
+		name := ""
+		if q.criteria.condition != nil {
+			name = shardRouter.ShardForCondition(namedTableName(structPtr, q.naming()), q.criteria.condition)
+		}
+		if name == "" {
+			name = shardRouter.ShardForModel(structPtr)
+		}
+		if name != "" {
+			d = getShard(name)
+		}
+	}
+	if d != nil {
+		q.routedFrom = q.database
+		q.database = d
+		q.Dialect = d.dialect
+	}
+}
+
+// routeTable routes the table parameter of Count and the aggregates, which is either a struct pointer routed
+// like route, or a table name queried on the database of the Qbs.
+func (q *Qbs) routeTable(table interface{}) {
+	if _, ok := table.(string); !ok {
+		q.route(table)
+	} else if q.tx == nil && !q.pinned {
+		q.unroute()
+	}
+}
+
+// unroute points the Qbs back to its own database.
+func (q *Qbs) unroute() {
+	if q.routedFrom != nil {
+		q.database = q.routedFrom
+		q.Dialect = q.database.dialect
+		q.routedFrom = nil
+	}
+}
+
+// shardQbs returns a Qbs querying the shard of the name for FindAllShards, which is pinned to the shard,
+// so neither UseDatabase nor the ShardRouter send its query to another database.
+func (q *Qbs) shardQbs(name string) *Qbs {
+	sub := new(Qbs)
+	sub.Log = q.Log
+	sub.LogLevel = q.LogLevel
+	sub.LogOutput = q.LogOutput
+	sub.LogJSON = q.LogJSON
+	sub.Logger = q.Logger
+	sub.Retry = q.Retry
+	sub.database = getShard(name)
+	sub.Dialect = sub.database.dialect
+	sub.pinned = true
+	sub.criteria = new(criteria)
+	return sub
+}
+
+// FindAllShards runs the query on every registered shard concurrently and merges the rows.
+// The merged rows are ordered by the OrderBy/OrderByDesc columns, limit and offset are applied
+// to the merged result.
+func (q *Qbs) FindAllShards(ptrOfSliceOfStructPtr interface{}) error {
+	defer q.Reset()
+	shardsMu.RLock()
+	names := make([]string, 0, len(shards))
+	for name := range shards {
+		names = append(names, name)
+	}
+	shardsMu.RUnlock()
+	sort.Strings(names)
+
+	sliceValue := reflect.Indirect(reflect.ValueOf(ptrOfSliceOfStructPtr))
+	limit, offset := q.criteria.limit, q.criteria.offset
+	results := make([]reflect.Value, len(names))
+	errs := make([]error, len(names))
+	wg := new(sync.WaitGroup)
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			sub := q.shardQbs(name)
+			c := *q.criteria
+			if limit > 0 {
+				c.limit = limit + offset
+			}
+			c.offset = 0
+			sub.criteria = &c
+			part := reflect.New(sliceValue.Type())
+			errs[i] = sub.FindAll(part.Interface())
+			results[i] = part.Elem()
+		}(i, name)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	merged := reflect.MakeSlice(sliceValue.Type(), 0, 0)
+	for _, part := range results {
+		merged = reflect.AppendSlice(merged, part)
+	}
+	if len(q.criteria.orderBys) > 0 {
+		orders := q.criteria.orderBys
+		sort.SliceStable(merged.Interface(), func(i, j int) bool {
+			a, b := merged.Index(i).Elem(), merged.Index(j).Elem()
+			for _, o := range orders {
+				column := unquotePath(o.path)
+				c := compareValues(fieldByColumn(a, column, q.naming()), fieldByColumn(b, column, q.naming()))
+				if c != 0 {
+					return (c < 0) != o.desc
+				}
+			}
+			return false
+		})
+	}
+	if offset > 0 {
+		if offset > merged.Len() {
+			offset = merged.Len()
+		}
+		merged = merged.Slice(offset, merged.Len())
+	}
+	if limit > 0 && limit < merged.Len() {
+		merged = merged.Slice(0, limit)
+	}
+	sliceValue.Set(reflect.AppendSlice(sliceValue, merged))
+	return nil
+}
+
+// unquotePath returns the unquoted column name of a quoted order by path.
+func unquotePath(path string) string {
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		path = path[i+1:]
+	}
+	if len(path) >= 2 && (path[0] == '`' || path[0] == '"') && path[len(path)-1] == path[0] {
+		quote := path[:1]
+		return strings.Replace(path[1:len(path)-1], quote+quote, quote, -1)
+	}
+	return path
+}
+
+// compareValues compares two struct field values of the same type,
+// values of unsupported types are considered equal.
+func compareValues(a, b reflect.Value) int {
+	if !a.IsValid() || !b.IsValid() {
+		return 0
+	}
+	if a.Kind() == reflect.Ptr {
+		if a.IsNil() || b.IsNil() {
+			switch {
+			case a.IsNil() && b.IsNil():
+				return 0
+			case a.IsNil():
+				return -1
+			}
+			return 1
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(a.Int() < b.Int(), a.Int() > b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return compareOrdered(a.Uint() < b.Uint(), a.Uint() > b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return compareOrdered(a.Float() < b.Float(), a.Float() > b.Float())
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case reflect.Bool:
+		return compareOrdered(!a.Bool() && b.Bool(), a.Bool() && !b.Bool())
+	case reflect.Struct:
+		if ta, ok := a.Interface().(time.Time); ok {
+			tb := b.Interface().(time.Time)
+			return compareOrdered(ta.Before(tb), ta.After(tb))
+		}
+	}
+	return 0
+}
+
+func compareOrdered(less, greater bool) int {
+	if less {
+		return -1
+	}
+	if greater {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package qbs
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type nameRouter struct {
+	name string
+}
+
+func (r *nameRouter) ShardForModel(structPtr interface{}) string {
+	return r.name
+}
+
+func (r *nameRouter) ShardForCondition(table string, condition *Condition) string {
+	return ""
+}
+
+func registerTestShard(name string) *database {
+	RegisterShardWithDb(name, new(sql.DB), NewPostgres())
+	return getShard(name)
+}
+
+func unregisterTestShard(name string) {
+	shardsMu.Lock()
+	defer shardsMu.Unlock()
+	delete(shards, name)
+}
+
+func TestShardRoute(t *testing.T) {
+	assert := NewAssert(t)
+	shard := registerTestShard("route_a")
+	defer unregisterTestShard("route_a")
+	router := &nameRouter{"route_a"}
+	SetShardRouter(router)
+	defer SetShardRouter(nil)
+	home := newDatabase(new(sql.DB), NewMysql())
+	q := &Qbs{Dialect: home.dialect, database: home, criteria: new(criteria)}
+
+	q.route(new(basic))
+	assert.True(q.database == shard)
+	assert.True(q.Dialect == shard.dialect)
+	router.name = ""
+	q.route(new(basic))
+	assert.True(q.database == home)
+	assert.True(q.Dialect == home.dialect)
+	assert.True(q.routedFrom == nil)
+}
+
+func TestShardQbsPinned(t *testing.T) {
+	assert := NewAssert(t)
+	shardA := registerTestShard("pinned_a")
+	defer unregisterTestShard("pinned_a")
+	shardB := registerTestShard("pinned_b")
+	defer unregisterTestShard("pinned_b")
+	SetShardRouter(&nameRouter{"pinned_a"})
+	defer SetShardRouter(nil)
+	RegisterDatabaseWithDb("pinned_analytics", new(sql.DB), NewMysql())
+	UseDatabase("pinned_analytics", new(analyticsEvent))
+	defer UseDatabase("", new(analyticsEvent))
+
+	q := &Qbs{criteria: new(criteria)}
+	sub := q.shardQbs("pinned_b")
+	sub.route(new(basic))
+	assert.True(sub.database == shardB)
+	sub.route(new(analyticsEvent))
+	assert.True(sub.database == shardB)
+	assert.True(shardA != shardB)
+}
+
+func TestUnquotePath(t *testing.T) {
+	assert := NewAssert(t)
+	assert.Equal("name", unquotePath("`name`"))
+	assert.Equal("name", unquotePath(`"post"."name"`))
+}
+
+func TestCompareValues(t *testing.T) {
+	assert := NewAssert(t)
+	now := time.Now()
+	assert.Equal(-1, compareValues(reflect.ValueOf(1), reflect.ValueOf(2)))
+	assert.Equal(1, compareValues(reflect.ValueOf("b"), reflect.ValueOf("a")))
+	assert.Equal(0, compareValues(reflect.ValueOf(1.5), reflect.ValueOf(1.5)))
+	assert.Equal(-1, compareValues(reflect.ValueOf(now), reflect.ValueOf(now.Add(time.Second))))
+}
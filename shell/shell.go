@@ -0,0 +1,311 @@
+// Package shell is a REPL for operators to inspect and change the rows of qbs models, which are named by
+// their struct and field names instead of the table and column names.
+//
+//	qbs> describe User
+//	qbs> find User 42
+//	qbs> where User Email LIKE '%@example.com' AND Created > '2024-01-01'
+//	qbs> save User {"Id": 42, "Name": "Alice"}
+//
+// The models are registered by Register, usually in an init function of the package defining them,
+// and a command importing that package and calling Main connects to the database and runs the REPL,
+// like cmd/qbs-shell.
+package shell
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/coocood/qbs"
+)
+
+// Limit is the maximum number of rows printed by where.
+var Limit = 100
+
+var models = make(map[string]reflect.Type)
+var modelsMu = new(sync.RWMutex)
+
+// Register makes the models of the struct pointers available to the REPL by their struct names.
+func Register(structPtrs ...interface{}) {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	for _, structPtr := range structPtrs {
+		t := reflect.TypeOf(structPtr)
+		if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+			panic(fmt.Sprintf("%T is not a struct pointer", structPtr))
+		}
+		models[t.Elem().Name()] = t.Elem()
+	}
+}
+
+// Main connects to the database of the -driver, -dsn and -db flags with the dialect registered by the driver name,
+// and runs the REPL on the standard input and output.
+func Main() {
+	driver := flag.String("driver", "mysql", "database/sql driver name")
+	dsn := flag.String("dsn", "", "data source name")
+	dbName := flag.String("db", "", "database name")
+	flag.Parse()
+	dialect := qbs.DialectByName(*driver)
+	if dialect == nil {
+		fmt.Fprintf(os.Stderr, "no dialect of driver %v, the dialects are %v\n", *driver, qbs.DialectNames())
+		os.Exit(2)
+	}
+	qbs.Register(*driver, *dsn, *dbName, dialect)
+	q, err := qbs.GetQbs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer q.Close()
+	if err = Run(q, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Run reads the commands from in and writes their results to out until in ends or the quit command.
+// The errors of the commands are written to out, only the errors reading in or writing out are returned.
+func Run(q *qbs.Qbs, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		if _, err := io.WriteString(out, "qbs> "); err != nil {
+			return err
+		}
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "quit" || line == "exit" {
+			return nil
+		}
+		if line == "" {
+			continue
+		}
+		if err := exec(q, out, line); err != nil {
+			if _, err = fmt.Fprintln(out, "error:", err); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+const help = `models                      list the registered models
+describe Model              list the fields of the model and their columns
+find Model pk               print the row of the primary key
+where Model condition       print the rows matching the condition, fields are named like Email or CreatedAt
+save Model {"Field": ...}   save the JSON fields, over the fields of the row of the primary key if it is given
+quit
+`
+
+func exec(q *qbs.Qbs, out io.Writer, line string) error {
+	command, args := split(line)
+	if command == "help" {
+		_, err := io.WriteString(out, help)
+		return err
+	}
+	if command == "models" {
+		for _, name := range modelNames() {
+			fmt.Fprintln(out, name)
+		}
+		return nil
+	}
+	name, args := split(args)
+	model := lookup(name)
+	if model == nil {
+		return fmt.Errorf("no model %v, the models are %v", name, modelNames())
+	}
+	switch command {
+	case "describe":
+		describe(q, out, model)
+		return nil
+	case "find":
+		structPtr, err := find(q, model, args)
+		if err != nil {
+			return err
+		}
+		return printRow(out, structPtr, true)
+	case "where":
+		if args == "" {
+			return errors.New("no condition")
+		}
+		rows := reflect.New(reflect.SliceOf(reflect.PtrTo(model)))
+		if err := q.Where(columns(q, model, args)).Limit(Limit).FindAll(rows.Interface()); err != nil {
+			return err
+		}
+		for i := 0; i < rows.Elem().Len(); i++ {
+			if err := printRow(out, rows.Elem().Index(i).Interface(), false); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(out, "(%d rows)\n", rows.Elem().Len())
+		return err
+	case "save":
+		return save(q, out, model, args)
+	}
+	return fmt.Errorf("unknown command %v, type help for the commands", command)
+}
+
+func split(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if i := strings.IndexFunc(line, unicode.IsSpace); i >= 0 {
+		return line[:i], strings.TrimSpace(line[i:])
+	}
+	return line, ""
+}
+
+func modelNames() []string {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookup returns the model of the struct name, ignoring the case.
+func lookup(name string) reflect.Type {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	for modelName, model := range models {
+		if strings.EqualFold(modelName, name) {
+			return model
+		}
+	}
+	return nil
+}
+
+// describe writes the fields of the model with their columns, types and qbs tags, then the joined fields.
+func describe(q *qbs.Qbs, out io.Writer, model reflect.Type) {
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+	meta := q.Describe(reflect.New(model).Interface())
+	fmt.Fprintf(w, "%v: table %v\n", model.Name(), meta.Table)
+	for _, field := range meta.Fields {
+		fmt.Fprintf(w, "  %-20v %-20v %-16v %v\n", field.Name, field.Column, field.Type, field.Tag.Get(qbs.TagKey))
+	}
+	for i := 0; i < model.NumField(); i++ {
+		field := model.Field(i)
+		if field.PkgPath == "" && meta.Field(field.Name) == nil && field.Tag.Get(qbs.TagKey) != "-" &&
+			field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct {
+			fmt.Fprintf(w, "  %-20v %-20v %-16v %v\n", field.Name, "(joined)", field.Type, field.Tag.Get(qbs.TagKey))
+		}
+	}
+}
+
+func find(q *qbs.Qbs, model reflect.Type, pk string) (interface{}, error) {
+	structPtr := reflect.New(model)
+	pks := q.Describe(structPtr.Interface()).Pks
+	if len(pks) == 0 {
+		return nil, errors.New("no primary key field of " + model.Name())
+	}
+	if len(pks) > 1 {
+		return nil, errors.New(model.Name() + " has a composite primary key, use where instead")
+	}
+	if pk == "" {
+		return nil, errors.New("no primary key value")
+	}
+	field := pks[0]
+	value := structPtr.Elem().FieldByIndex(field.Index)
+	if err := json.Unmarshal([]byte(pk), value.Addr().Interface()); err != nil {
+		if field.Type.Kind() != reflect.String {
+			return nil, err
+		}
+		value.SetString(pk) //an unquoted string key.
+	}
+	err := q.Find(structPtr.Interface()) //the condition is inferred from the primary key.
+	return structPtr.Interface(), err
+}
+
+// save saves the fields of the JSON object, over the row of the primary key if the object has one.
+func save(q *qbs.Qbs, out io.Writer, model reflect.Type, object string) error {
+	structPtr := reflect.New(model)
+	if err := json.Unmarshal([]byte(object), structPtr.Interface()); err != nil {
+		return err
+	}
+	if pks := q.Describe(structPtr.Interface()).Pks; len(pks) == 1 && !structPtr.Elem().FieldByIndex(pks[0].Index).IsZero() {
+		pk, _ := json.Marshal(structPtr.Elem().FieldByIndex(pks[0].Index).Interface())
+		found, err := find(q, model, string(pk))
+		if err == nil {
+			structPtr = reflect.ValueOf(found)
+			if err = json.Unmarshal([]byte(object), structPtr.Interface()); err != nil {
+				return err
+			}
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+	}
+	affected, err := q.Save(structPtr.Interface())
+	if err != nil {
+		return err
+	}
+	if err = printRow(out, structPtr.Interface(), true); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "(%d rows affected)\n", affected)
+	return err
+}
+
+func printRow(out io.Writer, structPtr interface{}, indent bool) error {
+	var b []byte
+	var err error
+	if indent {
+		b, err = json.MarshalIndent(structPtr, "", "  ")
+	} else {
+		b, err = json.Marshal(structPtr)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s\n", b)
+	return err
+}
+
+// columns replaces the field names of the model in the condition by their column names,
+// the quoted strings of the condition are kept.
+func columns(q *qbs.Qbs, model reflect.Type, condition string) string {
+	meta := q.Describe(reflect.New(model).Interface())
+	var b strings.Builder
+	runes := []rune(condition)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\'' || r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end < len(runes) {
+				end++
+			}
+			b.WriteString(string(runes[i:end]))
+			i = end
+		case unicode.IsLetter(r) || r == '_':
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			word := string(runes[i:end])
+			if field := meta.Field(word); field != nil {
+				word = field.Column
+			}
+			b.WriteString(word)
+			i = end
+		default:
+			b.WriteRune(r)
+			i++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,66 @@
+package shell
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coocood/qbs"
+)
+
+type shellUser struct {
+	Id        int64
+	Email     string `qbs:"size:255,unique"`
+	CreatedAt time.Time
+}
+
+func (*shellUser) TableName() string {
+	return "users"
+}
+
+func TestColumns(t *testing.T) {
+	q := new(qbs.Qbs)
+	condition := columns(q, reflect.TypeOf(shellUser{}), "Email LIKE 'Email%' AND CreatedAt > ? OR Missing = \"Id\"")
+	expected := "email LIKE 'Email%' AND created_at > ? OR Missing = \"Id\""
+	if condition != expected {
+		t.Errorf("columns are %v, expected %v", condition, expected)
+	}
+}
+
+func TestRun(t *testing.T) {
+	Register(new(shellUser))
+	out := new(bytes.Buffer)
+	in := strings.NewReader("models\ndescribe shellUser\nfind Nobody 1\nfind shellUser\nwhere shellUser\nquit\nmodels\n")
+	if err := Run(new(qbs.Qbs), in, out); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"qbs> shellUser\n",
+		"shellUser: table users\n",
+		"Email                email                string           size:255,unique\n",
+		"error: no model Nobody, the models are [shellUser]\n",
+		"error: no primary key value\n",
+		"error: no condition\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("output doesn't contain %q:\n%v", expected, out)
+		}
+	}
+	if strings.Count(out.String(), "qbs> shellUser\n") != 1 {
+		t.Errorf("the commands after quit are run:\n%v", out)
+	}
+}
+
+type shellMembership struct {
+	UserId  int64 `qbs:"pk"`
+	GroupId int64 `qbs:"pk"`
+}
+
+func TestFindCompositeKey(t *testing.T) {
+	_, err := find(new(qbs.Qbs), reflect.TypeOf(shellMembership{}), "1")
+	if err == nil || !strings.Contains(err.Error(), "composite primary key") {
+		t.Errorf("find of a composite key: %v", err)
+	}
+}
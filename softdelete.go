@@ -0,0 +1,125 @@
+package qbs
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Unscoped includes soft deleted rows in the next query, and makes the next Delete remove rows
+// instead of setting their `qbs:"deleted"` timestamp.
+func (q *Qbs) Unscoped() *Qbs {
+	q.criteria.unscoped = true
+	return q
+}
+
+// Restore clears the `qbs:"deleted"` timestamp of soft deleted rows, the condition can be inferred
+// by the Id value of the struct.
+func (q *Qbs) Restore(structPtr interface{}) (affected int64, err error) {
+	if q.Auditor != nil && q.tx == nil { //the change and its audit are committed together.
+		err = q.Transaction(func(tx *Qbs) error {
+			affected, err = tx.Restore(structPtr)
+			return err
+		})
+		return
+	}
+	q.route(structPtr)
+	model := structPtrToNamedModel(structPtr, false, nil, q.naming())
+	deleted := model.deletedField()
+	if deleted == nil {
+		panic("no deleted field to restore")
+	}
+	q.criteria.model = model
+	q.criteria.mergePkCondition(q.Dialect)
+	if q.criteria.condition == nil {
+		panic("Can not restore without condition")
+	}
+	crit := q.criteria //the criteria is reset after execution.
+	var before []map[string]interface{}
+	if q.Auditor != nil {
+		if before, err = q.auditedRows(model); err != nil {
+			return 0, q.updateTxError(err)
+		}
+	}
+	conditionSql, args := q.criteria.condition.Merge()
+	sql := fmt.Sprintf("UPDATE %v SET %v = NULL WHERE %v",
+		q.Dialect.quote(model.table), q.Dialect.quote(deleted.name), conditionSql)
+	result, err := q.Exec(sql, args...)
+	if err != nil {
+		return 0, err
+	}
+	setDeleted(structPtr, deleted, nil)
+	q.invalidateCached(structPtr, model)
+	invalidateQueries(model.table)
+	if q.Auditor != nil {
+		if err = q.auditUpdated(model, before, map[string]interface{}{deleted.name: nil}); err != nil {
+			return 0, err
+		}
+	}
+	if affected, err = result.RowsAffected(); err == nil && q.shadow != nil {
+		q.shadow.mirror(structPtr, crit.condition, crit, affected, shadowRestore)
+	}
+	return
+}
+
+// softDelete sets the deleted timestamp of the rows of the criteria.
+func (q *Qbs) softDelete(structPtr interface{}, deleted *modelField) (int64, error) {
+	now := time.Now()
+	conditionSql, args := q.criteria.condition.Merge()
+	sql := fmt.Sprintf("UPDATE %v SET %v = ? WHERE %v",
+		q.Dialect.quote(q.criteria.model.table), q.Dialect.quote(deleted.name), conditionSql)
+	result, err := q.Exec(sql, append([]interface{}{now}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	setDeleted(structPtr, deleted, &now)
+	return result.RowsAffected()
+}
+
+// setDeleted sets the deleted field of the struct to t, a nil t is the zero time of a time.Time field.
+func setDeleted(structPtr interface{}, deleted *modelField, t *time.Time) {
+	field := reflect.Indirect(reflect.ValueOf(structPtr)).FieldByName(deleted.camelName)
+	if field.Kind() == reflect.Ptr {
+		field.Set(reflect.ValueOf(t))
+	} else if t == nil {
+		field.Set(reflect.ValueOf(time.Time{}))
+	} else {
+		field.Set(reflect.ValueOf(*t))
+	}
+}
+
+// scopeDeleted excludes soft deleted rows from the query of the criteria unless it is unscoped,
+// the column is qualified by the table name if qualify is true.
+func (q *Qbs) scopeDeleted(qualify bool) {
+	q.criteria.condition = q.scopedCondition(q.criteria.model, qualify)
+}
+
+// tableCondition returns the condition of the criteria for the table of Count and the aggregates,
+// which excludes soft deleted rows if the table is given by a struct pointer. The criteria isn't changed.
+func (q *Qbs) tableCondition(table interface{}) *Condition {
+	if _, ok := table.(string); ok {
+		return q.criteria.condition
+	}
+	t := reflect.TypeOf(table)
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return q.scopedCondition(structPtrToNamedModel(reflect.New(t).Interface(), false, nil, q.naming()), false)
+}
+
+// scopedCondition returns the condition of the criteria excluding the soft deleted rows of the model
+// unless it is unscoped.
+func (q *Qbs) scopedCondition(model *model, qualify bool) *Condition {
+	deleted := model.deletedField()
+	if deleted == nil || q.criteria.unscoped {
+		return q.criteria.condition
+	}
+	expr := q.Dialect.quote(deleted.name) + " IS NULL"
+	if qualify {
+		expr = q.Dialect.quote(model.table) + "." + expr
+	}
+	if q.criteria.condition == nil {
+		return NewCondition(expr)
+	}
+	return NewCondition(expr).AndCondition(q.criteria.condition)
+}
@@ -0,0 +1,76 @@
+package qbs
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+)
+
+// Spill makes Iterate write all the rows to a temporary file before calling the function for them,
+// so the query doesn't hold the connection while the rows are processed, e.g. by a migration writing
+// to the same database over a huge table, and the memory is bounded by one row.
+// The struct is encoded by encoding/gob, only its exported fields are kept.
+func (q *Qbs) Spill() *Qbs {
+	q.criteria.spill = true
+	return q
+}
+
+func (q *Qbs) iterateSpilled(structPtr interface{}, do func() error, query string, args []interface{}) error {
+	file, err := ioutil.TempFile("", "qbs-spill-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	n, err := q.spillRows(file, structPtr, query, args)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	rowValue := reflect.ValueOf(structPtr)
+	zero := reflect.Zero(rowValue.Elem().Type())
+	dec := gob.NewDecoder(bufio.NewReader(file))
+	for i := 0; i < n; i++ {
+		rowValue.Elem().Set(zero) //gob doesn't encode zero fields.
+		if err = dec.Decode(structPtr); err != nil {
+			return err
+		}
+		if err = do(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spillRows writes the rows of the query to the file, it returns the number of rows.
+func (q *Qbs) spillRows(file io.Writer, structPtr interface{}, query string, args []interface{}) (int, error) {
+	rows, err := q.query(query, args...)
+	if err != nil {
+		return 0, q.updateTxError(err)
+	}
+	defer rows.Close()
+	w := bufio.NewWriter(file)
+	enc := gob.NewEncoder(w)
+	rowValue := reflect.ValueOf(structPtr)
+	zero := reflect.Zero(rowValue.Elem().Type())
+	n := 0
+	for rows.Next() {
+		rowValue.Elem().Set(zero)
+		if err = q.scanRows(rowValue, rows); err != nil {
+			return n, err
+		}
+		if err = enc.Encode(structPtr); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err = rows.Err(); err != nil {
+		return n, q.updateTxError(err)
+	}
+	return n, w.Flush()
+}
@@ -0,0 +1,206 @@
+package qbs
+
+import (
+	"container/list"
+	"database/sql"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// StmtCacheStats counts the lookups of the prepared statements cached for a connection pool.
+type StmtCacheStats struct {
+	Hits      int64 // statements found in the cache
+	Misses    int64 // statements prepared
+	Evictions int64 // least recently used statements closed to keep the cache size
+	Size      int   // statements in the cache
+}
+
+var stmtCacheSize int
+var databases = make(map[*sql.DB]*database)
+var databasesMu = new(sync.Mutex)
+
+// Set the maximum number of prepared statements cached for every connection pool, the least recently used
+// statements are closed when it is exceeded. The default 0 means unlimited.
+func SetStmtCacheSize(size int) {
+	databasesMu.Lock()
+	defer databasesMu.Unlock()
+	stmtCacheSize = size
+	for _, d := range databases {
+		d.stmts.resize(size)
+	}
+}
+
+// databaseOf returns the database of the connection pool, so all the Qbs working on it share the prepared statements.
+func databaseOf(sqlDb *sql.DB, dialect Dialect) *database {
+	databasesMu.Lock()
+	defer databasesMu.Unlock()
+	d, ok := databases[sqlDb]
+	if !ok {
+		d = newDatabase(sqlDb, dialect)
+		databases[sqlDb] = d
+	}
+	return d
+}
+
+// StmtCacheStats returns the counters of the statement cache of the connection pool, zero in a transaction of NewFromTx.
+func (q *Qbs) StmtCacheStats() StmtCacheStats {
+	if q.database == nil {
+		return StmtCacheStats{}
+	}
+	return q.database.stmts.statistics()
+}
+
+// Prepare prepares and caches the statements of Find by primary key, inserting by Save and Update
+// for the struct pointers, e.g. at startup, so the first requests don't wait for preparing them.
+// The statements of other queries are prepared when they are first executed.
+func (q *Qbs) Prepare(structPtrs ...interface{}) error {
+	defer q.Reset()
+	for _, structPtr := range structPtrs {
+		for _, query := range q.warmUpSqls(structPtr) {
+			_, cached, err := q.prepare(q.Dialect.substituteMarkers(query))
+			if err != nil {
+				return err
+			}
+			cached.release()
+		}
+	}
+	return nil
+}
+
+// warmUpSqls builds the statements Save would insert a new row of the struct type with,
+// and Find and Update would use when the primary key is given.
+func (q *Qbs) warmUpSqls(structPtr interface{}) []string {
+	zero := reflect.New(reflect.TypeOf(structPtr).Elem()).Interface()
+	model := structPtrToNamedModel(zero, true, nil, q.naming())
+	insertSql, _ := q.Dialect.insertSql(&criteria{model: model})
+	if len(model.pks) == 0 {
+		return []string{insertSql}
+	}
+	for _, pk := range model.pks {
+		switch pk.value.(type) {
+		case string:
+			pk.value = "-"
+		case time.Time:
+			pk.value = time.Unix(1, 0)
+		default:
+			pk.value = reflect.ValueOf(int64(1)).Convert(reflect.TypeOf(pk.value)).Interface()
+		}
+	}
+	q.criteria = &criteria{model: model, limit: 1, condition: model.pkCondition(q.Dialect, true)}
+	q.scopeDeleted(true)
+	findSql, _ := q.Dialect.querySql(q.criteria)
+	q.criteria = &criteria{model: model}
+	q.criteria.mergePkCondition(q.Dialect)
+	q.lockVersion(model)
+	updateSql, _ := q.Dialect.updateSql(q.criteria)
+	return []string{insertSql, findSql, updateSql}
+}
+
+// stmtCache is a LRU cache of prepared statements, a statement evicted while in use is closed when it's released.
+type stmtCache struct {
+	mu      sync.Mutex
+	size    int
+	lru     *list.List
+	entries map[string]*list.Element
+	stats   StmtCacheStats
+}
+
+type cachedStmt struct {
+	cache   *stmtCache
+	query   string
+	stmt    *sql.Stmt
+	users   int
+	evicted bool
+}
+
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{size: size, lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns the cached statement of the query, it must be released after use.
+func (c *stmtCache) get(query string) *cachedStmt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[query]
+	if !ok {
+		return nil
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(e)
+	s := e.Value.(*cachedStmt)
+	s.users++
+	return s
+}
+
+// add caches the statement prepared for the query, it must be released after use.
+// The statement is closed if another one has been cached for the query meanwhile.
+func (c *stmtCache) add(query string, stmt *sql.Stmt) *cachedStmt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Misses++
+	if e, ok := c.entries[query]; ok {
+		stmt.Close()
+		s := e.Value.(*cachedStmt)
+		s.users++
+		return s
+	}
+	s := &cachedStmt{cache: c, query: query, stmt: stmt, users: 1}
+	c.entries[query] = c.lru.PushFront(s)
+	c.evict(c.size)
+	return s
+}
+
+// release closes the statement if it has been evicted and nobody else uses it, it does nothing on nil.
+func (s *cachedStmt) release() {
+	if s == nil {
+		return
+	}
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	s.users--
+	if s.evicted && s.users == 0 {
+		s.stmt.Close()
+	}
+}
+
+func (c *stmtCache) resize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = size
+	c.evict(size)
+}
+
+// clear evicts all the statements.
+func (c *stmtCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// evict removes the least recently used statements until there are at most size, 0 means unlimited.
+func (c *stmtCache) evict(size int) {
+	for size > 0 && c.lru.Len() > size {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *stmtCache) remove(e *list.Element) {
+	s := c.lru.Remove(e).(*cachedStmt)
+	delete(c.entries, s.query)
+	s.evicted = true
+	if s.users == 0 {
+		s.stmt.Close()
+	}
+}
+
+func (c *stmtCache) statistics() StmtCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = c.lru.Len()
+	return stats
+}
@@ -1,5 +1,12 @@
 package qbs
 
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
 type dialectSyntax struct {
 	dialect                         Dialect
 	createTableWithoutPkIfExistsSql string
@@ -134,3 +141,347 @@ func doTestDropTableSQL(assert *Assert, info dialectSyntax) {
 	sql := info.dialect.dropTableSql("drop_table")
 	assert.Equal(info.dropTableIfExistsSql, sql)
 }
+
+func doTestTopNSQL(assert *Assert, dialect Dialect, expected string) {
+	type Comment struct {
+		Id     int64
+		PostId int64
+		Body   string
+	}
+	criteria := &criteria{model: structPtrToModel(new(Comment), false, nil)}
+	criteria.condition = NewCondition("body <> ?", "")
+	sql, args := dialect.topNSql(criteria, "post_id", 3)
+	assert.Equal(expected, sql)
+	assert.Equal(3, len(args))
+}
+
+func doTestAutoDiffSQL(assert *Assert, dialect Dialect, expected []string) {
+	type user struct {
+		Id    int64
+		Name  string `qbs:"size:64"`
+		Age   int32
+		Email string
+	}
+	type userV2 struct {
+		Id      int64
+		Name    string `qbs:"size:128"`
+		Age     int64
+		EmailV2 string
+		Nick    string
+	}
+	mg := &Migration{dialect: dialect}
+	sqls, err := mg.AutoDiff("user", new(user), new(userV2))
+	assert.MustNil(err)
+	assert.Equal(expected, sqls)
+
+	type userV3 struct {
+		Id      int64
+		Name    string `qbs:"size:64"`
+		Age     int32
+		Address string `qbs:"rename_from:email"`
+	}
+	sqls, err = mg.AutoDiff("user", new(user), new(userV3))
+	assert.MustNil(err)
+	assert.Equal(1, len(sqls))
+	assert.Equal(dialect.renameColumnSql("user", "email", *structPtrToModel(new(userV3), false, nil).field("Address")), sqls[0])
+}
+
+func doTestToSQL(assert *Assert, dialect Dialect, expected string) {
+	type comment struct {
+		Id   int64
+		Body string
+	}
+	q := &Qbs{Dialect: dialect, criteria: new(criteria)}
+	sql, args, err := q.Model(new([]*comment)).Where("body = ?", "a").OrderBy("id").Limit(5).ToSQL()
+	assert.MustNil(err)
+	assert.Equal(expected, sql)
+	assert.Equal(2, len(args))
+	_, _, err = q.ToSQL()
+	assert.NotNil(err)
+}
+
+func doTestSampleSQL(assert *Assert, dialect Dialect, expected, expectedPercent string) {
+	type comment struct {
+		Id   int64
+		Body string
+	}
+	q := &Qbs{Dialect: dialect, criteria: new(criteria)}
+	sql, args, _ := q.Model(new([]*comment)).Sample(3).ToSQL()
+	assert.Equal(expected, sql)
+	assert.Equal(1, len(args))
+	sql, _, _ = q.Model(new([]*comment)).Where("body = ?", "a").SamplePercent(10).ToSQL()
+	assert.Equal(expectedPercent, sql)
+}
+
+func doTestDryRunSQL(assert *Assert, dialect Dialect, expected string) {
+	type user struct {
+		Id   int64
+		Name string `qbs:"size:64"`
+	}
+	type userV2 struct {
+		Id   int64
+		Name string `qbs:"size:64"`
+		Nick string
+	}
+	mg := &Migration{dialect: dialect}
+	statements, err := mg.DryRun(func(mg *Migration) error {
+		if err := mg.ApplyAutoDiff("user", new(user), new(userV2)); err != nil {
+			return err
+		}
+		return mg.InsertRow("user", map[string]interface{}{"name": "o'neil", "id": 3})
+	})
+	assert.MustNil(err)
+	assert.Equal(2, len(statements))
+	buf := new(bytes.Buffer)
+	assert.MustNil(WriteScript(buf, statements))
+	assert.Equal(expected, buf.String())
+	assert.Nil(mg.dryRun)
+}
+
+type membership struct {
+	UserId  int64 `qbs:"pk"`
+	GroupId int64 `qbs:"pk"`
+	Role    string
+}
+
+func doTestCompositePkSQL(assert *Assert, dialect Dialect, expectedCreate, expectedUpdate string) {
+	model := structPtrToModel(&membership{2, 3, "admin"}, true, nil)
+	assert.Equal(expectedCreate, dialect.createTableSql(model, false))
+	criteria := &criteria{model: model}
+	criteria.mergePkCondition(dialect)
+	sql, args := dialect.updateSql(criteria)
+	assert.Equal(expectedUpdate, dialect.substituteMarkers(sql))
+	assert.Equal(3, len(args))
+}
+
+func doTestBulkInsertSQL(assert *Assert, dialect Dialect, expected string) {
+	models := []*model{
+		structPtrToModel(&sqlGenModel{3, "a", "b", 6}, false, nil),
+		structPtrToModel(&sqlGenModel{4, "c", "d", 7}, false, nil),
+	}
+	sql, args := dialect.bulkInsertSql(models)
+	assert.Equal(expected, dialect.substituteMarkers(sql))
+	assert.Equal(8, len(args))
+	assert.Equal(1000, dialect.maxBulkInsertRows(4))
+	assert.Equal(655, dialect.maxBulkInsertRows(100))
+}
+
+func doTestGroupBySQL(assert *Assert, dialect Dialect, expected string) {
+	type post struct {
+		AuthorId int64
+	}
+	q := &Qbs{Dialect: dialect, criteria: new(criteria)}
+	sql, args, err := q.Model(new([]*post)).Where("title <> ?", "").GroupBy("author_id").Having("COUNT(*) > ?", 2).OrderBy("author_id").ToSQL()
+	assert.MustNil(err)
+	assert.Equal(expected, sql)
+	assert.Equal(2, len(args))
+}
+
+func doTestWarmUpSQL(assert *Assert, dialect Dialect, expected ...string) {
+	q := &Qbs{Dialect: dialect, criteria: new(criteria)}
+	sqls := q.warmUpSqls(new(sqlGenModel))
+	assert.Equal(len(expected), len(sqls))
+	for i, sql := range sqls {
+		assert.Equal(expected[i], dialect.substituteMarkers(sql))
+	}
+	type reading struct {
+		SensorId int64     `qbs:"pk"`
+		Taken    time.Time `qbs:"pk"`
+		Value    float64
+	}
+	assert.Equal(3, len(q.warmUpSqls(new(reading))))
+}
+
+func doTestIndexSQL(assert *Assert, dialect Dialect, expectedCreate, expectedDrop, expectedRename string, partial bool) {
+	ix := Indexes{}
+	ix.AddUniquePartial("deleted IS NULL", "(lower(email))", "tenant")
+	assert.Equal("lower_email_tenant", ix[0].name)
+	assert.Equal(expectedCreate, dialect.createIndexSql("user_"+ix[0].name, "user", ix[0].unique, ix[0].columns...))
+	assert.Equal(expectedDrop, dialect.dropIndexSql("user", "user_name"))
+	assert.Equal(expectedRename, dialect.renameIndexSql("user", "user_name", "user_full_name"))
+	assert.Equal(partial, dialect.supportsPartialIndex())
+}
+
+type fkAuthor struct {
+	Id   int64
+	Name string
+}
+
+type fkPost struct {
+	Id         int64
+	FkAuthorId int64 `qbs:"fk:FkAuthor,ondelete:setnull,onupdate:cascade"`
+	FkAuthor   *fkAuthor
+}
+
+func doTestForeignKeySQL(assert *Assert, dialect Dialect, expectedCreate, expectedAdd, expectedDrop string) {
+	model := structPtrToModel(new(fkPost), true, nil)
+	assert.Equal(expectedCreate, dialect.createTableSql(model, false))
+	assert.Equal(expectedAdd, dialect.addForeignKeySql(model.table, "fk_post_fk_author_id_fkey", model.refs["FkAuthor"]))
+	assert.Equal(expectedDrop, dialect.dropForeignKeySql(model.table, "fk_post_fk_author_id_fkey"))
+}
+
+func doTestScheduleEventSQL(assert *Assert, dialect Dialect, expectedHourly, expectedDrop string) {
+	sql, args := dialect.scheduleEventSql("purge_sessions", 2*time.Hour, "DELETE FROM session WHERE expired < NOW()")
+	assert.Equal(expectedHourly, fmt.Sprint(sql, " ", args))
+	sql, args = dialect.unscheduleEventSql("purge_sessions")
+	assert.Equal(expectedDrop, fmt.Sprint(sql, " ", args))
+	sql, _ = dialect.scheduleEventSql("purge_sessions", 1500*time.Millisecond, "SELECT 1")
+	assert.Equal("", sql)
+}
+
+func doTestAlterColumnTypeSQL(assert *Assert, dialect Dialect, expected string) {
+	type account struct {
+		Id      int64
+		Balance float64
+	}
+	column := structPtrToModel(new(account), false, nil).field("Balance")
+	assert.Equal(expected, dialect.alterColumnTypeSql("account", *column)[0])
+}
+
+func doTestColTypeSQL(assert *Assert, dialect Dialect, expectedCreate, expectedAdd string) {
+	type invoice struct {
+		Id    string  `qbs:"pk,coltype:char(36)"`
+		Total float64 `qbs:"coltype:decimal(10,2),notnull,default:0"`
+	}
+	model := structPtrToModel(new(invoice), true, nil)
+	assert.Equal(expectedCreate, dialect.createTableSql(model, false))
+	assert.Equal(expectedAdd, dialect.addColumnSql("invoice", *model.field("Total")))
+}
+
+func doTestUUIDPkSQL(assert *Assert, dialect Dialect, expected string) {
+	type device struct {
+		Id   string `qbs:"pk,uuid"`
+		Name string `qbs:"size:64"`
+	}
+	assert.Equal(expected, dialect.createTableSql(structPtrToModel(new(device), true, nil), false))
+}
+
+func doTestTempTableSQL(assert *Assert, dialect Dialect, expectedCreate, expectedDrop string) {
+	type staging struct {
+		Id   int64
+		Name string `qbs:"size:64,index"`
+	}
+	create, drop := dialect.tempTableSql(structPtrToModel(new(staging), true, nil))
+	assert.Equal(expectedCreate, create)
+	assert.Equal(expectedDrop, drop)
+}
+
+func doTestAttachDatabaseSQL(assert *Assert, dialect Dialect, expectedAttach, expectedDetach, expectedCopy string) {
+	opts := AttachOptions{Host: "old-db", Port: 5432, DbName: "shop", User: "app", Password: "it's?"}
+	var attach []string
+	for _, sql := range dialect.attachDatabaseSqls("legacy", opts) {
+		attach = append(attach, dialect.substituteMarkers(sql))
+	}
+	assert.Equal(expectedAttach, strings.Join(attach, "; "))
+	assert.Equal(expectedDetach, strings.Join(dialect.detachDatabaseSqls("legacy"), "; "))
+	mg := &Migration{dialect: dialect}
+	statements, err := mg.DryRun(func(mg *Migration) error {
+		return mg.AttachDatabase("legacy", opts)
+	})
+	if err == nil {
+		assert.Equal(strings.Replace(expectedAttach, "'it''s?'", "'***'", 1), strings.Join(statements, "; "))
+	}
+	type customer struct {
+		Id   int64
+		Name string
+	}
+	statements, err = mg.DryRun(func(mg *Migration) error {
+		return mg.CopyRows(new(customer), "legacy")
+	})
+	assert.MustNil(err)
+	assert.Equal(expectedCopy, strings.Join(statements, "; "))
+}
+
+func doTestReturningSQL(assert *Assert, dialect Dialect, expectedInsert, expectedUpdate string) {
+	type account struct {
+		Id      int64
+		Balance int64 `qbs:"default:100"`
+	}
+	crit := &criteria{model: structPtrToModel(&account{Id: 3, Balance: 5}, true, nil), returning: true}
+	crit.mergePkCondition(dialect)
+	sql, _ := dialect.insertSql(crit)
+	assert.Equal(expectedInsert, dialect.substituteMarkers(sql+dialect.returningSql(crit.model)))
+	sql, _ = dialect.updateSql(crit)
+	assert.Equal(expectedUpdate, dialect.substituteMarkers(sql+dialect.returningSql(crit.model)))
+}
+
+func doTestSchemaSQL(assert *Assert, dialect Dialect, expectedSchema, expectedQuery, expectedDropIndex string) {
+	type writer struct {
+		Id   int64
+		Name string
+	}
+	type essay struct {
+		Id       int64
+		Title    string
+		WriterId int64
+		Writer   *writer
+	}
+	q := new(Qbs).WithSchema("tenant_a")
+	model := structPtrToNamedModel(new(essay), true, nil, q.naming())
+	assert.Equal(expectedSchema, dialect.createSchemaSql("tenant_a"))
+	sql, _ := dialect.querySql(&criteria{model: model})
+	assert.Equal(expectedQuery, sql)
+	assert.Equal(expectedDropIndex, dialect.dropIndexSql(model.table, unqualified(model.table)+"_title"))
+}
+
+type scriptProduct struct {
+	Id      int64
+	Sku     string `qbs:"size:32,unique"`
+	Name    string `qbs:"size:64"`
+	Deleted time.Time
+}
+
+func (*scriptProduct) Indexes(indexes *Indexes) {
+	indexes.AddNamedPartial("live_name", "deleted IS NULL", "name")
+	indexes.AddExpression("lower(name)")
+}
+
+func doTestCreateTableScriptSQL(assert *Assert, dialect Dialect, expected string) {
+	mg := &Migration{dialect: dialect}
+	assert.Equal(expected, mg.WithSchema("shop").CreateTableSQL(new(scriptProduct)))
+}
+
+func doTestPlanStepSQL(assert *Assert, dialect Dialect, expectedExplain string, row map[string]string, expected PlanStep) {
+	assert.Equal(expectedExplain, dialect.explainSql("SELECT `id` FROM `post` WHERE `title` = ?"))
+	assert.Equal(expected, dialect.planStep(row))
+}
+
+func doTestDataCheckSQL(assert *Assert, dialect Dialect, expected ...string) {
+	type checkedItem struct {
+		Id       int64
+		ParentId int64
+		Code     string
+		Price    int64
+	}
+	mg := &Migration{dialect: dialect}
+	checks := []DataCheck{
+		CheckNotNull(new(checkedItem), "Code"),
+		CheckRange(new(checkedItem), "Price", 1, 100),
+		CheckUnique(new(checkedItem), "Code"),
+		CheckReferences(new(checkedItem), "ParentId", new(checkedItem)),
+		CheckWhere(new(checkedItem), "code = ?", ""),
+	}
+	for i, check := range checks {
+		query, _ := check(mg)
+		assert.Equal(expected[i], dialect.substituteMarkers(query))
+	}
+}
+
+func doTestTimeTypeSQL(assert *Assert, dialect Dialect, expected ...string) {
+	type timed struct {
+		Plain   time.Time
+		Precise time.Time `qbs:"precision:3"`
+		Utc     time.Time `qbs:"tz:utc,precision:6"`
+	}
+	model := structPtrToModel(new(timed), false, nil)
+	for i, field := range model.fields {
+		assert.Equal(expected[i], dialect.sqlType(*field))
+	}
+}
+
+func doTestSoftDeleteToSQL(assert *Assert, dialect Dialect, expected string) {
+	q := &Qbs{Dialect: dialect, criteria: new(criteria)}
+	sql, _, err := q.Model(new(softDeletedPtr)).ToSQL()
+	assert.MustNil(err)
+	assert.Equal(expected, sql)
+}
@@ -0,0 +1,35 @@
+package qbs
+
+import (
+	"errors"
+)
+
+// CreateTempTable creates a temporary table of the struct in the transaction, e.g. to stage rows loaded by
+// BulkInsert, validate them and copy them to a permanent table by Exec. The table is visible to the connection
+// of the transaction only, and it's dropped when the transaction commits or rolls back.
+// Indexes and foreign keys are not created. It panics if no transaction has began.
+func (q *Qbs) CreateTempTable(structPtr interface{}) error {
+	if q.tx == nil {
+		panic("temporary tables can only be created in a transaction")
+	}
+	model := structPtrToNamedModel(structPtr, false, nil, q.naming())
+	create, drop := q.Dialect.tempTableSql(model)
+	if create == "" {
+		return errors.New("temporary tables are not supported by the dialect")
+	}
+	if err := q.execTx(create); err != nil {
+		return err
+	}
+	if drop != "" {
+		q.tempTables = append(q.tempTables, drop)
+	}
+	return nil
+}
+
+// dropTempTables drops the temporary tables the database doesn't drop at the end of the transaction.
+func (q *Qbs) dropTempTables() {
+	for _, drop := range q.tempTables {
+		q.execTx(drop)
+	}
+	q.tempTables = nil
+}
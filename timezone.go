@@ -0,0 +1,68 @@
+package qbs
+
+import (
+	"reflect"
+	"time"
+)
+
+// StoreUTC converts the times written to the time columns to UTC, like the `qbs:"tz:utc"` tag on every time field,
+// so the stored values don't depend on the time zone of the application server.
+var StoreUTC bool
+
+// ScanLocation is the location the times scanned from the time columns without a tz tag are converted to,
+// e.g. time.Local to show times stored as UTC in local time. The times are kept as the driver returns them if nil.
+var ScanLocation *time.Location
+
+// tagLocation returns the location of the tz tag, "utc", "local" or a name of the IANA time zone database.
+func tagLocation(name string) *time.Location {
+	switch name {
+	case "utc", "UTC":
+		return time.UTC
+	case "local", "Local":
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic("tz tag: " + err.Error())
+	}
+	return loc
+}
+
+// writeValue returns the value of the field written to the column, a time is converted to the location of the tz tag,
+// or to UTC by StoreUTC.
+func (f *modelField) writeValue() interface{} {
+	t, ok := f.value.(time.Time)
+	if !ok {
+		return f.value
+	}
+	if f.tz != nil {
+		return t.In(f.tz)
+	}
+	if StoreUTC {
+		return t.UTC()
+	}
+	return t
+}
+
+// scanLocation converts the time scanned into the field to the location of its tz tag, or to ScanLocation.
+func scanLocation(field reflect.Value, structField reflect.StructField) {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return
+		}
+		field = field.Elem()
+	}
+	t, ok := field.Interface().(time.Time)
+	if !ok {
+		return
+	}
+	fd := new(modelField)
+	parseCachedTags(fd, structField.Tag.Get(TagKey))
+	loc := ScanLocation
+	if fd.tz != nil {
+		loc = fd.tz
+	}
+	if loc != nil {
+		field.Set(reflect.ValueOf(t.In(loc)))
+	}
+}
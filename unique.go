@@ -0,0 +1,68 @@
+package qbs
+
+import (
+	"database/sql"
+	"reflect"
+	"sync"
+)
+
+// UniqueLookup finds a row of the model T by the value of a unique column.
+type UniqueLookup[T any] struct {
+	column string
+	value  interface{}
+}
+
+var uniqueColumns sync.Map // "type.column" -> true, columns validated by checkUnique
+
+// ByUnique returns a lookup of the row of T whose snakecase column equals the value, e.g.
+// qbs.ByUnique[User]("email", email).Exists(q). It panics if the column is neither the primary key
+// nor covered by a single column unique index, from the unique tag or the Indexed interface.
+func ByUnique[T any](column string, value interface{}) *UniqueLookup[T] {
+	checkUnique(new(T), column)
+	return &UniqueLookup[T]{column, value}
+}
+
+// ValidateUnique panics if a column of T is not unique, call it at startup to fail fast
+// instead of on the first ByUnique lookup.
+func ValidateUnique[T any](columns ...string) {
+	for _, column := range columns {
+		checkUnique(new(T), column)
+	}
+}
+
+func checkUnique(structPtr interface{}, column string) {
+	key := reflect.TypeOf(structPtr).Elem().String() + "." + column
+	if _, ok := uniqueColumns.Load(key); ok {
+		return
+	}
+	model := structPtrToModel(structPtr, true, nil)
+	unique := model.pk != nil && model.pk.name == column
+	for _, index := range model.indexes {
+		if index.unique && len(index.columns) == 1 && index.columns[0] == column {
+			unique = true
+		}
+	}
+	if !unique {
+		panic("column " + column + " of table " + model.table + " has no unique index")
+	}
+	uniqueColumns.Store(key, true)
+}
+
+// Exists reports if the row exists.
+func (l *UniqueLookup[T]) Exists(q *Qbs) (bool, error) {
+	_, err := l.Find(q.OmitJoin())
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Find returns the row, sql.ErrNoRows if it does not exist.
+func (l *UniqueLookup[T]) Find(q *Qbs) (*T, error) {
+	row := new(T)
+	err := q.WhereEqual(q.Dialect.quote(namedTableName(row, q.naming()))+"."+q.Dialect.quote(l.column), l.value).Find(row)
+	if err != nil {
+		return nil, err
+	}
+	return row, nil
+}
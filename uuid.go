@@ -0,0 +1,48 @@
+package qbs
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"time"
+)
+
+// newUUID returns a version 7 UUID, the leading millisecond timestamp keeps the inserts of an index in order.
+func newUUID() string {
+	var u [16]byte
+	if _, err := rand.Read(u[6:]); err != nil {
+		panic(err)
+	}
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(u[:6], ms[2:])
+	u[6] = u[6]&0x0f | 0x70 // version 7
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+	var s [36]byte
+	hex.Encode(s[0:8], u[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], u[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], u[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], u[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], u[10:])
+	return string(s[:])
+}
+
+// generatePk sets an empty string primary key tagged "uuid" to a new UUID in the model and the struct,
+// it reports if the key is generated, so the row is new.
+func (model *model) generatePk(structValue reflect.Value) bool {
+	if model.pk == nil || !model.pk.uuid {
+		return false
+	}
+	if s, ok := model.pk.value.(string); !ok || s != "" {
+		return false
+	}
+	id := newUUID()
+	model.pk.value = id
+	reflect.Indirect(structValue).FieldByName(model.pk.camelName).SetString(id)
+	return true
+}
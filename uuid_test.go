@@ -0,0 +1,35 @@
+package qbs
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestNewUUID(t *testing.T) {
+	assert := NewAssert(t)
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	first := newUUID()
+	assert.True(pattern.MatchString(first))
+	second := newUUID()
+	assert.True(first != second)
+	assert.True(first[:8] <= second[:8])
+}
+
+func TestGeneratePk(t *testing.T) {
+	assert := NewAssert(t)
+	type uuidRow struct {
+		Id   string `qbs:"pk,uuid"`
+		Name string
+	}
+	row := new(uuidRow)
+	model := structPtrToModel(row, true, nil)
+	assert.True(model.pkZero())
+	assert.True(model.generatePk(reflect.ValueOf(row)))
+	assert.Equal(row.Id, model.pk.value)
+	assert.True(!model.pkZero())
+	columns, _ := model.columnsAndValues(false)
+	assert.Equal("[id name]", columns)
+	model = structPtrToModel(row, true, nil)
+	assert.True(!model.generatePk(reflect.ValueOf(row)))
+}
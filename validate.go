@@ -0,0 +1,103 @@
+package qbs
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ValidationErrors is returned by Save if the values of the fields break their notnull, min, max, match or in tags,
+// it maps the struct field names to the messages.
+type ValidationErrors map[string]string
+
+func (e ValidationErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	messages := make([]string, len(names))
+	for i, name := range names {
+		messages[i] = name + " " + e[name]
+	}
+	return strings.Join(messages, ", ")
+}
+
+var matchRegexps = new(sync.Map)
+
+// compileMatch compiles the regexp of a match tag once, it panics if the regexp is invalid like other tag errors.
+func compileMatch(expr string) *regexp.Regexp {
+	if re, ok := matchRegexps.Load(expr); ok {
+		return re.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		panic("match tag syntax error: " + err.Error())
+	}
+	matchRegexps.Store(expr, re)
+	return re
+}
+
+// validate checks the values of the fields against their tags, the omitted fields are not checked.
+func (model *model) validate() error {
+	errs := make(ValidationErrors)
+	for _, f := range model.fields {
+		if f.omitempty && !f.pk && !f.includeZero && f.isEmpty() {
+			continue
+		}
+		if msg := f.validate(); msg != "" {
+			errs[f.camelName] = msg
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validate returns the message of the first broken tag, empty if the value is valid.
+func (f *modelField) validate() string {
+	if f.value == nil {
+		if f.notnull && f.nullable != reflect.Invalid {
+			return "must not be null"
+		}
+		return ""
+	}
+	v := reflect.ValueOf(f.value)
+	var number float64
+	var isNumber bool
+	prefix := ""
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, isNumber = float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number, isNumber = float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		number, isNumber = v.Float(), true
+	case reflect.String:
+		number, isNumber = float64(len([]rune(v.String()))), true
+		prefix = "length "
+	}
+	if isNumber && f.min != nil && number < *f.min {
+		return fmt.Sprintf("%vmust be at least %v", prefix, *f.min)
+	}
+	if isNumber && f.max != nil && number > *f.max {
+		return fmt.Sprintf("%vmust be at most %v", prefix, *f.max)
+	}
+	if f.match != nil && v.Kind() == reflect.String && !f.match.MatchString(v.String()) {
+		return "must match " + f.match.String()
+	}
+	if len(f.in) > 0 {
+		s := fmt.Sprint(f.value)
+		for _, option := range f.in {
+			if s == option {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(f.in, ", ")
+	}
+	return ""
+}
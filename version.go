@@ -0,0 +1,28 @@
+package qbs
+
+import (
+	"errors"
+	"reflect"
+)
+
+// ErrStaleObject is returned by Save, Update and BulkUpdate when the `qbs:"version"` field of the struct
+// doesn't match the row, it has been updated or deleted since the struct was read.
+var ErrStaleObject = errors.New("stale object, the row has been changed since it was read")
+
+// lockVersion adds the current version of the model to the update condition and increments the version
+// to be written, it returns the version field, nil if the model has none.
+func (q *Qbs) lockVersion(model *model) *modelField {
+	version := model.versionField()
+	if version == nil {
+		return nil
+	}
+	current := version.value.(int64)
+	q.criteria.condition = AllOf(q.criteria.condition, NewCondition(q.Dialect.quote(version.name)+" = ?", current))
+	version.value = current + 1
+	return version
+}
+
+// setVersion fills the incremented version in the struct after a successful update.
+func setVersion(structPtr interface{}, version *modelField) {
+	reflect.Indirect(reflect.ValueOf(structPtr)).FieldByName(version.camelName).SetInt(version.value.(int64))
+}